@@ -0,0 +1,204 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	goTypes "go/types"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/borosr/realworld/domain"
+	"github.com/borosr/realworld/lib/api"
+	"github.com/borosr/realworld/lib/broken"
+	"github.com/borosr/realworld/lib/config"
+	"github.com/borosr/realworld/lib/middleware"
+	"github.com/borosr/realworld/persist"
+	"github.com/borosr/realworld/types"
+)
+
+type adminController struct {
+	backupDir    string
+	auditService domain.AuditDescriptor
+	tagService   domain.TagDescriptor
+}
+
+func newAdminController(auditService domain.AuditDescriptor, tagService domain.TagDescriptor) adminController {
+	return adminController{
+		backupDir:    config.String("BACKUP_DIR", "/tmp/realworld-backups"),
+		auditService: auditService,
+		tagService:   tagService,
+	}
+}
+
+func (ac adminController) Init() {
+	api.Register[
+		goTypes.Nil,
+		types.BackupWrapper,
+		api.ControllerSimpleFunc[goTypes.Nil, types.BackupWrapper],
+	]("/api/admin/backup", http.MethodPost, ac.backup).
+		PreProcess(middleware.TokenAuthentication, middleware.AdminAuthorization)
+	api.Register[
+		goTypes.Nil,
+		StorageResponse,
+		api.ControllerSimpleFunc[goTypes.Nil, StorageResponse],
+	]("/api/admin/storage", http.MethodGet, ac.storage).
+		PreProcess(middleware.TokenAuthentication, middleware.AdminAuthorization)
+	api.Register[
+		goTypes.Nil,
+		CacheResponse,
+		api.ControllerSimpleFunc[goTypes.Nil, CacheResponse],
+	]("/api/admin/cache", http.MethodGet, ac.cache).
+		PreProcess(middleware.TokenAuthentication, middleware.AdminAuthorization)
+	api.Register[
+		goTypes.Nil,
+		types.AuditListResponse,
+		api.ControllerFunc[goTypes.Nil, types.AuditListResponse],
+	]("/api/admin/audit", http.MethodGet, ac.audit).
+		PreProcess(middleware.TokenAuthentication, middleware.AdminAuthorization)
+	api.Register[
+		types.TagMergeWrapper[types.TagMergeRequest],
+		types.TagMergeWrapper[types.TagMerge],
+		api.ControllerSimpleFunc[types.TagMergeWrapper[types.TagMergeRequest], types.TagMergeWrapper[types.TagMerge]],
+	]("/api/admin/tags/merge", http.MethodPost, ac.mergeTags).
+		PreProcess(middleware.TokenAuthentication, middleware.AdminAuthorization).
+		Validated()
+	api.Register[
+		goTypes.Nil,
+		types.TagAliasesWrapper,
+		api.ControllerSimpleFunc[goTypes.Nil, types.TagAliasesWrapper],
+	]("/api/admin/tags/aliases", http.MethodGet, ac.tagAliases).
+		PreProcess(middleware.TokenAuthentication, middleware.AdminAuthorization)
+	api.Register[
+		goTypes.Nil,
+		goTypes.Nil,
+		api.ControllerSimpleFunc[goTypes.Nil, goTypes.Nil],
+	]("/api/admin/tags/aliases/{alias}", http.MethodDelete, ac.deleteTagAlias).
+		PreProcess(middleware.TokenAuthentication, middleware.AdminAuthorization)
+}
+
+type StorageResponse struct {
+	Storage persist.StorageStats `json:"storage"`
+}
+
+type CacheResponse struct {
+	Caches []persist.CacheStats `json:"caches"`
+}
+
+func (ac adminController) backup(_ context.Context, _ goTypes.Nil) (types.BackupWrapper, error) {
+	if err := os.MkdirAll(ac.backupDir, 0o755); err != nil {
+		return types.BackupWrapper{}, err
+	}
+	now := time.Now().UTC()
+	path := filepath.Join(ac.backupDir, fmt.Sprintf("backup-%s.bak", now.Format("20060102T150405Z")))
+	f, err := os.Create(path)
+	if err != nil {
+		return types.BackupWrapper{}, err
+	}
+	version, err := persist.Backup(f)
+	if err != nil {
+		f.Close()
+		os.Remove(path)
+		return types.BackupWrapper{}, err
+	}
+	if err := f.Close(); err != nil {
+		return types.BackupWrapper{}, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return types.BackupWrapper{}, err
+	}
+	return types.BackupWrapper{
+		Backup: types.Backup{
+			File:      path,
+			Size:      info.Size(),
+			Version:   version,
+			CreatedAt: now,
+		},
+	}, nil
+}
+
+func (ac adminController) storage(_ context.Context, _ goTypes.Nil) (StorageResponse, error) {
+	stats, err := persist.Stats()
+	if err != nil {
+		return StorageResponse{}, err
+	}
+	return StorageResponse{
+		Storage: stats,
+	}, nil
+}
+
+func (ac adminController) cache(_ context.Context, _ goTypes.Nil) (CacheResponse, error) {
+	return CacheResponse{
+		Caches: persist.Caches(),
+	}, nil
+}
+
+// audit filters the audit log by the actor, type, key, from and to (RFC 3339)
+// query parameters
+func (ac adminController) audit(ctx context.Context, _ goTypes.Nil, m api.Meta) (types.AuditListResponse, error) {
+	q := domain.AuditQuery{
+		Actor: m.Params.Get("actor"),
+		Type:  m.Params.Get("type"),
+		Key:   m.Params.Get("key"),
+	}
+	var err error
+	if q.From, err = parseTime(m.Params.Get("from")); err != nil {
+		return types.AuditListResponse{}, broken.Validation("invalid from parameter")
+	}
+	if q.To, err = parseTime(m.Params.Get("to")); err != nil {
+		return types.AuditListResponse{}, broken.Validation("invalid to parameter")
+	}
+	if m.Params.Has("limit") {
+		if q.Limit, err = strconv.Atoi(m.Params.Get("limit")); err != nil {
+			return types.AuditListResponse{}, broken.Validation("invalid limit parameter")
+		}
+	}
+	entries, err := ac.auditService.Query(ctx, q)
+	if err != nil {
+		return types.AuditListResponse{}, err
+	}
+	return types.AuditListResponse{
+		Entries: entries,
+	}, nil
+}
+
+func (ac adminController) mergeTags(ctx context.Context, req types.TagMergeWrapper[types.TagMergeRequest]) (types.TagMergeWrapper[types.TagMerge], error) {
+	merge, err := ac.tagService.Merge(ctx, req.Merge)
+	if err != nil {
+		return types.TagMergeWrapper[types.TagMerge]{}, err
+	}
+	return types.TagMergeWrapper[types.TagMerge]{
+		Merge: merge,
+	}, nil
+}
+
+func (ac adminController) tagAliases(ctx context.Context, _ goTypes.Nil) (types.TagAliasesWrapper, error) {
+	aliases, err := ac.tagService.Aliases(ctx)
+	if err != nil {
+		return types.TagAliasesWrapper{}, err
+	}
+	return types.TagAliasesWrapper{
+		Aliases: aliases,
+	}, nil
+}
+
+func (ac adminController) deleteTagAlias(ctx context.Context, _ goTypes.Nil) (goTypes.Nil, error) {
+	alias, err := api.PathVariable[string](ctx, "alias")
+	if err != nil {
+		return goTypes.Nil{}, err
+	}
+	if err := ac.tagService.DeleteAlias(ctx, alias); err != nil {
+		return goTypes.Nil{}, err
+	}
+	return goTypes.Nil{}, nil
+}
+
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"context"
+	"errors"
 	goTypes "go/types"
 	"net/http"
 	"strconv"
@@ -14,6 +15,7 @@ import (
 
 type articlesController struct {
 	articleService domain.ArticleDescriptor
+	searchService  domain.SearchDescriptor
 }
 
 func (ac articlesController) Init() {
@@ -21,18 +23,26 @@ func (ac articlesController) Init() {
 		goTypes.Nil,
 		types.ArticleListResponseWrapper,
 		api.ControllerFunc[goTypes.Nil, types.ArticleListResponseWrapper],
-	]("/api/articles", http.MethodGet, ac.getAll)
+	]("/api/articles", http.MethodGet, ac.getAll).
+		PreProcess(middleware.OptionalTokenAuthentication)
 	api.Register[
 		goTypes.Nil,
 		types.ArticleListResponseWrapper,
 		api.ControllerFunc[goTypes.Nil, types.ArticleListResponseWrapper],
 	]("/api/articles/feed", http.MethodGet, ac.feed).
 		PreProcess(middleware.TokenAuthentication)
+	api.Register[
+		goTypes.Nil,
+		types.SearchResponseWrapper,
+		api.ControllerFunc[goTypes.Nil, types.SearchResponseWrapper],
+	]("/api/articles/search", http.MethodGet, ac.search).
+		PreProcess(middleware.OptionalTokenAuthentication)
 	api.Register[
 		goTypes.Nil,
 		types.ArticleWrapper[types.Article],
-		api.ControllerSimpleFunc[goTypes.Nil, types.ArticleWrapper[types.Article]],
-	]("/api/articles/{slug}", http.MethodGet, ac.get)
+		api.ControllerFunc[goTypes.Nil, types.ArticleWrapper[types.Article]],
+	]("/api/articles/{slug}", http.MethodGet, ac.get).
+		PreProcess(middleware.OptionalTokenAuthentication)
 	api.Register[
 		types.ArticleWrapper[types.ArticleRequest],
 		types.ArticleWrapper[types.Article],
@@ -53,6 +63,42 @@ func (ac articlesController) Init() {
 		api.ControllerSimpleFunc[goTypes.Nil, goTypes.Nil],
 	]("/api/articles/{slug}", http.MethodDelete, ac.delete).
 		PreProcess(middleware.TokenAuthentication)
+	api.Register[
+		types.ArticleWrapper[types.ArticleRequest],
+		types.ArticleWrapper[types.Article],
+		api.ControllerSimpleFunc[types.ArticleWrapper[types.ArticleRequest], types.ArticleWrapper[types.Article]],
+	]("/api/articles/{slug}/publish", http.MethodPost, ac.publish).
+		PreProcess(middleware.TokenAuthentication)
+	api.Register[
+		goTypes.Nil,
+		types.ArticleWrapper[types.Article],
+		api.ControllerSimpleFunc[goTypes.Nil, types.ArticleWrapper[types.Article]],
+	]("/api/articles/{slug}/unpublish", http.MethodPost, ac.unpublish).
+		PreProcess(middleware.TokenAuthentication)
+	api.Register[
+		goTypes.Nil,
+		types.RevisionListResponseWrapper,
+		api.ControllerSimpleFunc[goTypes.Nil, types.RevisionListResponseWrapper],
+	]("/api/articles/{slug}/revisions", http.MethodGet, ac.getRevisions).
+		PreProcess(middleware.TokenAuthentication)
+	api.Register[
+		goTypes.Nil,
+		types.RevisionWrapper,
+		api.ControllerSimpleFunc[goTypes.Nil, types.RevisionWrapper],
+	]("/api/articles/{slug}/revisions/{number}", http.MethodGet, ac.getRevision).
+		PreProcess(middleware.TokenAuthentication)
+	api.Register[
+		goTypes.Nil,
+		types.RevisionDiffWrapper,
+		api.ControllerSimpleFunc[goTypes.Nil, types.RevisionDiffWrapper],
+	]("/api/articles/{slug}/revisions/{from}/diff/{to}", http.MethodGet, ac.diffRevisions).
+		PreProcess(middleware.TokenAuthentication)
+	api.Register[
+		goTypes.Nil,
+		types.ArticleWrapper[types.Article],
+		api.ControllerSimpleFunc[goTypes.Nil, types.ArticleWrapper[types.Article]],
+	]("/api/articles/{slug}/revisions/{number}/rollback", http.MethodPost, ac.rollback).
+		PreProcess(middleware.TokenAuthentication)
 	api.Register[
 		types.CommentWrapper[types.CommentRequest],
 		types.CommentWrapper[types.CommonComment],
@@ -63,8 +109,22 @@ func (ac articlesController) Init() {
 	api.Register[
 		goTypes.Nil,
 		types.CommentListResponseWrapper,
-		api.ControllerSimpleFunc[goTypes.Nil, types.CommentListResponseWrapper],
-	]("/api/articles/{slug}/comments", http.MethodGet, ac.getComments)
+		api.ControllerFunc[goTypes.Nil, types.CommentListResponseWrapper],
+	]("/api/articles/{slug}/comments", http.MethodGet, ac.getComments).
+		PreProcess(middleware.OptionalTokenAuthentication)
+	api.Register[
+		types.CommentWrapper[types.CommentRequest],
+		types.CommentWrapper[types.CommonComment],
+		api.ControllerSimpleFunc[types.CommentWrapper[types.CommentRequest], types.CommentWrapper[types.CommonComment]],
+	]("/api/articles/{slug}/comments/{id}", http.MethodPut, ac.updateComment).
+		PreProcess(middleware.TokenAuthentication).
+		Validated()
+	api.Register[
+		goTypes.Nil,
+		types.CommentHistoryResponseWrapper,
+		api.ControllerSimpleFunc[goTypes.Nil, types.CommentHistoryResponseWrapper],
+	]("/api/articles/{slug}/comments/{id}/history", http.MethodGet, ac.getCommentHistory).
+		PreProcess(middleware.TokenAuthentication)
 	api.Register[
 		goTypes.Nil,
 		goTypes.Nil,
@@ -83,6 +143,30 @@ func (ac articlesController) Init() {
 		api.ControllerSimpleFunc[goTypes.Nil, types.ArticleWrapper[types.Article]],
 	]("/api/articles/{slug}/favorite", http.MethodDelete, ac.deleteFavoriteArticle).
 		PreProcess(middleware.TokenAuthentication)
+	api.Register[
+		goTypes.Nil,
+		types.ArticleListResponseWrapper,
+		api.ControllerSimpleFunc[goTypes.Nil, types.ArticleListResponseWrapper],
+	]("/api/user/trash/articles", http.MethodGet, ac.getTrashedArticles).
+		PreProcess(middleware.TokenAuthentication)
+	api.Register[
+		goTypes.Nil,
+		types.ArticleWrapper[types.Article],
+		api.ControllerSimpleFunc[goTypes.Nil, types.ArticleWrapper[types.Article]],
+	]("/api/articles/{slug}/restore", http.MethodPost, ac.restoreArticle).
+		PreProcess(middleware.TokenAuthentication)
+	api.Register[
+		goTypes.Nil,
+		types.TrashedCommentListResponseWrapper,
+		api.ControllerSimpleFunc[goTypes.Nil, types.TrashedCommentListResponseWrapper],
+	]("/api/user/trash/comments", http.MethodGet, ac.getTrashedComments).
+		PreProcess(middleware.TokenAuthentication)
+	api.Register[
+		goTypes.Nil,
+		types.CommentWrapper[types.CommonComment],
+		api.ControllerSimpleFunc[goTypes.Nil, types.CommentWrapper[types.CommonComment]],
+	]("/api/articles/{slug}/comments/{id}/restore", http.MethodPost, ac.restoreComment).
+		PreProcess(middleware.TokenAuthentication)
 }
 
 func (ac articlesController) getAll(ctx context.Context, _ goTypes.Nil, m api.Meta) (types.ArticleListResponseWrapper, error) {
@@ -91,10 +175,12 @@ func (ac articlesController) getAll(ctx context.Context, _ goTypes.Nil, m api.Me
 		m.Params.Get("tag"),
 		m.Params.Get("author"),
 		m.Params.Get("favorited"),
+		m.Params.Get("status"),
 		limit, offset)
 	if err != nil {
 		return types.ArticleListResponseWrapper{}, err
 	}
+	ac.render(m, results...)
 	return types.ArticleListResponseWrapper{
 		Articles:      results,
 		ArticlesCount: totalCount,
@@ -107,19 +193,40 @@ func (ac articlesController) feed(ctx context.Context, _ goTypes.Nil, m api.Meta
 	if err != nil {
 		return types.ArticleListResponseWrapper{}, err
 	}
+	ac.render(m, results...)
 	return types.ArticleListResponseWrapper{
 		Articles:      results,
 		ArticlesCount: totalCount,
 	}, nil
 }
 
-func (ac articlesController) get(ctx context.Context, _ goTypes.Nil) (types.ArticleWrapper[types.Article], error) {
+func (ac articlesController) search(ctx context.Context, _ goTypes.Nil, m api.Meta) (types.SearchResponseWrapper, error) {
+	limit, offset := ac.getLimitOffset(m)
+	results, totalCount, err := ac.searchService.Search(ctx, m.Params.Get("q"), limit, offset)
+	if err != nil {
+		return types.SearchResponseWrapper{}, err
+	}
+	for _, r := range results {
+		ac.render(m, r.Article)
+	}
+	return types.SearchResponseWrapper{
+		Articles:      results,
+		ArticlesCount: totalCount,
+	}, nil
+}
+
+func (ac articlesController) get(ctx context.Context, _ goTypes.Nil, m api.Meta) (types.ArticleWrapper[types.Article], error) {
 	var fallbackResult types.ArticleWrapper[types.Article]
 	id, err := api.PathVariable[string](ctx, "slug")
 	article, err := ac.articleService.Get(ctx, id)
+	var moved *domain.ArticleMovedError
+	if errors.As(err, &moved) {
+		return fallbackResult, api.Redirect("/api/articles/" + moved.Slug)
+	}
 	if err != nil {
 		return fallbackResult, err
 	}
+	ac.render(m, &article)
 	fallbackResult.Article = article
 	return fallbackResult, nil
 }
@@ -163,6 +270,107 @@ func (ac articlesController) delete(ctx context.Context, _ goTypes.Nil) (goTypes
 	return goTypes.Nil{}, nil
 }
 
+// publish takes the optional publishAt of the article to schedule it
+func (ac articlesController) publish(ctx context.Context, req types.ArticleWrapper[types.ArticleRequest]) (types.ArticleWrapper[types.Article], error) {
+	var fallbackResult types.ArticleWrapper[types.Article]
+	slug, err := api.PathVariable[string](ctx, "slug")
+	if err != nil {
+		return fallbackResult, err
+	}
+	article, err := ac.articleService.Publish(ctx, slug, req.Article.PublishAt)
+	if err != nil {
+		return fallbackResult, err
+	}
+	fallbackResult.Article = article
+	return fallbackResult, nil
+}
+
+func (ac articlesController) unpublish(ctx context.Context, _ goTypes.Nil) (types.ArticleWrapper[types.Article], error) {
+	var fallbackResult types.ArticleWrapper[types.Article]
+	slug, err := api.PathVariable[string](ctx, "slug")
+	if err != nil {
+		return fallbackResult, err
+	}
+	article, err := ac.articleService.Unpublish(ctx, slug)
+	if err != nil {
+		return fallbackResult, err
+	}
+	fallbackResult.Article = article
+	return fallbackResult, nil
+}
+
+func (ac articlesController) getRevisions(ctx context.Context, _ goTypes.Nil) (types.RevisionListResponseWrapper, error) {
+	slug, err := api.PathVariable[string](ctx, "slug")
+	if err != nil {
+		return types.RevisionListResponseWrapper{}, err
+	}
+	revisions, err := ac.articleService.GetRevisions(ctx, slug)
+	if err != nil {
+		return types.RevisionListResponseWrapper{}, err
+	}
+	return types.RevisionListResponseWrapper{
+		Revisions: revisions,
+	}, nil
+}
+
+func (ac articlesController) getRevision(ctx context.Context, _ goTypes.Nil) (types.RevisionWrapper, error) {
+	var fallbackResult types.RevisionWrapper
+	slug, err := api.PathVariable[string](ctx, "slug")
+	if err != nil {
+		return fallbackResult, err
+	}
+	number, err := api.PathVariable[int](ctx, "number")
+	if err != nil {
+		return fallbackResult, err
+	}
+	revision, err := ac.articleService.GetRevision(ctx, slug, number)
+	if err != nil {
+		return fallbackResult, err
+	}
+	fallbackResult.Revision = revision
+	return fallbackResult, nil
+}
+
+func (ac articlesController) diffRevisions(ctx context.Context, _ goTypes.Nil) (types.RevisionDiffWrapper, error) {
+	var fallbackResult types.RevisionDiffWrapper
+	slug, err := api.PathVariable[string](ctx, "slug")
+	if err != nil {
+		return fallbackResult, err
+	}
+	from, err := api.PathVariable[int](ctx, "from")
+	if err != nil {
+		return fallbackResult, err
+	}
+	to, err := api.PathVariable[int](ctx, "to")
+	if err != nil {
+		return fallbackResult, err
+	}
+	d, err := ac.articleService.DiffRevisions(ctx, slug, from, to)
+	if err != nil {
+		return fallbackResult, err
+	}
+	fallbackResult.Diff = d
+	return fallbackResult, nil
+}
+
+func (ac articlesController) rollback(ctx context.Context, _ goTypes.Nil) (types.ArticleWrapper[types.Article], error) {
+	var fallbackResult types.ArticleWrapper[types.Article]
+	slug, err := api.PathVariable[string](ctx, "slug")
+	if err != nil {
+		return fallbackResult, err
+	}
+	number, err := api.PathVariable[int](ctx, "number")
+	if err != nil {
+		return fallbackResult, err
+	}
+	article, err := ac.articleService.Rollback(ctx, slug, number)
+	if err != nil {
+		return fallbackResult, err
+	}
+	fallbackResult.Article = article
+	return fallbackResult, nil
+}
+
 func (ac articlesController) createComment(ctx context.Context, req types.CommentWrapper[types.CommentRequest]) (types.CommentWrapper[types.CommonComment], error) {
 	var fallbackResult types.CommentWrapper[types.CommonComment]
 	slug, err := api.PathVariable[string](ctx, "slug")
@@ -177,17 +385,60 @@ func (ac articlesController) createComment(ctx context.Context, req types.Commen
 	return fallbackResult, nil
 }
 
-func (ac articlesController) getComments(ctx context.Context, _ goTypes.Nil) (types.CommentListResponseWrapper, error) {
+// getComments lists every comment unless a limit is given, the pages after
+// the first one are requested with the cursor of the previous one
+func (ac articlesController) getComments(ctx context.Context, _ goTypes.Nil, m api.Meta) (types.CommentListResponseWrapper, error) {
 	slug, err := api.PathVariable[string](ctx, "slug")
 	if err != nil {
 		return types.CommentListResponseWrapper{}, err
 	}
-	comments, err := ac.articleService.GetComments(ctx, slug)
+	limit, err := strconv.Atoi(m.Params.Get("limit"))
+	if err != nil {
+		limit = 0
+	}
+	comments, next, err := ac.articleService.GetComments(ctx, slug, limit, m.Params.Get("after"))
 	if err != nil {
 		return types.CommentListResponseWrapper{}, err
 	}
 	return types.CommentListResponseWrapper{
-		Comments: comments,
+		Comments:   comments,
+		NextCursor: next,
+	}, nil
+}
+
+func (ac articlesController) updateComment(ctx context.Context, req types.CommentWrapper[types.CommentRequest]) (types.CommentWrapper[types.CommonComment], error) {
+	var fallbackResult types.CommentWrapper[types.CommonComment]
+	slug, err := api.PathVariable[string](ctx, "slug")
+	if err != nil {
+		return fallbackResult, err
+	}
+	id, err := api.PathVariable[int](ctx, "id")
+	if err != nil {
+		return fallbackResult, err
+	}
+	comment, err := ac.articleService.UpdateComment(ctx, slug, id, req.Comment)
+	if err != nil {
+		return fallbackResult, err
+	}
+	fallbackResult.Comment = comment
+	return fallbackResult, nil
+}
+
+func (ac articlesController) getCommentHistory(ctx context.Context, _ goTypes.Nil) (types.CommentHistoryResponseWrapper, error) {
+	slug, err := api.PathVariable[string](ctx, "slug")
+	if err != nil {
+		return types.CommentHistoryResponseWrapper{}, err
+	}
+	id, err := api.PathVariable[int](ctx, "id")
+	if err != nil {
+		return types.CommentHistoryResponseWrapper{}, err
+	}
+	history, err := ac.articleService.GetCommentHistory(ctx, slug, id)
+	if err != nil {
+		return types.CommentHistoryResponseWrapper{}, err
+	}
+	return types.CommentHistoryResponseWrapper{
+		History: history,
 	}, nil
 }
 
@@ -239,6 +490,82 @@ func (ac articlesController) deleteFavoriteArticle(ctx context.Context, _ goType
 	return fallbackResult, nil
 }
 
+func (ac articlesController) getTrashedArticles(ctx context.Context, _ goTypes.Nil) (types.ArticleListResponseWrapper, error) {
+	email, err := api.GetValue[string](ctx, "email")
+	if err != nil {
+		return types.ArticleListResponseWrapper{}, err
+	}
+	articles, err := ac.articleService.GetTrashedArticles(ctx, email)
+	if err != nil {
+		return types.ArticleListResponseWrapper{}, err
+	}
+	return types.ArticleListResponseWrapper{
+		Articles:      articles,
+		ArticlesCount: len(articles),
+	}, nil
+}
+
+func (ac articlesController) restoreArticle(ctx context.Context, _ goTypes.Nil) (types.ArticleWrapper[types.Article], error) {
+	var fallbackResult types.ArticleWrapper[types.Article]
+	slug, err := api.PathVariable[string](ctx, "slug")
+	if err != nil {
+		return fallbackResult, err
+	}
+	email, err := api.GetValue[string](ctx, "email")
+	if err != nil {
+		return fallbackResult, err
+	}
+	article, err := ac.articleService.RestoreArticle(ctx, slug, email)
+	if err != nil {
+		return fallbackResult, err
+	}
+	fallbackResult.Article = article
+	return fallbackResult, nil
+}
+
+func (ac articlesController) getTrashedComments(ctx context.Context, _ goTypes.Nil) (types.TrashedCommentListResponseWrapper, error) {
+	email, err := api.GetValue[string](ctx, "email")
+	if err != nil {
+		return types.TrashedCommentListResponseWrapper{}, err
+	}
+	comments, err := ac.articleService.GetTrashedComments(ctx, email)
+	if err != nil {
+		return types.TrashedCommentListResponseWrapper{}, err
+	}
+	return types.TrashedCommentListResponseWrapper{
+		Comments: comments,
+	}, nil
+}
+
+func (ac articlesController) restoreComment(ctx context.Context, _ goTypes.Nil) (types.CommentWrapper[types.CommonComment], error) {
+	var fallbackResult types.CommentWrapper[types.CommonComment]
+	slug, err := api.PathVariable[string](ctx, "slug")
+	if err != nil {
+		return fallbackResult, err
+	}
+	id, err := api.PathVariable[int](ctx, "id")
+	if err != nil {
+		return fallbackResult, err
+	}
+	email, err := api.GetValue[string](ctx, "email")
+	if err != nil {
+		return fallbackResult, err
+	}
+	comment, err := ac.articleService.RestoreComment(ctx, slug, id, email)
+	if err != nil {
+		return fallbackResult, err
+	}
+	fallbackResult.Comment = comment
+	return fallbackResult, nil
+}
+
+// render sets the HTML of the bodies when the request includes bodyHtml
+func (ac articlesController) render(m api.Meta, articles ...*types.Article) {
+	if m.Params.Get("include") == "bodyHtml" {
+		ac.articleService.Render(articles...)
+	}
+}
+
 func (ac articlesController) getLimitOffset(m api.Meta) (int, int) {
 	limit := 20
 	if m.Params.Has("limit") {
@@ -251,7 +578,7 @@ func (ac articlesController) getLimitOffset(m api.Meta) (int, int) {
 	offset := 0
 	if m.Params.Has("offset") {
 		var err error
-		limit, err = strconv.Atoi(m.Params.Get("offset"))
+		offset, err = strconv.Atoi(m.Params.Get("offset"))
 		if err != nil {
 			offset = 0
 		}
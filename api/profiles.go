@@ -21,7 +21,8 @@ func (pc profilesController) Init() {
 		goTypes.Nil,
 		types.ProfileWrapper,
 		api.ControllerSimpleFunc[goTypes.Nil, types.ProfileWrapper],
-	]("/api/profiles/{username}", http.MethodGet, pc.get)
+	]("/api/profiles/{username}", http.MethodGet, pc.get).
+		PreProcess(middleware.OptionalTokenAuthentication)
 	api.Register[
 		goTypes.Nil,
 		types.ProfileWrapper,
@@ -1,56 +1,272 @@
 package api
 
 import (
+	"context"
 	"log"
+	"net/http"
+	"time"
 
 	"github.com/borosr/realworld/domain"
 	"github.com/borosr/realworld/lib/api"
+	"github.com/borosr/realworld/lib/config"
+	"github.com/borosr/realworld/lib/middleware"
+	"github.com/borosr/realworld/lib/tenant"
 	"github.com/borosr/realworld/persist"
 	"github.com/borosr/realworld/types"
 )
 
+type Repositories struct {
+	User     persist.Repository[*types.User]
+	Article  persist.Repository[*types.Article]
+	Follow   persist.Repository[*types.Follow]
+	Comment  persist.Repository[*types.Comment]
+	Favorite persist.Repository[*types.Favorite]
+	Slug     persist.Repository[*types.SlugAlias]
+	Feed     persist.Repository[*types.Feed]
+	Follows  persist.Repository[*types.FollowIndex]
+	Timeline persist.Repository[*types.Timeline]
+	Audit    persist.Ranged[*types.AuditEntry]
+	Revision persist.Repository[*types.Revision]
+	Tag      persist.Repository[*types.TagIndex]
+	TagStats persist.Repository[*types.TagStats]
+	TagAlias persist.Repository[*types.TagAlias]
+	Schedule persist.Repository[*types.Schedule]
+}
+
 func Service() {
 	log.Println("Listening on 18000...")
 
-	initControllers()
+	ctx := context.Background()
+	api.Use(middleware.RequestID, middleware.Tenant, requestCache)
+	services := initControllers(InitRepositories())
+	persist.StartMaintenance(ctx)
+	startTrashPurger(ctx, services.article)
+	startPublisher(ctx, services.article)
 
 	if err := api.ListenAndServe(":18000"); err != nil {
 		log.Fatal(err)
 	}
 }
 
-func initControllers() {
-	userRepository := persist.Get[*types.User]()
-	articleRepository := persist.Get[*types.Article]()
-	followRepository := persist.Get[*types.Follow]()
-	commentRepository := persist.Get[*types.Comment]()
-	favoriteRepository := persist.Get[*types.Favorite]()
+// InitRepositories opens the repositories of every stored type
+func InitRepositories() Repositories {
+	return Repositories{
+		User:     persist.Get[*types.User](),
+		Article:  persist.Get[*types.Article](),
+		Follow:   persist.Get[*types.Follow](),
+		Comment:  persist.Get[*types.Comment](),
+		Favorite: persist.Get[*types.Favorite](),
+		Slug:     persist.Get[*types.SlugAlias](),
+		Feed:     persist.GetLog[*types.Feed](),
+		Follows:  persist.GetLog[*types.FollowIndex](),
+		Timeline: persist.GetLog[*types.Timeline](),
+		Audit:    persist.GetRangedLog[*types.AuditEntry](),
+		Revision: persist.GetLog[*types.Revision](),
+		Tag:      persist.GetLog[*types.TagIndex](),
+		TagStats: persist.GetLog[*types.TagStats](),
+		TagAlias: persist.Get[*types.TagAlias](),
+		Schedule: persist.GetLog[*types.Schedule](),
+	}
+}
+
+// NewFeedService maintains the feeds of the users
+func NewFeedService(repositories Repositories) domain.FeedService {
+	return domain.FeedService{
+		FeedRepository:        repositories.Feed,
+		FollowRepository:      repositories.Follow,
+		FollowIndexRepository: repositories.Follows,
+		TimelineRepository:    repositories.Timeline,
+		ArticleRepository:     repositories.Article,
+		Transaction:           persist.Transaction,
+		Size:                  config.Int("FEED_SIZE", domain.DefaultFeedSize),
+	}
+}
 
+// NewAuthorSync keeps the author profiles of the articles and comments in
+// sync with the users
+func NewAuthorSync(repositories Repositories) domain.AuthorSync {
+	return domain.AuthorSync{
+		UserRepository:     repositories.User,
+		ArticleRepository:  repositories.Article,
+		CommentRepository:  repositories.Comment,
+		FollowRepository:   repositories.Follow,
+		FavoriteRepository: repositories.Favorite,
+		ArticleTrash:       persist.GetTrash[*types.Article](),
+		CommentTrash:       persist.GetTrash[*types.Comment](),
+		FavoriteTrash:      persist.GetTrash[*types.Favorite](),
+		FeedService:        NewFeedService(repositories),
+		Transaction:        persist.Transaction,
+	}
+}
+
+type services struct {
+	user    domain.UserService
+	profile domain.ProfileService
+	article domain.ArticleService
+}
+
+func initControllers(repositories Repositories) services {
 	userService := domain.UserService{
-		UserRepository: userRepository,
+		UserRepository: repositories.User,
 	}
 	profileService := domain.ProfileService{
-		UserRepository:   userRepository,
-		FollowRepository: followRepository,
+		UserRepository:   repositories.User,
+		FollowRepository: repositories.Follow,
 	}
+	feedService := NewFeedService(repositories)
+	domain.Feeds(feedService)
+	domain.SyncAuthors(NewAuthorSync(repositories))
 	articleService := domain.ArticleService{
-		ArticleRepository:  articleRepository,
-		CommentRepository:  commentRepository,
-		FavoriteRepository: favoriteRepository,
+		ArticleRepository:  repositories.Article,
+		CommentRepository:  repositories.Comment,
+		FavoriteRepository: repositories.Favorite,
+		FollowRepository:   repositories.Follow,
+		SlugRepository:     repositories.Slug,
+		RevisionRepository: repositories.Revision,
+		TagAliasRepository: repositories.TagAlias,
+		ScheduleRepository: repositories.Schedule,
+		FeedService:        feedService,
+		ArticleTrash:       persist.GetTrash[*types.Article](),
+		CommentTrash:       persist.GetTrash[*types.Comment](),
+		FavoriteTrash:      persist.GetTrash[*types.Favorite](),
+		Transaction:        persist.Transaction,
+		TrashRetention:     config.Duration("TRASH_RETENTION", 30*24*time.Hour),
 		UserService:        userService,
+		Renderings:         &domain.Renderings{Size: config.Int("RENDER_CACHE_SIZE", domain.DefaultRenderCacheSize)},
+		CommentMaxDepth:    config.Int("COMMENT_MAX_DEPTH", domain.DefaultCommentMaxDepth),
+	}
+	domain.Scheduling(articleService)
+	auditService := domain.AuditService{
+		AuditRepository: repositories.Audit,
 	}
+	domain.Audit[*types.User](auditService)
+	domain.Audit[*types.Article](auditService)
+	domain.Audit[*types.Comment](auditService)
+	domain.Audit[*types.Follow](auditService)
+	domain.Audit[*types.Favorite](auditService)
 
+	accountService := domain.AccountService{
+		UserRepository:   repositories.User,
+		FollowRepository: repositories.Follow,
+		FeedService:      feedService,
+		ArticleService:   articleService,
+		DeletionPolicy:   config.String("ACCOUNT_DELETION_POLICY", domain.DeletionPolicyAnonymize),
+	}
 	userController{
-		userService: userService,
+		userService:    userService,
+		accountService: accountService,
 	}.Init()
 	profilesController{
 		profileService: profileService,
 		userService:    userService,
 	}.Init()
+	searchService := domain.SearchService{
+		ArticleRepository: repositories.Article,
+		ArticleService:    articleService,
+		Indexes:           &domain.SearchIndexes{},
+	}
+	domain.Indexing(searchService)
 	articlesController{
 		articleService: articleService,
+		searchService:  searchService,
 	}.Init()
+	tagService := domain.TagService{
+		TagRepository:     repositories.Tag,
+		StatsRepository:   repositories.TagStats,
+		AliasRepository:   repositories.TagAlias,
+		ArticleRepository: repositories.Article,
+		Transaction:       persist.Transaction,
+		TrendingDays:      config.Int("TAG_TRENDING_DAYS", domain.DefaultTrendingDays),
+	}
+	domain.CountTags(tagService)
 	tagsController{
-		articleRepository: articleRepository,
+		tagService: tagService,
 	}.Init()
+	newAdminController(auditService, tagService).Init()
+
+	return services{
+		user:    userService,
+		profile: profileService,
+		article: articleService,
+	}
+}
+
+// requestCache memoizes the records loaded while serving a request
+func requestCache(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(persist.WithRequestCache(r.Context())))
+	})
+}
+
+// startTrashPurger removes the expired soft deleted articles and comments
+// periodically
+func startTrashPurger(ctx context.Context, articleService domain.ArticleService) {
+	interval := config.Duration("TRASH_PURGE_INTERVAL", time.Hour)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				for _, id := range tenant.All() {
+					purged, err := articleService.PurgeTrash(tenant.WithID(ctx, id))
+					if err != nil {
+						log.Printf("trash purge of tenant %q: %v", id, err)
+					}
+					if purged > 0 {
+						log.Printf("purged %d deleted records of tenant %q", purged, id)
+					}
+				}
+			}
+		}
+	}()
+}
+
+// startPublisher publishes the scheduled articles when they are due. The
+// schedules are stored with the articles, so the articles which were due
+// while the service was down are published on start.
+func startPublisher(ctx context.Context, articleService domain.ArticleService) {
+	interval := config.Duration("PUBLISH_INTERVAL", time.Minute)
+	scheduled := make(chan struct{}, 1)
+	persist.Subscribe[*types.Article](func(_ context.Context, e persist.Event[*types.Article]) {
+		if e.After != nil && e.After.Status == types.ArticleScheduled {
+			select {
+			case scheduled <- struct{}{}:
+			default:
+			}
+		}
+	})
+	go func() {
+		timer := time.NewTimer(0)
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-scheduled:
+				if !timer.Stop() {
+					<-timer.C
+				}
+			case <-timer.C:
+			}
+			// the next check is at the earliest schedule, or after the
+			// interval at the latest
+			next := time.Now().Add(interval)
+			for _, id := range tenant.All() {
+				published, due, err := articleService.PublishScheduled(tenant.WithID(ctx, id))
+				if err != nil {
+					log.Printf("scheduled publishing of tenant %q: %v", id, err)
+				}
+				if published > 0 {
+					log.Printf("published %d scheduled articles of tenant %q", published, id)
+				}
+				if !due.IsZero() && due.Before(next) {
+					next = due
+				}
+			}
+			timer.Reset(time.Until(next))
+		}
+	}()
 }
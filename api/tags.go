@@ -4,42 +4,52 @@ import (
 	"context"
 	goTypes "go/types"
 	"net/http"
-	"sort"
+	"strconv"
 
+	"github.com/borosr/realworld/domain"
 	"github.com/borosr/realworld/lib/api"
-	"github.com/borosr/realworld/persist"
+	"github.com/borosr/realworld/lib/broken"
 	"github.com/borosr/realworld/types"
 )
 
 type tagsController struct {
-	articleRepository persist.Repository[*types.Article]
+	tagService domain.TagDescriptor
 }
 
 func (tc tagsController) Init() {
 	api.Register[
 		goTypes.Nil,
 		types.TagsWrapper,
-		api.ControllerSimpleFunc[goTypes.Nil, types.TagsWrapper],
+		api.ControllerFunc[goTypes.Nil, types.TagsWrapper],
 	]("/api/tags", http.MethodGet, tc.getAll)
 }
 
-func (tc tagsController) getAll(ctx context.Context, _ goTypes.Nil) (types.TagsWrapper, error) {
-	articles, err := tc.articleRepository.GetFiltered(ctx)
-	if err != nil {
-		return types.TagsWrapper{}, err
+// getAll lists the tags in the order of the sort parameter, alphabetical,
+// popular or trending, the trending ones counted within the days parameter,
+// at most limit of them
+func (tc tagsController) getAll(ctx context.Context, _ goTypes.Nil, m api.Meta) (types.TagsWrapper, error) {
+	var days, limit int
+	var err error
+	if m.Params.Has("days") {
+		if days, err = strconv.Atoi(m.Params.Get("days")); err != nil {
+			return types.TagsWrapper{}, broken.Validation("invalid days parameter")
+		}
 	}
-	var tagSet = make(map[string]struct{})
-	for i := range articles {
-		for _, tag := range articles[i].TagList {
-			tagSet[tag] = struct{}{}
+	if m.Params.Has("limit") {
+		if limit, err = strconv.Atoi(m.Params.Get("limit")); err != nil {
+			return types.TagsWrapper{}, broken.Validation("invalid limit parameter")
 		}
 	}
-	var tagList = make([]string, 0, len(tagSet))
-	for tag := range tagSet {
-		tagList = append(tagList, tag)
+	counts, err := tc.tagService.Tags(ctx, m.Params.Get("sort"), days, limit)
+	if err != nil {
+		return types.TagsWrapper{}, err
+	}
+	var tagList = make([]string, 0, len(counts))
+	for _, c := range counts {
+		tagList = append(tagList, c.Tag)
 	}
-	sort.Strings(tagList)
 	return types.TagsWrapper{
-		Tags: tagList,
+		Tags:      tagList,
+		TagCounts: counts,
 	}, nil
 }
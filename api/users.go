@@ -12,7 +12,8 @@ import (
 )
 
 type userController struct {
-	userService domain.UserDescriptor
+	userService    domain.UserDescriptor
+	accountService domain.AccountDescriptor
 }
 
 func (uc userController) Init() {
@@ -41,6 +42,12 @@ func (uc userController) Init() {
 		api.ControllerSimpleFunc[types.UserWrapper[types.User], types.UserWrapper[types.User]],
 	]("/api/user", http.MethodPut, uc.updateUser).
 		PreProcess(middleware.TokenAuthentication)
+	api.Register[
+		goTypes.Nil,
+		goTypes.Nil,
+		api.ControllerSimpleFunc[goTypes.Nil, goTypes.Nil],
+	]("/api/user", http.MethodDelete, uc.deleteUser).
+		PreProcess(middleware.TokenAuthentication)
 }
 
 func (uc userController) login(ctx context.Context, u types.UserWrapper[types.UserLogin]) (types.UserWrapper[types.User], error) {
@@ -86,3 +93,14 @@ func (uc userController) updateUser(ctx context.Context, u types.UserWrapper[typ
 	fallback.User = user
 	return fallback, nil
 }
+
+func (uc userController) deleteUser(ctx context.Context, _ goTypes.Nil) (goTypes.Nil, error) {
+	email, err := api.GetValue[string](ctx, "email")
+	if err != nil {
+		return goTypes.Nil{}, err
+	}
+	if err := uc.accountService.Delete(ctx, email); err != nil {
+		return goTypes.Nil{}, err
+	}
+	return goTypes.Nil{}, nil
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/borosr/realworld/api"
+	"github.com/borosr/realworld/lib/tenant"
+)
+
+func checkAuthors(args []string) error {
+	fs := newFlagSet("check-authors")
+	fix := fs.Bool("fix", false, "rewrite the drifted profiles with the profiles of their users")
+	tenantID := fs.String("tenant", "", "check only this tenant, all the tenants are checked by default")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	tenants := tenant.All()
+	if *tenantID != "" {
+		if err := tenant.Validate(*tenantID); err != nil {
+			return err
+		}
+		tenants = []string{*tenantID}
+	}
+
+	authorSync := api.NewAuthorSync(api.InitRepositories())
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TENANT\tTYPE\tKEY\tAUTHOR\tPROBLEM\tFIXED")
+	var count int
+	for _, id := range tenants {
+		drifts, err := authorSync.Check(tenant.WithID(context.Background(), id), *fix)
+		if err != nil {
+			return fmt.Errorf("tenant %q: %w", id, err)
+		}
+		count += len(drifts)
+		for _, d := range drifts {
+			problem, fixed := "stale profile", *fix
+			if d.User.Username == "" {
+				problem, fixed = "unknown user", false
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%t\n", tenantName(id), d.Type, d.Key, d.Embedded.Username, problem, fixed)
+		}
+	}
+	if count == 0 {
+		fmt.Println("no drift found")
+		return nil
+	}
+	return w.Flush()
+}
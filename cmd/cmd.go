@@ -0,0 +1,87 @@
+// Package cmd contains the maintenance commands of the application, the
+// server is started when no command is given.
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/borosr/realworld/api"
+)
+
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"serve": {
+		usage: "start the HTTP server",
+		run: func(_ []string) error {
+			api.Service()
+			return nil
+		},
+	},
+	"backup": {
+		usage: "write an online backup of the Badger database",
+		run:   backup,
+	},
+	"restore": {
+		usage: "restore a backup into an empty directory",
+		run:   restore,
+	},
+	"export": {
+		usage: "export every record as newline-delimited JSON",
+		run:   export,
+	},
+	"import": {
+		usage: "import the records of an export",
+		run:   load,
+	},
+	"encrypt": {
+		usage: "rewrite an unencrypted Badger database into an encrypted one",
+		run:   encrypt,
+	},
+	"rotate-key": {
+		usage: "replace the encryption key of a stopped Badger database",
+		run:   rotateKey,
+	},
+	"migrate": {
+		usage: "upgrade the stored records to the current schema versions",
+		run:   migrate,
+	},
+	"check-authors": {
+		usage: "report the author profiles differing from their users",
+		run:   checkAuthors,
+	},
+}
+
+func Run(args []string) error {
+	if len(args) == 0 {
+		args = []string{"serve"}
+	}
+	c, ok := commands[args[0]]
+	if !ok {
+		usage()
+		return fmt.Errorf("unknown command: %s", args[0])
+	}
+	return c.run(args[1:])
+}
+
+func usage() {
+	var names = make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags]\n\nCommands:\n", os.Args[0])
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-13s %s\n", name, commands[name].usage)
+	}
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	return flag.NewFlagSet(name, flag.ExitOnError)
+}
@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/borosr/realworld/api"
+	"github.com/borosr/realworld/domain"
+	"github.com/borosr/realworld/lib/tenant"
+	"github.com/borosr/realworld/persist"
+)
+
+func backup(args []string) error {
+	fs := newFlagSet("backup")
+	out := fs.String("out", "", "backup file to create")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *out == "" {
+		return fmt.Errorf("missing -out flag")
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	version, err := persist.Backup(w)
+	if err != nil {
+		f.Close()
+		os.Remove(*out)
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("backup written to %s (version %d)\n", *out, version)
+	return nil
+}
+
+func restore(args []string) error {
+	fs := newFlagSet("restore")
+	in := fs.String("in", "", "backup file to load")
+	dir := fs.String("dir", "", "empty directory of the restored database")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *in == "" || *dir == "" {
+		return fmt.Errorf("missing -in or -dir flag")
+	}
+	f, err := os.Open(*in)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := persist.Restore(*dir, bufio.NewReader(f)); err != nil {
+		return err
+	}
+	fmt.Printf("backup restored into %s\n", *dir)
+	return nil
+}
+
+func export(args []string) error {
+	fs := newFlagSet("export")
+	dir := fs.String("dir", "", "directory of the exported files")
+	tenantID := fs.String("tenant", "", "tenant to export, the default tenant when empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *dir == "" {
+		return fmt.Errorf("missing -dir flag")
+	}
+	ctx, err := tenantContext(*tenantID)
+	if err != nil {
+		return err
+	}
+	api.InitRepositories()
+	counts, err := persist.Export(ctx, *dir)
+	printCounts("exported", counts)
+	return err
+}
+
+func load(args []string) error {
+	fs := newFlagSet("import")
+	dir := fs.String("dir", "", "directory of an export")
+	tenantID := fs.String("tenant", "", "tenant to import into, the default tenant when empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *dir == "" {
+		return fmt.Errorf("missing -dir flag")
+	}
+	ctx, err := tenantContext(*tenantID)
+	if err != nil {
+		return err
+	}
+	repositories := api.InitRepositories()
+	counts, err := persist.Import(ctx, *dir)
+	printCounts("imported", counts)
+	// the imported records are audited by their counts, even when the import
+	// stopped halfway
+	auditService := domain.AuditService{AuditRepository: repositories.Audit}
+	if auditErr := auditService.RecordImport(ctx, counts); auditErr != nil && err == nil {
+		err = auditErr
+	}
+	return err
+}
+
+func printCounts(action string, counts map[string]uint64) {
+	var names = make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("%s %d %s records\n", action, counts[name], name)
+	}
+}
+
+func tenantContext(id string) (context.Context, error) {
+	ctx := context.Background()
+	if id == "" {
+		return ctx, nil
+	}
+	if err := tenant.Validate(id); err != nil {
+		return ctx, err
+	}
+	return tenant.WithID(ctx, id), nil
+}
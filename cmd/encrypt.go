@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/borosr/realworld/persist"
+	"github.com/borosr/realworld/persist/badger"
+)
+
+func encrypt(args []string) error {
+	fs := newFlagSet("encrypt")
+	src := fs.String("src", badger.Dir(), "directory of the unencrypted database")
+	dst := fs.String("dst", "", "empty directory of the encrypted database")
+	keyFile := fs.String("key-file", "", "file of the 16, 24 or 32 bytes long encryption key")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *dst == "" || *keyFile == "" {
+		return fmt.Errorf("missing -dst or -key-file flag")
+	}
+	key, err := badger.ReadKey(*keyFile)
+	if err != nil {
+		return err
+	}
+	if err := persist.Encrypt(*src, *dst, key); err != nil {
+		return err
+	}
+	fmt.Printf("encrypted database written to %s, point BADGER_DIR to it and set BADGER_ENCRYPTION_KEY_FILE=%s\n", *dst, *keyFile)
+	return nil
+}
+
+func rotateKey(args []string) error {
+	fs := newFlagSet("rotate-key")
+	dir := fs.String("dir", badger.Dir(), "directory of the encrypted database, the server must be stopped")
+	oldKeyFile := fs.String("old-key-file", "", "file of the current encryption key")
+	newKeyFile := fs.String("new-key-file", "", "file of the new encryption key")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *oldKeyFile == "" || *newKeyFile == "" {
+		return fmt.Errorf("missing -old-key-file or -new-key-file flag")
+	}
+	oldKey, err := badger.ReadKey(*oldKeyFile)
+	if err != nil {
+		return err
+	}
+	newKey, err := badger.ReadKey(*newKeyFile)
+	if err != nil {
+		return err
+	}
+	if err := persist.RotateKey(*dir, oldKey, newKey); err != nil {
+		return err
+	}
+	fmt.Printf("encryption key of %s rotated, set BADGER_ENCRYPTION_KEY_FILE=%s\n", *dir, *newKeyFile)
+	return nil
+}
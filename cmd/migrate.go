@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/borosr/realworld/api"
+	"github.com/borosr/realworld/lib/tenant"
+	"github.com/borosr/realworld/persist"
+)
+
+func migrate(args []string) error {
+	fs := newFlagSet("migrate")
+	dryRun := fs.Bool("dry-run", false, "only report the records each migration would touch")
+	tenantID := fs.String("tenant", "", "migrate only this tenant, all the tenants are migrated by default")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	tenants := tenant.All()
+	if *tenantID != "" {
+		if err := tenant.Validate(*tenantID); err != nil {
+			return err
+		}
+		tenants = []string{*tenantID}
+	}
+
+	api.InitRepositories()
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TENANT\tTYPE\tVERSION\tMIGRATION\tRECORDS\tAPPLIED")
+	var migrations int
+	for _, id := range tenants {
+		reports, err := persist.Migrate(tenant.WithID(context.Background(), id), *dryRun)
+		if err != nil {
+			return fmt.Errorf("tenant %q: %w", id, err)
+		}
+		migrations += len(reports)
+		for _, r := range reports {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%d\t%t\n", tenantName(id), r.Type, r.Version, r.Name, r.Records, r.Applied || !*dryRun)
+		}
+	}
+	if migrations == 0 {
+		fmt.Println("no migrations registered")
+		return nil
+	}
+	return w.Flush()
+}
+
+func tenantName(id string) string {
+	if id == "" {
+		return "default"
+	}
+	return id
+}
@@ -0,0 +1,157 @@
+package domain
+
+import (
+	"context"
+
+	"github.com/borosr/realworld/lib/broken"
+	"github.com/borosr/realworld/persist"
+	"github.com/borosr/realworld/types"
+)
+
+// The deletion policies decide what happens to the articles and comments of
+// a deleted account
+const (
+	// DeletionPolicyAnonymize keeps the articles and comments with the
+	// DeletedUsername as their author
+	DeletionPolicyAnonymize = "anonymize"
+	// DeletionPolicyRemove removes the articles and comments permanently
+	DeletionPolicyRemove = "remove"
+)
+
+// DeletedUsername is the author of the anonymized articles and comments, it
+// can't be registered
+const DeletedUsername = "[deleted]"
+
+var (
+	ErrUnknownDeletionPolicy = broken.Internal("unknown account deletion policy")
+	ErrReservedUsername      = broken.Validation("reserved username")
+)
+
+type AccountDescriptor interface {
+	Delete(ctx context.Context, email string) error
+}
+
+// AccountService deletes the accounts with everything referring to them
+type AccountService struct {
+	UserRepository   persist.Repository[*types.User]
+	FollowRepository persist.Repository[*types.Follow]
+	FeedService      FeedService
+	ArticleService   ArticleService
+	DeletionPolicy   string
+}
+
+// Delete removes the user, their follows, favorites and feed, and removes or
+// anonymizes their articles and comments according to the DeletionPolicy.
+// The deleted articles and comments of the user are removed in both cases.
+// The records are deleted in batches of their own transactions and the user
+// last, a failed deletion is repeated by deleting the account again.
+func (acs AccountService) Delete(ctx context.Context, email string) error {
+	if acs.DeletionPolicy != DeletionPolicyAnonymize && acs.DeletionPolicy != DeletionPolicyRemove {
+		return ErrUnknownDeletionPolicy
+	}
+	user, err := acs.UserRepository.Get(ctx, email)
+	if err != nil {
+		return err
+	}
+	username := user.Username
+	if err := acs.deleteArticles(ctx, username); err != nil {
+		return err
+	}
+	if err := acs.deleteComments(ctx, username); err != nil {
+		return err
+	}
+	// the favorites of the deleted articles are removed too, the articles
+	// would be restored with them
+	if _, err := acs.ArticleService.FavoriteTrash.Remove(ctx, func(f *types.Favorite) bool {
+		return f.Username == username
+	}); err != nil {
+		return err
+	}
+	if _, err := acs.FollowRepository.DeleteFiltered(ctx, func(f *types.Follow) bool {
+		return f.From == username || f.To == username
+	}); err != nil {
+		return err
+	}
+	if err := acs.FeedService.remove(ctx, username); err != nil {
+		return err
+	}
+	return acs.UserRepository.Delete(ctx, email)
+}
+
+func (acs AccountService) deleteArticles(ctx context.Context, username string) error {
+	as := acs.ArticleService
+	byAuthor := func(a *types.Article) bool {
+		return a.Author.Username == username
+	}
+	trashed, err := as.ArticleTrash.GetFiltered(ctx, byAuthor)
+	if err != nil {
+		return err
+	}
+	articles, err := as.ArticleRepository.GetFiltered(ctx, byAuthor)
+	if err != nil {
+		return err
+	}
+	var removed = make([]string, 0, len(trashed)+len(articles))
+	for _, a := range trashed {
+		removed = append(removed, a.Key())
+	}
+	if acs.DeletionPolicy == DeletionPolicyAnonymize {
+		for _, a := range articles {
+			a.Author = deletedAuthor()
+		}
+		if _, err := as.ArticleRepository.SaveMany(ctx, articles); err != nil {
+			return err
+		}
+		if err := acs.anonymizeRevisions(ctx, username); err != nil {
+			return err
+		}
+	} else {
+		for _, a := range articles {
+			removed = append(removed, a.Key())
+		}
+	}
+	return as.remove(ctx, removed)
+}
+
+func (acs AccountService) deleteComments(ctx context.Context, username string) error {
+	as := acs.ArticleService
+	anonymize := acs.DeletionPolicy == DeletionPolicyAnonymize
+	if _, err := as.CommentTrash.Remove(ctx, func(c *types.Comment) bool {
+		return c.Author.Username == username && (!anonymize || c.DeletedAt != nil)
+	}); err != nil {
+		return err
+	}
+	if !anonymize {
+		return nil
+	}
+	comments, err := as.CommentRepository.GetFiltered(ctx, func(c *types.Comment) bool {
+		return c.Author.Username == username
+	})
+	if err != nil {
+		return err
+	}
+	for _, c := range comments {
+		c.Author = deletedAuthor()
+	}
+	_, err = as.CommentRepository.SaveMany(ctx, comments)
+	return err
+}
+
+// anonymizeRevisions hides the user in the history of the kept articles
+func (acs AccountService) anonymizeRevisions(ctx context.Context, username string) error {
+	revisions, err := acs.ArticleService.RevisionRepository.GetFiltered(ctx, func(r *types.Revision) bool {
+		return r.Author.Username == username
+	})
+	if err != nil || len(revisions) == 0 {
+		return err
+	}
+	for _, r := range revisions {
+		r.Author = deletedAuthor()
+	}
+	_, err = acs.ArticleService.RevisionRepository.SaveMany(ctx, revisions)
+	return err
+}
+
+func deletedAuthor() types.Profile {
+	return types.Profile{Username: DeletedUsername}
+}
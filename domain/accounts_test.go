@@ -0,0 +1,245 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	persistTypes "github.com/borosr/realworld/persist/types"
+	"github.com/borosr/realworld/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// recordTransaction counts the transactions, so the tests can assert the
+// atomic parts
+func recordTransaction(count *int) TransactionFunc {
+	return func(ctx context.Context, fn func(ctx context.Context) error) error {
+		*count++
+		return fn(ctx)
+	}
+}
+
+func matchArticle(keys ...string) interface{} {
+	return mock.MatchedBy(func(f persistTypes.Filter[*types.Article]) bool {
+		for _, key := range keys {
+			if !f(&types.Article{ID: key}) {
+				return false
+			}
+		}
+		return !f(&types.Article{ID: "other"})
+	})
+}
+
+func TestArticleService_PurgeTrash(t *testing.T) {
+	ctx := context.Background()
+	expired := time.Now().Add(-2 * time.Hour)
+
+	mockArticleTrash := MockTrash[*types.Article]{}
+	mockCommentTrash := MockTrash[*types.Comment]{}
+	mockFavoriteTrash := MockTrash[*types.Favorite]{}
+	mockCommentRepo := MockRepository[*types.Comment]{}
+	mockSlugRepo := MockRepository[*types.SlugAlias]{}
+	mockRevisionRepo := MockRepository[*types.Revision]{}
+	mockArticleTrash.On("GetFiltered", ctx, mock.MatchedBy(func(f persistTypes.Filter[*types.Article]) bool {
+		now := time.Now()
+		return f(&types.Article{DeletedAt: &expired}) && !f(&types.Article{DeletedAt: &now})
+	})).
+		Return([]*types.Article{{ID: "expired", DeletedAt: &expired}}, nil)
+	mockArticleTrash.On("Remove", ctx, matchArticle("expired")).Return(1, nil)
+	mockCommentTrash.On("Remove", ctx, mock.MatchedBy(func(f persistTypes.Filter[*types.Comment]) bool {
+		return f(&types.Comment{Slug: "expired"}) && !f(&types.Comment{Slug: "other"})
+	})).
+		Return(2, nil)
+	mockFavoriteTrash.On("Remove", ctx, mock.MatchedBy(func(f persistTypes.Filter[*types.Favorite]) bool {
+		return f(&types.Favorite{Slug: "expired"}) && !f(&types.Favorite{Slug: "other"})
+	})).
+		Return(1, nil)
+	mockSlugRepo.On("DeleteFiltered", ctx, mock.MatchedBy(func(f persistTypes.Filter[*types.SlugAlias]) bool {
+		return f(&types.SlugAlias{Slug: "renamed", ArticleID: "expired"}) && !f(&types.SlugAlias{ArticleID: "other"})
+	})).
+		Return(1, nil)
+	mockCommentRepo.On("DeleteSequence", ctx, "expired").Return(nil)
+	mockRevisionRepo.On("DeleteFiltered", ctx, mock.MatchedBy(func(f persistTypes.Filter[*types.Revision]) bool {
+		return f(&types.Revision{ArticleID: "expired", Number: 2}) && !f(&types.Revision{ArticleID: "other"})
+	})).
+		Return(2, nil)
+	mockCommentTrash.On("Purge", ctx, mock.Anything).Return(3, nil)
+	mockFavoriteTrash.On("Purge", ctx, mock.Anything).Return(2, nil)
+	var transactions int
+	as := ArticleService{
+		CommentRepository:  &mockCommentRepo,
+		SlugRepository:     &mockSlugRepo,
+		RevisionRepository: &mockRevisionRepo,
+		ArticleTrash:       &mockArticleTrash,
+		CommentTrash:       &mockCommentTrash,
+		FavoriteTrash:      &mockFavoriteTrash,
+		Transaction:        recordTransaction(&transactions),
+		TrashRetention:     time.Hour,
+	}
+	purged, err := as.PurgeTrash(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(6), purged)
+	// the records are removed in batches of their own transactions
+	assert.Equal(t, 0, transactions)
+	mockArticleTrash.AssertExpectations(t)
+	mockCommentTrash.AssertExpectations(t)
+	mockFavoriteTrash.AssertExpectations(t)
+	mockSlugRepo.AssertExpectations(t)
+	mockCommentRepo.AssertExpectations(t)
+	mockRevisionRepo.AssertExpectations(t)
+}
+
+type accountMocks struct {
+	users         MockRepository[*types.User]
+	follows       MockRepository[*types.Follow]
+	feeds         MockRepository[*types.Feed]
+	indexes       MockRepository[*types.FollowIndex]
+	timelines     MockRepository[*types.Timeline]
+	articles      MockRepository[*types.Article]
+	comments      MockRepository[*types.Comment]
+	favorites     MockRepository[*types.Favorite]
+	slugs         MockRepository[*types.SlugAlias]
+	revisions     MockRepository[*types.Revision]
+	trash         MockTrash[*types.Article]
+	bin           MockTrash[*types.Comment]
+	favoriteTrash MockTrash[*types.Favorite]
+}
+
+func (m *accountMocks) service(policy string) AccountService {
+	return AccountService{
+		UserRepository:   &m.users,
+		FollowRepository: &m.follows,
+		FeedService: FeedService{
+			FeedRepository:        &m.feeds,
+			FollowIndexRepository: &m.indexes,
+			TimelineRepository:    &m.timelines,
+		},
+		ArticleService: ArticleService{
+			ArticleRepository:  &m.articles,
+			CommentRepository:  &m.comments,
+			FavoriteRepository: &m.favorites,
+			SlugRepository:     &m.slugs,
+			RevisionRepository: &m.revisions,
+			ArticleTrash:       &m.trash,
+			CommentTrash:       &m.bin,
+			FavoriteTrash:      &m.favoriteTrash,
+		},
+		DeletionPolicy: policy,
+	}
+}
+
+// expectAccount mocks the records of the user every policy deletes
+func (m *accountMocks) expectAccount(ctx context.Context) {
+	deletedAt := time.Now()
+	m.users.On("Get", ctx, "leaver@example.com").
+		Return(&types.User{Email: "leaver@example.com", Profile: types.Profile{Username: "leaver"}}, nil)
+	m.trash.On("GetFiltered", ctx, mock.Anything).
+		Return([]*types.Article{{ID: "trashed", Author: types.Profile{Username: "leaver"}, DeletedAt: &deletedAt}}, nil)
+	m.articles.On("GetFiltered", ctx, mock.MatchedBy(func(f persistTypes.Filter[*types.Article]) bool {
+		return f(&types.Article{Author: types.Profile{Username: "leaver"}}) && !f(&types.Article{Author: types.Profile{Username: "other"}})
+	})).
+		Return([]*types.Article{{ID: "live", Author: types.Profile{Username: "leaver"}}}, nil)
+	m.favoriteTrash.On("Remove", ctx, mock.MatchedBy(func(f persistTypes.Filter[*types.Favorite]) bool {
+		return f(&types.Favorite{Username: "leaver"}) && !f(&types.Favorite{Username: "other"})
+	})).
+		Return(1, nil)
+	m.follows.On("DeleteFiltered", ctx, mock.MatchedBy(func(f persistTypes.Filter[*types.Follow]) bool {
+		return f(&types.Follow{From: "leaver", To: "other"}) && f(&types.Follow{From: "other", To: "leaver"}) &&
+			!f(&types.Follow{From: "other", To: "another"})
+	})).
+		Return(2, nil)
+	m.feeds.On("Delete", ctx, "leaver").Return(nil)
+	m.indexes.On("Delete", ctx, "leaver").Return(nil)
+	m.timelines.On("Delete", ctx, "leaver").Return(nil)
+	m.users.On("Delete", ctx, "leaver@example.com").Return(nil)
+	m.slugs.On("DeleteFiltered", ctx, mock.Anything).Return(0, nil)
+	m.favoriteTrash.On("Remove", ctx, mock.Anything).Return(0, nil)
+	m.revisions.On("DeleteFiltered", ctx, mock.Anything).Return(0, nil)
+}
+
+func (m *accountMocks) assertExpectations(t *testing.T) {
+	m.users.AssertExpectations(t)
+	m.follows.AssertExpectations(t)
+	m.feeds.AssertExpectations(t)
+	m.indexes.AssertExpectations(t)
+	m.timelines.AssertExpectations(t)
+	m.articles.AssertExpectations(t)
+	m.comments.AssertExpectations(t)
+	m.trash.AssertExpectations(t)
+	m.bin.AssertExpectations(t)
+	m.favoriteTrash.AssertExpectations(t)
+	m.revisions.AssertExpectations(t)
+}
+
+func TestAccountService_DeleteAnonymize(t *testing.T) {
+	ctx := context.Background()
+	var m accountMocks
+	m.expectAccount(ctx)
+	m.articles.On("SaveMany", ctx, []*types.Article{{ID: "live", Author: types.Profile{Username: DeletedUsername}}}).
+		Return([]*types.Article{}, nil)
+	m.revisions.On("GetFiltered", ctx, mock.MatchedBy(func(f persistTypes.Filter[*types.Revision]) bool {
+		return f(&types.Revision{Author: types.Profile{Username: "leaver"}}) && !f(&types.Revision{})
+	})).
+		Return([]*types.Revision{{ArticleID: "live", Number: 1, Author: types.Profile{Username: "leaver"}}}, nil)
+	m.revisions.On("SaveMany", ctx, []*types.Revision{{ArticleID: "live", Number: 1, Author: types.Profile{Username: DeletedUsername}}}).
+		Return([]*types.Revision{}, nil)
+	m.trash.On("Remove", ctx, matchArticle("trashed")).Return(1, nil)
+	m.comments.On("DeleteSequence", ctx, "trashed").Return(nil)
+	m.bin.On("Remove", ctx, mock.MatchedBy(func(f persistTypes.Filter[*types.Comment]) bool {
+		deletedAt := time.Now()
+		var deleted, live types.Comment
+		deleted.Author.Username, deleted.DeletedAt = "leaver", &deletedAt
+		live.Author.Username = "leaver"
+		return f(&deleted) && !f(&live)
+	})).
+		Return(1, nil)
+	m.bin.On("Remove", ctx, mock.Anything).Return(0, nil)
+	var comment types.Comment
+	comment.ID, comment.Author.Username = 1, "leaver"
+	m.comments.On("GetFiltered", ctx, mock.Anything).
+		Return([]*types.Comment{&comment}, nil)
+	var anonymized types.Comment
+	anonymized.ID, anonymized.Author.Username = 1, DeletedUsername
+	m.comments.On("SaveMany", ctx, []*types.Comment{&anonymized}).
+		Return([]*types.Comment{}, nil)
+
+	assert.Nil(t, m.service(DeletionPolicyAnonymize).Delete(ctx, "leaver@example.com"))
+	m.assertExpectations(t)
+}
+
+func TestAccountService_DeleteRemove(t *testing.T) {
+	ctx := context.Background()
+	var m accountMocks
+	m.expectAccount(ctx)
+	m.trash.On("Remove", ctx, matchArticle("trashed", "live")).Return(2, nil)
+	m.comments.On("DeleteSequence", ctx, "trashed").Return(nil)
+	m.comments.On("DeleteSequence", ctx, "live").Return(nil)
+	m.bin.On("Remove", ctx, mock.MatchedBy(func(f persistTypes.Filter[*types.Comment]) bool {
+		var live types.Comment
+		live.Author.Username = "leaver"
+		return f(&live)
+	})).
+		Return(3, nil)
+	m.bin.On("Remove", ctx, mock.Anything).Return(0, nil)
+
+	assert.Nil(t, m.service(DeletionPolicyRemove).Delete(ctx, "leaver@example.com"))
+	m.assertExpectations(t)
+}
+
+func TestAccountService_DeleteFailure(t *testing.T) {
+	ctx := context.Background()
+	failure := errors.New("failure")
+	var m accountMocks
+	m.users.On("Get", ctx, "leaver@example.com").
+		Return(&types.User{Email: "leaver@example.com", Profile: types.Profile{Username: "leaver"}}, nil)
+	m.trash.On("GetFiltered", ctx, mock.Anything).Return([]*types.Article{}, failure)
+
+	err := m.service(DeletionPolicyRemove).Delete(ctx, "leaver@example.com")
+	assert.True(t, errors.Is(err, failure))
+	m.users.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+
+	err = m.service("unknown").Delete(ctx, "leaver@example.com")
+	assert.Equal(t, ErrUnknownDeletionPolicy, err)
+}
@@ -2,40 +2,114 @@ package domain
 
 import (
 	"context"
+	"errors"
 	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/borosr/realworld/lib/api"
 	"github.com/borosr/realworld/lib/broken"
+	"github.com/borosr/realworld/lib/sanitize"
+	"github.com/borosr/realworld/lib/slug"
 	"github.com/borosr/realworld/persist"
 	persistTypes "github.com/borosr/realworld/persist/types"
 	"github.com/borosr/realworld/types"
 )
 
 type ArticleDescriptor interface {
-	GetAll(ctx context.Context, tag, author, favorite string, limit, offset int) ([]*types.Article, int, error)
+	GetAll(ctx context.Context, tag, author, favorite, status string, limit, offset int) ([]*types.Article, int, error)
 	Feed(ctx context.Context, limit, offset int) ([]*types.Article, int, error)
 	Get(ctx context.Context, slug string) (types.Article, error)
+	Publish(ctx context.Context, slug string, publishAt *time.Time) (types.Article, error)
+	Unpublish(ctx context.Context, slug string) (types.Article, error)
+	GetRevisions(ctx context.Context, slug string) ([]*types.Revision, error)
+	GetRevision(ctx context.Context, slug string, number int) (types.Revision, error)
+	DiffRevisions(ctx context.Context, slug string, from, to int) (types.RevisionDiff, error)
+	Rollback(ctx context.Context, slug string, number int) (types.Article, error)
+	// Render sets the sanitized HTML of the bodies of the articles
+	Render(articles ...*types.Article)
 	Create(ctx context.Context, a types.ArticleRequest, ownerEmail string) (types.Article, error)
 	Update(ctx context.Context, slug string, a types.ArticleRequest) (types.Article, error)
 	Delete(ctx context.Context, slug string) error
 	CreateComment(ctx context.Context, slug string, c types.CommentRequest) (types.CommonComment, error)
-	GetComments(ctx context.Context, slug string) ([]types.CommonComment, error)
+	// GetComments returns the comments in the order of their creation, at
+	// most limit of them after the cursor when the limit is positive, and the
+	// cursor of the next page
+	GetComments(ctx context.Context, slug string, limit int, after string) ([]types.CommonComment, string, error)
+	UpdateComment(ctx context.Context, slug string, id int, c types.CommentRequest) (types.CommonComment, error)
+	GetCommentHistory(ctx context.Context, slug string, id int) ([]types.CommentEdit, error)
 	DeleteComment(ctx context.Context, slug string, id int) error
 	AddFavoriteArticle(ctx context.Context, slug, username string) (types.Article, error)
 	DeleteFavoriteArticle(ctx context.Context, slug, username string) (types.Article, error)
+	GetTrashedArticles(ctx context.Context, email string) ([]*types.Article, error)
+	RestoreArticle(ctx context.Context, slug, email string) (types.Article, error)
+	GetTrashedComments(ctx context.Context, email string) ([]types.Comment, error)
+	RestoreComment(ctx context.Context, slug string, id int, email string) (types.CommonComment, error)
+	PurgeTrash(ctx context.Context) (uint64, error)
+}
+
+var ErrRetentionExpired = broken.Validation("the retention window of the deleted record has expired")
+
+var ErrEmptyComment = broken.Validation("the comment has no content")
+
+var ErrArticleDeleted = broken.Validation("the article of the comment is deleted, restore the article first")
+
+// defaultSlug is the base slug of the titles without letters or digits
+const defaultSlug = "article"
+
+// slugMu serializes the slug allocations, so two articles never get the same
+// slug
+var slugMu sync.Mutex
+
+// ArticleMovedError is returned for the former slugs of an article
+type ArticleMovedError struct {
+	Slug string
+}
+
+func (e *ArticleMovedError) Error() string {
+	return "article moved to " + e.Slug
 }
 
 type ArticleService struct {
 	ArticleRepository  persist.Repository[*types.Article]
 	CommentRepository  persist.Repository[*types.Comment]
 	FavoriteRepository persist.Repository[*types.Favorite]
-	UserService        UserDescriptor
+	FollowRepository   persist.Repository[*types.Follow]
+	SlugRepository     persist.Repository[*types.SlugAlias]
+	RevisionRepository persist.Repository[*types.Revision]
+	TagAliasRepository persist.Repository[*types.TagAlias]
+	ScheduleRepository persist.Repository[*types.Schedule]
+	FeedService        FeedDescriptor
+	ArticleTrash       persist.Trash[*types.Article]
+	CommentTrash       persist.Trash[*types.Comment]
+	FavoriteTrash      persist.Trash[*types.Favorite]
+	Transaction        TransactionFunc
+	// TrashRetention is the time the deleted articles and comments can be
+	// restored within
+	TrashRetention time.Duration
+	UserService    UserDescriptor
+	Renderings     *Renderings
+	// CommentMaxDepth is the deepest reply allowed
+	CommentMaxDepth int
 }
 
-func (as ArticleService) GetAll(ctx context.Context, tag, author, favorite string, limit, offset int) ([]*types.Article, int, error) {
+// GetAll lists the published articles, or the articles of the user in the
+// other statuses. The author me stands for the user.
+func (as ArticleService) GetAll(ctx context.Context, tag, author, favorite, status string, limit, offset int) ([]*types.Article, int, error) {
+	author, listed, err := as.listing(ctx, author, status)
+	if err != nil {
+		return nil, 0, err
+	}
 	var filters []persistTypes.Filter[*types.Article]
 	if tag != "" {
+		tags, err := normalizeTags(ctx, as.TagAliasRepository, []string{tag})
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(tags) > 0 {
+			tag = tags[0]
+		}
 		filters = append(filters, func(t *types.Article) bool {
 			for _, t := range t.TagList {
 				if t == tag {
@@ -59,7 +133,7 @@ func (as ArticleService) GetAll(ctx context.Context, tag, author, favorite strin
 		}
 		filters = append(filters, func(t *types.Article) bool {
 			for i := range filtered {
-				if t.Slug == filtered[i].Slug {
+				if t.Key() == filtered[i].Slug {
 					return true
 				}
 			}
@@ -70,26 +144,58 @@ func (as ArticleService) GetAll(ctx context.Context, tag, author, favorite strin
 	if err != nil {
 		return nil, 0, err
 	}
-	results, totalCount := as.reduceResult(results, limit, offset)
-	as.attachFavorite(ctx, results)
+	var listedResults = results[:0]
+	for _, a := range results {
+		if listed(a) {
+			listedResults = append(listedResults, a)
+		}
+	}
+	results, totalCount := as.reduceResult(listedResults, limit, offset)
+	if err := as.attachFavorite(ctx, results); err != nil {
+		return nil, 0, err
+	}
+	if err := as.enrich(ctx, results...); err != nil {
+		return nil, 0, err
+	}
 	return results, totalCount, nil
 }
 
+// Feed returns the articles of the followed authors, newest first
 func (as ArticleService) Feed(ctx context.Context, limit, offset int) ([]*types.Article, int, error) {
-	results, err := as.ArticleRepository.GetFiltered(ctx)
+	user, err := actor(ctx, as.UserService)
+	if err != nil {
+		return nil, 0, err
+	}
+	results, err := as.FeedService.Articles(ctx, user.Username)
 	if err != nil {
 		return nil, 0, err
 	}
 	results, totalCount := as.reduceResult(results, limit, offset)
-	as.attachFavorite(ctx, results)
+	if err := as.attachFavorite(ctx, results); err != nil {
+		return nil, 0, err
+	}
+	if err := as.enrich(ctx, results...); err != nil {
+		return nil, 0, err
+	}
 	return results, totalCount, nil
 }
 
+// Get returns the article of the slug, the former slugs of the article are
+// answered with an ArticleMovedError
 func (as ArticleService) Get(ctx context.Context, slug string) (types.Article, error) {
-	article, err := as.ArticleRepository.Get(ctx, slug)
+	article, err := as.find(ctx, slug)
 	if err != nil {
 		return types.Article{}, err
 	}
+	if article.Slug != slug {
+		return types.Article{}, &ArticleMovedError{Slug: article.Slug}
+	}
+	if err := as.attachFavorite(ctx, []*types.Article{article}); err != nil {
+		return types.Article{}, err
+	}
+	if err := as.enrich(ctx, article); err != nil {
+		return types.Article{}, err
+	}
 	return *article, nil
 }
 
@@ -99,8 +205,18 @@ func (as ArticleService) Create(ctx context.Context, a types.ArticleRequest, own
 		return types.Article{}, err
 	}
 	now := time.Now()
-	sort.Strings(a.TagList)
-	saved, err := as.ArticleRepository.Save(ctx, &types.Article{
+	if a.TagList, err = normalizeTags(ctx, as.TagAliasRepository, a.TagList); err != nil {
+		return types.Article{}, err
+	}
+	slugMu.Lock()
+	defer slugMu.Unlock()
+	articleSlug, err := as.uniqueSlug(ctx, a.Title, "")
+	if err != nil {
+		return types.Article{}, err
+	}
+	article := &types.Article{
+		ID:          articleSlug,
+		Slug:        articleSlug,
 		Title:       a.Title,
 		Description: a.Description,
 		Body:        a.Body,
@@ -108,6 +224,19 @@ func (as ArticleService) Create(ctx context.Context, a types.ArticleRequest, own
 		CreatedAt:   now,
 		UpdatedAt:   now,
 		Author:      user.Profile,
+	}
+	if err := setStatus(article, requestedStatus(a), a.PublishAt, now); err != nil {
+		return types.Article{}, err
+	}
+	var saved *types.Article
+	err = as.Transaction.run(ctx, func(ctx context.Context) error {
+		// a retried transaction starts from the article as it was built
+		created := *article
+		if err := as.revise(ctx, &created, user.Profile); err != nil {
+			return err
+		}
+		saved, err = as.ArticleRepository.Save(ctx, &created)
+		return err
 	})
 	if err != nil {
 		return types.Article{}, err
@@ -115,40 +244,138 @@ func (as ArticleService) Create(ctx context.Context, a types.ArticleRequest, own
 	return *saved, nil
 }
 
+// Update changes the slug of the article when the new title has a different
+// slug, the former slugs keep pointing to the article. Every update stores a
+// revision of the article.
 func (as ArticleService) Update(ctx context.Context, slug string, a types.ArticleRequest) (types.Article, error) {
-	existing, err := as.ArticleRepository.Get(ctx, slug)
+	return as.update(ctx, slug, a, false)
+}
+
+// update changes the fields of the request, the empty ones are left as they
+// are unless replace is set
+func (as ArticleService) update(ctx context.Context, slug string, a types.ArticleRequest, replace bool) (types.Article, error) {
+	user, err := actor(ctx, as.UserService)
 	if err != nil {
 		return types.Article{}, err
 	}
-	if a.Title != "" {
-		existing.Title = a.Title
-	}
-	if a.Description != "" {
-		existing.Description = a.Description
-	}
-	if a.Body != "" {
-		existing.Body = a.Body
+	found, err := as.find(ctx, slug)
+	if err != nil {
+		return types.Article{}, err
 	}
-	if a.TagList != nil {
-		existing.TagList = a.TagList
-		sort.Strings(existing.TagList)
+	if err := CanEditArticle(user, found); err != nil {
+		return types.Article{}, err
 	}
-	updated, err := as.ArticleRepository.Save(ctx, existing)
+	now := time.Now()
+	if replace || a.Title != "" {
+		// the lock is held until the commit, so two renames never take the
+		// same slug
+		slugMu.Lock()
+		defer slugMu.Unlock()
+	}
+	var updated *types.Article
+	err = as.Transaction.run(ctx, func(ctx context.Context) error {
+		// every attempt starts from the stored article, so a retried
+		// transaction makes the same changes
+		existing, err := as.ArticleRepository.Get(ctx, found.Key())
+		if err != nil {
+			return err
+		}
+		before := *existing
+		if a.Status != "" || a.PublishAt != nil {
+			if err := setStatus(existing, requestedStatus(a), a.PublishAt, now); err != nil {
+				return err
+			}
+		}
+		if (replace || a.Title != "") && baseSlug(a.Title) != baseSlug(existing.Title) {
+			newSlug, err := as.uniqueSlug(ctx, a.Title, existing.Key())
+			if err != nil {
+				return err
+			}
+			// the key of the legacy articles is their first slug
+			existing.ID = existing.Key()
+			existing.Slug = newSlug
+			if _, err := as.SlugRepository.Save(ctx, &types.SlugAlias{
+				Slug:      newSlug,
+				ArticleID: existing.ID,
+			}); err != nil {
+				return err
+			}
+		}
+		if replace || a.Title != "" {
+			existing.Title = a.Title
+		}
+		if replace || a.Description != "" {
+			existing.Description = a.Description
+		}
+		if replace || a.Body != "" {
+			existing.Body = a.Body
+		}
+		if replace || a.TagList != nil {
+			if existing.TagList, err = normalizeTags(ctx, as.TagAliasRepository, a.TagList); err != nil {
+				return err
+			}
+		}
+		existing.UpdatedAt = now
+		if err := as.baseline(ctx, &before); err != nil {
+			return err
+		}
+		if err := as.revise(ctx, existing, user.Profile); err != nil {
+			return err
+		}
+		updated, err = as.ArticleRepository.Save(ctx, existing)
+		return err
+	})
 	if err != nil {
 		return types.Article{}, err
 	}
 	return *updated, nil
 }
 
+// Delete moves the article into the trash in one transaction with its
+// comments, the favorites and the comment sequence of the article are removed
 func (as ArticleService) Delete(ctx context.Context, slug string) error {
-	if err := as.ArticleRepository.Delete(ctx, slug); err != nil {
+	user, err := actor(ctx, as.UserService)
+	if err != nil {
 		return err
 	}
-	return nil
+	article, err := as.find(ctx, slug)
+	if err != nil {
+		return err
+	}
+	if err := CanEditArticle(user, article); err != nil {
+		return err
+	}
+	key := article.Key()
+	return as.Transaction.run(ctx, func(ctx context.Context) error {
+		if err := as.ArticleRepository.Delete(ctx, key); err != nil {
+			return err
+		}
+		if _, err := as.CommentRepository.DeleteFiltered(ctx, func(c *types.Comment) bool {
+			return c.Slug == key
+		}); err != nil {
+			return err
+		}
+		if _, err := as.FavoriteRepository.DeleteFiltered(ctx, func(f *types.Favorite) bool {
+			return f.Slug == key
+		}); err != nil {
+			return err
+		}
+		return as.CommentRepository.DeleteSequence(ctx, key)
+	})
 }
 
+// CreateComment stores the comment as it was written, its body is sanitized
+// when it is read
 func (as ArticleService) CreateComment(ctx context.Context, slug string, c types.CommentRequest) (types.CommonComment, error) {
-	commentID, err := as.CommentRepository.Sequence(ctx, slug)
+	body := c.Body
+	if strings.TrimSpace(sanitize.HTML(body)) == "" {
+		return types.CommonComment{}, ErrEmptyComment
+	}
+	key, err := as.articleKey(ctx, slug)
+	if err != nil {
+		return types.CommonComment{}, err
+	}
+	commentID, err := as.CommentRepository.Sequence(ctx, key)
 	if err != nil {
 		return types.CommonComment{}, err
 	}
@@ -161,48 +388,94 @@ func (as ArticleService) CreateComment(ctx context.Context, slug string, c types
 		return types.CommonComment{}, err
 	}
 	now := time.Now()
-	saved, err := as.CommentRepository.Save(ctx, &types.Comment{
+	comment := &types.Comment{
 		CommonComment: types.CommonComment{
 			ID:        int(commentID),
 			CreatedAt: now,
 			UpdatedAt: now,
-			Body:      c.Body,
+			Body:      body,
 			Author:    user.Profile,
 		},
-		Slug: slug,
-	})
+		Slug: key,
+	}
+	if c.ParentID != nil {
+		if err := as.reply(ctx, comment, *c.ParentID); err != nil {
+			return types.CommonComment{}, err
+		}
+	}
+	saved, err := as.CommentRepository.Save(ctx, comment)
 	if err != nil {
 		return types.CommonComment{}, err
 	}
-	return saved.CommonComment, nil
+	return renderComment(saved.CommonComment), nil
 }
 
-func (as ArticleService) GetComments(ctx context.Context, slug string) ([]types.CommonComment, error) {
+func (as ArticleService) GetComments(ctx context.Context, slug string, limit int, after string) ([]types.CommonComment, string, error) {
+	key, err := as.articleKey(ctx, slug)
+	if err != nil {
+		return nil, "", err
+	}
 	results, err := as.CommentRepository.GetFiltered(ctx, func(c *types.Comment) bool {
-		return c.Slug == slug
+		return c.Slug == key
 	})
 	if err != nil {
-		return nil, err
+		return nil, "", err
+	}
+	// the deleted comments keep the place of their replies in the thread
+	deleted, err := as.CommentTrash.GetFiltered(ctx, func(c *types.Comment) bool {
+		return c.Slug == key
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	results, next, err := page(thread(append(results, deleted...)), limit, after)
+	if err != nil {
+		return nil, "", err
 	}
 	var comments []types.CommonComment
 	for _, res := range results {
-		comments = append(comments, res.CommonComment)
+		comments = append(comments, renderComment(res.CommonComment))
 	}
-	return comments, nil
+	if err := as.enrichComments(ctx, comments); err != nil {
+		return nil, "", err
+	}
+	return comments, next, nil
 }
 
+// DeleteComment allows the author of the comment or the article to delete the
+// comment, deleting a missing comment is a no-op. A comment with replies is
+// listed as a placeholder while it is deleted, so its replies keep their place
+// in the thread.
 func (as ArticleService) DeleteComment(ctx context.Context, slug string, id int) error {
+	user, err := actor(ctx, as.UserService)
+	if err != nil {
+		return err
+	}
+	article, err := as.find(ctx, slug)
+	if err != nil {
+		return err
+	}
 	c := types.Comment{
 		CommonComment: types.CommonComment{
 			ID: id,
 		},
-		Slug: slug,
+		Slug: article.Key(),
+	}
+	comment, err := as.CommentRepository.Get(ctx, c.Key())
+	if errors.Is(err, persistTypes.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := CanDeleteComment(user, article, comment); err != nil {
+		return err
 	}
 	return as.CommentRepository.Delete(ctx, c.Key())
 }
 
 func (as ArticleService) AddFavoriteArticle(ctx context.Context, slug, email string) (types.Article, error) {
-	article, err := as.ArticleRepository.Get(ctx, slug)
+	article, err := as.find(ctx, slug)
 	if err != nil {
 		return types.Article{}, err
 	}
@@ -211,7 +484,7 @@ func (as ArticleService) AddFavoriteArticle(ctx context.Context, slug, email str
 		return types.Article{}, err
 	}
 	favorite := types.Favorite{
-		Slug:     slug,
+		Slug:     article.Key(),
 		Username: user.Username,
 	}
 	if _, err := as.FavoriteRepository.Get(ctx, favorite.Key()); err == nil {
@@ -222,12 +495,17 @@ func (as ArticleService) AddFavoriteArticle(ctx context.Context, slug, email str
 	}
 	article.Favorited = true
 	favoriteCount, err := as.FavoriteRepository.CountFiltered(ctx, func(f *types.Favorite) bool {
-		return f.Slug == slug
+		return f.Slug == article.Key()
 	})
 	if err != nil {
 		return types.Article{}, err
 	}
 	article.FavoritesCount = int(favoriteCount)
+	following, err := followedBy(ctx, as.FollowRepository, user.Username, []string{article.Author.Username})
+	if err != nil {
+		return types.Article{}, err
+	}
+	article.Author.Following = following[article.Author.Username]
 	return *article, nil
 }
 
@@ -236,12 +514,12 @@ func (as ArticleService) DeleteFavoriteArticle(ctx context.Context, slug, email
 	if err != nil {
 		return types.Article{}, err
 	}
-	article, err := as.ArticleRepository.Get(ctx, slug)
+	article, err := as.find(ctx, slug)
 	if err != nil {
 		return types.Article{}, err
 	}
 	favorite := types.Favorite{
-		Slug:     slug,
+		Slug:     article.Key(),
 		Username: user.Username,
 	}
 	article.Favorited = false
@@ -249,17 +527,357 @@ func (as ArticleService) DeleteFavoriteArticle(ctx context.Context, slug, email
 		return types.Article{}, err
 	}
 	favoriteCount, err := as.FavoriteRepository.CountFiltered(ctx, func(f *types.Favorite) bool {
-		return f.Slug == slug
+		return f.Slug == article.Key()
 	})
 	if err != nil {
 		return types.Article{}, err
 	}
 	article.FavoritesCount = int(favoriteCount)
+	following, err := followedBy(ctx, as.FollowRepository, user.Username, []string{article.Author.Username})
+	if err != nil {
+		return types.Article{}, err
+	}
+	article.Author.Following = following[article.Author.Username]
 	return *article, nil
 }
 
+func (as ArticleService) GetTrashedArticles(ctx context.Context, email string) ([]*types.Article, error) {
+	user, err := as.UserService.GetByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	retentionStart := as.retentionStart()
+	articles, err := as.ArticleTrash.GetFiltered(ctx, func(a *types.Article) bool {
+		return a.Author.Username == user.Username && a.DeletedAt.After(retentionStart)
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(articles, func(i, j int) bool {
+		return articles[i].DeletedAt.After(*articles[j].DeletedAt)
+	})
+	return articles, nil
+}
+
+func (as ArticleService) RestoreArticle(ctx context.Context, slug, email string) (types.Article, error) {
+	user, err := as.UserService.GetByEmail(ctx, email)
+	if err != nil {
+		return types.Article{}, err
+	}
+	article, err := as.ArticleTrash.Get(ctx, slug)
+	if errors.Is(err, persistTypes.ErrNotFound) {
+		article, err = as.findTrashed(ctx, slug)
+	}
+	if err != nil {
+		return types.Article{}, err
+	}
+	if err := CanRestore(user, article.Author); err != nil {
+		return types.Article{}, err
+	}
+	if !article.DeletedAt.After(as.retentionStart()) {
+		return types.Article{}, ErrRetentionExpired
+	}
+	key := article.Key()
+	trashed, err := as.CommentTrash.GetFiltered(ctx, func(c *types.Comment) bool {
+		return c.Slug == key
+	})
+	if err != nil {
+		return types.Article{}, err
+	}
+	// the comments and favorites deleted together with the article are
+	// restored with it
+	var comments []*types.Comment
+	for _, c := range trashed {
+		if !c.DeletedAt.Before(*article.DeletedAt) {
+			comments = append(comments, c)
+		}
+	}
+	favorites, err := as.FavoriteTrash.GetFiltered(ctx, func(f *types.Favorite) bool {
+		return f.Slug == key && !f.DeletedAt.Before(*article.DeletedAt)
+	})
+	if err != nil {
+		return types.Article{}, err
+	}
+	if err := as.skipComments(ctx, key, trashed); err != nil {
+		return types.Article{}, err
+	}
+	var restored *types.Article
+	if err := as.Transaction.run(ctx, func(ctx context.Context) error {
+		if restored, err = as.ArticleTrash.Restore(ctx, key); err != nil {
+			return err
+		}
+		for _, c := range comments {
+			if _, err := as.CommentTrash.Restore(ctx, c.Key()); err != nil {
+				return err
+			}
+		}
+		for _, f := range favorites {
+			if _, err := as.FavoriteTrash.Restore(ctx, f.Key()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return types.Article{}, err
+	}
+	return *restored, nil
+}
+
+// skipComments advances the comment sequence of the article past the ids of
+// the comments, it starts from zero again after the article is deleted
+func (as ArticleService) skipComments(ctx context.Context, key string, comments []*types.Comment) error {
+	var last = -1
+	for _, c := range comments {
+		if c.ID > last {
+			last = c.ID
+		}
+	}
+	for last >= 0 {
+		next, err := as.CommentRepository.Sequence(ctx, key)
+		if err != nil {
+			return err
+		}
+		if int(next) >= last {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (as ArticleService) GetTrashedComments(ctx context.Context, email string) ([]types.Comment, error) {
+	user, err := as.UserService.GetByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	retentionStart := as.retentionStart()
+	results, err := as.CommentTrash.GetFiltered(ctx, func(c *types.Comment) bool {
+		return c.Author.Username == user.Username && c.DeletedAt.After(retentionStart)
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].DeletedAt.After(*results[j].DeletedAt)
+	})
+	var comments = make([]types.Comment, 0, len(results))
+	for _, res := range results {
+		res.CommonComment = renderComment(res.CommonComment)
+		comments = append(comments, *res)
+	}
+	return comments, nil
+}
+
+func (as ArticleService) RestoreComment(ctx context.Context, slug string, id int, email string) (types.CommonComment, error) {
+	user, err := as.UserService.GetByEmail(ctx, email)
+	if err != nil {
+		return types.CommonComment{}, err
+	}
+	// the comments of a deleted article stay deleted until the article is
+	// restored
+	article, err := as.find(ctx, slug)
+	if errors.Is(err, persistTypes.ErrNotFound) {
+		return types.CommonComment{}, ErrArticleDeleted
+	}
+	if err != nil {
+		return types.CommonComment{}, err
+	}
+	c := types.Comment{
+		CommonComment: types.CommonComment{
+			ID: id,
+		},
+		Slug: article.Key(),
+	}
+	comment, err := as.CommentTrash.Get(ctx, c.Key())
+	if err != nil {
+		return types.CommonComment{}, err
+	}
+	if err := CanRestore(user, comment.Author); err != nil {
+		return types.CommonComment{}, err
+	}
+	if !comment.DeletedAt.After(as.retentionStart()) {
+		return types.CommonComment{}, ErrRetentionExpired
+	}
+	restored, err := as.CommentTrash.Restore(ctx, c.Key())
+	if err != nil {
+		return types.CommonComment{}, err
+	}
+	return renderComment(restored.CommonComment), nil
+}
+
+// PurgeTrash removes the articles, comments and favorites deleted before the
+// retention window permanently, the articles together with everything
+// referring to them
+func (as ArticleService) PurgeTrash(ctx context.Context) (uint64, error) {
+	retentionStart := as.retentionStart()
+	expired, err := as.ArticleTrash.GetFiltered(ctx, func(a *types.Article) bool {
+		return a.DeletedAt.Before(retentionStart)
+	})
+	if err != nil {
+		return 0, err
+	}
+	var keys = make([]string, 0, len(expired))
+	for _, a := range expired {
+		keys = append(keys, a.Key())
+	}
+	if err := as.remove(ctx, keys); err != nil {
+		return 0, err
+	}
+	comments, err := as.CommentTrash.Purge(ctx, retentionStart)
+	if err != nil {
+		return 0, err
+	}
+	favorites, err := as.FavoriteTrash.Purge(ctx, retentionStart)
+	return uint64(len(keys)) + comments + favorites, err
+}
+
+// remove deletes the articles permanently with everything referring to them:
+// the comments, the favorites, the former slugs, the revisions and the
+// comment sequence. It runs outside of a transaction, so the records are
+// deleted in batches of their own. The articles are deleted last, a failed
+// removal is repeated from the start on the next call.
+func (as ArticleService) remove(ctx context.Context, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	var removed = make(map[string]bool, len(keys))
+	for _, key := range keys {
+		removed[key] = true
+	}
+	if _, err := as.CommentTrash.Remove(ctx, func(c *types.Comment) bool {
+		return removed[c.Slug]
+	}); err != nil {
+		return err
+	}
+	if _, err := as.FavoriteTrash.Remove(ctx, func(f *types.Favorite) bool {
+		return removed[f.Slug]
+	}); err != nil {
+		return err
+	}
+	if _, err := as.SlugRepository.DeleteFiltered(ctx, func(s *types.SlugAlias) bool {
+		return removed[s.ArticleID]
+	}); err != nil {
+		return err
+	}
+	if _, err := as.RevisionRepository.DeleteFiltered(ctx, func(r *types.Revision) bool {
+		return removed[r.ArticleID]
+	}); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := as.CommentRepository.DeleteSequence(ctx, key); err != nil {
+			return err
+		}
+	}
+	_, err := as.ArticleTrash.Remove(ctx, func(a *types.Article) bool {
+		return removed[a.Key()]
+	})
+	return err
+}
+
+// find returns the article of a current or former slug, or of its key. The
+// drafts and the scheduled articles are found for their author only.
+func (as ArticleService) find(ctx context.Context, slug string) (*types.Article, error) {
+	article, err := as.ArticleRepository.Get(ctx, slug)
+	if errors.Is(err, persistTypes.ErrNotFound) {
+		alias, aliasErr := as.SlugRepository.Get(ctx, slug)
+		if errors.Is(aliasErr, persistTypes.ErrNotFound) {
+			return nil, err
+		}
+		if aliasErr != nil {
+			return nil, aliasErr
+		}
+		article, err = as.ArticleRepository.Get(ctx, alias.ArticleID)
+	}
+	if err != nil {
+		return article, err
+	}
+	if err := as.visible(ctx, article); err != nil {
+		return nil, err
+	}
+	return article, nil
+}
+
+// findTrashed returns the deleted article of a former slug
+func (as ArticleService) findTrashed(ctx context.Context, slug string) (*types.Article, error) {
+	alias, err := as.SlugRepository.Get(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+	return as.ArticleTrash.Get(ctx, alias.ArticleID)
+}
+
+// articleKey returns the key the comments and favorites refer to the article
+// of the slug with, the slugs without an article are used as they are
+func (as ArticleService) articleKey(ctx context.Context, slug string) (string, error) {
+	article, err := as.find(ctx, slug)
+	if errors.Is(err, persistTypes.ErrNotFound) {
+		return slug, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return article.Key(), nil
+}
+
+// uniqueSlug returns the first free slug of the title, numbered from 2 when
+// the slug of the title is taken. The slugs of the deleted articles and the
+// former slugs stay taken, so they keep pointing to their article, but the
+// former slugs of the renamed article are free for itself again.
+func (as ArticleService) uniqueSlug(ctx context.Context, title, articleID string) (string, error) {
+	base := baseSlug(title)
+	for n := 1; ; n++ {
+		candidate := slug.WithSuffix(base, n)
+		taken, err := as.slugTaken(ctx, candidate, articleID)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return candidate, nil
+		}
+	}
+}
+
+// slugTaken reports whether the slug belongs to an article other than the one
+// of the articleID
+func (as ArticleService) slugTaken(ctx context.Context, candidate, articleID string) (bool, error) {
+	if articleID != "" && candidate == articleID {
+		return false, nil
+	}
+	// the trash reports the articles which are not deleted with
+	// ErrNotDeleted, so it finds every stored article
+	_, err := as.ArticleTrash.Get(ctx, candidate)
+	if !errors.Is(err, persistTypes.ErrNotFound) {
+		if err == nil || errors.Is(err, persist.ErrNotDeleted) {
+			return true, nil
+		}
+		return false, err
+	}
+	alias, err := as.SlugRepository.Get(ctx, candidate)
+	if errors.Is(err, persistTypes.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return articleID == "" || alias.ArticleID != articleID, nil
+}
+
+func baseSlug(title string) string {
+	if s := slug.Make(title); s != "" {
+		return s
+	}
+	return defaultSlug
+}
+
+func (as ArticleService) retentionStart() time.Time {
+	return time.Now().Add(-as.TrashRetention)
+}
+
 func (_ ArticleService) reduceResult(results []*types.Article, limit int, offset int) ([]*types.Article, int) {
 	totalCount := len(results)
+	if offset > totalCount {
+		offset = totalCount
+	}
 	if totalCount > limit+offset {
 		results = results[offset : limit+offset]
 	} else {
@@ -268,11 +886,28 @@ func (_ ArticleService) reduceResult(results []*types.Article, limit int, offset
 	return results, totalCount
 }
 
-func (as ArticleService) attachFavorite(ctx context.Context, results []*types.Article) {
-	for i := range results {
-		favorites, _ := as.FavoriteRepository.CountFiltered(ctx, func(f *types.Favorite) bool {
-			return f.Slug == results[i].Slug
-		})
-		results[i].FavoritesCount = int(favorites)
+// attachFavorite sets the favorites counts of the articles, the favorites of
+// the whole page are counted in one scan
+func (as ArticleService) attachFavorite(ctx context.Context, results []*types.Article) error {
+	if len(results) == 0 {
+		return nil
+	}
+	var counts = make(map[string]int, len(results))
+	for _, a := range results {
+		counts[a.Key()] = 0
+	}
+	favorites, err := as.FavoriteRepository.GetFiltered(ctx, func(f *types.Favorite) bool {
+		_, ok := counts[f.Slug]
+		return ok
+	})
+	if err != nil {
+		return err
+	}
+	for _, f := range favorites {
+		counts[f.Slug]++
 	}
+	for _, a := range results {
+		a.FavoritesCount = counts[a.Key()]
+	}
+	return nil
 }
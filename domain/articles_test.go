@@ -4,7 +4,10 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
+	"github.com/borosr/realworld/lib/broken"
+	"github.com/borosr/realworld/persist"
 	persistTypes "github.com/borosr/realworld/persist/types"
 	"github.com/borosr/realworld/types"
 	"github.com/rs/xid"
@@ -32,10 +35,10 @@ func TestArticleService_GetAll(t *testing.T) {
 	mockArticleRepo := MockRepository[*types.Article]{}
 	mockCommentRepo := MockRepository[*types.Comment]{}
 	mockFavoriteRepo := MockRepository[*types.Favorite]{}
-	mockFavoriteRepo.On("CountFiltered", ctx, mock.MatchedBy(func(f persistTypes.Filter[*types.Favorite]) bool {
+	mockFavoriteRepo.On("GetFiltered", ctx, mock.MatchedBy(func(f persistTypes.Filter[*types.Favorite]) bool {
 		return f(&expectedFavorite)
 	})).
-		Return(1, nil)
+		Return([]*types.Favorite{&expectedFavorite}, nil)
 	mockArticleRepo.On("GetFiltered", ctx).
 		Return([]*types.Article{&expectedArticle}, nil)
 	service := MockUserService{}
@@ -45,7 +48,7 @@ func TestArticleService_GetAll(t *testing.T) {
 		FavoriteRepository: &mockFavoriteRepo,
 		UserService:        &service,
 	}
-	articles, total, err := as.GetAll(ctx, "", "", "", 10, 0)
+	articles, total, err := as.GetAll(ctx, "", "", "", "", 10, 0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -78,22 +81,26 @@ func TestArticleService_GetAllTagFilter(t *testing.T) {
 	mockArticleRepo := MockRepository[*types.Article]{}
 	mockCommentRepo := MockRepository[*types.Comment]{}
 	mockFavoriteRepo := MockRepository[*types.Favorite]{}
-	mockFavoriteRepo.On("CountFiltered", ctx, mock.MatchedBy(func(f persistTypes.Filter[*types.Favorite]) bool {
+	mockFavoriteRepo.On("GetFiltered", ctx, mock.MatchedBy(func(f persistTypes.Filter[*types.Favorite]) bool {
 		return f(&expectedFavorite)
 	})).
-		Return(1, nil)
+		Return([]*types.Favorite{&expectedFavorite}, nil)
 	mockArticleRepo.On("GetFiltered", ctx, mock.MatchedBy(func(f persistTypes.Filter[*types.Article]) bool {
 		return f(&expectedArticle)
 	})).
 		Return([]*types.Article{&expectedArticle}, nil)
+	mockTagAliasRepo := MockRepository[*types.TagAlias]{}
+	mockTagAliasRepo.On("GetMany", ctx, []string{expectedTag}).
+		Return([]*types.TagAlias{}, nil)
 	service := MockUserService{}
 	as := ArticleService{
 		ArticleRepository:  &mockArticleRepo,
 		CommentRepository:  &mockCommentRepo,
 		FavoriteRepository: &mockFavoriteRepo,
+		TagAliasRepository: &mockTagAliasRepo,
 		UserService:        &service,
 	}
-	articles, total, err := as.GetAll(ctx, expectedTag, "", "", 10, 0)
+	articles, total, err := as.GetAll(ctx, expectedTag, "", "", "", 10, 0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -127,10 +134,10 @@ func TestArticleService_GetAllAuthorFilter(t *testing.T) {
 	mockArticleRepo := MockRepository[*types.Article]{}
 	mockCommentRepo := MockRepository[*types.Comment]{}
 	mockFavoriteRepo := MockRepository[*types.Favorite]{}
-	mockFavoriteRepo.On("CountFiltered", ctx, mock.MatchedBy(func(f persistTypes.Filter[*types.Favorite]) bool {
+	mockFavoriteRepo.On("GetFiltered", ctx, mock.MatchedBy(func(f persistTypes.Filter[*types.Favorite]) bool {
 		return f(&expectedFavorite)
 	})).
-		Return(1, nil)
+		Return([]*types.Favorite{&expectedFavorite}, nil)
 	mockArticleRepo.On("GetFiltered", ctx, mock.MatchedBy(func(f persistTypes.Filter[*types.Article]) bool {
 		return f(&expectedArticle)
 	})).
@@ -142,7 +149,7 @@ func TestArticleService_GetAllAuthorFilter(t *testing.T) {
 		FavoriteRepository: &mockFavoriteRepo,
 		UserService:        &service,
 	}
-	articles, total, err := as.GetAll(ctx, "", email, "", 10, 0)
+	articles, total, err := as.GetAll(ctx, "", email, "", "", 10, 0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -176,10 +183,6 @@ func TestArticleService_GetAllFavoriteFilter(t *testing.T) {
 	mockArticleRepo := MockRepository[*types.Article]{}
 	mockCommentRepo := MockRepository[*types.Comment]{}
 	mockFavoriteRepo := MockRepository[*types.Favorite]{}
-	mockFavoriteRepo.On("CountFiltered", ctx, mock.MatchedBy(func(f persistTypes.Filter[*types.Favorite]) bool {
-		return f(&expectedFavorite)
-	})).
-		Return(1, nil)
 	mockFavoriteRepo.On("GetFiltered", ctx, mock.MatchedBy(func(f persistTypes.Filter[*types.Favorite]) bool {
 		return f(&expectedFavorite)
 	})).
@@ -195,7 +198,7 @@ func TestArticleService_GetAllFavoriteFilter(t *testing.T) {
 		FavoriteRepository: &mockFavoriteRepo,
 		UserService:        &service,
 	}
-	articles, total, err := as.GetAll(ctx, "", "", email, 10, 0)
+	articles, total, err := as.GetAll(ctx, "", "", email, "", 10, 0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -231,10 +234,6 @@ func TestArticleService_GetAllAllFilter(t *testing.T) {
 	mockArticleRepo := MockRepository[*types.Article]{}
 	mockCommentRepo := MockRepository[*types.Comment]{}
 	mockFavoriteRepo := MockRepository[*types.Favorite]{}
-	mockFavoriteRepo.On("CountFiltered", ctx, mock.MatchedBy(func(f persistTypes.Filter[*types.Favorite]) bool {
-		return f(&expectedFavorite)
-	})).
-		Return(1, nil)
 	mockFavoriteRepo.On("GetFiltered", ctx, mock.MatchedBy(func(f persistTypes.Filter[*types.Favorite]) bool {
 		return f(&expectedFavorite)
 	})).
@@ -244,14 +243,18 @@ func TestArticleService_GetAllAllFilter(t *testing.T) {
 	})
 	mockArticleRepo.On("GetFiltered", ctx, filterMatcher, filterMatcher, filterMatcher).
 		Return([]*types.Article{&expectedArticle}, nil)
+	mockTagAliasRepo := MockRepository[*types.TagAlias]{}
+	mockTagAliasRepo.On("GetMany", ctx, []string{expectedTag}).
+		Return([]*types.TagAlias{}, nil)
 	service := MockUserService{}
 	as := ArticleService{
 		ArticleRepository:  &mockArticleRepo,
 		CommentRepository:  &mockCommentRepo,
 		FavoriteRepository: &mockFavoriteRepo,
+		TagAliasRepository: &mockTagAliasRepo,
 		UserService:        &service,
 	}
-	articles, total, err := as.GetAll(ctx, expectedTag, email, email, 10, 0)
+	articles, total, err := as.GetAll(ctx, expectedTag, email, email, "", 10, 0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -268,7 +271,7 @@ func TestArticleService_Feed(t *testing.T) {
 	)
 	expectedSlug := "test-slug" + xid.New().String()
 
-	ctx := context.Background()
+	ctx := context.WithValue(context.Background(), "email", email)
 
 	expectedFavorite := types.Favorite{
 		Slug:     expectedSlug,
@@ -282,17 +285,27 @@ func TestArticleService_Feed(t *testing.T) {
 	mockArticleRepo := MockRepository[*types.Article]{}
 	mockCommentRepo := MockRepository[*types.Comment]{}
 	mockFavoriteRepo := MockRepository[*types.Favorite]{}
-	mockFavoriteRepo.On("CountFiltered", ctx, mock.MatchedBy(func(f persistTypes.Filter[*types.Favorite]) bool {
+	mockFavoriteRepo.On("GetFiltered", ctx, mock.MatchedBy(func(f persistTypes.Filter[*types.Favorite]) bool {
 		return f(&expectedFavorite)
 	})).
-		Return(1, nil)
-	mockArticleRepo.On("GetFiltered", ctx).
+		Return([]*types.Favorite{&expectedFavorite}, nil)
+	mockFavoriteRepo.On("GetMany", ctx, []string{expectedSlug + "/reader"}).
+		Return([]*types.Favorite{{Slug: expectedSlug, Username: "reader"}}, nil)
+	mockFollowRepo := MockRepository[*types.Follow]{}
+	mockFollowRepo.On("GetMany", ctx, mock.Anything).
+		Return([]*types.Follow{}, nil)
+	mockFeedService := MockFeedService{}
+	mockFeedService.On("Articles", ctx, "reader").
 		Return([]*types.Article{&expectedArticle}, nil)
 	service := MockUserService{}
+	service.On("GetByEmail", ctx, email).
+		Return(types.User{Email: email, Profile: types.Profile{Username: "reader"}}, nil)
 	as := ArticleService{
 		ArticleRepository:  &mockArticleRepo,
 		CommentRepository:  &mockCommentRepo,
 		FavoriteRepository: &mockFavoriteRepo,
+		FollowRepository:   &mockFollowRepo,
+		FeedService:        &mockFeedService,
 		UserService:        &service,
 	}
 	articles, total, err := as.Feed(ctx, 10, 0)
@@ -303,6 +316,7 @@ func TestArticleService_Feed(t *testing.T) {
 	assert.Equal(t, 1, len(articles))
 	if !t.Failed() {
 		assert.Equal(t, expectedSlug, articles[0].Slug)
+		assert.True(t, articles[0].Favorited)
 	}
 }
 
@@ -324,14 +338,31 @@ func TestArticleService_Create(t *testing.T) {
 	mockArticleRepo := MockRepository[*types.Article]{}
 	mockCommentRepo := MockRepository[*types.Comment]{}
 	mockFavoriteRepo := MockRepository[*types.Favorite]{}
+	mockSlugRepo := MockRepository[*types.SlugAlias]{}
+	mockRevisionRepo := MockRepository[*types.Revision]{}
+	mockArticleTrash := MockTrash[*types.Article]{}
+	mockArticleTrash.On("Get", ctx, "random-title").
+		Return(nil, persistTypes.ErrNotFound)
+	mockSlugRepo.On("Get", ctx, "random-title").
+		Return(nil, persistTypes.ErrNotFound)
 	mockArticleRepo.On("Save", ctx, mock.MatchedBy(func(a *types.Article) bool {
 		return a.Title == expectedArticle.Title &&
+			a.Slug == "random-title" &&
+			a.Revision == 1 &&
 			len(a.TagList) == 3 &&
 			a.TagList[0] == "a" &&
 			a.TagList[1] == "b" &&
 			a.TagList[2] == "c"
 	})).
 		Return(&expectedArticle, nil)
+	mockTagAliasRepo := MockRepository[*types.TagAlias]{}
+	mockTagAliasRepo.On("GetMany", ctx, []string{"a", "b", "c", "d"}).
+		Return([]*types.TagAlias{{Alias: "d", Tag: "a"}}, nil)
+	mockRevisionRepo.On("Get", ctx, "random-title-1").Return(nil, persistTypes.ErrNotFound)
+	mockRevisionRepo.On("Save", ctx, mock.MatchedBy(func(r *types.Revision) bool {
+		return r.ArticleID == "random-title" && r.Number == 1 && r.Title == expectedTitle
+	})).
+		Return(&types.Revision{}, nil)
 	service := MockUserService{}
 	service.On("GetByEmail", ctx, email).
 		Return(types.User{
@@ -343,11 +374,15 @@ func TestArticleService_Create(t *testing.T) {
 		ArticleRepository:  &mockArticleRepo,
 		CommentRepository:  &mockCommentRepo,
 		FavoriteRepository: &mockFavoriteRepo,
+		SlugRepository:     &mockSlugRepo,
+		RevisionRepository: &mockRevisionRepo,
+		TagAliasRepository: &mockTagAliasRepo,
+		ArticleTrash:       &mockArticleTrash,
 		UserService:        &service,
 	}
 	article, err := as.Create(ctx, types.ArticleRequest{
 		Title:   expectedTitle,
-		TagList: []string{"b", "c", "a"},
+		TagList: []string{"b", " C", "a", "D", "b"},
 	}, email)
 	if err != nil {
 		t.Fatal(err)
@@ -355,6 +390,7 @@ func TestArticleService_Create(t *testing.T) {
 	assert.Equal(t, expectedSlug, article.Slug)
 	assert.NotEmpty(t, article.Slug)
 	assert.Equal(t, []string{"a", "b", "c"}, article.TagList)
+	mockRevisionRepo.AssertExpectations(t)
 }
 
 func TestArticleService_Update(t *testing.T) {
@@ -366,10 +402,13 @@ func TestArticleService_Update(t *testing.T) {
 	)
 	expectedSlug := "test-slug" + xid.New().String()
 
-	ctx := context.Background()
+	ctx := context.WithValue(context.Background(), "email", email)
 
 	expectedArticle := types.Article{
-		Slug:        expectedSlug,
+		Slug: expectedSlug,
+		Author: types.Profile{
+			Username: email,
+		},
 		Title:       expectedTitle,
 		Description: expectedDescription,
 		Body:        expectedBody,
@@ -379,6 +418,7 @@ func TestArticleService_Update(t *testing.T) {
 	mockArticleRepo := MockRepository[*types.Article]{}
 	mockCommentRepo := MockRepository[*types.Comment]{}
 	mockFavoriteRepo := MockRepository[*types.Favorite]{}
+	mockRevisionRepo := MockRepository[*types.Revision]{}
 	mockArticleRepo.On("Get", ctx, expectedSlug).
 		Return(&expectedArticle, nil)
 	mockArticleRepo.On("Save", ctx, mock.MatchedBy(func(a *types.Article) bool {
@@ -386,9 +426,19 @@ func TestArticleService_Update(t *testing.T) {
 			len(a.TagList) == 3 &&
 			a.TagList[0] == "a" &&
 			a.TagList[1] == "b" &&
-			a.TagList[2] == "c"
+			a.TagList[2] == "c" &&
+			!a.UpdatedAt.IsZero()
 	})).
 		Return(&expectedArticle, nil)
+	mockRevisionRepo.On("Get", ctx, expectedSlug+"-1").Return(&types.Revision{}, nil)
+	mockRevisionRepo.On("Get", ctx, expectedSlug+"-2").Return(nil, persistTypes.ErrNotFound)
+	mockRevisionRepo.On("Save", ctx, mock.MatchedBy(func(r *types.Revision) bool {
+		return r.ArticleID == expectedSlug && r.Number == 2 && r.Body == expectedBody
+	})).
+		Return(&types.Revision{}, nil)
+	mockTagAliasRepo := MockRepository[*types.TagAlias]{}
+	mockTagAliasRepo.On("GetMany", ctx, []string{"a", "b", "c"}).
+		Return([]*types.TagAlias{}, nil)
 	service := MockUserService{}
 	service.On("GetByEmail", ctx, email).
 		Return(types.User{
@@ -400,6 +450,8 @@ func TestArticleService_Update(t *testing.T) {
 		ArticleRepository:  &mockArticleRepo,
 		CommentRepository:  &mockCommentRepo,
 		FavoriteRepository: &mockFavoriteRepo,
+		RevisionRepository: &mockRevisionRepo,
+		TagAliasRepository: &mockTagAliasRepo,
 		UserService:        &service,
 	}
 	article, err := as.Update(ctx, expectedSlug, types.ArticleRequest{
@@ -439,6 +491,8 @@ func TestArticleService_CreateComment(t *testing.T) {
 	mockArticleRepo := MockRepository[*types.Article]{}
 	mockCommentRepo := MockRepository[*types.Comment]{}
 	mockFavoriteRepo := MockRepository[*types.Favorite]{}
+	mockArticleRepo.On("Get", ctx, expectedSlug).
+		Return(&types.Article{Slug: expectedSlug}, nil)
 	mockCommentRepo.On("Save", ctx, mock.MatchedBy(func(a *types.Comment) bool {
 		return a.Slug == expectedSlug
 	})).
@@ -485,6 +539,9 @@ func TestArticleService_AddFavoriteArticle(t *testing.T) {
 		Description: expectedDescription,
 		Body:        expectedBody,
 		TagList:     []string{"a", "b", "c"},
+		Author: types.Profile{
+			Username: "author",
+		},
 	}
 
 	expectedFavorite := types.Favorite{
@@ -507,6 +564,9 @@ func TestArticleService_AddFavoriteArticle(t *testing.T) {
 		return f(&expectedFavorite)
 	})).
 		Return(1, nil)
+	mockFollowRepo := MockRepository[*types.Follow]{}
+	mockFollowRepo.On("GetMany", ctx, []string{email + "-author"}).
+		Return([]*types.Follow{{From: email, To: "author"}}, nil)
 	service := MockUserService{}
 	service.On("GetByEmail", ctx, email).
 		Return(types.User{
@@ -518,6 +578,7 @@ func TestArticleService_AddFavoriteArticle(t *testing.T) {
 		ArticleRepository:  &mockArticleRepo,
 		CommentRepository:  &mockCommentRepo,
 		FavoriteRepository: &mockFavoriteRepo,
+		FollowRepository:   &mockFollowRepo,
 		UserService:        &service,
 	}
 	article, err := as.AddFavoriteArticle(ctx, expectedSlug, email)
@@ -528,6 +589,7 @@ func TestArticleService_AddFavoriteArticle(t *testing.T) {
 	assert.NotEmpty(t, article.Slug)
 	assert.True(t, article.Favorited)
 	assert.Equal(t, 1, article.FavoritesCount)
+	assert.True(t, article.Author.Following)
 }
 
 func TestArticleService_DeleteFavoriteArticle(t *testing.T) {
@@ -547,6 +609,9 @@ func TestArticleService_DeleteFavoriteArticle(t *testing.T) {
 		Description: expectedDescription,
 		Body:        expectedBody,
 		TagList:     []string{"a", "b", "c"},
+		Author: types.Profile{
+			Username: "author",
+		},
 	}
 
 	expectedFavorite := types.Favorite{
@@ -565,6 +630,9 @@ func TestArticleService_DeleteFavoriteArticle(t *testing.T) {
 		return f(&expectedFavorite)
 	})).
 		Return(1, nil)
+	mockFollowRepo := MockRepository[*types.Follow]{}
+	mockFollowRepo.On("GetMany", ctx, []string{email + "-author"}).
+		Return([]*types.Follow{{From: email, To: "author"}}, nil)
 	service := MockUserService{}
 	service.On("GetByEmail", ctx, email).
 		Return(types.User{
@@ -576,6 +644,7 @@ func TestArticleService_DeleteFavoriteArticle(t *testing.T) {
 		ArticleRepository:  &mockArticleRepo,
 		CommentRepository:  &mockCommentRepo,
 		FavoriteRepository: &mockFavoriteRepo,
+		FollowRepository:   &mockFollowRepo,
 		UserService:        &service,
 	}
 	article, err := as.DeleteFavoriteArticle(ctx, expectedSlug, email)
@@ -586,4 +655,533 @@ func TestArticleService_DeleteFavoriteArticle(t *testing.T) {
 	assert.NotEmpty(t, article.Slug)
 	assert.False(t, article.Favorited)
 	assert.Equal(t, 1, article.FavoritesCount)
+	assert.True(t, article.Author.Following)
+}
+
+func TestArticleService_Delete(t *testing.T) {
+	const email = "test@email.com"
+	ctx := context.WithValue(context.Background(), "email", email)
+
+	article := types.Article{
+		ID:     "article-id",
+		Slug:   "article",
+		Author: types.Profile{Username: email},
+	}
+	mockArticleRepo := MockRepository[*types.Article]{}
+	mockCommentRepo := MockRepository[*types.Comment]{}
+	mockFavoriteRepo := MockRepository[*types.Favorite]{}
+	mockArticleRepo.On("Get", ctx, "article").Return(&article, nil)
+	mockArticleRepo.On("Delete", ctx, "article-id").Return(nil)
+	mockCommentRepo.On("DeleteFiltered", ctx, mock.MatchedBy(func(f persistTypes.Filter[*types.Comment]) bool {
+		return f(&types.Comment{Slug: "article-id"}) && !f(&types.Comment{Slug: "other"})
+	})).
+		Return(2, nil)
+	mockCommentRepo.On("DeleteSequence", ctx, "article-id").Return(nil)
+	mockFavoriteRepo.On("DeleteFiltered", ctx, mock.MatchedBy(func(f persistTypes.Filter[*types.Favorite]) bool {
+		return f(&types.Favorite{Slug: "article-id"}) && !f(&types.Favorite{Slug: "other"})
+	})).
+		Return(1, nil)
+	service := MockUserService{}
+	service.On("GetByEmail", ctx, email).
+		Return(types.User{Profile: types.Profile{Username: email}}, nil)
+	var transactions int
+	as := ArticleService{
+		ArticleRepository:  &mockArticleRepo,
+		CommentRepository:  &mockCommentRepo,
+		FavoriteRepository: &mockFavoriteRepo,
+		Transaction:        recordTransaction(&transactions),
+		UserService:        &service,
+	}
+	assert.Nil(t, as.Delete(ctx, "article"))
+	assert.Equal(t, 1, transactions)
+	mockArticleRepo.AssertExpectations(t)
+	mockCommentRepo.AssertExpectations(t)
+	mockFavoriteRepo.AssertExpectations(t)
+}
+
+func TestArticleService_RestoreArticle(t *testing.T) {
+	const (
+		email = "test@email.com"
+	)
+	expectedSlug := "test-slug" + xid.New().String()
+
+	ctx := context.Background()
+
+	deletedAt := time.Now().Add(-time.Hour)
+	deletedArticle := types.Article{
+		Slug: expectedSlug,
+		Author: types.Profile{
+			Username: email,
+		},
+		DeletedAt: &deletedAt,
+	}
+	restoredArticle := deletedArticle
+	restoredArticle.DeletedAt = nil
+
+	mockArticleTrash := MockTrash[*types.Article]{}
+	mockArticleTrash.On("Get", ctx, expectedSlug).
+		Return(&deletedArticle, nil)
+	mockArticleTrash.On("Restore", ctx, expectedSlug).
+		Return(&restoredArticle, nil)
+	earlier := deletedAt.Add(-time.Minute)
+	later := deletedAt.Add(time.Millisecond)
+	var before, with types.Comment
+	before.ID, before.Slug, before.DeletedAt = 4, expectedSlug, &earlier
+	with.ID, with.Slug, with.DeletedAt = 2, expectedSlug, &later
+	mockCommentTrash := MockTrash[*types.Comment]{}
+	mockCommentTrash.On("GetFiltered", ctx, mock.MatchedBy(func(f persistTypes.Filter[*types.Comment]) bool {
+		return f(&types.Comment{Slug: expectedSlug}) && !f(&types.Comment{Slug: "other"})
+	})).
+		Return([]*types.Comment{&before, &with}, nil)
+	mockCommentTrash.On("Restore", ctx, with.Key()).
+		Return(&with, nil)
+	// the favorites removed before the article stay deleted
+	favorite := types.Favorite{Slug: expectedSlug, Username: "reader", DeletedAt: &later}
+	mockFavoriteTrash := MockTrash[*types.Favorite]{}
+	mockFavoriteTrash.On("GetFiltered", ctx, mock.MatchedBy(func(f persistTypes.Filter[*types.Favorite]) bool {
+		return f(&favorite) && !f(&types.Favorite{Slug: expectedSlug, DeletedAt: &earlier}) &&
+			!f(&types.Favorite{Slug: "other", DeletedAt: &later})
+	})).
+		Return([]*types.Favorite{&favorite}, nil)
+	mockFavoriteTrash.On("Restore", ctx, favorite.Key()).
+		Return(&favorite, nil)
+	// the comment sequence is advanced past the comments in the trash
+	mockCommentRepo := MockRepository[*types.Comment]{}
+	mockCommentRepo.On("Sequence", ctx, expectedSlug).Return(0, nil).Once()
+	mockCommentRepo.On("Sequence", ctx, expectedSlug).Return(4, nil).Once()
+	service := MockUserService{}
+	service.On("GetByEmail", ctx, email).
+		Return(types.User{
+			Profile: types.Profile{
+				Username: email,
+			},
+		}, nil)
+	var transactions int
+	as := ArticleService{
+		CommentRepository: &mockCommentRepo,
+		ArticleTrash:      &mockArticleTrash,
+		CommentTrash:      &mockCommentTrash,
+		FavoriteTrash:     &mockFavoriteTrash,
+		Transaction:       recordTransaction(&transactions),
+		TrashRetention:    24 * time.Hour,
+		UserService:       &service,
+	}
+	article, err := as.RestoreArticle(ctx, expectedSlug, email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, expectedSlug, article.Slug)
+	assert.Nil(t, article.DeletedAt)
+	assert.Equal(t, 1, transactions)
+	mockArticleTrash.AssertExpectations(t)
+	mockCommentTrash.AssertExpectations(t)
+	mockFavoriteTrash.AssertExpectations(t)
+	mockCommentRepo.AssertExpectations(t)
+	mockCommentTrash.AssertNotCalled(t, "Restore", ctx, before.Key())
+}
+
+func TestArticleService_RestoreArticleErrors(t *testing.T) {
+	const (
+		email = "test@email.com"
+	)
+	expectedSlug := "test-slug" + xid.New().String()
+
+	ctx := context.Background()
+
+	deletedAt := time.Now().Add(-48 * time.Hour)
+	deletedArticle := types.Article{
+		Slug: expectedSlug,
+		Author: types.Profile{
+			Username: "other",
+		},
+		DeletedAt: &deletedAt,
+	}
+
+	mockArticleTrash := MockTrash[*types.Article]{}
+	mockArticleTrash.On("Get", ctx, expectedSlug).
+		Return(&deletedArticle, nil)
+	service := MockUserService{}
+	service.On("GetByEmail", ctx, email).
+		Return(types.User{
+			Profile: types.Profile{
+				Username: email,
+			},
+		}, nil)
+	as := ArticleService{
+		ArticleTrash:   &mockArticleTrash,
+		TrashRetention: 24 * time.Hour,
+		UserService:    &service,
+	}
+	_, err := as.RestoreArticle(ctx, expectedSlug, email)
+	var thing *broken.Thing
+	if assert.ErrorAs(t, err, &thing) {
+		assert.Equal(t, broken.TypeForbidden, thing.Type)
+	}
+
+	deletedArticle.Author.Username = email
+	_, err = as.RestoreArticle(ctx, expectedSlug, email)
+	assert.ErrorIs(t, err, ErrRetentionExpired)
+	mockArticleTrash.AssertNotCalled(t, "Restore", ctx, expectedSlug)
+}
+
+func TestArticleService_RestoreCommentOfDeletedArticle(t *testing.T) {
+	const email = "test@email.com"
+	ctx := context.Background()
+
+	mockArticleRepo := MockRepository[*types.Article]{}
+	mockSlugRepo := MockRepository[*types.SlugAlias]{}
+	mockCommentTrash := MockTrash[*types.Comment]{}
+	mockArticleRepo.On("Get", ctx, "deleted").
+		Return(nil, persistTypes.ErrNotFound)
+	mockSlugRepo.On("Get", ctx, "deleted").
+		Return(nil, persistTypes.ErrNotFound)
+	service := MockUserService{}
+	service.On("GetByEmail", ctx, email).
+		Return(types.User{Profile: types.Profile{Username: email}}, nil)
+	as := ArticleService{
+		ArticleRepository: &mockArticleRepo,
+		SlugRepository:    &mockSlugRepo,
+		CommentTrash:      &mockCommentTrash,
+		TrashRetention:    24 * time.Hour,
+		UserService:       &service,
+	}
+
+	_, err := as.RestoreComment(ctx, "deleted", 1, email)
+	assert.ErrorIs(t, err, ErrArticleDeleted)
+	mockCommentTrash.AssertNotCalled(t, "Restore", mock.Anything, mock.Anything)
+}
+
+func TestArticleService_CreateSlugCollision(t *testing.T) {
+	const email = "test@email.com"
+	ctx := context.Background()
+
+	mockArticleRepo := MockRepository[*types.Article]{}
+	mockSlugRepo := MockRepository[*types.SlugAlias]{}
+	mockArticleTrash := MockTrash[*types.Article]{}
+	mockArticleTrash.On("Get", ctx, "how-to-train-your-dragon").
+		Return(nil, persist.ErrNotDeleted)
+	mockArticleTrash.On("Get", ctx, "how-to-train-your-dragon-2").
+		Return(&types.Article{}, nil)
+	mockArticleTrash.On("Get", ctx, "how-to-train-your-dragon-3").
+		Return(nil, persistTypes.ErrNotFound)
+	mockSlugRepo.On("Get", ctx, "how-to-train-your-dragon-3").
+		Return(&types.SlugAlias{}, nil)
+	mockArticleTrash.On("Get", ctx, "how-to-train-your-dragon-4").
+		Return(nil, persistTypes.ErrNotFound)
+	mockSlugRepo.On("Get", ctx, "how-to-train-your-dragon-4").
+		Return(nil, persistTypes.ErrNotFound)
+	var saved *types.Article
+	mockArticleRepo.On("Save", ctx, mock.Anything).
+		Run(func(args mock.Arguments) {
+			saved = args.Get(1).(*types.Article)
+		}).
+		Return(&types.Article{}, nil)
+	service := MockUserService{}
+	service.On("GetByEmail", ctx, email).
+		Return(types.User{}, nil)
+	as := ArticleService{
+		ArticleRepository:  &mockArticleRepo,
+		SlugRepository:     &mockSlugRepo,
+		RevisionRepository: acceptRevisions(),
+		ArticleTrash:       &mockArticleTrash,
+		UserService:        &service,
+	}
+	_, err := as.Create(ctx, types.ArticleRequest{
+		Title: "How to Train Your Dragon",
+	}, email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "how-to-train-your-dragon-4", saved.Slug,
+		"the slugs of the stored, deleted and renamed articles are taken")
+	assert.Equal(t, saved.Slug, saved.ID)
+}
+
+func TestArticleService_UpdateTitle(t *testing.T) {
+	const email = "test@email.com"
+	ctx := context.WithValue(context.Background(), "email", email)
+	existing := &types.Article{
+		Slug:  "old-title",
+		Title: "Old title",
+		Author: types.Profile{
+			Username: "author",
+		},
+	}
+
+	mockArticleRepo := MockRepository[*types.Article]{}
+	mockSlugRepo := MockRepository[*types.SlugAlias]{}
+	mockArticleTrash := MockTrash[*types.Article]{}
+	mockArticleRepo.On("Get", ctx, "old-title").
+		Return(existing, nil)
+	mockArticleTrash.On("Get", ctx, "new-title").
+		Return(nil, persistTypes.ErrNotFound)
+	mockSlugRepo.On("Get", ctx, "new-title").
+		Return(nil, persistTypes.ErrNotFound)
+	mockSlugRepo.On("Save", ctx, &types.SlugAlias{Slug: "new-title", ArticleID: "old-title"}).
+		Return(&types.SlugAlias{}, nil)
+	mockArticleRepo.On("Save", ctx, mock.MatchedBy(func(a *types.Article) bool {
+		return a.Key() == "old-title" && a.Slug == "new-title"
+	})).
+		Return(existing, nil)
+	service := MockUserService{}
+	service.On("GetByEmail", ctx, email).
+		Return(types.User{Email: email, Profile: types.Profile{Username: "author"}}, nil)
+	as := ArticleService{
+		ArticleRepository:  &mockArticleRepo,
+		SlugRepository:     &mockSlugRepo,
+		RevisionRepository: acceptRevisions(),
+		ArticleTrash:       &mockArticleTrash,
+		UserService:        &service,
+	}
+	article, err := as.Update(ctx, "old-title", types.ArticleRequest{
+		Title: "New title",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "new-title", article.Slug)
+	assert.Equal(t, "old-title", article.ID, "the key of the article doesn't change")
+	mockSlugRepo.AssertExpectations(t)
+
+	// the same slug is kept when only the case or the punctuation changes
+	_, err = as.Update(ctx, "old-title", types.ArticleRequest{
+		Title: "NEW title!",
+	})
+	assert.Nil(t, err)
+	mockSlugRepo.AssertNumberOfCalls(t, "Save", 1)
+
+	// the first slug is the key of the article, it gets it back
+	mockSlugRepo.On("Save", ctx, &types.SlugAlias{Slug: "old-title", ArticleID: "old-title"}).
+		Return(&types.SlugAlias{}, nil)
+	mockArticleRepo.On("Save", ctx, mock.MatchedBy(func(a *types.Article) bool {
+		return a.Key() == "old-title" && a.Slug == "old-title"
+	})).
+		Return(existing, nil)
+	article, err = as.Update(ctx, "old-title", types.ArticleRequest{
+		Title: "Old title",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "old-title", article.Slug)
+}
+
+func TestArticleService_UpdateRetried(t *testing.T) {
+	const email = "test@email.com"
+	ctx := context.WithValue(context.Background(), "email", email)
+	stored := func() *types.Article {
+		return &types.Article{
+			Slug:     "old-title",
+			Title:    "Old title",
+			Revision: 1,
+			Author:   types.Profile{Username: "author"},
+		}
+	}
+
+	mockArticleRepo := MockRepository[*types.Article]{}
+	mockSlugRepo := MockRepository[*types.SlugAlias]{}
+	mockRevisionRepo := MockRepository[*types.Revision]{}
+	mockArticleTrash := MockTrash[*types.Article]{}
+	// every read returns a record of its own, like the backends do
+	for i := 0; i < 3; i++ {
+		mockArticleRepo.On("Get", ctx, "old-title").Return(stored(), nil).Once()
+	}
+	mockArticleTrash.On("Get", ctx, "new-title").Return(nil, persistTypes.ErrNotFound)
+	mockSlugRepo.On("Get", ctx, "new-title").Return(nil, persistTypes.ErrNotFound)
+	mockSlugRepo.On("Save", ctx, &types.SlugAlias{Slug: "new-title", ArticleID: "old-title"}).
+		Return(&types.SlugAlias{}, nil)
+	mockRevisionRepo.On("Get", ctx, "old-title-1").Return(&types.Revision{}, nil)
+	mockRevisionRepo.On("Get", ctx, "old-title-2").Return(nil, persistTypes.ErrNotFound)
+	mockRevisionRepo.On("Save", ctx, mock.MatchedBy(func(r *types.Revision) bool {
+		return r.Number == 2
+	})).
+		Return(&types.Revision{}, nil)
+	saved := &types.Article{}
+	mockArticleRepo.On("Save", ctx, mock.MatchedBy(func(a *types.Article) bool {
+		return a.Slug == "new-title" && a.Revision == 2
+	})).
+		Run(func(args mock.Arguments) {
+			*saved = *args.Get(1).(*types.Article)
+		}).
+		Return(saved, nil)
+	service := MockUserService{}
+	service.On("GetByEmail", ctx, email).
+		Return(types.User{Email: email, Profile: types.Profile{Username: "author"}}, nil)
+	as := ArticleService{
+		ArticleRepository:  &mockArticleRepo,
+		SlugRepository:     &mockSlugRepo,
+		RevisionRepository: &mockRevisionRepo,
+		ArticleTrash:       &mockArticleTrash,
+		UserService:        &service,
+		// the first attempt conflicts on its commit and is repeated
+		Transaction: func(ctx context.Context, fn func(ctx context.Context) error) error {
+			if err := fn(ctx); err != nil {
+				return err
+			}
+			return fn(ctx)
+		},
+	}
+
+	article, err := as.Update(ctx, "old-title", types.ArticleRequest{Title: "New title"})
+	assert.Nil(t, err)
+	assert.Equal(t, "new-title", article.Slug)
+	assert.Equal(t, 2, article.Revision)
+	mockSlugRepo.AssertNumberOfCalls(t, "Save", 2)
+	mockRevisionRepo.AssertNumberOfCalls(t, "Save", 2)
+}
+
+func TestArticleService_SlugTaken(t *testing.T) {
+	ctx := context.Background()
+	mockSlugRepo := MockRepository[*types.SlugAlias]{}
+	mockArticleTrash := MockTrash[*types.Article]{}
+	mockArticleTrash.On("Get", ctx, "former").
+		Return(nil, persistTypes.ErrNotFound)
+	mockSlugRepo.On("Get", ctx, "former").
+		Return(&types.SlugAlias{Slug: "former", ArticleID: "article"}, nil)
+	as := ArticleService{
+		SlugRepository: &mockSlugRepo,
+		ArticleTrash:   &mockArticleTrash,
+	}
+
+	taken, err := as.slugTaken(ctx, "former", "article")
+	assert.Nil(t, err)
+	assert.False(t, taken, "a former slug is free for its own article")
+	taken, err = as.slugTaken(ctx, "former", "other")
+	assert.Nil(t, err)
+	assert.True(t, taken)
+	taken, err = as.slugTaken(ctx, "former", "")
+	assert.Nil(t, err)
+	assert.True(t, taken, "taken for the new articles")
+}
+
+func TestArticleService_GetMoved(t *testing.T) {
+	ctx := context.Background()
+	article := &types.Article{
+		ID:   "first-title",
+		Slug: "current-title",
+	}
+
+	mockArticleRepo := MockRepository[*types.Article]{}
+	mockSlugRepo := MockRepository[*types.SlugAlias]{}
+	mockArticleRepo.On("Get", ctx, "first-title").
+		Return(article, nil)
+	mockArticleRepo.On("Get", ctx, "second-title").
+		Return(nil, persistTypes.ErrNotFound)
+	mockArticleRepo.On("Get", ctx, "current-title").
+		Return(nil, persistTypes.ErrNotFound)
+	mockArticleRepo.On("Get", ctx, "missing").
+		Return(nil, persistTypes.ErrNotFound)
+	mockSlugRepo.On("Get", ctx, "second-title").
+		Return(&types.SlugAlias{Slug: "second-title", ArticleID: "first-title"}, nil)
+	mockSlugRepo.On("Get", ctx, "current-title").
+		Return(&types.SlugAlias{Slug: "current-title", ArticleID: "first-title"}, nil)
+	mockSlugRepo.On("Get", ctx, "missing").
+		Return(nil, persistTypes.ErrNotFound)
+	mockFavoriteRepo := MockRepository[*types.Favorite]{}
+	mockFavoriteRepo.On("GetFiltered", ctx, mock.Anything).
+		Return([]*types.Favorite{{Slug: "first-title", Username: "a"}, {Slug: "first-title", Username: "b"}}, nil)
+	as := ArticleService{
+		ArticleRepository:  &mockArticleRepo,
+		FavoriteRepository: &mockFavoriteRepo,
+		SlugRepository:     &mockSlugRepo,
+	}
+
+	got, err := as.Get(ctx, "current-title")
+	assert.Nil(t, err)
+	assert.Equal(t, "current-title", got.Slug)
+	assert.Equal(t, 2, got.FavoritesCount)
+
+	for _, former := range []string{"first-title", "second-title"} {
+		_, err = as.Get(ctx, former)
+		var moved *ArticleMovedError
+		if assert.ErrorAs(t, err, &moved, former) {
+			assert.Equal(t, "current-title", moved.Slug)
+		}
+	}
+
+	_, err = as.Get(ctx, "missing")
+	assert.ErrorIs(t, err, persistTypes.ErrNotFound)
+}
+
+func TestArticleService_GetAllViewer(t *testing.T) {
+	const email = "reader@email.com"
+	ctx := context.WithValue(context.Background(), "email", email)
+	articles := []*types.Article{
+		{Slug: "first", Author: types.Profile{Username: "followed"}},
+		{Slug: "second", Author: types.Profile{Username: "other"}},
+		{Slug: "third", Author: types.Profile{Username: "followed"}},
+	}
+
+	mockArticleRepo := MockRepository[*types.Article]{}
+	mockFavoriteRepo := MockRepository[*types.Favorite]{}
+	mockFollowRepo := MockRepository[*types.Follow]{}
+	mockArticleRepo.On("GetFiltered", ctx).
+		Return(articles, nil)
+	mockFavoriteRepo.On("GetFiltered", ctx, mock.MatchedBy(func(f persistTypes.Filter[*types.Favorite]) bool {
+		return f(&types.Favorite{Slug: "first"}) && f(&types.Favorite{Slug: "third"}) && !f(&types.Favorite{Slug: "fourth"})
+	})).
+		Return([]*types.Favorite{{Slug: "second", Username: "reader"}, {Slug: "second", Username: "other"}, {Slug: "third", Username: "other"}}, nil)
+	mockFavoriteRepo.On("GetMany", ctx, []string{"first/reader", "second/reader", "third/reader"}).
+		Return([]*types.Favorite{{Slug: "second", Username: "reader"}}, nil)
+	mockFollowRepo.On("GetMany", ctx, []string{"reader-followed", "reader-other"}).
+		Return([]*types.Follow{{From: "reader", To: "followed"}}, nil)
+	service := MockUserService{}
+	service.On("GetByEmail", ctx, email).
+		Return(types.User{Email: email, Profile: types.Profile{Username: "reader"}}, nil)
+	as := ArticleService{
+		ArticleRepository:  &mockArticleRepo,
+		FavoriteRepository: &mockFavoriteRepo,
+		FollowRepository:   &mockFollowRepo,
+		UserService:        &service,
+	}
+	results, _, err := as.GetAll(ctx, "", "", "", "", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var favorited, following []bool
+	var counts []int
+	for _, a := range results {
+		favorited = append(favorited, a.Favorited)
+		following = append(following, a.Author.Following)
+		counts = append(counts, a.FavoritesCount)
+	}
+	assert.Equal(t, []bool{false, true, false}, favorited)
+	assert.Equal(t, []bool{true, false, true}, following)
+	assert.Equal(t, []int{0, 2, 1}, counts)
+	mockFavoriteRepo.AssertNumberOfCalls(t, "GetFiltered", 1)
+	mockFavoriteRepo.AssertNumberOfCalls(t, "GetMany", 1)
+	mockFollowRepo.AssertNumberOfCalls(t, "GetMany", 1)
+}
+
+func TestArticleService_GetAllDeletedViewer(t *testing.T) {
+	const email = "deleted@email.com"
+	ctx := context.WithValue(context.Background(), "email", email)
+	article := &types.Article{Slug: "first", Author: types.Profile{Username: "author"}}
+
+	mockArticleRepo := MockRepository[*types.Article]{}
+	mockFavoriteRepo := MockRepository[*types.Favorite]{}
+	mockArticleRepo.On("GetFiltered", ctx).
+		Return([]*types.Article{article}, nil)
+	mockFavoriteRepo.On("GetFiltered", ctx, mock.Anything).
+		Return([]*types.Favorite{}, nil)
+	service := MockUserService{}
+	service.On("GetByEmail", ctx, email).
+		Return(types.User{}, persistTypes.ErrNotFound)
+	as := ArticleService{
+		ArticleRepository:  &mockArticleRepo,
+		FavoriteRepository: &mockFavoriteRepo,
+		UserService:        &service,
+	}
+	results, _, err := as.GetAll(ctx, "", "", "", "", 10, 0)
+	assert.Nil(t, err, "the token of a deleted user reads anonymously")
+	assert.Equal(t, []*types.Article{article}, results)
+}
+
+func TestArticleService_reduceResultOffset(t *testing.T) {
+	results := []*types.Article{{Slug: "a"}, {Slug: "b"}, {Slug: "c"}}
+	var as ArticleService
+	page, total := as.reduceResult(results, 2, 1)
+	assert.Equal(t, []*types.Article{{Slug: "b"}, {Slug: "c"}}, page)
+	assert.Equal(t, 3, total)
+	page, total = as.reduceResult(results, 2, 5)
+	assert.Empty(t, page)
+	assert.Equal(t, 3, total)
 }
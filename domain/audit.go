@@ -0,0 +1,188 @@
+package domain
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/borosr/realworld/lib/api"
+	"github.com/borosr/realworld/persist"
+	persistTypes "github.com/borosr/realworld/persist/types"
+	"github.com/borosr/realworld/types"
+)
+
+const (
+	auditSequence     = "audit"
+	defaultAuditLimit = 100
+	// auditPageSize is the number of the entries read at once by a query
+	auditPageSize = 500
+)
+
+// ActionImport is the action of the entries recording an import
+const ActionImport = "import"
+
+type AuditDescriptor interface {
+	Query(ctx context.Context, q AuditQuery) ([]*types.AuditEntry, error)
+}
+
+type AuditService struct {
+	AuditRepository persist.Ranged[*types.AuditEntry]
+}
+
+// AuditQuery selects the entries, the empty fields match every entry
+type AuditQuery struct {
+	Actor string
+	Type  string
+	Key   string
+	From  time.Time
+	To    time.Time
+	Limit int
+}
+
+// Audit records the changes of a type in the audit log, the actor and the
+// request id are taken from the context of the change. The entry is written
+// in the transaction of the change, so a change is never committed without
+// its entry.
+func Audit[Type persistTypes.Storable](as AuditService) {
+	persist.Observe[Type](func(ctx context.Context, e persist.Event[Type]) error {
+		changes, err := diff(e.Before, e.After, e.Operation)
+		if err != nil {
+			return fmt.Errorf("audit diff of %s %s: %w", e.Name, e.Key, err)
+		}
+		return as.Record(ctx, &types.AuditEntry{
+			Action:    string(e.Operation),
+			Type:      e.Name,
+			RecordKey: e.Key,
+			Changes:   changes,
+			CreatedAt: e.Time,
+		})
+	})
+}
+
+// RecordImport records the number of the imported records of every type, the
+// imports write the records directly into the backend without change events
+func (as AuditService) RecordImport(ctx context.Context, counts map[string]uint64) error {
+	var names = make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := as.Record(ctx, &types.AuditEntry{
+			Action:  ActionImport,
+			Type:    name,
+			Records: counts[name],
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Record appends an entry to the audit log
+func (as AuditService) Record(ctx context.Context, entry *types.AuditEntry) error {
+	id, err := as.AuditRepository.Sequence(ctx, auditSequence)
+	if err != nil {
+		return err
+	}
+	entry.ID = id
+	entry.Actor, _ = api.GetValue[string](ctx, "email")
+	entry.RequestID, _ = api.GetValue[string](ctx, "requestID")
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	_, err = as.AuditRepository.Save(ctx, entry)
+	return err
+}
+
+// Query returns the matching entries, the latest first. The log is read
+// backwards in pages until the limit is reached, so the latest entries are
+// found without reading the whole log.
+func (as AuditService) Query(ctx context.Context, q AuditQuery) ([]*types.AuditEntry, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultAuditLimit
+	}
+	var entries = make([]*types.AuditEntry, 0)
+	var before string
+	for {
+		page, err := as.AuditRepository.GetRangeBefore(ctx, before, auditPageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range page {
+			if q.matches(e) {
+				entries = append(entries, e)
+				if len(entries) == limit {
+					return entries, nil
+				}
+			}
+		}
+		if len(page) < auditPageSize {
+			return entries, nil
+		}
+		before = page[len(page)-1].Key()
+	}
+}
+
+func (q AuditQuery) matches(e *types.AuditEntry) bool {
+	return (q.Actor == "" || e.Actor == q.Actor) &&
+		(q.Type == "" || e.Type == q.Type) &&
+		(q.Key == "" || e.RecordKey == q.Key) &&
+		(q.From.IsZero() || !e.CreatedAt.Before(q.From)) &&
+		(q.To.IsZero() || e.CreatedAt.Before(q.To))
+}
+
+// diff compares the top level JSON fields of the records
+func diff[Type persistTypes.Storable](before, after Type, operation persist.Operation) ([]types.FieldChange, error) {
+	var old, current map[string]json.RawMessage
+	if operation != persist.OperationCreate {
+		if err := unmarshalFields(before, &old); err != nil {
+			return nil, err
+		}
+	}
+	if operation != persist.OperationDelete {
+		if err := unmarshalFields(after, &current); err != nil {
+			return nil, err
+		}
+	}
+	var fields = make(map[string]struct{}, len(old)+len(current))
+	for f := range old {
+		fields[f] = struct{}{}
+	}
+	for f := range current {
+		fields[f] = struct{}{}
+	}
+	for f := range fields {
+		if bytes.Equal(old[f], current[f]) {
+			delete(fields, f)
+		}
+	}
+	// the secret fields are never written into the audit log, they are
+	// compared before they are redacted
+	persist.Redact(before, old)
+	persist.Redact(after, current)
+	var changes []types.FieldChange
+	for f := range fields {
+		changes = append(changes, types.FieldChange{
+			Field:  f,
+			Before: old[f],
+			After:  current[f],
+		})
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+	return changes, nil
+}
+
+func unmarshalFields(record any, fields *map[string]json.RawMessage) error {
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, fields)
+}
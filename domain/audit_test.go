@@ -0,0 +1,126 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/borosr/realworld/persist"
+	"github.com/borosr/realworld/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAuditService_Record(t *testing.T) {
+	ctx := context.WithValue(context.Background(), "email", "admin@email.com")
+	ctx = context.WithValue(ctx, "requestID", "req-1")
+	mockRepo := MockRepository[*types.AuditEntry]{}
+	mockRepo.On("Sequence", ctx, auditSequence).Return(7, nil)
+	mockRepo.On("Save", ctx, mock.MatchedBy(func(e *types.AuditEntry) bool {
+		return e.ID == 7 &&
+			e.Actor == "admin@email.com" &&
+			e.RequestID == "req-1" &&
+			e.Action == "delete" &&
+			!e.CreatedAt.IsZero()
+	})).Return(&types.AuditEntry{}, nil)
+	as := AuditService{
+		AuditRepository: &mockRepo,
+	}
+	err := as.Record(ctx, &types.AuditEntry{
+		Action:    "delete",
+		Type:      "article",
+		RecordKey: "some-slug",
+	})
+	assert.Nil(t, err)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestAuditService_Query(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := MockRepository[*types.AuditEntry]{}
+	mockRepo.On("GetRangeBefore", ctx, "", auditPageSize).
+		Return([]*types.AuditEntry{{ID: 4, Type: "user"}, {ID: 3}, {ID: 2}, {ID: 1}}, nil)
+	as := AuditService{
+		AuditRepository: &mockRepo,
+	}
+
+	res, err := as.Query(ctx, AuditQuery{Limit: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.AuditEntry{{ID: 4, Type: "user"}, {ID: 3}}, res, "the latest first")
+	res, err = as.Query(ctx, AuditQuery{Type: "user"})
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.AuditEntry{{ID: 4, Type: "user"}}, res)
+	mockRepo.AssertNumberOfCalls(t, "GetRangeBefore", 2)
+}
+
+func TestAuditService_RecordImport(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := MockRepository[*types.AuditEntry]{}
+	mockRepo.On("Sequence", ctx, auditSequence).Return(1, nil)
+	var recorded []string
+	mockRepo.On("Save", ctx, mock.MatchedBy(func(e *types.AuditEntry) bool {
+		return e.Action == ActionImport
+	})).
+		Run(func(args mock.Arguments) {
+			e := args.Get(1).(*types.AuditEntry)
+			recorded = append(recorded, e.Type+":"+strconv.FormatUint(e.Records, 10))
+		}).
+		Return(&types.AuditEntry{}, nil)
+	as := AuditService{
+		AuditRepository: &mockRepo,
+	}
+	assert.Nil(t, as.RecordImport(ctx, map[string]uint64{"user": 2, "article": 5}))
+	assert.Equal(t, []string{"article:5", "user:2"}, recorded)
+}
+
+func TestAuditQuery_Matches(t *testing.T) {
+	now := time.Now()
+	entry := &types.AuditEntry{
+		Actor:     "a@email.com",
+		Type:      "article",
+		RecordKey: "x",
+		CreatedAt: now,
+	}
+	assert.True(t, AuditQuery{}.matches(entry))
+	assert.True(t, AuditQuery{Actor: "a@email.com", Type: "article", Key: "x"}.matches(entry))
+	assert.False(t, AuditQuery{Actor: "b@email.com"}.matches(entry))
+	assert.False(t, AuditQuery{Type: "comment"}.matches(entry))
+	assert.False(t, AuditQuery{Key: "y"}.matches(entry))
+	assert.True(t, AuditQuery{From: now, To: now.Add(time.Second)}.matches(entry))
+	assert.False(t, AuditQuery{From: now.Add(time.Second)}.matches(entry))
+	assert.False(t, AuditQuery{To: now}.matches(entry), "to is exclusive")
+}
+
+func TestDiff(t *testing.T) {
+	before := &types.User{
+		Email:    "test@email.com",
+		Password: "old hash",
+		Profile: types.Profile{
+			Username: "test",
+			Bio:      "old bio",
+		},
+	}
+	after := &types.User{
+		Email:    "test@email.com",
+		Password: "new hash",
+		Profile: types.Profile{
+			Username: "test",
+			Bio:      "new bio",
+		},
+	}
+	changes, err := diff(before, after, persist.OperationUpdate)
+	assert.Nil(t, err)
+	assert.Equal(t, []types.FieldChange{
+		{Field: "bio", Before: json.RawMessage(`"old bio"`), After: json.RawMessage(`"new bio"`)},
+		{Field: "password", Before: persist.Redacted, After: persist.Redacted},
+	}, changes)
+
+	changes, err = diff(nil, after, persist.OperationCreate)
+	assert.Nil(t, err)
+	for _, c := range changes {
+		assert.Nil(t, c.Before, c.Field)
+		assert.NotNil(t, c.After, c.Field)
+	}
+}
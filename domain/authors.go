@@ -0,0 +1,297 @@
+package domain
+
+import (
+	"context"
+	"sort"
+
+	"github.com/borosr/realworld/persist"
+	"github.com/borosr/realworld/types"
+)
+
+// AuthorSync keeps the profiles embedded in the articles and comments in sync
+// with the users, and moves the follows, favorites and feeds of the renamed
+// users
+type AuthorSync struct {
+	UserRepository     persist.Repository[*types.User]
+	ArticleRepository  persist.Repository[*types.Article]
+	CommentRepository  persist.Repository[*types.Comment]
+	FollowRepository   persist.Repository[*types.Follow]
+	FavoriteRepository persist.Repository[*types.Favorite]
+	ArticleTrash       persist.Trash[*types.Article]
+	CommentTrash       persist.Trash[*types.Comment]
+	FavoriteTrash      persist.Trash[*types.Favorite]
+	FeedService        FeedService
+	Transaction        TransactionFunc
+}
+
+// Drift is an embedded author profile which differs from the profile of its
+// user, User is empty when no user has the username of the author
+type Drift struct {
+	Type     string        `json:"type"`
+	Key      string        `json:"key"`
+	Embedded types.Profile `json:"embedded"`
+	User     types.Profile `json:"user"`
+}
+
+// SyncAuthors propagates the profile changes of the users in the transaction
+// of the change, a failing propagation fails the update of the user
+func SyncAuthors(as AuthorSync) {
+	persist.Observe[*types.User](func(ctx context.Context, e persist.Event[*types.User]) error {
+		if e.Operation != persist.OperationUpdate || sameProfile(e.Before.Profile, e.After.Profile) {
+			return nil
+		}
+		_, err := as.Propagate(ctx, e.Before.Profile, e.After.Profile)
+		return err
+	})
+}
+
+// Propagate rewrites the author profiles of the articles and comments of the
+// user in one transaction, the deleted ones included. Renaming moves the
+// follows, favorites and feeds of the user too. It returns the number of the
+// rewritten records.
+func (as AuthorSync) Propagate(ctx context.Context, before, after types.Profile) (uint64, error) {
+	var count uint64
+	err := as.Transaction.run(ctx, func(ctx context.Context) error {
+		var err error
+		count, err = as.propagate(ctx, before, after)
+		return err
+	})
+	return count, err
+}
+
+func (as AuthorSync) propagate(ctx context.Context, before, after types.Profile) (uint64, error) {
+	profile := embedded(after)
+	byArticleAuthor := func(a *types.Article) bool {
+		return a.Author.Username == before.Username
+	}
+	articles, err := as.ArticleRepository.GetFiltered(ctx, byArticleAuthor)
+	if err != nil {
+		return 0, err
+	}
+	for _, a := range articles {
+		a.Author = profile
+	}
+	if _, err := as.ArticleRepository.SaveMany(ctx, articles); err != nil {
+		return 0, err
+	}
+	trashedArticles, err := as.ArticleTrash.GetFiltered(ctx, byArticleAuthor)
+	if err != nil {
+		return 0, err
+	}
+	if len(trashedArticles) > 0 {
+		for _, a := range trashedArticles {
+			a.Author = profile
+		}
+		if _, err := as.ArticleTrash.SaveMany(ctx, trashedArticles); err != nil {
+			return 0, err
+		}
+	}
+	byCommentAuthor := func(c *types.Comment) bool {
+		return c.Author.Username == before.Username
+	}
+	comments, err := as.CommentRepository.GetFiltered(ctx, byCommentAuthor)
+	if err != nil {
+		return 0, err
+	}
+	for _, c := range comments {
+		c.Author = profile
+	}
+	if _, err := as.CommentRepository.SaveMany(ctx, comments); err != nil {
+		return 0, err
+	}
+	trashedComments, err := as.CommentTrash.GetFiltered(ctx, byCommentAuthor)
+	if err != nil {
+		return 0, err
+	}
+	if len(trashedComments) > 0 {
+		for _, c := range trashedComments {
+			c.Author = profile
+		}
+		if _, err := as.CommentTrash.SaveMany(ctx, trashedComments); err != nil {
+			return 0, err
+		}
+	}
+	count := uint64(len(articles) + len(trashedArticles) + len(comments) + len(trashedComments))
+	if before.Username == after.Username {
+		return count, nil
+	}
+	moved, err := as.rename(ctx, before.Username, after.Username)
+	return count + moved, err
+}
+
+// rename moves the feeds, follows and favorites, their keys contain the
+// username. The feed and the timeline of the user are moved before the
+// follows, so the feed observers move the items of the follows to the new
+// username.
+func (as AuthorSync) rename(ctx context.Context, from, to string) (uint64, error) {
+	if err := as.FeedService.move(ctx, from, to); err != nil {
+		return 0, err
+	}
+	follows, err := as.FollowRepository.GetFiltered(ctx, func(f *types.Follow) bool {
+		return f.From == from || f.To == from
+	})
+	if err != nil {
+		return 0, err
+	}
+	var renamedFollows = make([]*types.Follow, 0, len(follows))
+	for _, f := range follows {
+		if err := as.FollowRepository.Delete(ctx, f.Key()); err != nil {
+			return 0, err
+		}
+		renamed := *f
+		if renamed.From == from {
+			renamed.From = to
+		}
+		if renamed.To == from {
+			renamed.To = to
+		}
+		renamedFollows = append(renamedFollows, &renamed)
+	}
+	if _, err := as.FollowRepository.SaveMany(ctx, renamedFollows); err != nil {
+		return 0, err
+	}
+	// emptied by the removed follows
+	if err := as.FeedService.FollowIndexRepository.Delete(ctx, from); err != nil {
+		return 0, err
+	}
+	byUsername := func(f *types.Favorite) bool {
+		return f.Username == from
+	}
+	favorites, err := as.FavoriteRepository.GetFiltered(ctx, byUsername)
+	if err != nil {
+		return 0, err
+	}
+	// the favorites of the deleted articles move too, so they are restored
+	// with the new username
+	trashedFavorites, err := as.FavoriteTrash.GetFiltered(ctx, byUsername)
+	if err != nil {
+		return 0, err
+	}
+	// deleting would leave tombstones behind at the old keys
+	if _, err := as.FavoriteTrash.Remove(ctx, byUsername); err != nil {
+		return 0, err
+	}
+	if _, err := as.FavoriteRepository.SaveMany(ctx, renamedFavorites(favorites, to)); err != nil {
+		return 0, err
+	}
+	if len(trashedFavorites) > 0 {
+		if _, err := as.FavoriteTrash.SaveMany(ctx, renamedFavorites(trashedFavorites, to)); err != nil {
+			return 0, err
+		}
+	}
+	return uint64(len(follows) + len(favorites) + len(trashedFavorites)), nil
+}
+
+func renamedFavorites(favorites []*types.Favorite, username string) []*types.Favorite {
+	var res = make([]*types.Favorite, 0, len(favorites))
+	for _, f := range favorites {
+		renamed := *f
+		renamed.Username = username
+		res = append(res, &renamed)
+	}
+	return res
+}
+
+// Check reports the articles and comments whose author profile differs from
+// the profile of the user, the deleted ones included. The drifted records are
+// rewritten when fix is set.
+func (as AuthorSync) Check(ctx context.Context, fix bool) ([]Drift, error) {
+	users, err := as.UserRepository.GetFiltered(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var profiles = make(map[string]types.Profile, len(users))
+	for _, u := range users {
+		profiles[u.Username] = embedded(u.Profile)
+	}
+	var drifts []Drift
+	drifted := func(name, key string, author types.Profile) (types.Profile, bool) {
+		user, ok := profiles[author.Username]
+		if ok && sameProfile(author, user) {
+			return user, false
+		}
+		drifts = append(drifts, Drift{
+			Type:     name,
+			Key:      key,
+			Embedded: author,
+			User:     user,
+		})
+		// the authors without a user can't be fixed
+		return user, ok
+	}
+
+	articles, err := as.ArticleRepository.GetFiltered(ctx)
+	if err != nil {
+		return nil, err
+	}
+	trashedArticles, err := as.ArticleTrash.GetFiltered(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var fixedArticles, fixedTrashedArticles []*types.Article
+	for _, a := range append(articles, trashedArticles...) {
+		if user, fixable := drifted(a.Name(), a.Key(), a.Author); fixable {
+			a.Author = user
+			if a.DeletedAt != nil {
+				fixedTrashedArticles = append(fixedTrashedArticles, a)
+			} else {
+				fixedArticles = append(fixedArticles, a)
+			}
+		}
+	}
+	comments, err := as.CommentRepository.GetFiltered(ctx)
+	if err != nil {
+		return nil, err
+	}
+	trashedComments, err := as.CommentTrash.GetFiltered(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var fixedComments, fixedTrashedComments []*types.Comment
+	for _, c := range append(comments, trashedComments...) {
+		if user, fixable := drifted(c.Name(), c.Key(), c.Author); fixable {
+			c.Author = user
+			if c.DeletedAt != nil {
+				fixedTrashedComments = append(fixedTrashedComments, c)
+			} else {
+				fixedComments = append(fixedComments, c)
+			}
+		}
+	}
+	sort.Slice(drifts, func(i, j int) bool {
+		if drifts[i].Type != drifts[j].Type {
+			return drifts[i].Type < drifts[j].Type
+		}
+		return drifts[i].Key < drifts[j].Key
+	})
+	if !fix {
+		return drifts, nil
+	}
+	if _, err := as.ArticleRepository.SaveMany(ctx, fixedArticles); err != nil {
+		return drifts, err
+	}
+	if _, err := as.CommentRepository.SaveMany(ctx, fixedComments); err != nil {
+		return drifts, err
+	}
+	if len(fixedTrashedArticles) > 0 {
+		if _, err := as.ArticleTrash.SaveMany(ctx, fixedTrashedArticles); err != nil {
+			return drifts, err
+		}
+	}
+	if len(fixedTrashedComments) > 0 {
+		if _, err := as.CommentTrash.SaveMany(ctx, fixedTrashedComments); err != nil {
+			return drifts, err
+		}
+	}
+	return drifts, nil
+}
+
+// embedded is the stored form of a profile, following depends on the viewer
+func embedded(p types.Profile) types.Profile {
+	p.Following = false
+	return p
+}
+
+func sameProfile(a, b types.Profile) bool {
+	return a.Username == b.Username && a.Bio == b.Bio && a.Image == b.Image
+}
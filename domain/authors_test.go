@@ -0,0 +1,187 @@
+package domain
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	persistTypes "github.com/borosr/realworld/persist/types"
+	"github.com/borosr/realworld/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAuthorSync_Propagate(t *testing.T) {
+	ctx := context.Background()
+	before := types.Profile{Username: "old", Bio: "bio"}
+	after := types.Profile{Username: "new", Bio: "new bio", Image: "image"}
+	deletedAt := time.Now()
+
+	mockArticleRepo := MockRepository[*types.Article]{}
+	mockCommentRepo := MockRepository[*types.Comment]{}
+	mockFollowRepo := MockRepository[*types.Follow]{}
+	mockFavoriteRepo := MockRepository[*types.Favorite]{}
+	mockArticleTrash := MockTrash[*types.Article]{}
+	mockCommentTrash := MockTrash[*types.Comment]{}
+	mockFavoriteTrash := MockTrash[*types.Favorite]{}
+	mockFeedRepo := MockRepository[*types.Feed]{}
+	mockIndexRepo := MockRepository[*types.FollowIndex]{}
+	mockTimelineRepo := MockRepository[*types.Timeline]{}
+	mockArticleRepo.On("GetFiltered", ctx, mock.Anything).
+		Return([]*types.Article{{ID: "article", Author: before}}, nil)
+	mockArticleRepo.On("SaveMany", ctx, []*types.Article{{ID: "article", Author: after}}).
+		Return([]*types.Article{}, nil)
+	mockCommentRepo.On("GetFiltered", ctx, mock.Anything).
+		Return([]*types.Comment{{Slug: "article", CommonComment: types.CommonComment{ID: 1, Author: before}}}, nil)
+	mockCommentRepo.On("SaveMany", ctx, []*types.Comment{{Slug: "article", CommonComment: types.CommonComment{ID: 1, Author: after}}}).
+		Return([]*types.Comment{}, nil)
+	mockFollowRepo.On("GetFiltered", ctx, mock.Anything).
+		Return([]*types.Follow{{From: "old", To: "author"}, {From: "reader", To: "old"}}, nil)
+	mockFollowRepo.On("Delete", ctx, "old-author").Return(nil)
+	mockFollowRepo.On("Delete", ctx, "reader-old").Return(nil)
+	mockFollowRepo.On("SaveMany", ctx, []*types.Follow{{From: "new", To: "author"}, {From: "reader", To: "new"}}).
+		Return([]*types.Follow{}, nil)
+	mockFavoriteRepo.On("GetFiltered", ctx, mock.Anything).
+		Return([]*types.Favorite{{Slug: "other", Username: "old"}}, nil)
+	mockFavoriteRepo.On("SaveMany", ctx, []*types.Favorite{{Slug: "other", Username: "new"}}).
+		Return([]*types.Favorite{}, nil)
+	// the deleted records are renamed too, so their author can restore them
+	mockArticleTrash.On("GetFiltered", ctx, mock.Anything).
+		Return([]*types.Article{{ID: "trashed", Author: before, DeletedAt: &deletedAt}}, nil)
+	mockArticleTrash.On("SaveMany", ctx, []*types.Article{{ID: "trashed", Author: after, DeletedAt: &deletedAt}}).
+		Return([]*types.Article{}, nil)
+	mockCommentTrash.On("GetFiltered", ctx, mock.Anything).
+		Return([]*types.Comment{}, nil)
+	mockFavoriteTrash.On("GetFiltered", ctx, mock.Anything).
+		Return([]*types.Favorite{{Slug: "trashed", Username: "old", DeletedAt: &deletedAt}}, nil)
+	// the favorites are removed from their old keys, no tombstone is left
+	mockFavoriteTrash.On("Remove", ctx, mock.MatchedBy(func(f persistTypes.Filter[*types.Favorite]) bool {
+		return f(&types.Favorite{Username: "old"}) && f(&types.Favorite{Username: "old", DeletedAt: &deletedAt}) &&
+			!f(&types.Favorite{Username: "other"})
+	})).
+		Return(2, nil)
+	mockFavoriteTrash.On("SaveMany", ctx, []*types.Favorite{{Slug: "trashed", Username: "new", DeletedAt: &deletedAt}}).
+		Return([]*types.Favorite{}, nil)
+	// the feed and the timeline move with the user
+	mockFeedRepo.On("Get", ctx, "old").
+		Return(&types.Feed{Username: "old", Items: []types.FeedItem{{ArticleID: "followed", Author: "author"}}}, nil)
+	mockFeedRepo.On("Save", ctx, &types.Feed{Username: "new", Items: []types.FeedItem{{ArticleID: "followed", Author: "author"}}}).
+		Return(&types.Feed{}, nil)
+	mockFeedRepo.On("Delete", ctx, "old").Return(nil)
+	mockTimelineRepo.On("Get", ctx, "old").
+		Return(&types.Timeline{Author: "old", Items: []types.FeedItem{{ArticleID: "article", Author: "old"}}}, nil)
+	mockTimelineRepo.On("Save", ctx, &types.Timeline{Author: "new", Items: []types.FeedItem{{ArticleID: "article", Author: "new"}}}).
+		Return(&types.Timeline{}, nil)
+	mockTimelineRepo.On("Delete", ctx, "old").Return(nil)
+	mockIndexRepo.On("Delete", ctx, "old").Return(nil)
+	var transactions int
+	as := AuthorSync{
+		ArticleRepository:  &mockArticleRepo,
+		CommentRepository:  &mockCommentRepo,
+		FollowRepository:   &mockFollowRepo,
+		FavoriteRepository: &mockFavoriteRepo,
+		ArticleTrash:       &mockArticleTrash,
+		CommentTrash:       &mockCommentTrash,
+		FavoriteTrash:      &mockFavoriteTrash,
+		FeedService: FeedService{
+			FeedRepository:        &mockFeedRepo,
+			FollowIndexRepository: &mockIndexRepo,
+			TimelineRepository:    &mockTimelineRepo,
+		},
+		Transaction: recordTransaction(&transactions),
+	}
+	count, err := as.Propagate(ctx, before, after)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(7), count)
+	assert.Equal(t, 1, transactions, "renamed in one transaction")
+	mockArticleRepo.AssertExpectations(t)
+	mockCommentRepo.AssertExpectations(t)
+	mockFollowRepo.AssertExpectations(t)
+	mockFavoriteRepo.AssertExpectations(t)
+	mockArticleTrash.AssertExpectations(t)
+	mockFavoriteTrash.AssertExpectations(t)
+	mockFeedRepo.AssertExpectations(t)
+	mockTimelineRepo.AssertExpectations(t)
+	mockIndexRepo.AssertExpectations(t)
+}
+
+func TestAuthorSync_PropagateProfile(t *testing.T) {
+	ctx := context.Background()
+	before := types.Profile{Username: "author", Bio: "bio"}
+	after := types.Profile{Username: "author", Bio: "new bio", Following: true}
+
+	mockArticleRepo := MockRepository[*types.Article]{}
+	mockCommentRepo := MockRepository[*types.Comment]{}
+	mockArticleRepo.On("GetFiltered", ctx, mock.Anything).
+		Return([]*types.Article{}, nil)
+	mockArticleRepo.On("SaveMany", ctx, []*types.Article{}).
+		Return([]*types.Article{}, nil)
+	mockCommentRepo.On("GetFiltered", ctx, mock.Anything).
+		Return([]*types.Comment{{CommonComment: types.CommonComment{ID: 1, Author: before}}}, nil)
+	mockCommentRepo.On("SaveMany", ctx, []*types.Comment{{CommonComment: types.CommonComment{ID: 1, Author: types.Profile{Username: "author", Bio: "new bio"}}}}).
+		Return([]*types.Comment{}, nil)
+	mockArticleTrash := MockTrash[*types.Article]{}
+	mockArticleTrash.On("GetFiltered", ctx, mock.Anything).
+		Return([]*types.Article{}, nil)
+	mockCommentTrash := MockTrash[*types.Comment]{}
+	mockCommentTrash.On("GetFiltered", ctx, mock.Anything).
+		Return([]*types.Comment{}, nil)
+	as := AuthorSync{
+		ArticleRepository: &mockArticleRepo,
+		CommentRepository: &mockCommentRepo,
+		ArticleTrash:      &mockArticleTrash,
+		CommentTrash:      &mockCommentTrash,
+	}
+	count, err := as.Propagate(ctx, before, after)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), count, "the follows and favorites are kept without renaming")
+	mockCommentRepo.AssertExpectations(t)
+}
+
+func TestAuthorSync_Check(t *testing.T) {
+	ctx := context.Background()
+	current := types.Profile{Username: "author", Bio: "current"}
+
+	mockUserRepo := MockRepository[*types.User]{}
+	mockArticleRepo := MockRepository[*types.Article]{}
+	mockCommentRepo := MockRepository[*types.Comment]{}
+	mockUserRepo.On("GetFiltered", ctx).
+		Return([]*types.User{{Email: "author@example.com", Profile: current}}, nil)
+	mockArticleRepo.On("GetFiltered", ctx).
+		Return([]*types.Article{
+			{ID: "synced", Author: current},
+			{ID: "stale", Author: types.Profile{Username: "author", Bio: "old"}},
+		}, nil)
+	mockCommentRepo.On("GetFiltered", ctx).
+		Return([]*types.Comment{{Slug: "synced", CommonComment: types.CommonComment{ID: 1, Author: types.Profile{Username: "gone"}}}}, nil)
+	mockArticleRepo.On("SaveMany", ctx, []*types.Article{{ID: "stale", Author: current}}).
+		Return([]*types.Article{}, nil)
+	mockCommentRepo.On("SaveMany", ctx, []*types.Comment(nil)).
+		Return([]*types.Comment{}, nil)
+	deletedAt := time.Now()
+	mockArticleTrash := MockTrash[*types.Article]{}
+	mockArticleTrash.On("GetFiltered", ctx).
+		Return([]*types.Article{{ID: "trashed", Author: types.Profile{Username: "author"}, DeletedAt: &deletedAt}}, nil)
+	mockArticleTrash.On("SaveMany", ctx, []*types.Article{{ID: "trashed", Author: current, DeletedAt: &deletedAt}}).
+		Return([]*types.Article{}, nil)
+	mockCommentTrash := MockTrash[*types.Comment]{}
+	mockCommentTrash.On("GetFiltered", ctx).
+		Return([]*types.Comment{}, nil)
+	as := AuthorSync{
+		UserRepository:    &mockUserRepo,
+		ArticleRepository: &mockArticleRepo,
+		CommentRepository: &mockCommentRepo,
+		ArticleTrash:      &mockArticleTrash,
+		CommentTrash:      &mockCommentTrash,
+	}
+	drifts, err := as.Check(ctx, true)
+	assert.Nil(t, err)
+	assert.Equal(t, []Drift{
+		{Type: "article", Key: "stale", Embedded: types.Profile{Username: "author", Bio: "old"}, User: current},
+		{Type: "article", Key: "trashed", Embedded: types.Profile{Username: "author"}, User: current},
+		{Type: "comment", Key: "synced-1", Embedded: types.Profile{Username: "gone"}},
+	}, drifts)
+	mockArticleRepo.AssertExpectations(t)
+	mockCommentRepo.AssertExpectations(t)
+	mockArticleTrash.AssertExpectations(t)
+}
@@ -0,0 +1,262 @@
+package domain
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/borosr/realworld/lib/broken"
+	"github.com/borosr/realworld/lib/sanitize"
+	persistTypes "github.com/borosr/realworld/persist/types"
+	"github.com/borosr/realworld/types"
+)
+
+// DefaultCommentMaxDepth is the deepest reply allowed by default, the
+// comments of the article are at depth 0
+const DefaultCommentMaxDepth = 5
+
+var (
+	ErrParentNotFound = broken.Validation("the comment replied to doesn't exist")
+	ErrCommentTooDeep = broken.Validation("the reply is nested too deep")
+	ErrCommentDeleted = broken.Validation("the comment has been deleted")
+	ErrInvalidCursor  = broken.Validation("invalid cursor")
+)
+
+// UpdateComment allows the author of the comment to change its body, the
+// former body is kept in the history of the comment
+func (as ArticleService) UpdateComment(ctx context.Context, slug string, id int, c types.CommentRequest) (types.CommonComment, error) {
+	body := c.Body
+	if strings.TrimSpace(sanitize.HTML(body)) == "" {
+		return types.CommonComment{}, ErrEmptyComment
+	}
+	user, err := actor(ctx, as.UserService)
+	if err != nil {
+		return types.CommonComment{}, err
+	}
+	key, err := as.articleKey(ctx, slug)
+	if err != nil {
+		return types.CommonComment{}, err
+	}
+	comment, err := as.comment(ctx, key, id)
+	if err != nil {
+		return types.CommonComment{}, err
+	}
+	if err := CanEditComment(user, comment); err != nil {
+		return types.CommonComment{}, err
+	}
+	if comment.Body == body {
+		return renderComment(comment.CommonComment), nil
+	}
+	comment.History = append(comment.History, types.CommentEdit{
+		Body:      comment.Body,
+		UpdatedAt: comment.UpdatedAt,
+	})
+	comment.Body = body
+	comment.UpdatedAt = time.Now()
+	saved, err := as.CommentRepository.Save(ctx, comment)
+	if err != nil {
+		return types.CommonComment{}, err
+	}
+	return renderComment(saved.CommonComment), nil
+}
+
+// GetCommentHistory returns the former bodies of the comment to its author,
+// the latest first
+func (as ArticleService) GetCommentHistory(ctx context.Context, slug string, id int) ([]types.CommentEdit, error) {
+	user, err := actor(ctx, as.UserService)
+	if err != nil {
+		return nil, err
+	}
+	key, err := as.articleKey(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+	comment, err := as.comment(ctx, key, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := CanReadCommentHistory(user, comment); err != nil {
+		return nil, err
+	}
+	history := make([]types.CommentEdit, 0, len(comment.History))
+	for i := len(comment.History) - 1; i >= 0; i-- {
+		edit := comment.History[i]
+		edit.Body = sanitize.HTML(edit.Body)
+		history = append(history, edit)
+	}
+	return history, nil
+}
+
+func (as ArticleService) comment(ctx context.Context, key string, id int) (*types.Comment, error) {
+	c := types.Comment{
+		CommonComment: types.CommonComment{
+			ID: id,
+		},
+		Slug: key,
+	}
+	return as.CommentRepository.Get(ctx, c.Key())
+}
+
+// reply sets the parent of a new comment, the parent has to be a live
+// comment of the same article within the maximum depth
+func (as ArticleService) reply(ctx context.Context, comment *types.Comment, parentID int) error {
+	parent, err := as.comment(ctx, comment.Slug, parentID)
+	if errors.Is(err, persistTypes.ErrNotFound) {
+		return as.deletedParent(ctx, comment.Slug, parentID)
+	}
+	if err != nil {
+		return err
+	}
+	if parent.Depth+1 > as.CommentMaxDepth {
+		return ErrCommentTooDeep
+	}
+	comment.ParentID = &parentID
+	comment.Depth = parent.Depth + 1
+	return nil
+}
+
+// deletedParent tells a parent in the trash from a missing one
+func (as ArticleService) deletedParent(ctx context.Context, key string, parentID int) error {
+	c := types.Comment{
+		CommonComment: types.CommonComment{
+			ID: parentID,
+		},
+		Slug: key,
+	}
+	_, err := as.CommentTrash.Get(ctx, c.Key())
+	if errors.Is(err, persistTypes.ErrNotFound) {
+		return ErrParentNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return ErrCommentDeleted
+}
+
+// thread orders the comments by their creation, the deleted ones included,
+// and shows the deleted comments with replies as placeholders, the others are
+// dropped. The replies are created after their parent, so they follow it. A
+// parent removed permanently gets a placeholder before its first reply.
+func thread(comments []*types.Comment) []*types.Comment {
+	known := make(map[int]bool, len(comments))
+	for _, c := range comments {
+		known[c.ID] = true
+	}
+	removed := make(map[int]*types.Comment)
+	for _, c := range comments {
+		if c.ParentID == nil || known[*c.ParentID] {
+			continue
+		}
+		if p, ok := removed[*c.ParentID]; ok {
+			if c.CreatedAt.Before(p.CreatedAt) {
+				p.CreatedAt = c.CreatedAt
+			}
+			continue
+		}
+		removed[*c.ParentID] = &types.Comment{
+			CommonComment: types.CommonComment{
+				ID:        *c.ParentID,
+				CreatedAt: c.CreatedAt,
+				Deleted:   true,
+			},
+			Slug: c.Slug,
+		}
+	}
+	for _, p := range removed {
+		comments = append(comments, p)
+	}
+	sort.Slice(comments, func(i, j int) bool {
+		return before(comments[i], comments[j].CreatedAt, comments[j].ID)
+	})
+	replied := make(map[int]bool)
+	shown := make([]bool, len(comments))
+	for i := len(comments) - 1; i >= 0; i-- {
+		c := comments[i]
+		shown[i] = !isDeleted(c) || replied[c.ID]
+		if shown[i] && c.ParentID != nil {
+			replied[*c.ParentID] = true
+		}
+	}
+	var result []*types.Comment
+	for i, c := range comments {
+		if !shown[i] {
+			continue
+		}
+		if isDeleted(c) {
+			c = placeholder(c)
+		}
+		result = append(result, c)
+	}
+	return result
+}
+
+func isDeleted(c *types.Comment) bool {
+	return c.DeletedAt != nil || c.Deleted
+}
+
+// placeholder keeps the place of a deleted comment in the thread without its
+// body, author and history
+func placeholder(c *types.Comment) *types.Comment {
+	return &types.Comment{
+		CommonComment: types.CommonComment{
+			ID:        c.ID,
+			CreatedAt: c.CreatedAt,
+			ParentID:  c.ParentID,
+			Deleted:   true,
+		},
+		Slug:  c.Slug,
+		Depth: c.Depth,
+	}
+}
+
+func before(c *types.Comment, createdAt time.Time, id int) bool {
+	if !c.CreatedAt.Equal(createdAt) {
+		return c.CreatedAt.Before(createdAt)
+	}
+	return c.ID < id
+}
+
+// page returns the comments after the cursor, at most limit of them when the
+// limit is positive, and the cursor of the next page
+func page(comments []*types.Comment, limit int, after string) ([]*types.Comment, string, error) {
+	if after != "" {
+		createdAt, id, err := decodeCursor(after)
+		if err != nil {
+			return nil, "", err
+		}
+		start := sort.Search(len(comments), func(i int) bool {
+			c := comments[i]
+			return c.CreatedAt.After(createdAt) || c.CreatedAt.Equal(createdAt) && c.ID > id
+		})
+		comments = comments[start:]
+	}
+	if limit <= 0 || len(comments) <= limit {
+		return comments, "", nil
+	}
+	comments = comments[:limit]
+	last := comments[limit-1]
+	return comments, encodeCursor(last.CreatedAt, last.ID), nil
+}
+
+// the cursors are opaque to the clients, they hold the creation time and the
+// id of the last comment of the page
+func encodeCursor(createdAt time.Time, id int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d", createdAt.UnixNano(), id)))
+}
+
+func decodeCursor(cursor string) (time.Time, int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	var nanos int64
+	var id int
+	if _, err := fmt.Sscanf(string(raw), "%d:%d", &nanos, &id); err != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	return time.Unix(0, nanos), id, nil
+}
@@ -0,0 +1,258 @@
+package domain
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	persistTypes "github.com/borosr/realworld/persist/types"
+	"github.com/borosr/realworld/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func testComment(id int, parent *int, createdAt time.Time, deleted bool) *types.Comment {
+	c := &types.Comment{
+		CommonComment: types.CommonComment{
+			ID:        id,
+			CreatedAt: createdAt,
+			ParentID:  parent,
+			Body:      "body",
+			Author:    types.Profile{Username: "commenter"},
+		},
+		Slug: "article",
+	}
+	if deleted {
+		c.DeletedAt = &createdAt
+	}
+	return c
+}
+
+func ids(comments []*types.Comment) []int {
+	var result []int
+	for _, c := range comments {
+		result = append(result, c.ID)
+	}
+	return result
+}
+
+func TestThread(t *testing.T) {
+	start := time.Now()
+	at := func(i int) time.Time {
+		return start.Add(time.Duration(i) * time.Second)
+	}
+	zero, one, three := 0, 1, 3
+	comments := []*types.Comment{
+		testComment(4, &three, at(4), false),
+		testComment(1, &zero, at(1), true),
+		testComment(0, nil, at(0), true),
+		testComment(3, nil, at(2), true),
+		testComment(2, &one, at(2), true),
+		testComment(5, nil, at(5), true),
+		testComment(6, nil, at(5), false),
+	}
+	// 0 and 1 are deleted without live replies, 3 is the placeholder of 4
+	assert.Equal(t, []int{3, 4, 6}, ids(thread(comments)))
+
+	comments = append(comments, testComment(7, &one, at(7), false))
+	threaded := thread(comments)
+	assert.Equal(t, []int{0, 1, 3, 4, 6, 7}, ids(threaded))
+	for _, c := range threaded {
+		assert.Equal(t, c.DeletedAt == nil && !c.Deleted, c.Body != "" && c.Author.Username != "")
+	}
+	assert.True(t, threaded[0].Deleted)
+	assert.Equal(t, "body", comments[0].Body)
+
+	// 8 was removed permanently, its reply keeps a placeholder in its place
+	eight := 8
+	threaded = thread([]*types.Comment{testComment(9, &eight, at(9), false)})
+	assert.Equal(t, []int{8, 9}, ids(threaded))
+	assert.True(t, threaded[0].Deleted)
+}
+
+func TestPage(t *testing.T) {
+	start := time.Now()
+	var comments []*types.Comment
+	for i := 0; i < 5; i++ {
+		comments = append(comments, testComment(i, nil, start.Add(time.Duration(i/2)*time.Second), false))
+	}
+
+	var got []int
+	var cursor string
+	for pages := 0; ; pages++ {
+		result, next, err := page(comments, 2, cursor)
+		assert.Nil(t, err)
+		got = append(got, ids(result)...)
+		if next == "" {
+			assert.Equal(t, 2, pages)
+			break
+		}
+		cursor = next
+	}
+	assert.Equal(t, []int{0, 1, 2, 3, 4}, got)
+
+	all, next, err := page(comments, 0, "")
+	assert.Nil(t, err)
+	assert.Len(t, all, 5)
+	assert.Empty(t, next)
+
+	_, _, err = page(comments, 2, "not a cursor")
+	assert.Equal(t, ErrInvalidCursor, err)
+}
+
+func TestArticleService_Reply(t *testing.T) {
+	const email = "test@email.com"
+	ctx := context.WithValue(context.Background(), "email", email)
+	zero, deep, deleted, missing := 0, 1, 2, 3
+
+	mockArticleRepo := MockRepository[*types.Article]{}
+	mockCommentRepo := MockRepository[*types.Comment]{}
+	mockArticleRepo.On("Get", ctx, "article").
+		Return(&types.Article{Slug: "article"}, nil)
+	mockCommentRepo.On("Sequence", ctx, "article").Return(4, nil)
+	mockCommentRepo.On("Get", ctx, "article-0").
+		Return(testComment(zero, nil, time.Now(), false), nil)
+	mockCommentRepo.On("Get", ctx, "article-1").
+		Return(&types.Comment{CommonComment: types.CommonComment{ID: deep}, Slug: "article", Depth: 2}, nil)
+	mockCommentRepo.On("Get", ctx, "article-2").
+		Return(nil, persistTypes.ErrNotFound)
+	mockCommentRepo.On("Get", ctx, "article-3").
+		Return(nil, persistTypes.ErrNotFound)
+	mockCommentTrash := MockTrash[*types.Comment]{}
+	mockCommentTrash.On("Get", ctx, "article-2").
+		Return(testComment(deleted, nil, time.Now(), true), nil)
+	mockCommentTrash.On("Get", ctx, "article-3").
+		Return(nil, persistTypes.ErrNotFound)
+	mockCommentRepo.On("Save", ctx, mock.MatchedBy(func(c *types.Comment) bool {
+		return c.ParentID != nil && *c.ParentID == zero && c.Depth == 1
+	})).
+		Return(&types.Comment{}, nil)
+	service := MockUserService{}
+	service.On("GetByEmail", ctx, email).Return(types.User{}, nil)
+	as := ArticleService{
+		ArticleRepository: &mockArticleRepo,
+		CommentRepository: &mockCommentRepo,
+		CommentTrash:      &mockCommentTrash,
+		UserService:       &service,
+		CommentMaxDepth:   2,
+	}
+
+	_, err := as.CreateComment(ctx, "article", types.CommentRequest{Body: "reply", ParentID: &zero})
+	assert.Nil(t, err)
+	_, err = as.CreateComment(ctx, "article", types.CommentRequest{Body: "reply", ParentID: &deep})
+	assert.Equal(t, ErrCommentTooDeep, err)
+	_, err = as.CreateComment(ctx, "article", types.CommentRequest{Body: "reply", ParentID: &deleted})
+	assert.Equal(t, ErrCommentDeleted, err)
+	_, err = as.CreateComment(ctx, "article", types.CommentRequest{Body: "reply", ParentID: &missing})
+	assert.Equal(t, ErrParentNotFound, err)
+	mockCommentRepo.AssertNumberOfCalls(t, "Save", 1)
+}
+
+func TestArticleService_UpdateComment(t *testing.T) {
+	const email = "commenter@email.com"
+	ctx := context.WithValue(context.Background(), "email", email)
+	written := time.Now().Add(-time.Hour)
+	comment := &types.Comment{
+		CommonComment: types.CommonComment{
+			ID:        1,
+			UpdatedAt: written,
+			Body:      "second",
+			Author:    types.Profile{Username: "commenter"},
+		},
+		Slug:    "article",
+		History: []types.CommentEdit{{Body: "first", UpdatedAt: written.Add(-time.Hour)}},
+	}
+
+	mockArticleRepo := MockRepository[*types.Article]{}
+	mockCommentRepo := MockRepository[*types.Comment]{}
+	mockArticleRepo.On("Get", mock.Anything, "article").
+		Return(&types.Article{Slug: "article", Author: types.Profile{Username: "author"}}, nil)
+	mockCommentRepo.On("Get", mock.Anything, "article-1").Return(comment, nil)
+	mockCommentRepo.On("Save", ctx, mock.MatchedBy(func(c *types.Comment) bool {
+		return c.Body == "<em onclick=x>third</em>" && c.UpdatedAt.After(written) &&
+			assert.ObjectsAreEqual([]types.CommentEdit{
+				{Body: "first", UpdatedAt: written.Add(-time.Hour)},
+				{Body: "second", UpdatedAt: written},
+			}, c.History)
+	})).
+		Return(comment, nil)
+	service := MockUserService{}
+	service.On("GetByEmail", mock.Anything, email).
+		Return(types.User{Profile: types.Profile{Username: "commenter"}}, nil)
+	service.On("GetByEmail", mock.Anything, "author@email.com").
+		Return(types.User{Profile: types.Profile{Username: "author"}}, nil)
+	as := ArticleService{
+		ArticleRepository: &mockArticleRepo,
+		CommentRepository: &mockCommentRepo,
+		UserService:       &service,
+	}
+
+	updated, err := as.UpdateComment(ctx, "article", 1, types.CommentRequest{Body: "<em onclick=x>third</em>"})
+	assert.Nil(t, err)
+	assert.Equal(t, "<em>third</em>", updated.Body)
+	history, err := as.GetCommentHistory(ctx, "article", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"second", "first"}, []string{history[0].Body, history[1].Body})
+
+	// the author of the article moderates, but doesn't edit the comments
+	authorCtx := context.WithValue(context.Background(), "email", "author@email.com")
+	_, err = as.UpdateComment(authorCtx, "article", 1, types.CommentRequest{Body: "changed"})
+	assert.Equal(t, ErrNotCommentEditor, err)
+	_, err = as.GetCommentHistory(authorCtx, "article", 1)
+	assert.Equal(t, ErrNotEditsReader, err)
+	mockCommentRepo.AssertNumberOfCalls(t, "Save", 1)
+}
+
+func TestArticleService_DeleteCommentWithReplies(t *testing.T) {
+	const email = "commenter@email.com"
+	ctx := context.WithValue(context.Background(), "email", email)
+	one := 1
+	comment := &types.Comment{
+		CommonComment: types.CommonComment{
+			ID:     1,
+			Body:   "parent",
+			Author: types.Profile{Username: "commenter"},
+		},
+		Slug:    "article",
+		History: []types.CommentEdit{{Body: "draft"}},
+	}
+
+	mockArticleRepo := MockRepository[*types.Article]{}
+	mockCommentRepo := MockRepository[*types.Comment]{}
+	mockArticleRepo.On("Get", mock.Anything, "article").
+		Return(&types.Article{Slug: "article"}, nil)
+	mockCommentRepo.On("Get", ctx, "article-1").Return(comment, nil).Once()
+	mockCommentRepo.On("Get", ctx, "article-1").Return(nil, persistTypes.ErrNotFound)
+	mockCommentRepo.On("Delete", ctx, "article-1").Return(nil)
+	service := MockUserService{}
+	service.On("GetByEmail", ctx, email).
+		Return(types.User{Profile: types.Profile{Username: "commenter"}}, nil)
+	as := ArticleService{
+		ArticleRepository: &mockArticleRepo,
+		CommentRepository: &mockCommentRepo,
+		UserService:       &service,
+	}
+
+	// the comment goes to the trash with its body, the reply keeps its place
+	assert.Nil(t, as.DeleteComment(ctx, "article", 1))
+	// deleting it again is a no-op
+	assert.Nil(t, as.DeleteComment(ctx, "article", 1))
+	mockCommentRepo.AssertNumberOfCalls(t, "Delete", 1)
+	mockCommentRepo.AssertNotCalled(t, "Save", mock.Anything, mock.Anything)
+
+	// the placeholder is listed to anyone
+	anonymous := context.Background()
+	mockCommentRepo.On("GetFiltered", anonymous, mock.Anything).
+		Return([]*types.Comment{testComment(2, &one, time.Now(), false)}, nil)
+	deleted := *comment
+	deletedAt := time.Now()
+	deleted.DeletedAt = &deletedAt
+	mockCommentTrash := MockTrash[*types.Comment]{}
+	mockCommentTrash.On("GetFiltered", anonymous, mock.Anything).
+		Return([]*types.Comment{&deleted}, nil)
+	as.CommentTrash = &mockCommentTrash
+	comments, _, err := as.GetComments(anonymous, "article", 0, "")
+	assert.Nil(t, err)
+	assert.Len(t, comments, 2)
+	assert.Equal(t, types.CommonComment{ID: 1, Deleted: true}, comments[0])
+}
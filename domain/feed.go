@@ -0,0 +1,451 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+
+	"github.com/borosr/realworld/persist"
+	persistTypes "github.com/borosr/realworld/persist/types"
+	"github.com/borosr/realworld/types"
+)
+
+// DefaultFeedSize is the number of the latest articles kept in a feed
+const DefaultFeedSize = 1000
+
+const (
+	// feedBatchSize is the number of the feeds updated in one transaction by
+	// the fan-out
+	feedBatchSize = 100
+	// feedAttempts limits the runs of the fan-out to a batch of feeds, the
+	// feeds of the failing batches are marked stale
+	feedAttempts = 3
+)
+
+type FeedDescriptor interface {
+	// Articles returns the articles of the user's feed, newest first
+	Articles(ctx context.Context, username string) ([]*types.Article, error)
+}
+
+// FeedService maintains a feed per user by fanning out the new articles to
+// the feeds of the followers of their author. The follows are indexed by
+// user and the published articles by author, so neither the fan-out nor the
+// rebuild of a feed scans the follows or the articles.
+type FeedService struct {
+	FeedRepository        persist.Repository[*types.Feed]
+	FollowRepository      persist.Repository[*types.Follow]
+	FollowIndexRepository persist.Repository[*types.FollowIndex]
+	TimelineRepository    persist.Repository[*types.Timeline]
+	ArticleRepository     persist.Repository[*types.Article]
+	Transaction           TransactionFunc
+	// Size is the number of the latest articles kept in a feed
+	Size int
+}
+
+// Feeds keeps the feeds up to date with the published articles and the
+// follows. The indexes change in the transactions of the articles and the
+// follows, the feeds of the followers are updated after the commit.
+func Feeds(fs FeedService) {
+	persist.Observe[*types.Article](func(ctx context.Context, e persist.Event[*types.Article]) error {
+		switch {
+		case published(e):
+			return fs.publish(ctx, e.After)
+		case withdrawn(e):
+			return fs.updateTimeline(ctx, e.Before.Author.Username, func(items []types.FeedItem) []types.FeedItem {
+				return withoutArticle(items, e.Key)
+			})
+		}
+		return nil
+	})
+	persist.Observe[*types.Follow](func(ctx context.Context, e persist.Event[*types.Follow]) error {
+		switch e.Operation {
+		case persist.OperationCreate:
+			return fs.follow(ctx, e.After.From, e.After.To)
+		case persist.OperationDelete:
+			return fs.unfollow(ctx, e.Before.From, e.Before.To)
+		}
+		return nil
+	})
+}
+
+// published reports the articles becoming visible: created as published,
+// published later or restored, the feeds skip the duplicates
+func published(e persist.Event[*types.Article]) bool {
+	return visible(e.After) && !visible(e.Before)
+}
+
+// withdrawn reports the articles unpublished, archived or deleted
+func withdrawn(e persist.Event[*types.Article]) bool {
+	return visible(e.Before) && !visible(e.After)
+}
+
+func visible(a *types.Article) bool {
+	return a != nil && a.Listed() && a.DeletedAt == nil
+}
+
+// Articles resolves the items of the feed, the deleted and the unpublished
+// articles are skipped. The missing and the stale feeds are built on their
+// read.
+func (fs FeedService) Articles(ctx context.Context, username string) ([]*types.Article, error) {
+	feed, err := fs.FeedRepository.Get(ctx, username)
+	if errors.Is(err, persistTypes.ErrNotFound) || err == nil && feed.Stale {
+		feed, err = fs.rebuild(ctx, username)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var keys = make([]string, 0, len(feed.Items))
+	for _, item := range feed.Items {
+		keys = append(keys, item.ArticleID)
+	}
+	articles, err := fs.ArticleRepository.GetMany(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	var listed = articles[:0]
+	for _, a := range articles {
+		if a.Listed() {
+			listed = append(listed, a)
+		}
+	}
+	return listed, nil
+}
+
+// publish adds the article to the timeline of its author and reads the
+// followers in the transaction of the article, their feeds are updated after
+// the commit
+func (fs FeedService) publish(ctx context.Context, article *types.Article) error {
+	item := feedItem(article)
+	if err := fs.updateTimeline(ctx, article.Author.Username, func(items []types.FeedItem) []types.FeedItem {
+		return fs.add(items, item)
+	}); err != nil {
+		return err
+	}
+	index, err := fs.followIndex(ctx, article.Author.Username)
+	if err != nil {
+		return err
+	}
+	followers := index.Followers
+	persist.OnCommit(ctx, func(ctx context.Context) {
+		fs.fanOut(ctx, followers, item)
+	})
+	return nil
+}
+
+// fanOut adds the item to the existing feeds of the followers in batches of
+// their own transactions. The failing batches are retried, the feeds still
+// failing are marked stale.
+func (fs FeedService) fanOut(ctx context.Context, followers []string, item types.FeedItem) {
+	for start := 0; start < len(followers); start += feedBatchSize {
+		end := start + feedBatchSize
+		if end > len(followers) {
+			end = len(followers)
+		}
+		batch := followers[start:end]
+		var err error
+		for attempt := 0; attempt < feedAttempts; attempt++ {
+			if err = fs.deliver(ctx, batch, item); err == nil {
+				break
+			}
+		}
+		if err == nil {
+			continue
+		}
+		log.Printf("feed fan-out of %s: %v", item.ArticleID, err)
+		if err := fs.markStale(ctx, batch); err != nil {
+			log.Printf("feed fan-out of %s: marking the feeds stale: %v", item.ArticleID, err)
+		}
+	}
+}
+
+// deliver adds the item to the existing feeds of the users, the missing ones
+// are built on their first read
+func (fs FeedService) deliver(ctx context.Context, usernames []string, item types.FeedItem) error {
+	return fs.Transaction.run(ctx, func(ctx context.Context) error {
+		feeds, err := fs.FeedRepository.GetMany(ctx, usernames)
+		if err != nil || len(feeds) == 0 {
+			return err
+		}
+		for _, feed := range feeds {
+			feed.Items = fs.add(feed.Items, item)
+		}
+		_, err = fs.FeedRepository.SaveMany(ctx, feeds)
+		return err
+	})
+}
+
+func (fs FeedService) markStale(ctx context.Context, usernames []string) error {
+	return fs.Transaction.run(ctx, func(ctx context.Context) error {
+		feeds, err := fs.FeedRepository.GetMany(ctx, usernames)
+		if err != nil || len(feeds) == 0 {
+			return err
+		}
+		for _, feed := range feeds {
+			feed.Stale = true
+		}
+		_, err = fs.FeedRepository.SaveMany(ctx, feeds)
+		return err
+	})
+}
+
+// follow indexes the follow and adds the latest articles of the author to
+// the follower's feed, in the transaction of the follow
+func (fs FeedService) follow(ctx context.Context, follower, author string) error {
+	if err := fs.updateFollowIndex(ctx, follower, func(index *types.FollowIndex) {
+		index.Following = insertSorted(index.Following, author)
+	}); err != nil {
+		return err
+	}
+	if err := fs.updateFollowIndex(ctx, author, func(index *types.FollowIndex) {
+		index.Followers = insertSorted(index.Followers, follower)
+	}); err != nil {
+		return err
+	}
+	timeline, err := fs.timeline(ctx, author)
+	if err != nil {
+		return err
+	}
+	return fs.updateFeed(ctx, follower, func(feed *types.Feed) {
+		for _, item := range timeline.Items {
+			feed.Items = fs.add(feed.Items, item)
+		}
+	})
+}
+
+// unfollow removes the follow from the index and the articles of the author
+// from the follower's feed, in the transaction of the follow
+func (fs FeedService) unfollow(ctx context.Context, follower, author string) error {
+	if err := fs.updateFollowIndex(ctx, follower, func(index *types.FollowIndex) {
+		index.Following = removeSorted(index.Following, author)
+	}); err != nil {
+		return err
+	}
+	if err := fs.updateFollowIndex(ctx, author, func(index *types.FollowIndex) {
+		index.Followers = removeSorted(index.Followers, follower)
+	}); err != nil {
+		return err
+	}
+	return fs.updateFeed(ctx, follower, func(feed *types.Feed) {
+		var items = feed.Items[:0]
+		for _, item := range feed.Items {
+			if item.Author != author {
+				items = append(items, item)
+			}
+		}
+		feed.Items = items
+	})
+}
+
+// updateFeed changes an existing feed, the missing ones are built on their
+// first read
+func (fs FeedService) updateFeed(ctx context.Context, username string, change func(feed *types.Feed)) error {
+	feed, err := fs.FeedRepository.Get(ctx, username)
+	if errors.Is(err, persistTypes.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	change(feed)
+	_, err = fs.FeedRepository.Save(ctx, feed)
+	return err
+}
+
+// rebuild builds the feed of the user from the timelines of the followed
+// authors
+func (fs FeedService) rebuild(ctx context.Context, username string) (*types.Feed, error) {
+	var feed *types.Feed
+	err := fs.Transaction.run(ctx, func(ctx context.Context) error {
+		index, err := fs.followIndex(ctx, username)
+		if err != nil {
+			return err
+		}
+		feed = &types.Feed{Username: username}
+		for _, author := range index.Following {
+			timeline, err := fs.timeline(ctx, author)
+			if err != nil {
+				return err
+			}
+			for _, item := range timeline.Items {
+				feed.Items = fs.add(feed.Items, item)
+			}
+		}
+		feed, err = fs.FeedRepository.Save(ctx, feed)
+		return err
+	})
+	return feed, err
+}
+
+// followIndex returns the follows of the user, the index missing for the
+// users who followed or were followed before it existed is built from the
+// follows once
+func (fs FeedService) followIndex(ctx context.Context, username string) (*types.FollowIndex, error) {
+	index, err := fs.FollowIndexRepository.Get(ctx, username)
+	if !errors.Is(err, persistTypes.ErrNotFound) {
+		return index, err
+	}
+	follows, err := fs.FollowRepository.GetFiltered(ctx, func(f *types.Follow) bool {
+		return f.From == username || f.To == username
+	})
+	if err != nil {
+		return nil, err
+	}
+	index = &types.FollowIndex{Username: username}
+	for _, f := range follows {
+		if f.From == username {
+			index.Following = insertSorted(index.Following, f.To)
+		} else {
+			index.Followers = insertSorted(index.Followers, f.From)
+		}
+	}
+	return fs.FollowIndexRepository.Save(ctx, index)
+}
+
+func (fs FeedService) updateFollowIndex(ctx context.Context, username string, change func(index *types.FollowIndex)) error {
+	index, err := fs.followIndex(ctx, username)
+	if err != nil {
+		return err
+	}
+	change(index)
+	_, err = fs.FollowIndexRepository.Save(ctx, index)
+	return err
+}
+
+// timeline returns the latest published articles of the author, the timeline
+// missing for the authors who published before it existed is built from
+// their articles once
+func (fs FeedService) timeline(ctx context.Context, author string) (*types.Timeline, error) {
+	timeline, err := fs.TimelineRepository.Get(ctx, author)
+	if !errors.Is(err, persistTypes.ErrNotFound) {
+		return timeline, err
+	}
+	articles, err := fs.ArticleRepository.GetFiltered(ctx, func(a *types.Article) bool {
+		return a.Author.Username == author && visible(a)
+	})
+	if err != nil {
+		return nil, err
+	}
+	timeline = &types.Timeline{Author: author}
+	for _, a := range articles {
+		timeline.Items = fs.add(timeline.Items, feedItem(a))
+	}
+	return fs.TimelineRepository.Save(ctx, timeline)
+}
+
+func (fs FeedService) updateTimeline(ctx context.Context, author string, change func(items []types.FeedItem) []types.FeedItem) error {
+	timeline, err := fs.timeline(ctx, author)
+	if err != nil {
+		return err
+	}
+	timeline.Items = change(timeline.Items)
+	_, err = fs.TimelineRepository.Save(ctx, timeline)
+	return err
+}
+
+// move moves the feed and the timeline of the renamed user, the follow
+// indexes are moved by the observers of the moved follows
+func (fs FeedService) move(ctx context.Context, from, to string) error {
+	feed, err := fs.FeedRepository.Get(ctx, from)
+	if err == nil {
+		feed.Username = to
+		if _, err := fs.FeedRepository.Save(ctx, feed); err != nil {
+			return err
+		}
+		if err := fs.FeedRepository.Delete(ctx, from); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, persistTypes.ErrNotFound) {
+		return err
+	}
+	timeline, err := fs.TimelineRepository.Get(ctx, from)
+	if errors.Is(err, persistTypes.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	timeline.Author = to
+	for i := range timeline.Items {
+		timeline.Items[i].Author = to
+	}
+	if _, err := fs.TimelineRepository.Save(ctx, timeline); err != nil {
+		return err
+	}
+	return fs.TimelineRepository.Delete(ctx, from)
+}
+
+// remove deletes the feed and the indexes of the user
+func (fs FeedService) remove(ctx context.Context, username string) error {
+	if err := fs.FeedRepository.Delete(ctx, username); err != nil {
+		return err
+	}
+	if err := fs.FollowIndexRepository.Delete(ctx, username); err != nil {
+		return err
+	}
+	return fs.TimelineRepository.Delete(ctx, username)
+}
+
+// add inserts the item keeping the items ordered and bounded
+func (fs FeedService) add(items []types.FeedItem, item types.FeedItem) []types.FeedItem {
+	for _, existing := range items {
+		if existing.ArticleID == item.ArticleID {
+			return items
+		}
+	}
+	i := sort.Search(len(items), func(i int) bool {
+		return items[i].CreatedAt.Before(item.CreatedAt)
+	})
+	items = append(items, types.FeedItem{})
+	copy(items[i+1:], items[i:])
+	items[i] = item
+	if size := fs.size(); len(items) > size {
+		items = items[:size]
+	}
+	return items
+}
+
+func (fs FeedService) size() int {
+	if fs.Size <= 0 {
+		return DefaultFeedSize
+	}
+	return fs.Size
+}
+
+func feedItem(a *types.Article) types.FeedItem {
+	return types.FeedItem{
+		ArticleID: a.Key(),
+		Author:    a.Author.Username,
+		CreatedAt: a.PublishedAt(),
+	}
+}
+
+func withoutArticle(items []types.FeedItem, key string) []types.FeedItem {
+	var res = items[:0]
+	for _, item := range items {
+		if item.ArticleID != key {
+			res = append(res, item)
+		}
+	}
+	return res
+}
+
+// insertSorted adds the value to the sorted list unless it is already there
+func insertSorted(list []string, value string) []string {
+	i := sort.SearchStrings(list, value)
+	if i < len(list) && list[i] == value {
+		return list
+	}
+	list = append(list, "")
+	copy(list[i+1:], list[i:])
+	list[i] = value
+	return list
+}
+
+func removeSorted(list []string, value string) []string {
+	i := sort.SearchStrings(list, value)
+	if i == len(list) || list[i] != value {
+		return list
+	}
+	return append(list[:i], list[i+1:]...)
+}
@@ -0,0 +1,238 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/borosr/realworld/persist"
+	persistTypes "github.com/borosr/realworld/persist/types"
+	"github.com/borosr/realworld/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestFeedService_Add(t *testing.T) {
+	now := time.Now()
+	fs := FeedService{Size: 3}
+	var items []types.FeedItem
+	for _, id := range []string{"b", "d", "a", "c", "e"} {
+		items = fs.add(items, types.FeedItem{ArticleID: id, CreatedAt: now.Add(time.Duration(id[0]) * time.Minute)})
+	}
+	items = fs.add(items, types.FeedItem{ArticleID: "e", CreatedAt: now.Add(time.Hour)})
+	var ids []string
+	for _, item := range items {
+		ids = append(ids, item.ArticleID)
+	}
+	assert.Equal(t, []string{"e", "d", "c"}, ids, "newest first, bounded and without duplicates")
+}
+
+func TestFeedService_Publish(t *testing.T) {
+	ctx := context.Background()
+	article := &types.Article{
+		ID:        "new-article",
+		Author:    types.Profile{Username: "author"},
+		CreatedAt: time.Now(),
+	}
+	item := feedItem(article)
+	older := types.FeedItem{ArticleID: "older", CreatedAt: article.CreatedAt.Add(-time.Hour)}
+
+	mockTimelineRepo := MockRepository[*types.Timeline]{}
+	mockIndexRepo := MockRepository[*types.FollowIndex]{}
+	mockFeedRepo := MockRepository[*types.Feed]{}
+	mockTimelineRepo.On("Get", ctx, "author").
+		Return(&types.Timeline{Author: "author", Items: []types.FeedItem{older}}, nil)
+	mockTimelineRepo.On("Save", ctx, &types.Timeline{Author: "author", Items: []types.FeedItem{item, older}}).
+		Return(&types.Timeline{}, nil)
+	mockIndexRepo.On("Get", ctx, "author").
+		Return(&types.FollowIndex{Username: "author", Followers: []string{"new-reader", "reader"}}, nil)
+	mockFeedRepo.On("GetMany", ctx, []string{"new-reader", "reader"}).
+		Return([]*types.Feed{{Username: "reader", Items: []types.FeedItem{older}}}, nil)
+	mockFeedRepo.On("SaveMany", ctx, []*types.Feed{{Username: "reader", Items: []types.FeedItem{item, older}}}).
+		Return([]*types.Feed{}, nil)
+	fs := FeedService{
+		FeedRepository:        &mockFeedRepo,
+		FollowIndexRepository: &mockIndexRepo,
+		TimelineRepository:    &mockTimelineRepo,
+	}
+	assert.Nil(t, fs.publish(ctx, article))
+	mockTimelineRepo.AssertExpectations(t)
+	mockFeedRepo.AssertExpectations(t)
+}
+
+func TestFeedService_FanOutFailure(t *testing.T) {
+	ctx := context.Background()
+	item := types.FeedItem{ArticleID: "new-article", Author: "author", CreatedAt: time.Now()}
+	failure := errors.New("failure")
+
+	mockFeedRepo := MockRepository[*types.Feed]{}
+	mockFeedRepo.On("GetMany", ctx, []string{"reader"}).
+		Return([]*types.Feed{{Username: "reader"}}, nil)
+	mockFeedRepo.On("SaveMany", ctx, mock.MatchedBy(func(feeds []*types.Feed) bool {
+		return !feeds[0].Stale
+	})).
+		Return([]*types.Feed{}, failure).Times(feedAttempts)
+	mockFeedRepo.On("SaveMany", ctx, mock.MatchedBy(func(feeds []*types.Feed) bool {
+		return feeds[0].Stale
+	})).
+		Return([]*types.Feed{}, nil).Once()
+	fs := FeedService{FeedRepository: &mockFeedRepo}
+	fs.fanOut(ctx, []string{"reader"}, item)
+	mockFeedRepo.AssertExpectations(t)
+}
+
+func TestFeedService_Articles(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	followed := &types.Article{ID: "followed", Author: types.Profile{Username: "author"}, CreatedAt: now}
+	earlier := &types.Article{ID: "earlier", Author: types.Profile{Username: "author"}, CreatedAt: now.Add(-time.Hour)}
+
+	mockFollowRepo := MockRepository[*types.Follow]{}
+	mockIndexRepo := MockRepository[*types.FollowIndex]{}
+	mockTimelineRepo := MockRepository[*types.Timeline]{}
+	mockFeedRepo := MockRepository[*types.Feed]{}
+	mockArticleRepo := MockRepository[*types.Article]{}
+	mockFeedRepo.On("Get", ctx, "reader").
+		Return(nil, persistTypes.ErrNotFound)
+	mockIndexRepo.On("Get", ctx, "reader").
+		Return(nil, persistTypes.ErrNotFound)
+	mockFollowRepo.On("GetFiltered", ctx, mock.MatchedBy(func(f persistTypes.Filter[*types.Follow]) bool {
+		return f(&types.Follow{From: "reader", To: "author"}) && !f(&types.Follow{From: "other", To: "author"})
+	})).
+		Return([]*types.Follow{{From: "reader", To: "author"}, {From: "follower", To: "reader"}}, nil)
+	mockIndexRepo.On("Save", ctx, &types.FollowIndex{Username: "reader", Followers: []string{"follower"}, Following: []string{"author"}}).
+		Return(&types.FollowIndex{Username: "reader", Followers: []string{"follower"}, Following: []string{"author"}}, nil)
+	mockTimelineRepo.On("Get", ctx, "author").
+		Return(&types.Timeline{Author: "author", Items: []types.FeedItem{feedItem(earlier), feedItem(followed)}}, nil)
+	mockFeedRepo.On("Save", ctx, mock.MatchedBy(func(f *types.Feed) bool {
+		return f.Username == "reader" && len(f.Items) == 2 && !f.Stale
+	})).
+		Return(&types.Feed{Username: "reader", Items: []types.FeedItem{feedItem(followed), feedItem(earlier)}}, nil)
+	mockArticleRepo.On("GetMany", ctx, []string{"followed", "earlier"}).
+		Return([]*types.Article{followed, earlier}, nil)
+	fs := FeedService{
+		FeedRepository:        &mockFeedRepo,
+		FollowRepository:      &mockFollowRepo,
+		FollowIndexRepository: &mockIndexRepo,
+		TimelineRepository:    &mockTimelineRepo,
+		ArticleRepository:     &mockArticleRepo,
+	}
+	articles, err := fs.Articles(ctx, "reader")
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Article{followed, earlier}, articles, "the missing feed is built from the timelines")
+	mockFeedRepo.AssertExpectations(t)
+	mockIndexRepo.AssertExpectations(t)
+	mockArticleRepo.AssertNotCalled(t, "GetFiltered", mock.Anything, mock.Anything)
+}
+
+func TestFeedService_ArticlesOfStaleFeed(t *testing.T) {
+	ctx := context.Background()
+	article := &types.Article{ID: "missed", Author: types.Profile{Username: "author"}, CreatedAt: time.Now()}
+
+	mockIndexRepo := MockRepository[*types.FollowIndex]{}
+	mockTimelineRepo := MockRepository[*types.Timeline]{}
+	mockFeedRepo := MockRepository[*types.Feed]{}
+	mockArticleRepo := MockRepository[*types.Article]{}
+	mockFeedRepo.On("Get", ctx, "reader").
+		Return(&types.Feed{Username: "reader", Stale: true}, nil)
+	mockIndexRepo.On("Get", ctx, "reader").
+		Return(&types.FollowIndex{Username: "reader", Following: []string{"author"}}, nil)
+	mockTimelineRepo.On("Get", ctx, "author").
+		Return(&types.Timeline{Author: "author", Items: []types.FeedItem{feedItem(article)}}, nil)
+	mockFeedRepo.On("Save", ctx, &types.Feed{Username: "reader", Items: []types.FeedItem{feedItem(article)}}).
+		Return(&types.Feed{Username: "reader", Items: []types.FeedItem{feedItem(article)}}, nil)
+	mockArticleRepo.On("GetMany", ctx, []string{"missed"}).
+		Return([]*types.Article{article}, nil)
+	fs := FeedService{
+		FeedRepository:        &mockFeedRepo,
+		FollowIndexRepository: &mockIndexRepo,
+		TimelineRepository:    &mockTimelineRepo,
+		ArticleRepository:     &mockArticleRepo,
+	}
+	articles, err := fs.Articles(ctx, "reader")
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Article{article}, articles, "the stale feed is rebuilt")
+	mockFeedRepo.AssertExpectations(t)
+}
+
+func TestFeedService_Follow(t *testing.T) {
+	ctx := context.Background()
+	item := types.FeedItem{ArticleID: "a", Author: "author", CreatedAt: time.Now()}
+
+	mockIndexRepo := MockRepository[*types.FollowIndex]{}
+	mockTimelineRepo := MockRepository[*types.Timeline]{}
+	mockFeedRepo := MockRepository[*types.Feed]{}
+	mockIndexRepo.On("Get", ctx, "reader").
+		Return(&types.FollowIndex{Username: "reader", Following: []string{"other"}}, nil)
+	mockIndexRepo.On("Save", ctx, &types.FollowIndex{Username: "reader", Following: []string{"author", "other"}}).
+		Return(&types.FollowIndex{}, nil)
+	mockIndexRepo.On("Get", ctx, "author").
+		Return(&types.FollowIndex{Username: "author"}, nil)
+	mockIndexRepo.On("Save", ctx, &types.FollowIndex{Username: "author", Followers: []string{"reader"}}).
+		Return(&types.FollowIndex{}, nil)
+	mockTimelineRepo.On("Get", ctx, "author").
+		Return(&types.Timeline{Author: "author", Items: []types.FeedItem{item}}, nil)
+	mockFeedRepo.On("Get", ctx, "reader").
+		Return(&types.Feed{Username: "reader"}, nil)
+	mockFeedRepo.On("Save", ctx, &types.Feed{Username: "reader", Items: []types.FeedItem{item}}).
+		Return(&types.Feed{}, nil)
+	fs := FeedService{
+		FeedRepository:        &mockFeedRepo,
+		FollowIndexRepository: &mockIndexRepo,
+		TimelineRepository:    &mockTimelineRepo,
+	}
+	assert.Nil(t, fs.follow(ctx, "reader", "author"))
+	mockIndexRepo.AssertExpectations(t)
+	mockFeedRepo.AssertExpectations(t)
+}
+
+func TestFeedService_Unfollow(t *testing.T) {
+	ctx := context.Background()
+	mockIndexRepo := MockRepository[*types.FollowIndex]{}
+	mockFeedRepo := MockRepository[*types.Feed]{}
+	mockIndexRepo.On("Get", ctx, "reader").
+		Return(&types.FollowIndex{Username: "reader", Following: []string{"author", "other"}}, nil)
+	mockIndexRepo.On("Save", ctx, &types.FollowIndex{Username: "reader", Following: []string{"other"}}).
+		Return(&types.FollowIndex{}, nil)
+	mockIndexRepo.On("Get", ctx, "author").
+		Return(&types.FollowIndex{Username: "author", Followers: []string{"reader"}}, nil)
+	mockIndexRepo.On("Save", ctx, &types.FollowIndex{Username: "author", Followers: []string{}}).
+		Return(&types.FollowIndex{}, nil)
+	mockFeedRepo.On("Get", ctx, "reader").
+		Return(&types.Feed{Username: "reader", Items: []types.FeedItem{
+			{ArticleID: "a", Author: "author"},
+			{ArticleID: "b", Author: "other"},
+		}}, nil)
+	mockFeedRepo.On("Save", ctx, &types.Feed{Username: "reader", Items: []types.FeedItem{
+		{ArticleID: "b", Author: "other"},
+	}}).
+		Return(&types.Feed{}, nil)
+	fs := FeedService{
+		FeedRepository:        &mockFeedRepo,
+		FollowIndexRepository: &mockIndexRepo,
+	}
+	assert.Nil(t, fs.unfollow(ctx, "reader", "author"))
+	mockIndexRepo.AssertExpectations(t)
+	mockFeedRepo.AssertExpectations(t)
+}
+
+func TestPublished(t *testing.T) {
+	deletedAt := time.Now()
+	draft := &types.Article{Status: types.ArticleDraft}
+	public := &types.Article{Status: types.ArticlePublished}
+	legacy := &types.Article{}
+	trashed := &types.Article{Status: types.ArticlePublished, DeletedAt: &deletedAt}
+	assert.True(t, published(persist.Event[*types.Article]{Operation: persist.OperationCreate, After: public}))
+	assert.True(t, published(persist.Event[*types.Article]{Operation: persist.OperationCreate, After: legacy}))
+	assert.False(t, published(persist.Event[*types.Article]{Operation: persist.OperationCreate, After: draft}))
+	assert.True(t, published(persist.Event[*types.Article]{Operation: persist.OperationUpdate, Before: draft, After: public}))
+	assert.False(t, published(persist.Event[*types.Article]{Operation: persist.OperationUpdate, Before: legacy, After: public}))
+	assert.False(t, published(persist.Event[*types.Article]{Operation: persist.OperationDelete, Before: public}))
+	assert.True(t, published(persist.Event[*types.Article]{Operation: persist.OperationUpdate, Before: trashed, After: public}), "restored")
+
+	assert.True(t, withdrawn(persist.Event[*types.Article]{Operation: persist.OperationUpdate, Before: public, After: trashed}))
+	assert.True(t, withdrawn(persist.Event[*types.Article]{Operation: persist.OperationUpdate, Before: public, After: draft}))
+	assert.True(t, withdrawn(persist.Event[*types.Article]{Operation: persist.OperationDelete, Before: public}))
+	assert.False(t, withdrawn(persist.Event[*types.Article]{Operation: persist.OperationUpdate, Before: draft, After: public}))
+}
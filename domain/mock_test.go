@@ -2,6 +2,7 @@ package domain
 
 import (
 	"context"
+	"time"
 
 	persistTypes "github.com/borosr/realworld/persist/types"
 	"github.com/borosr/realworld/types"
@@ -17,6 +18,21 @@ func (m *MockRepository[Type]) Save(ctx context.Context, data Type) (Type, error
 	return args.Get(0).(Type), args.Error(1)
 }
 
+func (m *MockRepository[Type]) SaveWithTTL(ctx context.Context, data Type, ttl time.Duration) (Type, error) {
+	args := m.Called(ctx, data, ttl)
+	return args.Get(0).(Type), args.Error(1)
+}
+
+func (m *MockRepository[Type]) SaveMany(ctx context.Context, data []Type) ([]Type, error) {
+	args := m.Called(ctx, data)
+	return args.Get(0).([]Type), args.Error(1)
+}
+
+func (m *MockRepository[Type]) GetMany(ctx context.Context, keys []string) ([]Type, error) {
+	args := m.Called(ctx, keys)
+	return args.Get(0).([]Type), args.Error(1)
+}
+
 func (m *MockRepository[Type]) Get(ctx context.Context, key string) (Type, error) {
 	args := m.Called(ctx, key)
 	res := args.Get(0)
@@ -53,11 +69,86 @@ func (m *MockRepository[Type]) Delete(ctx context.Context, key string) error {
 	return args.Error(0)
 }
 
+func (m *MockRepository[Type]) DeleteFiltered(ctx context.Context, filters ...persistTypes.Filter[Type]) (uint64, error) {
+	var is = make([]interface{}, 0, len(filters)+1)
+	is = append(is, ctx)
+	for _, f := range filters {
+		is = append(is, f)
+	}
+	args := m.Called(is...)
+	return uint64(args.Int(0)), args.Error(1)
+}
+
+func (m *MockRepository[Type]) GetRange(ctx context.Context, from string, limit int) ([]Type, error) {
+	args := m.Called(ctx, from, limit)
+	return args.Get(0).([]Type), args.Error(1)
+}
+
+func (m *MockRepository[Type]) GetRangeBefore(ctx context.Context, before string, limit int) ([]Type, error) {
+	args := m.Called(ctx, before, limit)
+	return args.Get(0).([]Type), args.Error(1)
+}
+
 func (m *MockRepository[Type]) Sequence(ctx context.Context, key string) (uint64, error) {
 	args := m.Called(ctx, key)
 	return uint64(args.Int(0)), args.Error(1)
 }
 
+func (m *MockRepository[Type]) DeleteSequence(ctx context.Context, key string) error {
+	args := m.Called(ctx, key)
+	return args.Error(0)
+}
+
+type MockTrash[Type persistTypes.Storable] struct {
+	mock.Mock
+}
+
+func (m *MockTrash[Type]) GetFiltered(ctx context.Context, filters ...persistTypes.Filter[Type]) ([]Type, error) {
+	var is = make([]interface{}, 0, len(filters)+1)
+	is = append(is, ctx)
+	for _, f := range filters {
+		is = append(is, f)
+	}
+	args := m.Called(is...)
+	return args.Get(0).([]Type), args.Error(1)
+}
+
+func (m *MockTrash[Type]) Get(ctx context.Context, key string) (Type, error) {
+	args := m.Called(ctx, key)
+	res := args.Get(0)
+	err := args.Error(1)
+	if res == nil {
+		var t Type
+		return t, err
+	}
+	return res.(Type), err
+}
+
+func (m *MockTrash[Type]) Restore(ctx context.Context, key string) (Type, error) {
+	args := m.Called(ctx, key)
+	return args.Get(0).(Type), args.Error(1)
+}
+
+func (m *MockTrash[Type]) Purge(ctx context.Context, deletedBefore time.Time) (uint64, error) {
+	args := m.Called(ctx, deletedBefore)
+	return uint64(args.Int(0)), args.Error(1)
+}
+
+func (m *MockTrash[Type]) Remove(ctx context.Context, filters ...persistTypes.Filter[Type]) (uint64, error) {
+	var is = make([]interface{}, 0, len(filters)+1)
+	is = append(is, ctx)
+	for _, f := range filters {
+		is = append(is, f)
+	}
+	args := m.Called(is...)
+	return uint64(args.Int(0)), args.Error(1)
+}
+
+func (m *MockTrash[Type]) SaveMany(ctx context.Context, records []Type) ([]Type, error) {
+	args := m.Called(ctx, records)
+	return args.Get(0).([]Type), args.Error(1)
+}
+
 type MockUserService struct {
 	mock.Mock
 }
@@ -81,3 +172,12 @@ func (m *MockUserService) Update(ctx context.Context, u types.User) (types.User,
 	args := m.Called(ctx, u)
 	return args.Get(0).(types.User), args.Error(1)
 }
+
+type MockFeedService struct {
+	mock.Mock
+}
+
+func (m *MockFeedService) Articles(ctx context.Context, username string) ([]*types.Article, error) {
+	args := m.Called(ctx, username)
+	return args.Get(0).([]*types.Article), args.Error(1)
+}
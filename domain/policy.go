@@ -0,0 +1,87 @@
+package domain
+
+import (
+	"context"
+
+	"github.com/borosr/realworld/lib/api"
+	"github.com/borosr/realworld/lib/broken"
+	"github.com/borosr/realworld/types"
+)
+
+// The policies decide whether the user may act on the content, they compare
+// the user with the authors by username and return a forbidden error
+// otherwise
+
+var (
+	ErrNoActor          = broken.Forbidden("the user of the request is unknown")
+	ErrNotArticleAuthor = broken.Forbidden("only the author can modify the article")
+	ErrNotCommentAuthor = broken.Forbidden("only the author of the article or the comment can delete the comment")
+	ErrNotRestorer      = broken.Forbidden("only the author can restore the deleted content")
+	ErrNotCommentEditor = broken.Forbidden("only the author can edit the comment")
+	ErrNotHistoryReader = broken.Forbidden("only the author can read the revisions of the article")
+	ErrNotEditsReader   = broken.Forbidden("only the author can read the history of the comment")
+)
+
+// CanEditArticle allows the author to update and delete the article
+func CanEditArticle(user types.User, article *types.Article) error {
+	if !isAuthor(user, article.Author) {
+		return ErrNotArticleAuthor
+	}
+	return nil
+}
+
+// CanReadRevisions allows the author to read the history of the article
+func CanReadRevisions(user types.User, article *types.Article) error {
+	if !isAuthor(user, article.Author) {
+		return ErrNotHistoryReader
+	}
+	return nil
+}
+
+// CanDeleteComment allows the author of the comment and the author of the
+// article to delete the comment
+func CanDeleteComment(user types.User, article *types.Article, comment *types.Comment) error {
+	if !isAuthor(user, comment.Author) && !isAuthor(user, article.Author) {
+		return ErrNotCommentAuthor
+	}
+	return nil
+}
+
+// CanEditComment allows the author of the comment to edit it
+func CanEditComment(user types.User, comment *types.Comment) error {
+	if !isAuthor(user, comment.Author) {
+		return ErrNotCommentEditor
+	}
+	return nil
+}
+
+// CanReadCommentHistory allows the author of the comment to read its former
+// bodies
+func CanReadCommentHistory(user types.User, comment *types.Comment) error {
+	if !isAuthor(user, comment.Author) {
+		return ErrNotEditsReader
+	}
+	return nil
+}
+
+// CanRestore allows the author of the deleted article or comment to restore
+// it
+func CanRestore(user types.User, author types.Profile) error {
+	if !isAuthor(user, author) {
+		return ErrNotRestorer
+	}
+	return nil
+}
+
+func isAuthor(user types.User, author types.Profile) bool {
+	return user.Username != "" && user.Username == author.Username
+}
+
+// actor returns the user of the request
+func actor(ctx context.Context, userService UserDescriptor) (types.User, error) {
+	email, err := api.GetValue[string](ctx, "email")
+	if err != nil || email == "" {
+		return types.User{}, ErrNoActor
+	}
+	return userService.GetByEmail(ctx, email)
+}
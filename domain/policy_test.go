@@ -0,0 +1,130 @@
+package domain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/borosr/realworld/lib/broken"
+	persistTypes "github.com/borosr/realworld/persist/types"
+	"github.com/borosr/realworld/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestPolicies(t *testing.T) {
+	author := types.User{Profile: types.Profile{Username: "author"}}
+	commenter := types.User{Profile: types.Profile{Username: "commenter"}}
+	other := types.User{Profile: types.Profile{Username: "other"}}
+	article := &types.Article{Author: author.Profile}
+	comment := &types.Comment{CommonComment: types.CommonComment{Author: commenter.Profile}}
+
+	assert.Nil(t, CanEditArticle(author, article))
+	assert.ErrorIs(t, CanEditArticle(commenter, article), ErrNotArticleAuthor)
+	assert.ErrorIs(t, CanEditArticle(types.User{}, &types.Article{}), ErrNotArticleAuthor,
+		"empty usernames never match")
+
+	assert.Nil(t, CanDeleteComment(author, article, comment))
+	assert.Nil(t, CanDeleteComment(commenter, article, comment))
+	assert.ErrorIs(t, CanDeleteComment(other, article, comment), ErrNotCommentAuthor)
+
+	assert.Nil(t, CanRestore(author, article.Author))
+	assert.ErrorIs(t, CanRestore(other, article.Author), ErrNotRestorer)
+}
+
+func TestArticleService_Forbidden(t *testing.T) {
+	const (
+		email = "other@email.com"
+		slug  = "some-article"
+	)
+	ctx := context.WithValue(context.Background(), "email", email)
+	article := &types.Article{
+		Slug:   slug,
+		Author: types.Profile{Username: "author"},
+	}
+	comment := &types.Comment{
+		CommonComment: types.CommonComment{
+			ID:     1,
+			Author: types.Profile{Username: "commenter"},
+		},
+		Slug: slug,
+	}
+
+	mockArticleRepo := MockRepository[*types.Article]{}
+	mockCommentRepo := MockRepository[*types.Comment]{}
+	mockArticleRepo.On("Get", ctx, slug).
+		Return(article, nil)
+	mockCommentRepo.On("Get", ctx, comment.Key()).
+		Return(comment, nil)
+	service := MockUserService{}
+	service.On("GetByEmail", ctx, email).
+		Return(types.User{Email: email, Profile: types.Profile{Username: "other"}}, nil)
+	as := ArticleService{
+		ArticleRepository: &mockArticleRepo,
+		CommentRepository: &mockCommentRepo,
+		UserService:       &service,
+	}
+
+	_, err := as.Update(ctx, slug, types.ArticleRequest{Body: "changed"})
+	assertForbidden(t, err)
+	assertForbidden(t, as.Delete(ctx, slug))
+	assertForbidden(t, as.DeleteComment(ctx, slug, 1))
+	mockArticleRepo.AssertNotCalled(t, "Save")
+	mockArticleRepo.AssertNotCalled(t, "Delete")
+	mockCommentRepo.AssertNotCalled(t, "Delete")
+
+	_, err = as.Update(context.Background(), slug, types.ArticleRequest{Body: "changed"})
+	assert.ErrorIs(t, err, ErrNoActor)
+}
+
+func TestArticleService_DeleteComment(t *testing.T) {
+	const (
+		email = "author@email.com"
+		slug  = "some-article"
+	)
+	ctx := context.WithValue(context.Background(), "email", email)
+	article := &types.Article{
+		Slug:   slug,
+		Author: types.Profile{Username: "author"},
+	}
+	comment := &types.Comment{
+		CommonComment: types.CommonComment{
+			ID:     1,
+			Author: types.Profile{Username: "commenter"},
+		},
+		Slug: slug,
+	}
+	missing := types.Comment{CommonComment: types.CommonComment{ID: 2}, Slug: slug}
+
+	mockArticleRepo := MockRepository[*types.Article]{}
+	mockCommentRepo := MockRepository[*types.Comment]{}
+	mockArticleRepo.On("Get", ctx, slug).
+		Return(article, nil)
+	mockCommentRepo.On("Get", ctx, comment.Key()).
+		Return(comment, nil)
+	mockCommentRepo.On("Get", ctx, missing.Key()).
+		Return(nil, persistTypes.ErrNotFound)
+	mockCommentRepo.On("Delete", ctx, comment.Key()).
+		Return(nil)
+	mockCommentRepo.On("GetFiltered", ctx, mock.Anything).
+		Return([]*types.Comment{}, nil)
+	service := MockUserService{}
+	service.On("GetByEmail", ctx, email).
+		Return(types.User{Email: email, Profile: types.Profile{Username: "author"}}, nil)
+	as := ArticleService{
+		ArticleRepository: &mockArticleRepo,
+		CommentRepository: &mockCommentRepo,
+		UserService:       &service,
+	}
+
+	assert.Nil(t, as.DeleteComment(ctx, slug, 1), "the author of the article moderates the comments")
+	assert.Nil(t, as.DeleteComment(ctx, slug, 2))
+	mockCommentRepo.AssertNumberOfCalls(t, "Delete", 1)
+}
+
+func assertForbidden(t *testing.T, err error) {
+	t.Helper()
+	var thing *broken.Thing
+	if assert.ErrorAs(t, err, &thing) {
+		assert.Equal(t, broken.TypeForbidden, thing.Type)
+	}
+}
@@ -2,9 +2,12 @@ package domain
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
+	"github.com/borosr/realworld/lib/api"
 	"github.com/borosr/realworld/persist"
+	persistTypes "github.com/borosr/realworld/persist/types"
 	"github.com/borosr/realworld/types"
 )
 
@@ -29,7 +32,26 @@ func (ps ProfileService) GetByUsername(ctx context.Context, username string) (ty
 	if len(users) != 1 {
 		return types.Profile{}, fmt.Errorf("unable to find profile with username: %s", username)
 	}
-	return users[0].Profile, nil
+	profile := users[0].Profile
+	email, err := api.GetValue[string](ctx, "email")
+	if err != nil || email == "" {
+		return profile, nil
+	}
+	// the following flag of the user of the request, the deleted users
+	// read the profiles anonymously
+	user, err := ps.UserRepository.Get(ctx, email)
+	if errors.Is(err, persistTypes.ErrNotFound) {
+		return profile, nil
+	}
+	if err != nil {
+		return types.Profile{}, err
+	}
+	following, err := followedBy(ctx, ps.FollowRepository, user.Username, []string{profile.Username})
+	if err != nil {
+		return types.Profile{}, err
+	}
+	profile.Following = following[profile.Username]
+	return profile, nil
 }
 
 func (ps ProfileService) Follow(ctx context.Context, from, to string) (types.Profile, error) {
@@ -193,3 +193,31 @@ func TestProfileService_UnfollowNotFollowedYet(t *testing.T) {
 	_, err := ps.Unfollow(ctx, fromEmail, toEmail)
 	assert.NotNil(t, err)
 }
+
+func TestProfileService_GetByUsernameViewer(t *testing.T) {
+	const email = "reader@email.com"
+	ctx := context.WithValue(context.Background(), "email", email)
+	mockUserRepo := MockRepository[*types.User]{}
+	mockFollowRepo := MockRepository[*types.Follow]{}
+	mockUserRepo.On("GetFiltered", mock.Anything, mock.Anything).
+		Return([]*types.User{{Profile: types.Profile{Username: "author"}}}, nil)
+	mockUserRepo.On("Get", ctx, email).
+		Return(&types.User{Email: email, Profile: types.Profile{Username: "reader"}}, nil)
+	mockFollowRepo.On("GetMany", ctx, []string{"reader-author"}).
+		Return([]*types.Follow{{From: "reader", To: "author"}}, nil)
+	ps := ProfileService{
+		UserRepository:   &mockUserRepo,
+		FollowRepository: &mockFollowRepo,
+	}
+	profile, err := ps.GetByUsername(ctx, "author")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, profile.Following)
+
+	anonymous, err := ps.GetByUsername(context.Background(), "author")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, anonymous.Following)
+}
@@ -0,0 +1,273 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/borosr/realworld/lib/broken"
+	"github.com/borosr/realworld/persist"
+	persistTypes "github.com/borosr/realworld/persist/types"
+	"github.com/borosr/realworld/types"
+)
+
+var (
+	ErrUnknownStatus = broken.Validation("unknown article status")
+	ErrPublishAtPast = broken.Validation("a scheduled article has to be published in the future")
+	// ErrNotPublished hides the drafts and the scheduled articles of the other
+	// authors as if they didn't exist
+	ErrNotPublished   = broken.NotFound("article not found")
+	ErrOwnAnonymous   = broken.Forbidden("listing the own articles needs an authenticated user")
+	ErrStatusOfOthers = broken.Forbidden("only the published articles of the other authors are listed")
+)
+
+// authorMe stands for the user of the request in the author filter
+const authorMe = "me"
+
+// Publish publishes the article, or schedules it when publishAt is in the
+// future
+func (as ArticleService) Publish(ctx context.Context, slug string, publishAt *time.Time) (types.Article, error) {
+	return as.changeStatus(ctx, slug, types.ArticlePublished, publishAt)
+}
+
+// Unpublish turns the article back to a draft
+func (as ArticleService) Unpublish(ctx context.Context, slug string) (types.Article, error) {
+	return as.changeStatus(ctx, slug, types.ArticleDraft, nil)
+}
+
+func (as ArticleService) changeStatus(ctx context.Context, slug, status string, publishAt *time.Time) (types.Article, error) {
+	user, err := actor(ctx, as.UserService)
+	if err != nil {
+		return types.Article{}, err
+	}
+	article, err := as.find(ctx, slug)
+	if err != nil {
+		return types.Article{}, err
+	}
+	if err := CanEditArticle(user, article); err != nil {
+		return types.Article{}, err
+	}
+	if err := setStatus(article, status, publishAt, time.Now()); err != nil {
+		return types.Article{}, err
+	}
+	saved, err := as.ArticleRepository.Save(ctx, article)
+	if err != nil {
+		return types.Article{}, err
+	}
+	if err := as.attachFavorite(ctx, []*types.Article{saved}); err != nil {
+		return types.Article{}, err
+	}
+	if err := as.enrich(ctx, saved); err != nil {
+		return types.Article{}, err
+	}
+	return *saved, nil
+}
+
+// scheduleKey is the key of the schedule of a tenant
+const scheduleKey = "articles"
+
+// Scheduling keeps the schedule up to date in the transactions of the changes
+// of the articles
+func Scheduling(as ArticleService) {
+	persist.Observe[*types.Article](func(ctx context.Context, e persist.Event[*types.Article]) error {
+		before, after := scheduledAt(e.Before), scheduledAt(e.After)
+		if before == nil && after == nil || before != nil && after != nil && before.Equal(*after) {
+			return nil
+		}
+		return as.updateSchedule(ctx, func(s *types.Schedule) {
+			s.Items = withScheduledItem(s.Items, e.Key, after)
+		})
+	})
+}
+
+// scheduledAt returns the time the article is due at, nil when it isn't
+// scheduled
+func scheduledAt(a *types.Article) *time.Time {
+	if a == nil || a.DeletedAt != nil || a.Status != types.ArticleScheduled {
+		return nil
+	}
+	return a.PublishAt
+}
+
+// PublishScheduled publishes the scheduled articles which are due, it returns
+// their number and the time the next scheduled article is due at, zero when
+// there is none. Every article is checked again and published in a
+// transaction of its own, so the changes of the author made meanwhile win.
+func (as ArticleService) PublishScheduled(ctx context.Context) (uint64, time.Time, error) {
+	schedule, err := as.schedule(ctx)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	now := time.Now()
+	var next time.Time
+	var due []string
+	for _, item := range schedule.Items {
+		if item.PublishAt.After(now) {
+			next = item.PublishAt
+			break
+		}
+		due = append(due, item.Article)
+	}
+	var published uint64
+	for _, key := range due {
+		if err := as.Transaction.run(ctx, func(ctx context.Context) error {
+			article, err := as.ArticleRepository.Get(ctx, key)
+			if errors.Is(err, persistTypes.ErrNotFound) {
+				return as.updateSchedule(ctx, func(s *types.Schedule) {
+					s.Items = withScheduledItem(s.Items, key, nil)
+				})
+			}
+			if err != nil {
+				return err
+			}
+			if article.Status != types.ArticleScheduled || article.PublishAt == nil || article.PublishAt.After(now) {
+				return nil
+			}
+			article.Status = types.ArticlePublished
+			if _, err := as.ArticleRepository.Save(ctx, article); err != nil {
+				return err
+			}
+			published++
+			return nil
+		}); err != nil {
+			return published, next, err
+		}
+	}
+	return published, next, nil
+}
+
+// schedule returns the schedule of the tenant, the schedule missing for the
+// articles scheduled before it existed is built from the articles once
+func (as ArticleService) schedule(ctx context.Context) (*types.Schedule, error) {
+	schedule, err := as.ScheduleRepository.Get(ctx, scheduleKey)
+	if !errors.Is(err, persistTypes.ErrNotFound) {
+		return schedule, err
+	}
+	scheduled, err := as.ArticleRepository.GetFiltered(ctx, func(a *types.Article) bool {
+		return scheduledAt(a) != nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	schedule = &types.Schedule{ID: scheduleKey}
+	for _, a := range scheduled {
+		schedule.Items = withScheduledItem(schedule.Items, a.Key(), a.PublishAt)
+	}
+	return as.ScheduleRepository.Save(ctx, schedule)
+}
+
+func (as ArticleService) updateSchedule(ctx context.Context, change func(s *types.Schedule)) error {
+	schedule, err := as.schedule(ctx)
+	if err != nil {
+		return err
+	}
+	change(schedule)
+	_, err = as.ScheduleRepository.Save(ctx, schedule)
+	return err
+}
+
+// withScheduledItem moves the article to its place in the items sorted by
+// their publishAt, or removes it when publishAt is nil
+func withScheduledItem(items []types.ScheduledItem, key string, publishAt *time.Time) []types.ScheduledItem {
+	var res = make([]types.ScheduledItem, 0, len(items)+1)
+	for _, item := range items {
+		if item.Article != key {
+			res = append(res, item)
+		}
+	}
+	if publishAt == nil {
+		return res
+	}
+	i := sort.Search(len(res), func(i int) bool {
+		return res[i].PublishAt.After(*publishAt)
+	})
+	res = append(res, types.ScheduledItem{})
+	copy(res[i+1:], res[i:])
+	res[i] = types.ScheduledItem{Article: key, PublishAt: *publishAt}
+	return res
+}
+
+// setStatus moves the article to the status, the published articles with a
+// future publishAt are scheduled
+func setStatus(a *types.Article, status string, publishAt *time.Time, now time.Time) error {
+	switch status {
+	case types.ArticlePublished, types.ArticleScheduled:
+		if publishAt != nil && publishAt.After(now) {
+			a.Status = types.ArticleScheduled
+			a.PublishAt = publishAt
+			return nil
+		}
+		if status == types.ArticleScheduled {
+			return ErrPublishAtPast
+		}
+		if a.PublishAt == nil || a.Status == types.ArticleScheduled {
+			a.PublishAt = &now
+		}
+		a.Status = types.ArticlePublished
+	case types.ArticleDraft:
+		a.Status = types.ArticleDraft
+		a.PublishAt = nil
+	case types.ArticleArchived:
+		a.Status = types.ArticleArchived
+	default:
+		return ErrUnknownStatus
+	}
+	return nil
+}
+
+// requestedStatus defaults to published, the future publishAt of the request
+// schedules the article then
+func requestedStatus(a types.ArticleRequest) string {
+	if a.Status == "" {
+		return types.ArticlePublished
+	}
+	return a.Status
+}
+
+// visible hides the drafts and the scheduled articles from everyone but
+// their author
+func (as ArticleService) visible(ctx context.Context, article *types.Article) error {
+	if article.Public() {
+		return nil
+	}
+	user, err := viewer(ctx, as.UserService)
+	if err != nil {
+		return err
+	}
+	if !isAuthor(user, article.Author) {
+		return ErrNotPublished
+	}
+	return nil
+}
+
+// listing resolves the author filter and returns the filter of the status,
+// the articles which aren't published are listed to their author only, so
+// the author defaults to the user for them
+func (as ArticleService) listing(ctx context.Context, author, status string) (string, func(a *types.Article) bool, error) {
+	if author == authorMe || status != "" && status != types.ArticlePublished {
+		user, err := viewer(ctx, as.UserService)
+		if err != nil {
+			return "", nil, err
+		}
+		if user.Username == "" {
+			return "", nil, ErrOwnAnonymous
+		}
+		if author == authorMe || author == "" {
+			author = user.Username
+		}
+		if status != "" && status != types.ArticlePublished && author != user.Username {
+			return "", nil, ErrStatusOfOthers
+		}
+	}
+	switch status {
+	case "", types.ArticlePublished:
+		return author, (*types.Article).Listed, nil
+	case types.ArticleDraft, types.ArticleScheduled, types.ArticleArchived:
+		return author, func(a *types.Article) bool {
+			return a.Status == status
+		}, nil
+	default:
+		return "", nil, ErrUnknownStatus
+	}
+}
@@ -0,0 +1,186 @@
+package domain
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/borosr/realworld/lib/broken"
+	"github.com/borosr/realworld/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestSetStatus(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+
+	a := &types.Article{}
+	assert.NoError(t, setStatus(a, types.ArticlePublished, &future, now))
+	assert.Equal(t, types.ArticleScheduled, a.Status)
+	assert.Equal(t, future, *a.PublishAt)
+
+	assert.NoError(t, setStatus(a, types.ArticlePublished, nil, now))
+	assert.Equal(t, types.ArticlePublished, a.Status)
+	assert.Equal(t, now, *a.PublishAt)
+
+	assert.NoError(t, setStatus(a, types.ArticleArchived, nil, now))
+	assert.NoError(t, setStatus(a, types.ArticlePublished, nil, future))
+	assert.Equal(t, now, *a.PublishAt, "republishing keeps the publication time")
+
+	assert.NoError(t, setStatus(a, types.ArticleDraft, nil, now))
+	assert.Equal(t, types.ArticleDraft, a.Status)
+	assert.Nil(t, a.PublishAt)
+
+	assert.ErrorIs(t, setStatus(a, types.ArticleScheduled, &past, now), ErrPublishAtPast)
+	assert.ErrorIs(t, setStatus(a, types.ArticleScheduled, nil, now), ErrPublishAtPast)
+	assert.ErrorIs(t, setStatus(a, "hidden", nil, now), ErrUnknownStatus)
+	assert.Equal(t, types.ArticleDraft, a.Status)
+}
+
+func TestArticleService_PublishScheduled(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	past, soon, later := now.Add(-time.Minute), now.Add(time.Minute), now.Add(time.Hour)
+
+	mockScheduleRepo := MockRepository[*types.Schedule]{}
+	mockScheduleRepo.On("Get", ctx, scheduleKey).Return(&types.Schedule{ID: scheduleKey, Items: []types.ScheduledItem{
+		{Article: "due", PublishAt: past},
+		{Article: "unpublished", PublishAt: past},
+		{Article: "soon", PublishAt: soon},
+		{Article: "later", PublishAt: later},
+	}}, nil)
+	mockArticleRepo := MockRepository[*types.Article]{}
+	mockArticleRepo.On("Get", ctx, "due").
+		Return(&types.Article{ID: "due", Status: types.ArticleScheduled, PublishAt: &past}, nil)
+	// the author turned it back to a draft after the schedule was read
+	mockArticleRepo.On("Get", ctx, "unpublished").
+		Return(&types.Article{ID: "unpublished", Status: types.ArticleDraft}, nil)
+	mockArticleRepo.On("Save", ctx, mock.MatchedBy(func(a *types.Article) bool {
+		return a.ID == "due" && a.Status == types.ArticlePublished && a.PublishAt.Equal(past)
+	})).Return(&types.Article{}, nil)
+	var transactions int
+	as := ArticleService{
+		ArticleRepository:  &mockArticleRepo,
+		ScheduleRepository: &mockScheduleRepo,
+		Transaction:        recordTransaction(&transactions),
+	}
+	published, next, err := as.PublishScheduled(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, uint64(1), published)
+	assert.Equal(t, soon, next)
+	assert.Equal(t, 2, transactions)
+	mockArticleRepo.AssertExpectations(t)
+	mockArticleRepo.AssertNumberOfCalls(t, "Save", 1)
+	mockArticleRepo.AssertNotCalled(t, "GetFiltered", mock.Anything, mock.Anything)
+}
+
+func TestWithScheduledItem(t *testing.T) {
+	now := time.Now()
+	soon, later := now.Add(time.Minute), now.Add(time.Hour)
+	items := withScheduledItem(nil, "later", &later)
+	items = withScheduledItem(items, "now", &now)
+	items = withScheduledItem(items, "soon", &soon)
+	assert.Equal(t, []types.ScheduledItem{
+		{Article: "now", PublishAt: now},
+		{Article: "soon", PublishAt: soon},
+		{Article: "later", PublishAt: later},
+	}, items)
+	// moved to its new time, or removed
+	items = withScheduledItem(items, "now", &later)
+	items = withScheduledItem(items, "soon", nil)
+	assert.Equal(t, []types.ScheduledItem{
+		{Article: "later", PublishAt: later},
+		{Article: "now", PublishAt: later},
+	}, items)
+}
+
+func TestArticleService_GetAllStatus(t *testing.T) {
+	const email = "author@email.com"
+	ctx := context.WithValue(context.Background(), "email", email)
+
+	articles := []*types.Article{
+		{Slug: "published", Status: types.ArticlePublished, Author: types.Profile{Username: "author"}},
+		{Slug: "legacy", Author: types.Profile{Username: "other"}},
+		{Slug: "draft", Status: types.ArticleDraft, Author: types.Profile{Username: "author"}},
+		{Slug: "other-draft", Status: types.ArticleDraft, Author: types.Profile{Username: "other"}},
+		{Slug: "archived", Status: types.ArticleArchived, Author: types.Profile{Username: "author"}},
+	}
+	mockArticleRepo := MockRepository[*types.Article]{}
+	mockArticleRepo.On("GetFiltered", mock.Anything).Return(articles, nil)
+	// filtered by the author
+	mockArticleRepo.On("GetFiltered", mock.Anything, mock.Anything).
+		Return([]*types.Article{articles[0], articles[2], articles[4]}, nil)
+	mockFavoriteRepo := MockRepository[*types.Favorite]{}
+	mockFavoriteRepo.On("GetFiltered", mock.Anything, mock.Anything).Return([]*types.Favorite{}, nil)
+	mockFavoriteRepo.On("GetMany", mock.Anything, mock.Anything).Return([]*types.Favorite{}, nil)
+	mockFollowRepo := MockRepository[*types.Follow]{}
+	mockFollowRepo.On("GetMany", mock.Anything, mock.Anything).Return([]*types.Follow{}, nil)
+	service := MockUserService{}
+	service.On("GetByEmail", ctx, email).
+		Return(types.User{Profile: types.Profile{Username: "author"}}, nil)
+	as := ArticleService{
+		ArticleRepository:  &mockArticleRepo,
+		FavoriteRepository: &mockFavoriteRepo,
+		FollowRepository:   &mockFollowRepo,
+		UserService:        &service,
+	}
+
+	slugs := func(articles []*types.Article) []string {
+		var res []string
+		for _, a := range articles {
+			res = append(res, a.Slug)
+		}
+		return res
+	}
+	results, total, err := as.GetAll(context.Background(), "", "", "", "", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 2, total)
+	assert.Equal(t, []string{"published", "legacy"}, slugs(results))
+
+	results, _, err = as.GetAll(ctx, "", "me", "", types.ArticleDraft, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"draft"}, slugs(results))
+
+	_, _, err = as.GetAll(ctx, "", "other", "", types.ArticleDraft, 10, 0)
+	assert.ErrorIs(t, err, ErrStatusOfOthers)
+	_, _, err = as.GetAll(context.Background(), "", "me", "", "", 10, 0)
+	assert.ErrorIs(t, err, ErrOwnAnonymous)
+	_, _, err = as.GetAll(ctx, "", "", "", "hidden", 10, 0)
+	assert.ErrorIs(t, err, ErrUnknownStatus)
+}
+
+func TestArticleService_GetDraft(t *testing.T) {
+	const email = "other@email.com"
+	ctx := context.WithValue(context.Background(), "email", email)
+
+	mockArticleRepo := MockRepository[*types.Article]{}
+	mockArticleRepo.On("Get", mock.Anything, "draft").Return(&types.Article{
+		Slug:   "draft",
+		Status: types.ArticleDraft,
+		Author: types.Profile{Username: "author"},
+	}, nil)
+	service := MockUserService{}
+	service.On("GetByEmail", ctx, email).
+		Return(types.User{Profile: types.Profile{Username: "other"}}, nil)
+	as := ArticleService{
+		ArticleRepository: &mockArticleRepo,
+		UserService:       &service,
+	}
+	_, err := as.Get(ctx, "draft")
+	assert.ErrorIs(t, err, ErrNotPublished)
+	var thing *broken.Thing
+	if assert.ErrorAs(t, err, &thing) {
+		assert.Equal(t, broken.TypeNotFound, thing.Type, "the draft isn't revealed")
+	}
+	_, err = as.Get(context.Background(), "draft")
+	assert.ErrorIs(t, err, ErrNotPublished)
+	_, err = as.CreateComment(ctx, "draft", types.CommentRequest{Body: "leaked"})
+	assert.ErrorIs(t, err, ErrNotPublished)
+}
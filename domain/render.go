@@ -0,0 +1,87 @@
+package domain
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+
+	"github.com/borosr/realworld/lib/markdown"
+	"github.com/borosr/realworld/lib/sanitize"
+	"github.com/borosr/realworld/types"
+)
+
+// DefaultRenderCacheSize is the number of rendered bodies kept by default
+const DefaultRenderCacheSize = 1000
+
+// Renderings caches the rendered bodies of the articles by the hash of the
+// body, so an entry never goes stale and is never served for another body.
+// The least recently used ones are evicted first.
+type Renderings struct {
+	mu      sync.Mutex
+	Size    int
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type rendering struct {
+	key  string
+	html string
+}
+
+func (r *Renderings) get(key string, render func() string) string {
+	if r == nil || r.Size <= 0 {
+		return render()
+	}
+	r.mu.Lock()
+	if e, ok := r.entries[key]; ok {
+		r.order.MoveToFront(e)
+		r.mu.Unlock()
+		return e.Value.(*rendering).html
+	}
+	r.mu.Unlock()
+	// rendered without the lock, the same body may be rendered twice
+	html := render()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.entries == nil {
+		r.entries = make(map[string]*list.Element)
+		r.order = list.New()
+	}
+	if _, ok := r.entries[key]; !ok {
+		r.entries[key] = r.order.PushFront(&rendering{key: key, html: html})
+	}
+	for r.order.Len() > r.Size {
+		oldest := r.order.Back()
+		r.order.Remove(oldest)
+		delete(r.entries, oldest.Value.(*rendering).key)
+	}
+	return html
+}
+
+// RenderBody renders the Markdown body to sanitized HTML
+func RenderBody(body string) string {
+	return sanitize.HTML(markdown.ToHTML(body))
+}
+
+// Render sets the BodyHTML of the articles
+func (as ArticleService) Render(articles ...*types.Article) {
+	for _, a := range articles {
+		body := a.Body
+		a.BodyHTML = as.Renderings.get(bodyKey(body), func() string {
+			return RenderBody(body)
+		})
+	}
+}
+
+func bodyKey(body string) string {
+	sum := sha256.Sum256([]byte(body))
+	return hex.EncodeToString(sum[:])
+}
+
+// renderComment sanitizes the body of the comment, the comments are stored
+// as they were written
+func renderComment(c types.CommonComment) types.CommonComment {
+	c.Body = sanitize.HTML(c.Body)
+	return c
+}
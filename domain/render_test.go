@@ -0,0 +1,71 @@
+package domain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/borosr/realworld/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestArticleService_Render(t *testing.T) {
+	as := ArticleService{Renderings: &Renderings{Size: 2}}
+	article := &types.Article{ID: "article", Revision: 2, Body: "**bold** <script>alert(1)</script>[x](javascript:alert(1))"}
+	as.Render(article)
+	assert.Equal(t, "<p><strong>bold</strong> <a>x</a></p>\n", article.BodyHTML)
+
+	// the cache is keyed by the body, an article reusing the key of a purged
+	// one gets its own body
+	reused := &types.Article{ID: "article", Revision: 2, Body: "changed"}
+	as.Render(reused)
+	assert.Equal(t, "<p>changed</p>\n", reused.BodyHTML)
+	assert.Equal(t, 2, as.Renderings.order.Len())
+	same := &types.Article{ID: "other", Revision: 1, Body: "changed"}
+	as.Render(same)
+	assert.Equal(t, reused.BodyHTML, same.BodyHTML)
+	assert.Equal(t, 2, as.Renderings.order.Len())
+
+	// the least recently used body was evicted
+	as.Render(&types.Article{Body: "third"})
+	_, cached := as.Renderings.entries[bodyKey(article.Body)]
+	assert.False(t, cached)
+}
+
+func TestArticleService_CreateCommentSanitized(t *testing.T) {
+	const email = "test@email.com"
+	ctx := context.WithValue(context.Background(), "email", email)
+
+	mockArticleRepo := MockRepository[*types.Article]{}
+	mockCommentRepo := MockRepository[*types.Comment]{}
+	mockArticleRepo.On("Get", ctx, "article").
+		Return(&types.Article{Slug: "article"}, nil)
+	mockCommentRepo.On("Sequence", ctx, "article").Return(1, nil)
+	// stored as written, sanitized when read
+	written := `nice <a href="/x" onclick="steal()">link</a><script>steal()</script>`
+	mockCommentRepo.On("Save", ctx, mock.MatchedBy(func(c *types.Comment) bool {
+		return c.Body == written
+	})).
+		Return(&types.Comment{CommonComment: types.CommonComment{Body: written}}, nil)
+	mockCommentRepo.On("Save", ctx, mock.MatchedBy(func(c *types.Comment) bool {
+		return c.Body == "a < b"
+	})).
+		Return(&types.Comment{CommonComment: types.CommonComment{Body: "a < b"}}, nil)
+	service := MockUserService{}
+	service.On("GetByEmail", ctx, email).Return(types.User{}, nil)
+	as := ArticleService{
+		ArticleRepository: &mockArticleRepo,
+		CommentRepository: &mockCommentRepo,
+		UserService:       &service,
+	}
+	comment, err := as.CreateComment(ctx, "article", types.CommentRequest{Body: written})
+	assert.Nil(t, err)
+	assert.Equal(t, `nice <a href="/x">link</a>`, comment.Body)
+	comment, err = as.CreateComment(ctx, "article", types.CommentRequest{Body: "a < b"})
+	assert.Nil(t, err)
+	assert.Equal(t, "a &lt; b", comment.Body)
+	mockCommentRepo.AssertExpectations(t)
+
+	_, err = as.CreateComment(ctx, "article", types.CommentRequest{Body: "<script>steal()</script> "})
+	assert.Equal(t, ErrEmptyComment, err)
+}
@@ -0,0 +1,146 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	textDiff "github.com/borosr/realworld/lib/diff"
+	persistTypes "github.com/borosr/realworld/persist/types"
+	"github.com/borosr/realworld/types"
+)
+
+// GetRevisions returns the revisions of the article, the latest first
+func (as ArticleService) GetRevisions(ctx context.Context, slug string) ([]*types.Revision, error) {
+	article, err := as.history(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+	revisions, err := as.RevisionRepository.GetFiltered(ctx, func(r *types.Revision) bool {
+		return r.ArticleID == article.Key()
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i].Number > revisions[j].Number
+	})
+	return revisions, nil
+}
+
+func (as ArticleService) GetRevision(ctx context.Context, slug string, number int) (types.Revision, error) {
+	article, err := as.history(ctx, slug)
+	if err != nil {
+		return types.Revision{}, err
+	}
+	revision, err := as.revision(ctx, article, number)
+	if err != nil {
+		return types.Revision{}, err
+	}
+	return *revision, nil
+}
+
+// DiffRevisions compares the bodies of two revisions of the article line by
+// line
+func (as ArticleService) DiffRevisions(ctx context.Context, slug string, from, to int) (types.RevisionDiff, error) {
+	article, err := as.history(ctx, slug)
+	if err != nil {
+		return types.RevisionDiff{}, err
+	}
+	fromRevision, err := as.revision(ctx, article, from)
+	if err != nil {
+		return types.RevisionDiff{}, err
+	}
+	toRevision, err := as.revision(ctx, article, to)
+	if err != nil {
+		return types.RevisionDiff{}, err
+	}
+	return types.RevisionDiff{
+		From:  from,
+		To:    to,
+		Lines: textDiff.Lines(fromRevision.Body, toRevision.Body),
+	}, nil
+}
+
+// Rollback restores the content of a former revision of the article, it is
+// stored as a new revision, so the history is never rewritten
+func (as ArticleService) Rollback(ctx context.Context, slug string, number int) (types.Article, error) {
+	article, err := as.history(ctx, slug)
+	if err != nil {
+		return types.Article{}, err
+	}
+	revision, err := as.revision(ctx, article, number)
+	if err != nil {
+		return types.Article{}, err
+	}
+	return as.update(ctx, slug, types.ArticleRequest{
+		Title:       revision.Title,
+		Description: revision.Description,
+		Body:        revision.Body,
+		TagList:     append([]string{}, revision.TagList...),
+	}, true)
+}
+
+// history returns the article if the user of the request can read its
+// revisions: the former versions and the drafts before the publication are
+// shown to the author only
+func (as ArticleService) history(ctx context.Context, slug string) (*types.Article, error) {
+	user, err := actor(ctx, as.UserService)
+	if err != nil {
+		return nil, err
+	}
+	article, err := as.find(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+	if err := CanReadRevisions(user, article); err != nil {
+		return nil, err
+	}
+	return article, nil
+}
+
+func (as ArticleService) revision(ctx context.Context, article *types.Article, number int) (*types.Revision, error) {
+	r := types.Revision{ArticleID: article.Key(), Number: number}
+	return as.RevisionRepository.Get(ctx, r.Key())
+}
+
+// revise stores the next revision of the article and sets its number on the
+// article, which has to be read or built in the same attempt of the
+// transaction. The number follows the latest revision read in the
+// transaction, so a rolled back change leaves no gap and the concurrent
+// changes conflict.
+func (as ArticleService) revise(ctx context.Context, article *types.Article, author types.Profile) error {
+	number := article.Revision + 1
+	for {
+		_, err := as.revision(ctx, article, number)
+		if errors.Is(err, persistTypes.ErrNotFound) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		number++
+	}
+	article.Revision = number
+	_, err := as.RevisionRepository.Save(ctx, &types.Revision{
+		ArticleID:   article.Key(),
+		Number:      article.Revision,
+		Title:       article.Title,
+		Description: article.Description,
+		Body:        article.Body,
+		TagList:     article.TagList,
+		Author:      embedded(author),
+		CreatedAt:   article.UpdatedAt,
+	})
+	return err
+}
+
+// baseline stores the article as its first revision when it was created
+// before the revisions existed
+func (as ArticleService) baseline(ctx context.Context, article *types.Article) error {
+	_, err := as.revision(ctx, article, 1)
+	if !errors.Is(err, persistTypes.ErrNotFound) {
+		return err
+	}
+	return as.revise(ctx, article, article.Author)
+}
@@ -0,0 +1,198 @@
+package domain
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	textDiff "github.com/borosr/realworld/lib/diff"
+	persistTypes "github.com/borosr/realworld/persist/types"
+	"github.com/borosr/realworld/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// acceptRevisions mocks the revisions of the tests which don't check them
+func acceptRevisions() *MockRepository[*types.Revision] {
+	m := MockRepository[*types.Revision]{}
+	m.On("Get", mock.Anything, mock.MatchedBy(func(key string) bool {
+		return strings.HasSuffix(key, "-1")
+	})).Return(&types.Revision{}, nil)
+	m.On("Get", mock.Anything, mock.Anything).Return(nil, persistTypes.ErrNotFound)
+	m.On("Save", mock.Anything, mock.Anything).Return(&types.Revision{}, nil)
+	return &m
+}
+
+func revisionTestService(ctx context.Context, article *types.Article) (ArticleService, *MockRepository[*types.Article], *MockRepository[*types.Revision]) {
+	mockArticleRepo := MockRepository[*types.Article]{}
+	mockArticleRepo.On("Get", ctx, article.Slug).Return(article, nil)
+	mockRevisionRepo := MockRepository[*types.Revision]{}
+	mockRevisionRepo.On("Get", ctx, "article-1").Return(&types.Revision{
+		ArticleID: "article", Number: 1, Title: "Article", Body: "first\nsecond\n", TagList: []string{"a"},
+	}, nil)
+	mockRevisionRepo.On("Get", ctx, "article-2").Return(&types.Revision{
+		ArticleID: "article", Number: 2, Title: "Article", Description: "added", Body: "first\n2nd\nthird\n",
+	}, nil)
+	mockRevisionRepo.On("Get", ctx, "article-3").Return(nil, persistTypes.ErrNotFound)
+	mockTagAliasRepo := MockRepository[*types.TagAlias]{}
+	mockTagAliasRepo.On("GetMany", ctx, mock.Anything).Return([]*types.TagAlias{}, nil)
+	service := MockUserService{}
+	service.On("GetByEmail", ctx, "author@email.com").
+		Return(types.User{Profile: types.Profile{Username: "author"}}, nil)
+	return ArticleService{
+		ArticleRepository:  &mockArticleRepo,
+		RevisionRepository: &mockRevisionRepo,
+		TagAliasRepository: &mockTagAliasRepo,
+		UserService:        &service,
+	}, &mockArticleRepo, &mockRevisionRepo
+}
+
+func TestArticleService_Revisions(t *testing.T) {
+	ctx := context.WithValue(context.Background(), "email", "author@email.com")
+	article := &types.Article{ID: "article", Slug: "article", Author: types.Profile{Username: "author"}}
+	as, _, mockRevisionRepo := revisionTestService(ctx, article)
+	mockRevisionRepo.On("GetFiltered", ctx, mock.MatchedBy(func(f persistTypes.Filter[*types.Revision]) bool {
+		return f(&types.Revision{ArticleID: "article"}) && !f(&types.Revision{ArticleID: "other"})
+	})).
+		Return([]*types.Revision{{ArticleID: "article", Number: 1}, {ArticleID: "article", Number: 2}}, nil)
+
+	revisions, err := as.GetRevisions(ctx, "article")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, revisions, 2) {
+		assert.Equal(t, 2, revisions[0].Number, "latest first")
+	}
+
+	revision, err := as.GetRevision(ctx, "article", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "first\nsecond\n", revision.Body)
+	_, err = as.GetRevision(ctx, "article", 3)
+	assert.ErrorIs(t, err, persistTypes.ErrNotFound)
+
+	d, err := as.DiffRevisions(ctx, "article", 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []textDiff.Edit{
+		{Op: textDiff.Equal, Text: "first"},
+		{Op: textDiff.Delete, Text: "second"},
+		{Op: textDiff.Insert, Text: "2nd"},
+		{Op: textDiff.Insert, Text: "third"},
+	}, d.Lines)
+}
+
+func TestArticleService_RevisionsOfOthers(t *testing.T) {
+	ctx := context.WithValue(context.Background(), "email", "other@email.com")
+	article := &types.Article{ID: "article", Slug: "article", Author: types.Profile{Username: "author"}}
+	as, _, mockRevisionRepo := revisionTestService(ctx, article)
+	service := MockUserService{}
+	service.On("GetByEmail", ctx, "other@email.com").
+		Return(types.User{Profile: types.Profile{Username: "other"}}, nil)
+	as.UserService = &service
+
+	_, err := as.GetRevisions(ctx, "article")
+	assertForbidden(t, err)
+	_, err = as.GetRevision(ctx, "article", 1)
+	assertForbidden(t, err)
+	_, err = as.DiffRevisions(ctx, "article", 1, 2)
+	assertForbidden(t, err)
+	_, err = as.GetRevision(context.Background(), "article", 1)
+	assert.ErrorIs(t, err, ErrNoActor)
+	mockRevisionRepo.AssertNotCalled(t, "Get", mock.Anything, mock.Anything)
+	mockRevisionRepo.AssertNotCalled(t, "GetFiltered", mock.Anything, mock.Anything)
+}
+
+func TestArticleService_Rollback(t *testing.T) {
+	ctx := context.WithValue(context.Background(), "email", "author@email.com")
+	article := &types.Article{
+		ID:          "article",
+		Slug:        "article",
+		Title:       "Article",
+		Description: "added",
+		Body:        "first\n2nd\nthird\n",
+		Author:      types.Profile{Username: "author"},
+		UpdatedAt:   time.Now().Add(-time.Hour),
+	}
+	as, mockArticleRepo, mockRevisionRepo := revisionTestService(ctx, article)
+	mockArticleRepo.On("Save", ctx, mock.MatchedBy(func(a *types.Article) bool {
+		return a.Description == "" && a.Body == "first\nsecond\n" && len(a.TagList) == 1
+	})).
+		Return(article, nil)
+	mockRevisionRepo.On("Save", ctx, mock.MatchedBy(func(r *types.Revision) bool {
+		return r.Number == 3 && r.Body == "first\nsecond\n" && r.Author.Username == "author"
+	})).
+		Return(&types.Revision{}, nil)
+
+	_, err := as.Rollback(ctx, "article", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockArticleRepo.AssertExpectations(t)
+	mockRevisionRepo.AssertNumberOfCalls(t, "Save", 1)
+}
+
+func TestArticleService_Baseline(t *testing.T) {
+	ctx := context.Background()
+	updatedAt := time.Now().Add(-time.Hour)
+	legacy := &types.Article{Slug: "legacy", Body: "old", Author: types.Profile{Username: "author"}, UpdatedAt: updatedAt}
+
+	mockRevisionRepo := MockRepository[*types.Revision]{}
+	mockRevisionRepo.On("Get", ctx, "legacy-1").Return(nil, persistTypes.ErrNotFound)
+	mockRevisionRepo.On("Save", ctx, &types.Revision{
+		ArticleID: "legacy",
+		Number:    1,
+		Body:      "old",
+		Author:    types.Profile{Username: "author"},
+		CreatedAt: updatedAt,
+	}).
+		Return(&types.Revision{}, nil)
+	as := ArticleService{RevisionRepository: &mockRevisionRepo}
+	assert.Nil(t, as.baseline(ctx, legacy))
+	mockRevisionRepo.AssertExpectations(t)
+}
+
+func TestArticleService_CreateRetried(t *testing.T) {
+	const email = "test@email.com"
+	ctx := context.Background()
+
+	mockArticleRepo := MockRepository[*types.Article]{}
+	mockSlugRepo := MockRepository[*types.SlugAlias]{}
+	mockRevisionRepo := MockRepository[*types.Revision]{}
+	mockArticleTrash := MockTrash[*types.Article]{}
+	mockArticleTrash.On("Get", ctx, "article").Return(nil, persistTypes.ErrNotFound)
+	mockSlugRepo.On("Get", ctx, "article").Return(nil, persistTypes.ErrNotFound)
+	mockRevisionRepo.On("Get", ctx, "article-1").Return(nil, persistTypes.ErrNotFound)
+	mockRevisionRepo.On("Save", ctx, mock.MatchedBy(func(r *types.Revision) bool {
+		return r.Number == 1
+	})).
+		Return(&types.Revision{}, nil)
+	mockArticleRepo.On("Save", ctx, mock.MatchedBy(func(a *types.Article) bool {
+		return a.Revision == 1
+	})).
+		Return(&types.Article{Revision: 1}, nil)
+	service := MockUserService{}
+	service.On("GetByEmail", ctx, email).Return(types.User{}, nil)
+	as := ArticleService{
+		ArticleRepository:  &mockArticleRepo,
+		SlugRepository:     &mockSlugRepo,
+		RevisionRepository: &mockRevisionRepo,
+		ArticleTrash:       &mockArticleTrash,
+		UserService:        &service,
+		// the first attempt conflicts on its commit and is repeated
+		Transaction: func(ctx context.Context, fn func(ctx context.Context) error) error {
+			if err := fn(ctx); err != nil {
+				return err
+			}
+			return fn(ctx)
+		},
+	}
+
+	article, err := as.Create(ctx, types.ArticleRequest{Title: "Article"}, email)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, article.Revision, "the repeated attempt takes the same number")
+	mockRevisionRepo.AssertNumberOfCalls(t, "Save", 2)
+}
@@ -0,0 +1,218 @@
+package domain
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/borosr/realworld/lib/broken"
+	"github.com/borosr/realworld/lib/search"
+	"github.com/borosr/realworld/lib/tenant"
+	"github.com/borosr/realworld/persist"
+	"github.com/borosr/realworld/types"
+)
+
+// the weights of the fields of the articles in the search index
+const (
+	titleWeight       = 3
+	descriptionWeight = 2
+	bodyWeight        = 1
+)
+
+// snippetSize is the length of the highlighted part of the articles in bytes
+const snippetSize = 160
+
+var ErrEmptySearch = broken.Validation("the search query has no searchable words")
+
+type SearchDescriptor interface {
+	// Search returns the articles matching the query, the most relevant first
+	Search(ctx context.Context, q string, limit, offset int) ([]types.SearchResult, int, error)
+}
+
+// SearchIndexes holds the search index of every tenant, they are built from
+// the stored articles on the first search of the tenant
+type SearchIndexes struct {
+	// mu guards the maps only, the indexes are built without holding it
+	mu      sync.Mutex
+	indexes map[string]*search.Index
+	// building collects the changes made while the index of a tenant is
+	// built, they are applied to it after the build
+	building map[string]*pendingIndex
+}
+
+type pendingIndex struct {
+	done    chan struct{}
+	changes []func(idx *search.Index)
+	idx     *search.Index
+	err     error
+}
+
+// get returns the index of the tenant, building it when it doesn't exist
+// yet. The searches meanwhile wait for the same build.
+func (si *SearchIndexes) get(ctx context.Context, build func(ctx context.Context) (*search.Index, error)) (*search.Index, error) {
+	id := tenant.ID(ctx)
+	si.mu.Lock()
+	if idx, ok := si.indexes[id]; ok {
+		si.mu.Unlock()
+		return idx, nil
+	}
+	if p, ok := si.building[id]; ok {
+		si.mu.Unlock()
+		<-p.done
+		return p.idx, p.err
+	}
+	p := &pendingIndex{done: make(chan struct{})}
+	if si.building == nil {
+		si.building = make(map[string]*pendingIndex)
+	}
+	si.building[id] = p
+	si.mu.Unlock()
+
+	idx, err := build(ctx)
+
+	si.mu.Lock()
+	delete(si.building, id)
+	if err == nil {
+		for _, change := range p.changes {
+			change(idx)
+		}
+		if si.indexes == nil {
+			si.indexes = make(map[string]*search.Index)
+		}
+		si.indexes[id] = idx
+	}
+	p.idx, p.err = idx, err
+	si.mu.Unlock()
+	close(p.done)
+	return idx, err
+}
+
+// apply changes the index of the tenant, or records the change when the
+// index is being built. The indexes not built yet are left alone.
+func (si *SearchIndexes) apply(ctx context.Context, change func(idx *search.Index)) {
+	id := tenant.ID(ctx)
+	si.mu.Lock()
+	if p, ok := si.building[id]; ok {
+		p.changes = append(p.changes, change)
+		si.mu.Unlock()
+		return
+	}
+	idx := si.indexes[id]
+	si.mu.Unlock()
+	if idx != nil {
+		change(idx)
+	}
+}
+
+// SearchService searches the articles by their title, description and body
+type SearchService struct {
+	ArticleRepository persist.Repository[*types.Article]
+	ArticleService    ArticleService
+	Indexes           *SearchIndexes
+}
+
+// Indexing keeps the built search indexes up to date with the committed
+// changes of the articles, only the published articles are indexed
+func Indexing(ss SearchService) {
+	persist.Subscribe[*types.Article](func(ctx context.Context, e persist.Event[*types.Article]) {
+		ss.update(ctx, e)
+	})
+}
+
+// update applies a change of an article to the index of its tenant
+func (ss SearchService) update(ctx context.Context, e persist.Event[*types.Article]) {
+	if e.Operation == persist.OperationDelete || e.After.DeletedAt != nil || !e.After.Listed() {
+		ss.Indexes.apply(ctx, func(idx *search.Index) {
+			idx.Remove(e.Key)
+		})
+		return
+	}
+	fields := articleFields(e.After)
+	ss.Indexes.apply(ctx, func(idx *search.Index) {
+		idx.Add(e.Key, fields...)
+	})
+}
+
+func (ss SearchService) Search(ctx context.Context, q string, limit, offset int) ([]types.SearchResult, int, error) {
+	query := search.ParseQuery(q)
+	if query.Empty() {
+		return nil, 0, ErrEmptySearch
+	}
+	idx, err := ss.Indexes.get(ctx, ss.build)
+	if err != nil {
+		return nil, 0, err
+	}
+	matches := idx.Search(query)
+	totalCount := len(matches)
+	if offset > len(matches) {
+		offset = len(matches)
+	}
+	matches = matches[offset:]
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	var keys = make([]string, 0, len(matches))
+	var scores = make(map[string]float64, len(matches))
+	for _, m := range matches {
+		keys = append(keys, m.ID)
+		scores[m.ID] = m.Score
+	}
+	articles, err := ss.ArticleRepository.GetMany(ctx, keys)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := ss.ArticleService.attachFavorite(ctx, articles); err != nil {
+		return nil, 0, err
+	}
+	if err := ss.ArticleService.enrich(ctx, articles...); err != nil {
+		return nil, 0, err
+	}
+	var res = make([]types.SearchResult, 0, len(articles))
+	for _, a := range articles {
+		res = append(res, types.SearchResult{
+			Article: a,
+			Score:   scores[a.Key()],
+			Snippet: snippet(a, query),
+		})
+	}
+	return res, totalCount, nil
+}
+
+func (ss SearchService) build(ctx context.Context) (*search.Index, error) {
+	articles, err := ss.ArticleRepository.GetFiltered(ctx)
+	if err != nil {
+		return nil, err
+	}
+	idx := search.NewIndex()
+	for _, a := range articles {
+		if a.Listed() {
+			idx.Add(a.Key(), articleFields(a)...)
+		}
+	}
+	log.Printf("search index of %d articles built", idx.Len())
+	return idx, nil
+}
+
+func articleFields(a *types.Article) []search.Field {
+	return []search.Field{
+		{Text: a.Title, Weight: titleWeight},
+		{Text: a.Description, Weight: descriptionWeight},
+		{Text: a.Body, Weight: bodyWeight},
+	}
+}
+
+// snippet highlights the body, or the description or the title when the
+// match is only there
+func snippet(a *types.Article, q search.Query) string {
+	var first string
+	for i, text := range []string{a.Body, a.Description, a.Title} {
+		s, ok := search.Snippet(text, q, snippetSize)
+		if ok {
+			return s
+		}
+		if i == 0 {
+			first = s
+		}
+	}
+	return first
+}
@@ -0,0 +1,143 @@
+package domain
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/borosr/realworld/lib/search"
+	"github.com/borosr/realworld/persist"
+	"github.com/borosr/realworld/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func searchTestService() (SearchService, *MockRepository[*types.Article]) {
+	mockArticleRepo := MockRepository[*types.Article]{}
+	mockFavoriteRepo := MockRepository[*types.Favorite]{}
+	mockFavoriteRepo.On("GetFiltered", mock.Anything, mock.Anything).Return([]*types.Favorite{}, nil)
+	mockArticleRepo.On("GetFiltered", mock.Anything).Return([]*types.Article{
+		{ID: "dragons", Slug: "dragons", Title: "How to train your dragon", Body: "Dragons are trained with patience."},
+		{ID: "angular", Slug: "angular", Title: "Angular tips", Description: "Training for developers"},
+		{ID: "go", Slug: "go", Title: "Generics in Go"},
+	}, nil).Once()
+	return SearchService{
+		ArticleRepository: &mockArticleRepo,
+		ArticleService: ArticleService{
+			ArticleRepository:  &mockArticleRepo,
+			FavoriteRepository: &mockFavoriteRepo,
+			UserService:        &MockUserService{},
+		},
+		Indexes: &SearchIndexes{},
+	}, &mockArticleRepo
+}
+
+func TestSearchService_Search(t *testing.T) {
+	ctx := context.Background()
+	ss, mockArticleRepo := searchTestService()
+	mockArticleRepo.On("GetMany", ctx, []string{"dragons", "angular"}).Return([]*types.Article{
+		{ID: "dragons", Slug: "dragons", Title: "How to train your dragon", Body: "Dragons are trained with patience."},
+		{ID: "angular", Slug: "angular", Title: "Angular tips", Description: "Training for developers"},
+	}, nil)
+
+	results, total, err := ss.Search(ctx, "trains", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 2, total)
+	if assert.Len(t, results, 2) {
+		assert.Equal(t, "dragons", results[0].Slug)
+		assert.Greater(t, results[0].Score, results[1].Score)
+		assert.Equal(t, "Dragons are <em>trained</em> with patience.", results[0].Snippet)
+		assert.Equal(t, "<em>Training</em> for developers", results[1].Snippet)
+	}
+
+	mockArticleRepo.On("GetMany", ctx, []string{"angular"}).Return([]*types.Article{
+		{ID: "angular", Slug: "angular", Title: "Angular tips"},
+	}, nil)
+	results, total, err = ss.Search(ctx, "train", 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 2, total)
+	assert.Len(t, results, 1)
+
+	_, _, err = ss.Search(ctx, "the", 10, 0)
+	assert.ErrorIs(t, err, ErrEmptySearch)
+	mockArticleRepo.AssertNumberOfCalls(t, "GetFiltered", 1)
+}
+
+func TestSearchService_Update(t *testing.T) {
+	ctx := context.Background()
+	ss, mockArticleRepo := searchTestService()
+
+	// the index isn't built yet
+	ss.update(ctx, persist.Event[*types.Article]{
+		Operation: persist.OperationCreate,
+		Key:       "rust",
+		After:     &types.Article{ID: "rust", Title: "Rust ownership"},
+	})
+	idx, err := ss.Indexes.get(ctx, ss.build)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 3, idx.Len())
+
+	ss.update(ctx, persist.Event[*types.Article]{
+		Operation: persist.OperationCreate,
+		Key:       "rust",
+		After:     &types.Article{ID: "rust", Title: "Rust ownership"},
+	})
+	mockArticleRepo.On("GetMany", ctx, []string{"rust"}).Return([]*types.Article{
+		{ID: "rust", Slug: "rust", Title: "Rust ownership"},
+	}, nil)
+	results, _, err := ss.Search(ctx, "owner", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, "Rust <em>ownership</em>", results[0].Snippet, "prefix of the title")
+	}
+
+	now := time.Now()
+	ss.update(ctx, persist.Event[*types.Article]{
+		Operation: persist.OperationUpdate,
+		Key:       "rust",
+		After:     &types.Article{ID: "rust", Title: "Rust ownership", DeletedAt: &now},
+	})
+	ss.update(ctx, persist.Event[*types.Article]{
+		Operation: persist.OperationDelete,
+		Key:       "go",
+		Before:    &types.Article{ID: "go", Title: "Generics in Go"},
+	})
+	assert.Equal(t, 2, idx.Len())
+}
+
+func TestSearchService_UpdateDuringBuild(t *testing.T) {
+	ctx := context.Background()
+	ss, _ := searchTestService()
+
+	// the index isn't locked while it is built, the changes made meanwhile
+	// are applied after the build
+	idx, err := ss.Indexes.get(ctx, func(ctx context.Context) (*search.Index, error) {
+		ss.update(ctx, persist.Event[*types.Article]{
+			Operation: persist.OperationCreate,
+			Key:       "rust",
+			After:     &types.Article{ID: "rust", Title: "Rust ownership"},
+		})
+		ss.update(ctx, persist.Event[*types.Article]{
+			Operation: persist.OperationDelete,
+			Key:       "go",
+			Before:    &types.Article{ID: "go", Title: "Generics in Go"},
+		})
+		return ss.build(ctx)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 3, idx.Len())
+	if results := idx.Search(search.ParseQuery("ownership")); assert.Len(t, results, 1) {
+		assert.Equal(t, "rust", results[0].ID)
+	}
+	assert.Empty(t, idx.Search(search.ParseQuery("generics")))
+}
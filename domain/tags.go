@@ -0,0 +1,473 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/borosr/realworld/lib/broken"
+	"github.com/borosr/realworld/lib/tag"
+	"github.com/borosr/realworld/persist"
+	persistTypes "github.com/borosr/realworld/persist/types"
+	"github.com/borosr/realworld/types"
+)
+
+// The orders of the tag list
+const (
+	TagsAlphabetical = "alphabetical"
+	TagsPopular      = "popular"
+	TagsTrending     = "trending"
+)
+
+const (
+	// DefaultTrendingDays is the trending window by default
+	DefaultTrendingDays = 7
+	// MaxTrendingDays is the longest trending window, the daily counts are
+	// kept for this long
+	MaxTrendingDays = 90
+)
+
+// tagIndexKey is the key of the tag index of a tenant, it marks the tag
+// counts as built
+const tagIndexKey = "tags"
+
+const dayLayout = "2006-01-02"
+
+var (
+	ErrUnknownTagOrder  = broken.Validation("unknown tag order")
+	ErrInvalidTrending  = broken.Validation("the trending window has to be between 1 and 90 days")
+	ErrEmptyTag         = broken.Validation("the tag is empty")
+	ErrNothingToMerge   = broken.Validation("the tags merged are the same as the one merged into")
+	ErrTagMergeCycle    = broken.Validation("the tag merged into is an alias of a merged tag")
+	ErrTagAliasNotFound = broken.Validation("the tag alias doesn't exist")
+)
+
+// tagMu serializes the builds of the tag counts, so the articles are scanned
+// once
+var tagMu sync.Mutex
+
+type TagDescriptor interface {
+	// Tags returns the tags of the published articles with their counts in
+	// the order given, the trending ones are counted within the last days
+	Tags(ctx context.Context, order string, days, limit int) ([]types.TagCount, error)
+	// Merge replaces the tags with another one in every article
+	Merge(ctx context.Context, m types.TagMergeRequest) (types.TagMerge, error)
+	Aliases(ctx context.Context) ([]*types.TagAlias, error)
+	DeleteAlias(ctx context.Context, alias string) error
+}
+
+// TagService counts the published articles of the tags and merges the tags
+type TagService struct {
+	TagRepository     persist.Repository[*types.TagIndex]
+	StatsRepository   persist.Repository[*types.TagStats]
+	AliasRepository   persist.Repository[*types.TagAlias]
+	ArticleRepository persist.Repository[*types.Article]
+	Transaction       TransactionFunc
+	// TrendingDays is the trending window when none is requested
+	TrendingDays int
+}
+
+// CountTags keeps the tag counts up to date with the changes of the articles,
+// the counts of the changed tags are written in the transaction of the
+// article, so a failed count fails the change
+func CountTags(ts TagService) {
+	persist.Observe[*types.Article](func(ctx context.Context, e persist.Event[*types.Article]) error {
+		return ts.count(ctx, e.Before, e.After)
+	})
+}
+
+// counted returns the tags the article is counted for, only the published
+// articles are
+func counted(a *types.Article) []string {
+	if a == nil || a.DeletedAt != nil || !a.Listed() {
+		return nil
+	}
+	return tag.List(a.TagList)
+}
+
+func day(a *types.Article) string {
+	return a.PublishedAt().UTC().Format(dayLayout)
+}
+
+// count moves the article from the counts of its former tags to the counts
+// of its current ones, every tag has a record of its own. Until the counts are
+// built the change only writes the index, so a build running meanwhile
+// conflicts with it and counts the article when it is repeated.
+func (ts TagService) count(ctx context.Context, before, after *types.Article) error {
+	removed, added := counted(before), counted(after)
+	if len(removed) == 0 && len(added) == 0 {
+		return nil
+	}
+	if len(removed) == len(added) && day(before) == day(after) {
+		same := true
+		for i := range removed {
+			same = same && removed[i] == added[i]
+		}
+		if same {
+			return nil
+		}
+	}
+	index, err := ts.TagRepository.Get(ctx, tagIndexKey)
+	if errors.Is(err, persistTypes.ErrNotFound) {
+		index, err = &types.TagIndex{ID: tagIndexKey}, nil
+	}
+	if err != nil {
+		return err
+	}
+	if !index.Built {
+		_, err = ts.TagRepository.Save(ctx, index)
+		return err
+	}
+	var changed = make(map[string]*types.TagStats)
+	var stored = make(map[string]bool)
+	stats := func(t string) (*types.TagStats, error) {
+		if s, ok := changed[t]; ok {
+			return s, nil
+		}
+		s, err := ts.StatsRepository.Get(ctx, t)
+		if errors.Is(err, persistTypes.ErrNotFound) {
+			s, err = &types.TagStats{Tag: t}, nil
+		} else if err == nil {
+			stored[t] = true
+		}
+		changed[t] = s
+		return s, err
+	}
+	for _, t := range removed {
+		s, err := stats(t)
+		if err != nil {
+			return err
+		}
+		remove(s, day(before))
+	}
+	for _, t := range added {
+		s, err := stats(t)
+		if err != nil {
+			return err
+		}
+		add(s, day(after))
+	}
+	now := time.Now()
+	for t, s := range changed {
+		if s.Count > 0 {
+			prune(s, now)
+			if _, err := ts.StatsRepository.Save(ctx, s); err != nil {
+				return err
+			}
+		} else if stored[t] {
+			if err := ts.StatsRepository.Delete(ctx, t); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func add(stats *types.TagStats, day string) {
+	stats.Count++
+	if stats.Daily == nil {
+		stats.Daily = make(map[string]int)
+	}
+	stats.Daily[day]++
+}
+
+func remove(stats *types.TagStats, day string) {
+	if stats.Count <= 0 {
+		return
+	}
+	if stats.Count--; stats.Count == 0 {
+		stats.Daily = nil
+		return
+	}
+	// the days out of the trending windows are dropped already
+	if n, ok := stats.Daily[day]; ok {
+		if n <= 1 {
+			delete(stats.Daily, day)
+		} else {
+			stats.Daily[day] = n - 1
+		}
+	}
+}
+
+// prune drops the daily counts older than the longest trending window
+func prune(stats *types.TagStats, now time.Time) {
+	oldest := now.UTC().AddDate(0, 0, -MaxTrendingDays).Format(dayLayout)
+	for d := range stats.Daily {
+		if d < oldest {
+			delete(stats.Daily, d)
+		}
+	}
+}
+
+// Tags lists the tags alphabetically, by their counts when popular, or by
+// their counts within the trending window when trending. The trending list
+// has the tags of the articles published within the window only.
+func (ts TagService) Tags(ctx context.Context, order string, days, limit int) ([]types.TagCount, error) {
+	if days == 0 {
+		days = ts.trendingDays()
+	}
+	if days < 1 || days > MaxTrendingDays {
+		return nil, ErrInvalidTrending
+	}
+	var less func(a, b types.TagCount) bool
+	switch order {
+	case "", TagsAlphabetical:
+		less = func(a, b types.TagCount) bool {
+			return a.Tag < b.Tag
+		}
+	case TagsPopular:
+		less = func(a, b types.TagCount) bool {
+			if a.Count != b.Count {
+				return a.Count > b.Count
+			}
+			return a.Tag < b.Tag
+		}
+	case TagsTrending:
+		less = func(a, b types.TagCount) bool {
+			if a.Recent != b.Recent {
+				return a.Recent > b.Recent
+			}
+			if a.Count != b.Count {
+				return a.Count > b.Count
+			}
+			return a.Tag < b.Tag
+		}
+	default:
+		return nil, ErrUnknownTagOrder
+	}
+	all, err := ts.stats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	since := time.Now().UTC().AddDate(0, 0, 1-days).Format(dayLayout)
+	var counts = make([]types.TagCount, 0, len(all))
+	for _, stats := range all {
+		c := types.TagCount{Tag: stats.Tag, Count: stats.Count}
+		if order == TagsTrending {
+			for d, n := range stats.Daily {
+				if d >= since {
+					c.Recent += n
+				}
+			}
+			if c.Recent == 0 {
+				continue
+			}
+		}
+		counts = append(counts, c)
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		return less(counts[i], counts[j])
+	})
+	if limit > 0 && len(counts) > limit {
+		counts = counts[:limit]
+	}
+	return counts, nil
+}
+
+func (ts TagService) trendingDays() int {
+	if ts.TrendingDays <= 0 {
+		return DefaultTrendingDays
+	}
+	return ts.TrendingDays
+}
+
+// stats returns the tag counts of the tenant, they are built from the
+// published articles on the first read
+func (ts TagService) stats(ctx context.Context) ([]*types.TagStats, error) {
+	index, err := ts.TagRepository.Get(ctx, tagIndexKey)
+	if err != nil && !errors.Is(err, persistTypes.ErrNotFound) {
+		return nil, err
+	}
+	if err != nil || !index.Built {
+		if err := ts.build(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return ts.StatsRepository.GetFiltered(ctx)
+}
+
+// build counts the tags of the published articles and marks the index as
+// built in one transaction. The articles changed meanwhile write the index as
+// well, so the transaction conflicts with them and the build is repeated.
+func (ts TagService) build(ctx context.Context) error {
+	tagMu.Lock()
+	defer tagMu.Unlock()
+	return ts.Transaction.run(ctx, func(ctx context.Context) error {
+		index, err := ts.TagRepository.Get(ctx, tagIndexKey)
+		if err == nil && index.Built {
+			return nil
+		}
+		if err != nil && !errors.Is(err, persistTypes.ErrNotFound) {
+			return err
+		}
+		articles, err := ts.ArticleRepository.GetFiltered(ctx, func(a *types.Article) bool {
+			return a.Listed()
+		})
+		if err != nil {
+			return err
+		}
+		var counts = make(map[string]*types.TagStats)
+		for _, a := range articles {
+			for _, t := range counted(a) {
+				stats, ok := counts[t]
+				if !ok {
+					stats = &types.TagStats{Tag: t}
+					counts[t] = stats
+				}
+				add(stats, day(a))
+			}
+		}
+		now := time.Now()
+		var all = make([]*types.TagStats, 0, len(counts))
+		for _, stats := range counts {
+			prune(stats, now)
+			all = append(all, stats)
+		}
+		if len(all) > 0 {
+			if _, err := ts.StatsRepository.SaveMany(ctx, all); err != nil {
+				return err
+			}
+		}
+		_, err = ts.TagRepository.Save(ctx, &types.TagIndex{ID: tagIndexKey, Built: true})
+		return err
+	})
+}
+
+// Merge rewrites the articles having any of the merged tags to have the tag
+// merged into instead. The aliases of the merged tags are redirected to the
+// tag merged into, and with Alias set the merged tags become its aliases.
+func (ts TagService) Merge(ctx context.Context, m types.TagMergeRequest) (types.TagMerge, error) {
+	into := tag.Normalize(m.Into)
+	if into == "" {
+		return types.TagMerge{}, ErrEmptyTag
+	}
+	var from []string
+	var merged = make(map[string]bool)
+	for _, t := range tag.List(m.From) {
+		if t != into {
+			from = append(from, t)
+			merged[t] = true
+		}
+	}
+	if len(from) == 0 {
+		return types.TagMerge{}, ErrNothingToMerge
+	}
+	var rewritten int
+	err := ts.Transaction.run(ctx, func(ctx context.Context) error {
+		// the tag merged into may be an alias itself, the aliases point to
+		// tags which aren't aliases, so they never chain
+		target, err := ts.AliasRepository.Get(ctx, into)
+		if err == nil {
+			into = target.Tag
+		} else if !errors.Is(err, persistTypes.ErrNotFound) {
+			return err
+		}
+		if merged[into] {
+			return ErrTagMergeCycle
+		}
+		articles, err := ts.ArticleRepository.GetFiltered(ctx, func(a *types.Article) bool {
+			for _, t := range a.TagList {
+				if merged[t] {
+					return true
+				}
+			}
+			return false
+		})
+		if err != nil {
+			return err
+		}
+		for _, a := range articles {
+			var tags = make([]string, 0, len(a.TagList))
+			for _, t := range a.TagList {
+				if merged[t] {
+					t = into
+				}
+				tags = append(tags, t)
+			}
+			a.TagList = tag.List(tags)
+		}
+		if len(articles) > 0 {
+			if _, err := ts.ArticleRepository.SaveMany(ctx, articles); err != nil {
+				return err
+			}
+		}
+		rewritten = len(articles)
+		aliases, err := ts.AliasRepository.GetFiltered(ctx, func(a *types.TagAlias) bool {
+			return merged[a.Tag]
+		})
+		if err != nil {
+			return err
+		}
+		for _, a := range aliases {
+			a.Tag = into
+		}
+		if m.Alias {
+			now := time.Now()
+			for _, t := range from {
+				aliases = append(aliases, &types.TagAlias{Alias: t, Tag: into, CreatedAt: now})
+			}
+		}
+		if len(aliases) == 0 {
+			return nil
+		}
+		_, err = ts.AliasRepository.SaveMany(ctx, aliases)
+		return err
+	})
+	if err != nil {
+		return types.TagMerge{}, err
+	}
+	return types.TagMerge{
+		Into:     into,
+		From:     from,
+		Articles: rewritten,
+	}, nil
+}
+
+// Aliases lists the tag aliases ordered by the alias
+func (ts TagService) Aliases(ctx context.Context) ([]*types.TagAlias, error) {
+	aliases, err := ts.AliasRepository.GetFiltered(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(aliases, func(i, j int) bool {
+		return aliases[i].Alias < aliases[j].Alias
+	})
+	return aliases, nil
+}
+
+// DeleteAlias stops redirecting the alias, the articles rewritten keep the
+// tag they were rewritten to
+func (ts TagService) DeleteAlias(ctx context.Context, alias string) error {
+	alias = tag.Normalize(alias)
+	if _, err := ts.AliasRepository.Get(ctx, alias); errors.Is(err, persistTypes.ErrNotFound) {
+		return ErrTagAliasNotFound
+	} else if err != nil {
+		return err
+	}
+	return ts.AliasRepository.Delete(ctx, alias)
+}
+
+// normalizeTags normalizes the tags and replaces the aliases with the tags
+// they point to
+func normalizeTags(ctx context.Context, aliases persist.Repository[*types.TagAlias], tags []string) ([]string, error) {
+	list := tag.List(tags)
+	if len(list) == 0 {
+		return list, nil
+	}
+	found, err := aliases.GetMany(ctx, list)
+	if err != nil || len(found) == 0 {
+		return list, err
+	}
+	var targets = make(map[string]string, len(found))
+	for _, a := range found {
+		targets[a.Alias] = a.Tag
+	}
+	for i, t := range list {
+		if target, ok := targets[t]; ok {
+			list[i] = target
+		}
+	}
+	return tag.List(list), nil
+}
@@ -0,0 +1,172 @@
+package domain
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	persistTypes "github.com/borosr/realworld/persist/types"
+	"github.com/borosr/realworld/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func tagged(publishedAt time.Time, tags ...string) *types.Article {
+	return &types.Article{Status: types.ArticlePublished, PublishAt: &publishedAt, TagList: tags}
+}
+
+func TestTagService_Count(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	today := now.UTC().Format(dayLayout)
+	goStats := &types.TagStats{Tag: "go", Count: 2, Daily: map[string]int{today: 1}}
+	saved := make(map[string]*types.TagStats)
+
+	mockTagRepo := MockRepository[*types.TagIndex]{}
+	mockStatsRepo := MockRepository[*types.TagStats]{}
+	mockTagRepo.On("Get", ctx, tagIndexKey).Return(&types.TagIndex{ID: tagIndexKey, Built: true}, nil)
+	mockStatsRepo.On("Get", ctx, "go").Return(goStats, nil)
+	mockStatsRepo.On("Get", ctx, "rust").Return(nil, persistTypes.ErrNotFound).Once()
+	mockStatsRepo.On("Save", ctx, mock.Anything).
+		Run(func(args mock.Arguments) {
+			stats := args.Get(1).(*types.TagStats)
+			saved[stats.Tag] = stats
+		}).
+		Return(goStats, nil)
+	ts := TagService{TagRepository: &mockTagRepo, StatsRepository: &mockStatsRepo}
+
+	assert.Nil(t, ts.count(ctx, nil, tagged(now, "go", "rust")))
+	assert.Equal(t, 3, saved["go"].Count)
+	assert.Equal(t, 2, saved["go"].Daily[today])
+	assert.Equal(t, 1, saved["rust"].Count)
+
+	// a changed body with the same tags doesn't touch the counts
+	assert.Nil(t, ts.count(ctx, tagged(now, "go", "rust"), tagged(now, "go", "rust")))
+	mockStatsRepo.AssertNumberOfCalls(t, "Save", 2)
+
+	mockStatsRepo.On("Get", ctx, "rust").Return(saved["rust"], nil)
+	mockStatsRepo.On("Delete", ctx, "rust").Return(nil)
+	draft := tagged(now, "rust")
+	draft.Status = types.ArticleDraft
+	assert.Nil(t, ts.count(ctx, tagged(now, "go", "rust"), draft))
+	assert.Equal(t, 2, saved["go"].Count)
+	assert.Equal(t, 1, saved["go"].Daily[today])
+	mockStatsRepo.AssertCalled(t, "Delete", ctx, "rust")
+}
+
+func TestTagService_CountBeforeBuild(t *testing.T) {
+	ctx := context.Background()
+
+	mockTagRepo := MockRepository[*types.TagIndex]{}
+	mockStatsRepo := MockRepository[*types.TagStats]{}
+	mockTagRepo.On("Get", ctx, tagIndexKey).Return(nil, persistTypes.ErrNotFound)
+	mockTagRepo.On("Save", ctx, &types.TagIndex{ID: tagIndexKey}).Return(&types.TagIndex{}, nil)
+	ts := TagService{TagRepository: &mockTagRepo, StatsRepository: &mockStatsRepo}
+
+	// the change writes the index only, so a build running meanwhile conflicts
+	assert.Nil(t, ts.count(ctx, nil, tagged(time.Now(), "go")))
+	mockTagRepo.AssertNumberOfCalls(t, "Save", 1)
+	mockStatsRepo.AssertNotCalled(t, "Get", mock.Anything, mock.Anything)
+	mockStatsRepo.AssertNotCalled(t, "Save", mock.Anything, mock.Anything)
+}
+
+func TestTagService_Tags(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	old := now.AddDate(0, 0, -30)
+
+	mockTagRepo := MockRepository[*types.TagIndex]{}
+	mockStatsRepo := MockRepository[*types.TagStats]{}
+	mockArticleRepo := MockRepository[*types.Article]{}
+	mockTagRepo.On("Get", ctx, tagIndexKey).Return(nil, persistTypes.ErrNotFound).Twice()
+	mockTagRepo.On("Get", ctx, tagIndexKey).Return(&types.TagIndex{ID: tagIndexKey, Built: true}, nil)
+	mockTagRepo.On("Save", ctx, &types.TagIndex{ID: tagIndexKey, Built: true}).
+		Return(&types.TagIndex{}, nil)
+	mockArticleRepo.On("GetFiltered", ctx, mock.Anything).Return([]*types.Article{
+		tagged(old, "go", "rust"),
+		tagged(old, "go"),
+		tagged(old, "go"),
+		tagged(now, "rust", "zig"),
+		tagged(now, "zig"),
+		tagged(now, "c"),
+	}, nil)
+	// the counts built are read back
+	mockStatsRepo.On("SaveMany", ctx, mock.Anything).
+		Run(func(args mock.Arguments) {
+			mockStatsRepo.On("GetFiltered", ctx).Return(args.Get(1), nil)
+		}).
+		Return([]*types.TagStats{}, nil)
+	ts := TagService{
+		TagRepository:     &mockTagRepo,
+		StatsRepository:   &mockStatsRepo,
+		ArticleRepository: &mockArticleRepo,
+	}
+
+	names := func(counts []types.TagCount) []string {
+		var result []string
+		for _, c := range counts {
+			result = append(result, c.Tag)
+		}
+		return result
+	}
+	counts, err := ts.Tags(ctx, "", 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"c", "go", "rust", "zig"}, names(counts))
+	counts, err = ts.Tags(ctx, TagsPopular, 0, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"go", "rust", "zig"}, names(counts))
+	assert.Equal(t, 3, counts[0].Count)
+	counts, err = ts.Tags(ctx, TagsTrending, 7, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"zig", "rust", "c"}, names(counts))
+	assert.Equal(t, 2, counts[0].Recent)
+	counts, err = ts.Tags(ctx, TagsTrending, MaxTrendingDays, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "go", counts[0].Tag)
+	// the articles are scanned once
+	mockArticleRepo.AssertNumberOfCalls(t, "GetFiltered", 1)
+
+	_, err = ts.Tags(ctx, "newest", 0, 0)
+	assert.Equal(t, ErrUnknownTagOrder, err)
+	_, err = ts.Tags(ctx, TagsTrending, MaxTrendingDays+1, 0)
+	assert.Equal(t, ErrInvalidTrending, err)
+}
+
+func TestTagService_Merge(t *testing.T) {
+	ctx := context.Background()
+	article := &types.Article{ID: "article", TagList: []string{"go", "golang", "web"}}
+
+	mockArticleRepo := MockRepository[*types.Article]{}
+	mockAliasRepo := MockRepository[*types.TagAlias]{}
+	mockAliasRepo.On("Get", ctx, "go").Return(nil, persistTypes.ErrNotFound)
+	mockAliasRepo.On("Get", ctx, "gopher").Return(&types.TagAlias{Alias: "gopher", Tag: "golang"}, nil)
+	mockArticleRepo.On("GetFiltered", ctx, mock.MatchedBy(func(f persistTypes.Filter[*types.Article]) bool {
+		return f(article) && !f(&types.Article{TagList: []string{"go", "web"}})
+	})).
+		Return([]*types.Article{article}, nil)
+	mockArticleRepo.On("SaveMany", ctx, mock.MatchedBy(func(articles []*types.Article) bool {
+		return assert.ObjectsAreEqual([]string{"go", "web"}, articles[0].TagList)
+	})).
+		Return([]*types.Article{article}, nil)
+	mockAliasRepo.On("GetFiltered", ctx, mock.Anything).
+		Return([]*types.TagAlias{{Alias: "gopher", Tag: "golang"}}, nil)
+	mockAliasRepo.On("SaveMany", ctx, mock.MatchedBy(func(aliases []*types.TagAlias) bool {
+		return len(aliases) == 2 &&
+			aliases[0].Alias == "gopher" && aliases[0].Tag == "go" &&
+			aliases[1].Alias == "golang" && aliases[1].Tag == "go"
+	})).
+		Return([]*types.TagAlias{}, nil)
+	ts := TagService{ArticleRepository: &mockArticleRepo, AliasRepository: &mockAliasRepo}
+
+	merge, err := ts.Merge(ctx, types.TagMergeRequest{From: []string{"GoLang", "go"}, Into: " Go", Alias: true})
+	assert.Nil(t, err)
+	assert.Equal(t, types.TagMerge{Into: "go", From: []string{"golang"}, Articles: 1}, merge)
+
+	_, err = ts.Merge(ctx, types.TagMergeRequest{From: []string{"go"}, Into: "go"})
+	assert.Equal(t, ErrNothingToMerge, err)
+	// gopher is an alias of golang, so golang can't be merged into it
+	_, err = ts.Merge(ctx, types.TagMergeRequest{From: []string{"golang"}, Into: "gopher"})
+	assert.Equal(t, ErrTagMergeCycle, err)
+	mockArticleRepo.AssertNumberOfCalls(t, "SaveMany", 1)
+	mockAliasRepo.AssertExpectations(t)
+}
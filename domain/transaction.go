@@ -0,0 +1,15 @@
+package domain
+
+import "context"
+
+// TransactionFunc runs fn atomically, it is persist.Transaction outside of
+// the tests
+type TransactionFunc func(ctx context.Context, fn func(ctx context.Context) error) error
+
+// run calls fn directly when no transaction is set
+func (t TransactionFunc) run(ctx context.Context, fn func(ctx context.Context) error) error {
+	if t == nil {
+		return fn(ctx)
+	}
+	return t(ctx, fn)
+}
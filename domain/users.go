@@ -2,14 +2,29 @@ package domain
 
 import (
 	"context"
+	"errors"
+	"sync"
 	"time"
 
 	"github.com/borosr/realworld/lib/auth"
+	"github.com/borosr/realworld/lib/broken"
+	"github.com/borosr/realworld/lib/tenant"
 	"github.com/borosr/realworld/persist"
+	persistTypes "github.com/borosr/realworld/persist/types"
 	"github.com/borosr/realworld/types"
 	"golang.org/x/crypto/bcrypt"
 )
 
+var (
+	ErrUsernameTaken = broken.Validation("username is already taken")
+	ErrEmailTaken    = broken.Validation("email is already registered")
+)
+
+// usernameMu serializes the sign ups and the username changes, so two users
+// never get the same username. The policies identify the authors by their
+// usernames.
+var usernameMu sync.Mutex
+
 type UserDescriptor interface {
 	Login(ctx context.Context, u types.UserLogin) (types.User, error)
 	SignUp(ctx context.Context, u types.UserSignUp) (types.User, error)
@@ -30,10 +45,14 @@ func (us UserService) Login(ctx context.Context, u types.UserLogin) (types.User,
 		return types.User{}, err
 	}
 	if user.Token == "" {
-		token, err := auth.Sign(map[string]interface{}{
+		claims := map[string]interface{}{
 			"email": user.Email,
 			"iat":   time.Now().UTC().Unix(),
-		})
+		}
+		if id := tenant.ID(ctx); id != "" {
+			claims["tenant"] = id
+		}
+		token, err := auth.Sign(claims)
 		if err != nil {
 			return types.User{}, err
 		}
@@ -46,10 +65,25 @@ func (us UserService) Login(ctx context.Context, u types.UserLogin) (types.User,
 }
 
 func (us UserService) SignUp(ctx context.Context, u types.UserSignUp) (types.User, error) {
+	if u.Username == DeletedUsername {
+		return types.User{}, ErrReservedUsername
+	}
 	encryptedPassword, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
 	if err != nil {
 		return types.User{}, err
 	}
+	usernameMu.Lock()
+	defer usernameMu.Unlock()
+	// the users are keyed by their emails, so a sign up with a registered
+	// email would replace the user
+	if _, err := us.UserRepository.Get(ctx, u.Email); err == nil {
+		return types.User{}, ErrEmailTaken
+	} else if !errors.Is(err, persistTypes.ErrNotFound) {
+		return types.User{}, err
+	}
+	if err := us.checkUsername(ctx, u.Username, u.Email); err != nil {
+		return types.User{}, err
+	}
 	saved, err := us.UserRepository.Save(ctx, &types.User{
 		Email: u.Email,
 		Profile: types.Profile{
@@ -72,10 +106,20 @@ func (us UserService) GetByEmail(ctx context.Context, email string) (types.User,
 }
 
 func (us UserService) Update(ctx context.Context, u types.User) (types.User, error) {
+	if u.Username == DeletedUsername {
+		return types.User{}, ErrReservedUsername
+	}
+	usernameMu.Lock()
+	defer usernameMu.Unlock()
 	user, err := us.UserRepository.Get(ctx, u.Email)
 	if err != nil {
 		return types.User{}, err
 	}
+	if u.Username != "" && u.Username != user.Username {
+		if err := us.checkUsername(ctx, u.Username, u.Email); err != nil {
+			return types.User{}, err
+		}
+	}
 	if u.Token != "" {
 		user.Token = u.Token
 	}
@@ -97,3 +141,18 @@ func (us UserService) Update(ctx context.Context, u types.User) (types.User, err
 	}
 	return *saved, nil
 }
+
+// checkUsername fails when another user has the username, it has to run with
+// usernameMu held
+func (us UserService) checkUsername(ctx context.Context, username, email string) error {
+	count, err := us.UserRepository.CountFiltered(ctx, func(other *types.User) bool {
+		return other.Username == username && other.Email != email
+	})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrUsernameTaken
+	}
+	return nil
+}
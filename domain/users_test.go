@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/borosr/realworld/lib/auth"
+	persistTypes "github.com/borosr/realworld/persist/types"
 	"github.com/borosr/realworld/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -61,6 +62,8 @@ func TestUserService_SignUp(t *testing.T) {
 			u.Username == username &&
 			u.Password != ""
 	})).Return(&expectedUser, nil)
+	mockRepo.On("Get", ctx, email).Return(nil, persistTypes.ErrNotFound)
+	mockRepo.On("CountFiltered", ctx, mock.Anything).Return(0, nil)
 	us := UserService{
 		UserRepository: &mockRepo,
 	}
@@ -108,3 +111,38 @@ func TestUserService_Update(t *testing.T) {
 	}
 	assert.Equal(t, expectedBio, updated.Bio)
 }
+
+func TestUserService_UsernameTaken(t *testing.T) {
+	ctx := context.Background()
+	victim := &types.User{Email: "victim@email.com", Profile: types.Profile{Username: "victim"}}
+	user := &types.User{Email: "user@email.com", Profile: types.Profile{Username: "user"}}
+	mockRepo := MockRepository[*types.User]{}
+	mockRepo.On("Get", ctx, victim.Email).Return(victim, nil)
+	mockRepo.On("Get", ctx, user.Email).Return(user, nil)
+	mockRepo.On("Get", ctx, "new@email.com").Return(nil, persistTypes.ErrNotFound)
+	mockRepo.On("CountFiltered", ctx, mock.MatchedBy(func(f persistTypes.Filter[*types.User]) bool {
+		return f(victim) && !f(user)
+	})).Return(1, nil)
+	us := UserService{
+		UserRepository: &mockRepo,
+	}
+
+	_, err := us.SignUp(ctx, types.UserSignUp{Username: "victim", Email: "new@email.com", Password: "password"})
+	assert.Equal(t, ErrUsernameTaken, err)
+	_, err = us.Update(ctx, types.User{Email: user.Email, Profile: types.Profile{Username: "victim"}})
+	assert.Equal(t, ErrUsernameTaken, err)
+	_, err = us.SignUp(ctx, types.UserSignUp{Username: "other", Email: victim.Email, Password: "password"})
+	assert.Equal(t, ErrEmailTaken, err, "a sign up never replaces a user")
+	mockRepo.AssertNotCalled(t, "Save", mock.Anything, mock.Anything)
+}
+
+func TestUserService_ReservedUsername(t *testing.T) {
+	ctx := context.Background()
+	us := UserService{
+		UserRepository: &MockRepository[*types.User]{},
+	}
+	_, err := us.SignUp(ctx, types.UserSignUp{Username: DeletedUsername, Email: "a@example.com", Password: "password"})
+	assert.Equal(t, ErrReservedUsername, err)
+	_, err = us.Update(ctx, types.User{Email: "a@example.com", Profile: types.Profile{Username: DeletedUsername}})
+	assert.Equal(t, ErrReservedUsername, err)
+}
@@ -0,0 +1,105 @@
+package domain
+
+import (
+	"context"
+	"errors"
+
+	"github.com/borosr/realworld/lib/api"
+	"github.com/borosr/realworld/persist"
+	persistTypes "github.com/borosr/realworld/persist/types"
+	"github.com/borosr/realworld/types"
+)
+
+// viewer returns the user of the request, it is empty for the anonymous
+// requests and for the valid tokens of the deleted users
+func viewer(ctx context.Context, userService UserDescriptor) (types.User, error) {
+	email, err := api.GetValue[string](ctx, "email")
+	if err != nil || email == "" {
+		return types.User{}, nil
+	}
+	user, err := userService.GetByEmail(ctx, email)
+	if errors.Is(err, persistTypes.ErrNotFound) {
+		return types.User{}, nil
+	}
+	return user, err
+}
+
+// followedBy returns which of the profiles the username follows, with a
+// single batch read
+func followedBy(ctx context.Context, follows persist.Repository[*types.Follow], username string, profiles []string) (map[string]bool, error) {
+	var following = make(map[string]bool)
+	if username == "" || len(profiles) == 0 {
+		return following, nil
+	}
+	var keys = make([]string, 0, len(profiles))
+	var seen = make(map[string]bool, len(profiles))
+	for _, p := range profiles {
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		f := types.Follow{From: username, To: p}
+		keys = append(keys, f.Key())
+	}
+	found, err := follows.GetMany(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range found {
+		following[f.To] = true
+	}
+	return following, nil
+}
+
+// enrich sets the viewer dependent flags of the articles: favorited and the
+// following of their authors
+func (as ArticleService) enrich(ctx context.Context, articles ...*types.Article) error {
+	user, err := viewer(ctx, as.UserService)
+	if err != nil || user.Username == "" || len(articles) == 0 {
+		return err
+	}
+	var keys = make([]string, 0, len(articles))
+	var authors = make([]string, 0, len(articles))
+	for _, a := range articles {
+		f := types.Favorite{Slug: a.Key(), Username: user.Username}
+		keys = append(keys, f.Key())
+		authors = append(authors, a.Author.Username)
+	}
+	favorites, err := as.FavoriteRepository.GetMany(ctx, keys)
+	if err != nil {
+		return err
+	}
+	var favorited = make(map[string]bool, len(favorites))
+	for _, f := range favorites {
+		favorited[f.Slug] = true
+	}
+	following, err := followedBy(ctx, as.FollowRepository, user.Username, authors)
+	if err != nil {
+		return err
+	}
+	for _, a := range articles {
+		a.Favorited = favorited[a.Key()]
+		a.Author.Following = following[a.Author.Username]
+	}
+	return nil
+}
+
+// enrichComments sets the following of the authors of the comments
+func (as ArticleService) enrichComments(ctx context.Context, comments []types.CommonComment) error {
+	user, err := viewer(ctx, as.UserService)
+	if err != nil || user.Username == "" || len(comments) == 0 {
+		return err
+	}
+	var authors = make([]string, 0, len(comments))
+	for _, c := range comments {
+		authors = append(authors, c.Author.Username)
+	}
+	following, err := followedBy(ctx, as.FollowRepository, user.Username, authors)
+	if err != nil {
+		return err
+	}
+	for i := range comments {
+		comments[i].Author.Following = following[comments[i].Author.Username]
+	}
+	return nil
+}
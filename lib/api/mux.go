@@ -37,6 +37,18 @@ func Register[Request RequestConstraint, Response ResponseConstraint, Function C
 	}
 }
 
+// GlobalMiddleware wraps the handling of every request, including the
+// routing
+type GlobalMiddleware func(next http.Handler) http.Handler
+
+// Use registers global middlewares, the first one registered is the
+// outermost
+func Use(mws ...GlobalMiddleware) {
+	mu.Lock()
+	defer mu.Unlock()
+	mux.Use(mws...)
+}
+
 type route struct {
 	pattern []string
 	method  string
@@ -50,8 +62,15 @@ type routeParam struct {
 }
 
 type Server struct {
-	mu     sync.RWMutex
-	routes []*route
+	mu          sync.RWMutex
+	routes      []*route
+	middlewares []GlobalMiddleware
+}
+
+func (s *Server) Use(mws ...GlobalMiddleware) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.middlewares = append(s.middlewares, mws...)
 }
 
 func (s *Server) Handler(pattern, method string, handler http.Handler) {
@@ -71,24 +90,17 @@ func (r route) parse(ctx context.Context, urlPath, method string) (context.Conte
 	}
 	splitURL := strings.Split(urlPath, "/")
 
-	var matched bool
+	// every segment has to match, not only the last one
 	for i := 0; i < len(splitURL); i++ {
 		if p, ok := r.params[i]; ok {
-			if p.pattern != nil {
-				matched = p.pattern.MatchString(splitURL[i])
-				if matched {
-					ctx = SetPathVariable(ctx, p.name, splitURL[i])
-				}
-			} else {
-				ctx = SetPathVariable(ctx, p.name, splitURL[i])
+			if p.pattern != nil && !p.pattern.MatchString(splitURL[i]) {
+				return nil, broken.Internal("urls not match")
 			}
-		} else {
-			matched = r.pattern[i] == splitURL[i]
+			ctx = SetPathVariable(ctx, p.name, splitURL[i])
+		} else if r.pattern[i] != splitURL[i] {
+			return nil, broken.Internal("urls not match")
 		}
 	}
-	if !matched {
-		return nil, broken.Internal("urls not match")
-	}
 
 	return ctx, nil
 }
@@ -115,6 +127,21 @@ func (s *Server) HandleFunc(pattern, method string, handler func(http.ResponseWr
 }
 
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	mws := s.middlewares
+	s.mu.RUnlock()
+	if len(mws) == 0 {
+		s.route(w, r)
+		return
+	}
+	var h http.Handler = http.HandlerFunc(s.route)
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	h.ServeHTTP(w, r)
+}
+
+func (s *Server) route(w http.ResponseWriter, r *http.Request) {
 	for _, route := range s.routes { // TODO make it faster with tree
 		ctx, err := route.parse(r.Context(), r.URL.Path, r.Method)
 		if err == nil {
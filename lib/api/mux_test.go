@@ -185,3 +185,45 @@ func TestServer_parse(t *testing.T) {
 	r := route{pattern: sp, method: http.MethodPost, params: buildParams(sp), handler: http.HandlerFunc(handler)}
 	r.parse(context.Background(), path, http.MethodPost)
 }
+
+func TestRoute_parseEverySegment(t *testing.T) {
+	sp := strings.Split("/api/articles/{slug}/comments", "/")
+	r := route{pattern: sp, method: http.MethodGet, params: buildParams(sp)}
+	ctx, err := r.parse(context.Background(), "/api/articles/hello/comments", http.MethodGet)
+	assert.Nil(t, err)
+	slug, _ := PathVariable[string](ctx, "slug")
+	assert.Equal(t, "hello", slug)
+	_, err = r.parse(context.Background(), "/api/user/trash/comments", http.MethodGet)
+	assert.NotNil(t, err)
+}
+
+func TestServer_Use(t *testing.T) {
+	s := Server{}
+	type test struct {
+		Value string `json:"value"`
+	}
+	var calls []string
+	handlerFunc := func(ctx context.Context, _ goTypes.Nil) (test, error) {
+		calls = append(calls, "handler")
+		return test{Value: ctx.Value("global").(string)}, nil
+	}
+	path := "/test/path/" + xid.New().String()
+	s.HandleFunc(path, http.MethodGet, methodWrapper[goTypes.Nil, test, ControllerSimpleFunc[goTypes.Nil, test]](path, http.MethodGet, handlerFunc))
+	s.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls = append(calls, "first")
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), "global", "set")))
+		})
+	}, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls = append(calls, "second")
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, path, nil)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	assert.Equal(t, []string{"first", "second", "handler"}, calls)
+	assert.JSONEq(t, `{"value":"set"}`, w.Body.String())
+}
@@ -121,7 +121,37 @@ func processRequest[Request RequestConstraint](body io.Reader) (Request, error)
 	return r, nil
 }
 
+// Error writes the error response of the global middlewares
+func Error(w http.ResponseWriter, err error) {
+	handleResponse(w, err)
+}
+
+// RedirectError answers the request with a redirect to the Location
+type RedirectError struct {
+	Location string
+	Code     int
+}
+
+func (re *RedirectError) Error() string {
+	return "moved to " + re.Location
+}
+
+// Redirect returns the error of a permanent redirect, the controllers return
+// it instead of a response
+func Redirect(location string) error {
+	return &RedirectError{
+		Location: location,
+		Code:     http.StatusMovedPermanently,
+	}
+}
+
 func handleResponse(w http.ResponseWriter, err error) {
+	var re *RedirectError
+	if errors.As(err, &re) {
+		w.Header().Set("Location", re.Location)
+		w.WriteHeader(re.Code)
+		return
+	}
 	var bt broken.Mess
 	if !errors.As(err, &bt) {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
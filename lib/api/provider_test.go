@@ -3,9 +3,12 @@ package api
 import (
 	"context"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 
+	"github.com/borosr/realworld/lib/broken"
 	"github.com/rs/xid"
+	"github.com/stretchr/testify/assert"
 )
 
 func BenchmarkMethodWrapper(b *testing.B) {
@@ -19,3 +22,15 @@ func BenchmarkMethodWrapper(b *testing.B) {
 		methodWrapper[test, test, ControllerSimpleFunc[test, test]]("/test/path/"+xid.New().String(), http.MethodPost, handler)
 	}
 }
+
+func TestHandleResponse(t *testing.T) {
+	w := httptest.NewRecorder()
+	handleResponse(w, Redirect("/api/articles/new-slug"))
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "/api/articles/new-slug", w.Header().Get("Location"))
+
+	w = httptest.NewRecorder()
+	handleResponse(w, broken.Validation("invalid"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Empty(t, w.Header().Get("Location"))
+}
@@ -11,6 +11,7 @@ const (
 	TypeValidation = "validation"
 	TypeInternal   = "internal"
 	TypeForbidden  = "forbidden"
+	TypeNotFound   = "not_found"
 )
 
 type Mess interface {
@@ -39,6 +40,8 @@ func (t *Thing) Format() (string, int) {
 		code = http.StatusBadRequest
 	case TypeForbidden:
 		code = http.StatusForbidden
+	case TypeNotFound:
+		code = http.StatusNotFound
 	case TypeInternal:
 		code = http.StatusInternalServerError
 	default:
@@ -81,6 +84,10 @@ func Forbiddenf(format string, args ...any) error {
 	return New(TypeForbidden, fmt.Sprintf(format, args...))
 }
 
+func NotFound(msg string) error {
+	return New(TypeNotFound, msg)
+}
+
 func Internal(msg string) error {
 	return New(TypeInternal, msg)
 }
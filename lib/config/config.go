@@ -0,0 +1,82 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func String(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+func Int(key string, fallback int) int {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return fallback
+	}
+	res, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("invalid integer in %s: %v", key, err)
+		return fallback
+	}
+	return res
+}
+
+func Int64(key string, fallback int64) int64 {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return fallback
+	}
+	res, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		log.Printf("invalid integer in %s: %v", key, err)
+		return fallback
+	}
+	return res
+}
+
+func Bool(key string, fallback bool) bool {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return fallback
+	}
+	res, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("invalid boolean in %s: %v", key, err)
+		return fallback
+	}
+	return res
+}
+
+func Duration(key string, fallback time.Duration) time.Duration {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return fallback
+	}
+	res, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("invalid duration in %s: %v", key, err)
+		return fallback
+	}
+	return res
+}
+
+func List(key string) []string {
+	value := String(key, "")
+	if value == "" {
+		return nil
+	}
+	var res []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			res = append(res, item)
+		}
+	}
+	return res
+}
@@ -0,0 +1,131 @@
+// Package diff compares texts line by line with the Myers algorithm
+// (E.W. Myers, An O(ND) Difference Algorithm and Its Variations, 1986).
+package diff
+
+import "strings"
+
+type Op string
+
+const (
+	Equal  Op = "equal"
+	Insert Op = "insert"
+	Delete Op = "delete"
+)
+
+// Edit is a line of the diff, the deleted lines are from the first text and
+// the inserted ones from the second
+type Edit struct {
+	Op   Op     `json:"op"`
+	Text string `json:"text"`
+}
+
+// Lines returns the shortest edit script turning the lines of a into the
+// lines of b
+func Lines(a, b string) []Edit {
+	return diff(split(a), split(b))
+}
+
+func split(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+func diff(a, b []string) []Edit {
+	// the common prefix and suffix are kept out of the search
+	var prefix, suffix int
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	var edits = make([]Edit, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		edits = append(edits, Edit{Op: Equal, Text: line})
+	}
+	edits = append(edits, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		edits = append(edits, Edit{Op: Equal, Text: line})
+	}
+	return edits
+}
+
+// myers finds the furthest reaching paths of every edit distance d, then
+// walks the snapshots of the paths back from the end
+func myers(a, b []string) []Edit {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return replace(a, b)
+	}
+	max := n + m
+	offset := max
+	v := make([]int, 2*max+2)
+	var trace [][]int
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[offset+k-1] < v[offset+k+1] {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(a, b, trace, offset)
+			}
+		}
+	}
+	return replace(a, b)
+}
+
+func backtrack(a, b []string, trace [][]int, offset int) []Edit {
+	var reversed []Edit
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || k != d && v[offset+k-1] < v[offset+k+1] {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x, y = x-1, y-1
+			reversed = append(reversed, Edit{Op: Equal, Text: a[x]})
+		}
+		if d > 0 {
+			if x == prevX {
+				reversed = append(reversed, Edit{Op: Insert, Text: b[prevY]})
+			} else {
+				reversed = append(reversed, Edit{Op: Delete, Text: a[prevX]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+	var edits = make([]Edit, len(reversed))
+	for i, e := range reversed {
+		edits[len(reversed)-1-i] = e
+	}
+	return edits
+}
+
+func replace(a, b []string) []Edit {
+	var edits = make([]Edit, 0, len(a)+len(b))
+	for _, line := range a {
+		edits = append(edits, Edit{Op: Delete, Text: line})
+	}
+	for _, line := range b {
+		edits = append(edits, Edit{Op: Insert, Text: line})
+	}
+	return edits
+}
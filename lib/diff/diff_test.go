@@ -0,0 +1,79 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// apply rebuilds both texts from the edits
+func apply(edits []Edit) (string, string) {
+	var a, b []string
+	for _, e := range edits {
+		if e.Op != Insert {
+			a = append(a, e.Text)
+		}
+		if e.Op != Delete {
+			b = append(b, e.Text)
+		}
+	}
+	return strings.Join(a, "\n"), strings.Join(b, "\n")
+}
+
+func distance(edits []Edit) int {
+	var d int
+	for _, e := range edits {
+		if e.Op != Equal {
+			d++
+		}
+	}
+	return d
+}
+
+func TestLines(t *testing.T) {
+	// the example of the paper
+	a := strings.Join(strings.Split("abcabba", ""), "\n")
+	b := strings.Join(strings.Split("cbabac", ""), "\n")
+	edits := Lines(a, b)
+	gotA, gotB := apply(edits)
+	assert.Equal(t, a, gotA)
+	assert.Equal(t, b, gotB)
+	assert.Equal(t, 5, distance(edits))
+
+	assert.Equal(t, []Edit{
+		{Op: Equal, Text: "first"},
+		{Op: Delete, Text: "second"},
+		{Op: Insert, Text: "2nd"},
+		{Op: Equal, Text: "third"},
+		{Op: Insert, Text: "fourth"},
+	}, Lines("first\nsecond\nthird\n", "first\n2nd\nthird\nfourth"))
+}
+
+func TestLines_Empty(t *testing.T) {
+	assert.Empty(t, Lines("", ""))
+	assert.Equal(t, []Edit{{Op: Insert, Text: "new"}}, Lines("", "new"))
+	assert.Equal(t, []Edit{{Op: Delete, Text: "old"}}, Lines("old", ""))
+	assert.Equal(t, []Edit{{Op: Equal, Text: "same"}}, Lines("same", "same"))
+}
+
+func TestLines_Random(t *testing.T) {
+	words := []string{"a", "b", "c"}
+	seed := uint32(7)
+	next := func() string {
+		seed = seed*1664525 + 1013904223
+		return words[seed>>16%uint32(len(words))]
+	}
+	for i := 0; i < 200; i++ {
+		var a, b []string
+		for j := 0; j < i%13; j++ {
+			a = append(a, next())
+		}
+		for j := 0; j < i%11; j++ {
+			b = append(b, next())
+		}
+		gotA, gotB := apply(Lines(strings.Join(a, "\n"), strings.Join(b, "\n")))
+		assert.Equal(t, strings.Join(a, "\n"), gotA)
+		assert.Equal(t, strings.Join(b, "\n"), gotB)
+	}
+}
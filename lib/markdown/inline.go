@@ -0,0 +1,345 @@
+package markdown
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	entityPattern   = regexp.MustCompile(`^&(?:#[0-9]{1,7}|#[xX][0-9a-fA-F]{1,6}|[A-Za-z][A-Za-z0-9]{1,31});`)
+	autolinkPattern = regexp.MustCompile(`^<([A-Za-z][A-Za-z0-9+.-]{1,31}:[^<>\x00-\x20]*)>`)
+	emailPattern    = regexp.MustCompile(`^<([A-Za-z0-9.!#$%&'*+/=?^_` + "`" + `{|}~-]+@[A-Za-z0-9](?:[A-Za-z0-9-]{0,61}[A-Za-z0-9])?(?:\.[A-Za-z0-9](?:[A-Za-z0-9-]{0,61}[A-Za-z0-9])?)*)>`)
+	rawTagPattern   = regexp.MustCompile(`^(?:<[A-Za-z][A-Za-z0-9-]*(?:\s+[A-Za-z_:][A-Za-z0-9_.:-]*(?:\s*=\s*(?:"[^"]*"|'[^']*'|[^\s"'=<>` + "`" + `]+))?)*\s*/?>|</[A-Za-z][A-Za-z0-9-]*\s*>|<!--(?:[^-]|-[^-])*-->)`)
+)
+
+var escaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+func isPunct(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\n'
+}
+
+func isAlnum(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// unescape removes the backslashes escaping the punctuation
+func unescape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && isPunct(s[i+1]) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// inline renders the inline elements of the text of a block
+func (r *renderer) inline(s string) string {
+	var out []byte
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch c {
+		case '\\':
+			if i+1 < len(s) && s[i+1] == '\n' {
+				out = append(out, "<br>\n"...)
+				i += 2
+				continue
+			}
+			if i+1 < len(s) && isPunct(s[i+1]) {
+				out = append(out, escape(s[i+1:i+2])...)
+				i += 2
+				continue
+			}
+		case '\n':
+			trimmed := strings.TrimRight(string(out), " ")
+			if len(out)-len(trimmed) >= 2 {
+				out = append([]byte(trimmed), "<br>\n"...)
+			} else {
+				out = append([]byte(trimmed), '\n')
+			}
+			i = i + 1 + indentation(s[i+1:])
+			continue
+		case '`':
+			if code, n := codeSpan(s[i:]); n > 0 {
+				out = append(out, "<code>"+escape(code)+"</code>"...)
+				i += n
+				continue
+			}
+			n := run(s[i:], '`')
+			out = append(out, s[i:i+n]...)
+			i += n
+			continue
+		case '<':
+			if m := autolinkPattern.FindStringSubmatch(s[i:]); m != nil {
+				out = append(out, `<a href="`+escape(m[1])+`">`+escape(m[1])+"</a>"...)
+				i += len(m[0])
+				continue
+			}
+			if m := emailPattern.FindStringSubmatch(s[i:]); m != nil {
+				out = append(out, `<a href="mailto:`+escape(m[1])+`">`+escape(m[1])+"</a>"...)
+				i += len(m[0])
+				continue
+			}
+			if m := rawTagPattern.FindString(s[i:]); m != "" {
+				out = append(out, m...)
+				i += len(m)
+				continue
+			}
+		case '&':
+			if m := entityPattern.FindString(s[i:]); m != "" {
+				out = append(out, m...)
+				i += len(m)
+				continue
+			}
+		case '!':
+			if i+1 < len(s) && s[i+1] == '[' {
+				if text, dest, title, n := r.link(s[i+1:]); n > 0 {
+					out = append(out, `<img src="`+escape(dest)+`" alt="`+escape(unescape(text))+`"`...)
+					if title != "" {
+						out = append(out, ` title="`+escape(title)+`"`...)
+					}
+					out = append(out, '>')
+					i += 1 + n
+					continue
+				}
+			}
+		case '[':
+			if text, dest, title, n := r.link(s[i:]); n > 0 {
+				out = append(out, `<a href="`+escape(dest)+`"`...)
+				if title != "" {
+					out = append(out, ` title="`+escape(title)+`"`...)
+				}
+				out = append(out, ">"+r.inline(text)+"</a>"...)
+				i += n
+				continue
+			}
+		case '*', '_', '~':
+			if html, n := r.emphasis(s, i); n > 0 {
+				out = append(out, html...)
+				i += n
+				continue
+			}
+			n := run(s[i:], c)
+			out = append(out, s[i:i+n]...)
+			i += n
+			continue
+		}
+		out = append(out, escape(s[i:i+1])...)
+		i++
+	}
+	return string(out)
+}
+
+// run is the length of the run of c at the start of s
+func run(s string, c byte) int {
+	n := 0
+	for n < len(s) && s[n] == c {
+		n++
+	}
+	return n
+}
+
+// codeSpan returns the code of the span at the start of s and its length,
+// the span is closed by a backtick run of the same length
+func codeSpan(s string) (string, int) {
+	n := run(s, '`')
+	for i := n; i < len(s); {
+		if s[i] != '`' {
+			i++
+			continue
+		}
+		m := run(s[i:], '`')
+		if m == n {
+			code := strings.ReplaceAll(s[n:i], "\n", " ")
+			if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.Trim(code, " ") != "" {
+				code = code[1 : len(code)-1]
+			}
+			return code, i + m
+		}
+		i += m
+	}
+	return "", 0
+}
+
+// skip returns the length of the code span or the escaped character at the
+// start of s, the delimiters inside them don't count
+func skip(s string) int {
+	if s[0] == '\\' && len(s) > 1 {
+		return 2
+	}
+	if s[0] == '`' {
+		if _, n := codeSpan(s); n > 0 {
+			return n
+		}
+		return run(s, '`')
+	}
+	return 1
+}
+
+// link parses a [text](destination "title") at the start of s, it returns
+// the length of the link, or 0 when s doesn't start with one
+func (r *renderer) link(s string) (text, dest, title string, n int) {
+	depth := 0
+	end := -1
+	for i := 0; i < len(s) && end < 0; {
+		if !r.spend(1) {
+			return "", "", "", 0
+		}
+		switch s[i] {
+		case '[':
+			depth++
+		case ']':
+			if depth--; depth == 0 {
+				end = i
+			}
+		}
+		i += skip(s[i:])
+	}
+	if end < 0 || end+1 >= len(s) || s[end+1] != '(' {
+		return "", "", "", 0
+	}
+	text = s[1:end]
+	i := end + 2
+	i += len(s[i:]) - len(strings.TrimLeft(s[i:], " \n"))
+	if i < len(s) && s[i] == '<' {
+		closing := strings.IndexAny(s[i+1:], ">\n")
+		if closing < 0 || s[i+1+closing] != '>' {
+			return "", "", "", 0
+		}
+		dest = s[i+1 : i+1+closing]
+		i += closing + 2
+	} else {
+		start, parens := i, 0
+		for ; i < len(s) && s[i] > ' '; i++ {
+			if s[i] == '\\' && i+1 < len(s) && isPunct(s[i+1]) {
+				i++
+				continue
+			}
+			if s[i] == '(' {
+				parens++
+			}
+			if s[i] == ')' {
+				if parens == 0 {
+					break
+				}
+				parens--
+			}
+		}
+		dest = s[start:i]
+	}
+	spaces := len(s[i:]) - len(strings.TrimLeft(s[i:], " \n"))
+	i += spaces
+	if i < len(s) && spaces > 0 && (s[i] == '"' || s[i] == '\'' || s[i] == '(') {
+		closer := s[i]
+		if closer == '(' {
+			closer = ')'
+		}
+		j := i + 1
+		for ; j < len(s) && s[j] != closer; j++ {
+			if s[j] == '\\' {
+				j++
+			}
+		}
+		if j >= len(s) {
+			return "", "", "", 0
+		}
+		title = unescape(s[i+1 : j])
+		i = j + 1
+		i += len(s[i:]) - len(strings.TrimLeft(s[i:], " \n"))
+	}
+	if i >= len(s) || s[i] != ')' {
+		return "", "", "", 0
+	}
+	return text, unescape(dest), title, i + 1
+}
+
+// flanking reports whether the delimiter run s[i:j] can open and close an
+// emphasis, the underscores don't work inside the words
+func flanking(s string, i, j int) (opens, closes bool) {
+	before, after := byte(' '), byte(' ')
+	if i > 0 {
+		before = s[i-1]
+	}
+	if j < len(s) {
+		after = s[j]
+	}
+	opens = !isSpace(after) && (!isPunct(after) || isSpace(before) || isPunct(before))
+	closes = !isSpace(before) && (!isPunct(before) || isSpace(after) || isPunct(after))
+	if s[i] == '_' {
+		opens = opens && !isAlnum(before)
+		closes = closes && !isAlnum(after)
+	}
+	return opens, closes
+}
+
+var emphasisTags = map[int][2]string{
+	1: {"<em>", "</em>"},
+	2: {"<strong>", "</strong>"},
+	3: {"<em><strong>", "</strong></em>"},
+}
+
+// emphasis renders the emphasis opened by the delimiter run at s[i], it
+// returns the HTML and the length of the emphasis, or 0 when the run isn't
+// closed. The runs of 3 are both emphasized and strong, the strikethrough
+// takes 2 tildes.
+func (r *renderer) emphasis(s string, i int) (string, int) {
+	c := s[i]
+	n := run(s[i:], c)
+	if opens, _ := flanking(s, i, i+n); !opens {
+		return "", 0
+	}
+	if c == '~' {
+		if n != 2 {
+			return "", 0
+		}
+		if end := r.closer(s, i+n, c, 2, true); end > 0 {
+			return "<del>" + r.inline(s[i+n:end]) + "</del>", end + 2 - i
+		}
+		return "", 0
+	}
+	for k := min(n, 3); k > 0; k-- {
+		if end := r.closer(s, i+n, c, k, false); end > 0 {
+			tags := emphasisTags[k]
+			literal := s[i : i+n-k]
+			return escape(literal) + tags[0] + r.inline(s[i+n:end]) + tags[1], end + k - i
+		}
+	}
+	return "", 0
+}
+
+// closer finds the run of c closing an emphasis of k delimiters from s[i],
+// the runs opening nested emphases are matched first. exact requires a run
+// of k delimiters.
+func (r *renderer) closer(s string, i int, c byte, k int, exact bool) int {
+	var pending []int
+	for i < len(s) {
+		if !r.spend(1) {
+			return -1
+		}
+		if s[i] != c {
+			i += skip(s[i:])
+			continue
+		}
+		n := run(s[i:], c)
+		opens, closes := flanking(s, i, i+n)
+		switch {
+		case closes && len(pending) > 0:
+			pending = pending[:len(pending)-1]
+		case closes && (n == k || !exact && n > k):
+			return i
+		case opens:
+			pending = append(pending, n)
+		}
+		i += n
+	}
+	return -1
+}
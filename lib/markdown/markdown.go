@@ -0,0 +1,448 @@
+// Package markdown renders the CommonMark subset the articles use to HTML:
+// headings, paragraphs, block quotes, lists, code blocks, thematic breaks,
+// tables, emphasis, strikethrough, code spans, links, images and autolinks.
+// The raw HTML is passed through, the output has to be sanitized before it is
+// shown.
+package markdown
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ToHTML renders the Markdown source to HTML
+func ToHTML(src string) string {
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	src = strings.ReplaceAll(src, "\r", "\n")
+	lines := strings.Split(src, "\n")
+	for i, line := range lines {
+		lines[i] = expandTabs(line)
+	}
+	b := renderer{budget: new(int)}
+	*b.budget = scanBudget
+	renderBlocks(&b, lines, false)
+	return b.String()
+}
+
+// scanBudget bounds the bytes scanned looking for the ends of the emphases
+// and the links of a document, the delimiters found after it is spent are
+// kept as text. The matching is quadratic on crafted inputs without it.
+const scanBudget = 1 << 22
+
+// maxNesting bounds the nesting of the block quotes and the lists, the deeper
+// ones are kept as text
+const maxNesting = 32
+
+type renderer struct {
+	strings.Builder
+	budget *int
+	depth  int
+}
+
+// spend takes n bytes from the budget, it reports whether there were enough
+func (r *renderer) spend(n int) bool {
+	*r.budget -= n
+	return *r.budget >= 0
+}
+
+// expandTabs replaces the tabs of the indentation with spaces to the next
+// multiple of 4 columns
+func expandTabs(line string) string {
+	var b strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case ' ':
+			b.WriteByte(' ')
+		case '\t':
+			b.WriteString(strings.Repeat(" ", 4-b.Len()%4))
+		default:
+			return b.String() + line[i:]
+		}
+	}
+	return b.String()
+}
+
+func indentation(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+func blank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+var (
+	headingPattern   = regexp.MustCompile(`^(#{1,6})(?:[ ]+(.*?))?(?:[ ]+#+)?[ ]*$`)
+	breakPattern     = regexp.MustCompile(`^(?:(?:\*[ ]*){3,}|(?:-[ ]*){3,}|(?:_[ ]*){3,})$`)
+	fencePattern     = regexp.MustCompile("^(`{3,}|~{3,})[ ]*([^ ]*)")
+	setextPattern    = regexp.MustCompile(`^(?:=+|-+)[ ]*$`)
+	htmlBlockPattern = regexp.MustCompile(`^</?[A-Za-z][A-Za-z0-9-]*(?:[ />]|$)|^<!--`)
+	delimiterPattern = regexp.MustCompile(`^[ ]*:?-+:?[ ]*$`)
+)
+
+// block trims the indentation of a line starting a block, nothing starts a
+// block with 4 or more spaces
+func block(line string) (string, bool) {
+	if indentation(line) >= 4 {
+		return "", false
+	}
+	return strings.TrimLeft(line, " "), true
+}
+
+// interrupts reports whether the line starts a block ending a paragraph
+func interrupts(line string) bool {
+	t, ok := block(line)
+	if !ok {
+		return false
+	}
+	// only the ordered lists starting from 1 interrupt a paragraph, so the
+	// numbers starting a line aren't taken for a list
+	m, isList := listMarker(line)
+	isList = isList && (!m.ordered || m.start == 1)
+	return headingPattern.MatchString(t) || breakPattern.MatchString(t) || fencePattern.MatchString(t) ||
+		strings.HasPrefix(t, ">") || htmlBlockPattern.MatchString(t) || isList
+}
+
+// renderBlocks writes the blocks of the lines, the paragraphs of the tight
+// list items aren't wrapped
+func renderBlocks(b *renderer, lines []string, tight bool) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		if blank(line) {
+			i++
+			continue
+		}
+		t, ok := block(line)
+		if !ok {
+			i = codeBlock(b, lines, i)
+			continue
+		}
+		if m := fencePattern.FindStringSubmatch(t); m != nil && !(m[1][0] == '`' && strings.Contains(m[2], "`")) {
+			i = fencedCode(b, lines, i, m[1], m[2])
+			continue
+		}
+		if m := headingPattern.FindStringSubmatch(t); m != nil {
+			level := strconv.Itoa(len(m[1]))
+			b.WriteString("<h" + level + ">" + b.inline(m[2]) + "</h" + level + ">\n")
+			i++
+			continue
+		}
+		if breakPattern.MatchString(t) {
+			b.WriteString("<hr>\n")
+			i++
+			continue
+		}
+		if strings.HasPrefix(t, ">") && b.depth < maxNesting {
+			i = blockquote(b, lines, i)
+			continue
+		}
+		if _, ok := listMarker(line); ok && b.depth < maxNesting {
+			i = list(b, lines, i)
+			continue
+		}
+		if htmlBlockPattern.MatchString(t) {
+			for ; i < len(lines) && !blank(lines[i]); i++ {
+				b.WriteString(lines[i] + "\n")
+			}
+			continue
+		}
+		if i+1 < len(lines) && strings.Contains(t, "|") && isDelimiterRow(lines[i+1]) {
+			i = table(b, lines, i)
+			continue
+		}
+		i = paragraph(b, lines, i, tight)
+	}
+}
+
+func codeBlock(b *renderer, lines []string, i int) int {
+	var code []string
+	for ; i < len(lines) && (blank(lines[i]) || indentation(lines[i]) >= 4); i++ {
+		if len(lines[i]) >= 4 {
+			code = append(code, lines[i][4:])
+		} else {
+			code = append(code, "")
+		}
+	}
+	for len(code) > 0 && blank(code[len(code)-1]) {
+		code = code[:len(code)-1]
+	}
+	b.WriteString("<pre><code>" + escape(strings.Join(code, "\n")+"\n") + "</code></pre>\n")
+	return i
+}
+
+// fencedCode writes the code up to the closing fence, or to the end when the
+// fence isn't closed
+func fencedCode(b *renderer, lines []string, i int, fence, info string) int {
+	indent := indentation(lines[i])
+	var code []string
+	for i++; i < len(lines); i++ {
+		if t, ok := block(lines[i]); ok && strings.HasPrefix(t, fence) && strings.Trim(t, fence[:1]+" ") == "" {
+			i++
+			break
+		}
+		line := lines[i]
+		line = line[min(indent, indentation(line)):]
+		code = append(code, line)
+	}
+	b.WriteString("<pre><code")
+	if info != "" {
+		b.WriteString(` class="language-` + escape(unescape(info)) + `"`)
+	}
+	b.WriteString(">")
+	if len(code) > 0 {
+		b.WriteString(escape(strings.Join(code, "\n") + "\n"))
+	}
+	b.WriteString("</code></pre>\n")
+	return i
+}
+
+// blockquote collects the lines of the quote, the lines continuing its last
+// paragraph don't need the marker
+func blockquote(b *renderer, lines []string, i int) int {
+	var quoted []string
+	var lazy bool
+	for ; i < len(lines); i++ {
+		t, ok := block(lines[i])
+		if ok && strings.HasPrefix(t, ">") {
+			t = strings.TrimPrefix(t[1:], " ")
+			quoted = append(quoted, t)
+			lazy = !blank(t)
+			continue
+		}
+		if !lazy || blank(lines[i]) || interrupts(lines[i]) {
+			break
+		}
+		quoted = append(quoted, lines[i])
+	}
+	b.WriteString("<blockquote>\n")
+	b.depth++
+	renderBlocks(b, quoted, false)
+	b.depth--
+	b.WriteString("</blockquote>\n")
+	return i
+}
+
+func paragraph(b *renderer, lines []string, i int, tight bool) int {
+	var text []string
+	for ; i < len(lines) && !blank(lines[i]); i++ {
+		if len(text) > 0 {
+			if t, ok := block(lines[i]); ok && setextPattern.MatchString(t) {
+				level := "1"
+				if t[0] == '-' {
+					level = "2"
+				}
+				b.WriteString("<h" + level + ">" + b.inline(strings.Join(text, "\n")) + "</h" + level + ">\n")
+				return i + 1
+			}
+			if interrupts(lines[i]) {
+				break
+			}
+		}
+		text = append(text, strings.TrimLeft(lines[i], " "))
+	}
+	content := b.inline(strings.TrimRight(strings.Join(text, "\n"), " "))
+	if tight {
+		b.WriteString(content + "\n")
+		return i
+	}
+	b.WriteString("<p>" + content + "</p>\n")
+	return i
+}
+
+type marker struct {
+	ordered bool
+	start   int
+	// delimiter is the bullet or the character after the number
+	delimiter byte
+	// width is the indentation of the content of the item
+	width int
+}
+
+var orderedPattern = regexp.MustCompile(`^([0-9]{1,9})([.)])`)
+
+func listMarker(line string) (marker, bool) {
+	t, ok := block(line)
+	if !ok || t == "" {
+		return marker{}, false
+	}
+	var m marker
+	var size int
+	if t[0] == '-' || t[0] == '*' || t[0] == '+' {
+		m.delimiter, size = t[0], 1
+	} else if g := orderedPattern.FindStringSubmatch(t); g != nil {
+		m.ordered, m.delimiter, size = true, g[2][0], len(g[0])
+		m.start, _ = strconv.Atoi(g[1])
+	} else {
+		return marker{}, false
+	}
+	rest := t[size:]
+	if rest != "" && rest[0] != ' ' {
+		return marker{}, false
+	}
+	if !m.ordered && breakPattern.MatchString(t) {
+		return marker{}, false
+	}
+	spaces := indentation(rest)
+	if spaces > 4 || blank(rest) {
+		spaces = 1
+	}
+	m.width = indentation(line) + size + spaces
+	return m, true
+}
+
+// list collects the items of the list, it is loose when a blank line
+// separates its items or the blocks of an item
+func list(b *renderer, lines []string, i int) int {
+	first, _ := listMarker(lines[i])
+	var items [][]string
+	var loose bool
+	for i < len(lines) {
+		m, ok := listMarker(lines[i])
+		if !ok || m.ordered != first.ordered || m.delimiter != first.delimiter {
+			break
+		}
+		item := []string{lines[i][min(m.width, len(lines[i])):]}
+		var gap bool
+	item:
+		for i++; i < len(lines); i++ {
+			line := lines[i]
+			switch {
+			case blank(line):
+				item = append(item, "")
+				gap = true
+				continue
+			case indentation(line) >= m.width:
+				item = append(item, line[m.width:])
+			case !gap && !interrupts(line) && !isMarker(line):
+				item = append(item, line)
+			default:
+				break item
+			}
+			if gap {
+				loose = true
+			}
+			gap = false
+		}
+		if gap && i < len(lines) {
+			if next, ok := listMarker(lines[i]); ok && next.ordered == first.ordered && next.delimiter == first.delimiter {
+				loose = true
+			}
+		}
+		items = append(items, item)
+	}
+	tag := "ul"
+	if first.ordered {
+		tag = "ol"
+	}
+	b.WriteString("<" + tag)
+	if first.ordered && first.start != 1 {
+		b.WriteString(` start="` + strconv.Itoa(first.start) + `"`)
+	}
+	b.WriteString(">\n")
+	for _, item := range items {
+		content := renderer{budget: b.budget, depth: b.depth + 1}
+		renderBlocks(&content, item, !loose)
+		c := content.String()
+		if !loose {
+			c = strings.TrimSuffix(c, "\n")
+		} else if c != "" {
+			c = "\n" + c
+		}
+		b.WriteString("<li>" + c + "</li>\n")
+	}
+	b.WriteString("</" + tag + ">\n")
+	return i
+}
+
+func isMarker(line string) bool {
+	_, ok := listMarker(line)
+	return ok
+}
+
+func isDelimiterRow(line string) bool {
+	if !strings.Contains(line, "-") {
+		return false
+	}
+	for _, cell := range cells(line) {
+		if !delimiterPattern.MatchString(cell) {
+			return false
+		}
+	}
+	return true
+}
+
+// cells splits a row of a table by its unescaped pipes
+func cells(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+	var result []string
+	var cell strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case line[i] == '|':
+			result = append(result, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(line[i])
+		}
+	}
+	return append(result, strings.TrimSpace(cell.String()))
+}
+
+func table(b *renderer, lines []string, i int) int {
+	header := cells(lines[i])
+	var aligns []string
+	for _, d := range cells(lines[i+1]) {
+		switch {
+		case strings.HasPrefix(d, ":") && strings.HasSuffix(d, ":"):
+			aligns = append(aligns, "center")
+		case strings.HasSuffix(d, ":"):
+			aligns = append(aligns, "right")
+		case strings.HasPrefix(d, ":"):
+			aligns = append(aligns, "left")
+		default:
+			aligns = append(aligns, "")
+		}
+	}
+	row := func(tag string, values []string) {
+		b.WriteString("<tr>\n")
+		for j := range header {
+			b.WriteString("<" + tag)
+			if j < len(aligns) && aligns[j] != "" {
+				b.WriteString(` align="` + aligns[j] + `"`)
+			}
+			b.WriteString(">")
+			if j < len(values) {
+				b.WriteString(b.inline(values[j]))
+			}
+			b.WriteString("</" + tag + ">\n")
+		}
+		b.WriteString("</tr>\n")
+	}
+	b.WriteString("<table>\n<thead>\n")
+	row("th", header)
+	b.WriteString("</thead>\n")
+	i += 2
+	if i < len(lines) && !blank(lines[i]) && !interrupts(lines[i]) {
+		b.WriteString("<tbody>\n")
+		for ; i < len(lines) && !blank(lines[i]) && !interrupts(lines[i]); i++ {
+			row("td", cells(lines[i]))
+		}
+		b.WriteString("</tbody>\n")
+	}
+	b.WriteString("</table>\n")
+	return i
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,78 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToHTML_Blocks(t *testing.T) {
+	for _, tc := range []struct {
+		name, in, out string
+	}{
+		{"paragraphs", "a\nb\n\nc", "<p>a\nb</p>\n<p>c</p>\n"},
+		{"atx headings", "# One\n### Three ###\n#hashtag", "<h1>One</h1>\n<h3>Three</h3>\n<p>#hashtag</p>\n"},
+		{"setext headings", "One\n===\nTwo\n---", "<h1>One</h1>\n<h2>Two</h2>\n"},
+		{"thematic break", "a\n\n* * *\n", "<p>a</p>\n<hr>\n"},
+		{"indented code", "    a < b\n\n    c\n", "<pre><code>a &lt; b\n\nc\n</code></pre>\n"},
+		{"fenced code", "```go\nfunc() {}\n\n  x\n```\nafter",
+			"<pre><code class=\"language-go\">func() {}\n\n  x\n</code></pre>\n<p>after</p>\n"},
+		{"unclosed fence", "~~~\ncode", "<pre><code>code\n</code></pre>\n"},
+		{"blockquote", "> # Quote\n> a\nlazy\n\nb", "<blockquote>\n<h1>Quote</h1>\n<p>a\nlazy</p>\n</blockquote>\n<p>b</p>\n"},
+		{"tight list", "- a\n- b\n  - c\n- d", "<ul>\n<li>a</li>\n<li>b\n<ul>\n<li>c</li>\n</ul></li>\n<li>d</li>\n</ul>\n"},
+		{"loose list", "1. a\n\n2. b", "<ol>\n<li>\n<p>a</p>\n</li>\n<li>\n<p>b</p>\n</li>\n</ol>\n"},
+		{"ordered start", "3) a\n4) b", "<ol start=\"3\">\n<li>a</li>\n<li>b</li>\n</ol>\n"},
+		{"list types", "- a\n+ b", "<ul>\n<li>a</li>\n</ul>\n<ul>\n<li>b</li>\n</ul>\n"},
+		{"number in paragraph", "in\n2019. was", "<p>in\n2019. was</p>\n"},
+		{"html block", "<div>\n*a*\n</div>\n\n*b*", "<div>\n*a*\n</div>\n<p><em>b</em></p>\n"},
+		{"table", "| a | b |\n|:--|--:|\n| 1 | 2 \\| 3 |\n| 4 |",
+			"<table>\n<thead>\n<tr>\n<th align=\"left\">a</th>\n<th align=\"right\">b</th>\n</tr>\n</thead>\n" +
+				"<tbody>\n<tr>\n<td align=\"left\">1</td>\n<td align=\"right\">2 | 3</td>\n</tr>\n" +
+				"<tr>\n<td align=\"left\">4</td>\n<td align=\"right\"></td>\n</tr>\n</tbody>\n</table>\n"},
+		{"crlf", "a\r\nb", "<p>a\nb</p>\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.out, ToHTML(tc.in))
+		})
+	}
+}
+
+func TestToHTML_Inline(t *testing.T) {
+	for _, tc := range []struct {
+		name, in, out string
+	}{
+		{"escape", `a < b & "c" \*d\*`, "a &lt; b &amp; &quot;c&quot; *d*"},
+		{"entity", "&copy; &#169;", "&copy; &#169;"},
+		{"emphasis", "*a* _b_ **c** __d__ ***e***", "<em>a</em> <em>b</em> <strong>c</strong> <strong>d</strong> <em><strong>e</strong></em>"},
+		{"nested emphasis", "*a **b** c*", "<em>a <strong>b</strong> c</em>"},
+		{"unbalanced emphasis", "**a* b*", "*<em>a</em> b*"},
+		{"intraword underscore", "snake_case_name", "snake_case_name"},
+		{"lone star", "a * b", "a * b"},
+		{"strikethrough", "~~a~~ ~b~", "<del>a</del> ~b~"},
+		{"code span", "`a <b>` `` c`d ``", "<code>a &lt;b&gt;</code> <code>c`d</code>"},
+		{"code span emphasis", "*a `*` b*", "<em>a <code>*</code> b</em>"},
+		{"link", `[a *b*](/x "T") [c](<d e>)`, `<a href="/x" title="T">a <em>b</em></a> <a href="d e">c</a>`},
+		{"link parens", "[a](https://x.io/a_(b))", `<a href="https://x.io/a_(b)">a</a>`},
+		{"not a link", "[a] (b) [c](d", "[a] (b) [c](d"},
+		{"image", `![a "b"](/i.png)`, `<img src="/i.png" alt="a &quot;b&quot;">`},
+		{"autolink", "<https://x.io?a=1&b=2> <me@x.io>",
+			`<a href="https://x.io?a=1&amp;b=2">https://x.io?a=1&amp;b=2</a> <a href="mailto:me@x.io">me@x.io</a>`},
+		{"raw html", `a <span class="x">b</span> <3`, `a <span class="x">b</span> &lt;3`},
+		{"hard break", "a  \nb\\\nc\nd", "a<br>\nb<br>\nc\nd"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, "<p>"+tc.out+"</p>\n", ToHTML(tc.in))
+		})
+	}
+}
+
+func TestToHTML_Limits(t *testing.T) {
+	out := ToHTML(strings.Repeat(">", 1000) + " x")
+	assert.Equal(t, maxNesting, strings.Count(out, "<blockquote>"))
+	assert.Contains(t, out, "<p>"+strings.Repeat("&gt;", 1000-maxNesting)+" x</p>")
+
+	// the delimiters found after the budget is spent are kept as text
+	out = ToHTML(strings.Repeat("*a ", scanBudget/4) + "*b*")
+	assert.True(t, strings.HasSuffix(out, "*b*</p>\n"))
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/borosr/realworld/lib/api"
+	"github.com/borosr/realworld/lib/broken"
+	"github.com/borosr/realworld/lib/config"
+	"github.com/borosr/realworld/lib/tenant"
+)
+
+var (
+	admins = config.List("ADMIN_EMAILS")
+
+	ErrNotAdmin = broken.Forbidden("admin permission required")
+)
+
+var _ api.Middleware = AdminAuthorization
+
+// AdminAuthorization allows the users of the default tenant listed in
+// ADMIN_EMAILS. The admin endpoints reach every tenant, and anyone can
+// register a listed email in another tenant, so the users of the other
+// tenants are never admins. It has to wrap the TokenAuthentication, so it
+// must be registered after that: PreProcess(TokenAuthentication,
+// AdminAuthorization)
+func AdminAuthorization(next api.MiddlewareFunc) api.MiddlewareFunc {
+	return func(w http.ResponseWriter, r *http.Request) (context.Context, error) {
+		ctx, err := next(w, r)
+		if err != nil {
+			return ctx, err
+		}
+		email, err := api.GetValue[string](ctx, "email")
+		if err != nil {
+			return ctx, ErrNotAuthenticated
+		}
+		if tenant.ID(r.Context()) != "" {
+			return ctx, ErrNotAdmin
+		}
+		for _, admin := range admins {
+			if admin == email {
+				return ctx, nil
+			}
+		}
+		return ctx, ErrNotAdmin
+	}
+}
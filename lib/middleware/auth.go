@@ -8,6 +8,7 @@ import (
 	"github.com/borosr/realworld/lib/api"
 	"github.com/borosr/realworld/lib/auth"
 	"github.com/borosr/realworld/lib/broken"
+	"github.com/borosr/realworld/lib/tenant"
 )
 
 const tokenPrefix = "Token "
@@ -16,7 +17,10 @@ var (
 	ErrNotAuthenticated = broken.Internal("not authenticated")
 )
 
-var _ api.Middleware = TokenAuthentication
+var (
+	_ api.Middleware = TokenAuthentication
+	_ api.Middleware = OptionalTokenAuthentication
+)
 
 func TokenAuthentication(next api.MiddlewareFunc) api.MiddlewareFunc {
 	return func(w http.ResponseWriter, r *http.Request) (context.Context, error) {
@@ -24,21 +28,42 @@ func TokenAuthentication(next api.MiddlewareFunc) api.MiddlewareFunc {
 		if token == "" {
 			return r.Context(), ErrNotAuthenticated
 		}
+		return authenticate(r, token)
+	}
+}
 
-		if !strings.HasPrefix(token, tokenPrefix) {
-			return r.Context(), ErrNotAuthenticated
-		}
-
-		token = strings.ReplaceAll(token, tokenPrefix, "")
+// OptionalTokenAuthentication lets the anonymous requests through without an
+// email in the context, the requests with a token are authenticated like by
+// the TokenAuthentication, so an invalid token is still rejected
+func OptionalTokenAuthentication(next api.MiddlewareFunc) api.MiddlewareFunc {
+	return func(w http.ResponseWriter, r *http.Request) (context.Context, error) {
+		token := r.Header.Get("Authorization")
 		if token == "" {
-			return r.Context(), ErrNotAuthenticated
+			return r.Context(), nil
 		}
+		return authenticate(r, token)
+	}
+}
 
-		claims, err := auth.Verify(token)
-		if err != nil {
-			return r.Context(), err
-		}
+func authenticate(r *http.Request, token string) (context.Context, error) {
+	if !strings.HasPrefix(token, tokenPrefix) {
+		return r.Context(), ErrNotAuthenticated
+	}
 
-		return context.WithValue(r.Context(), "email", claims["email"]), nil
+	token = strings.ReplaceAll(token, tokenPrefix, "")
+	if token == "" {
+		return r.Context(), ErrNotAuthenticated
 	}
+
+	claims, err := auth.Verify(token)
+	if err != nil {
+		return r.Context(), err
+	}
+	// the tokens are valid only in the tenant they were issued for
+	issuedFor, _ := claims["tenant"].(string)
+	if issuedFor != tenant.ID(r.Context()) {
+		return r.Context(), auth.ErrUnableToVerifyToken
+	}
+
+	return context.WithValue(r.Context(), "email", claims["email"]), nil
 }
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/borosr/realworld/lib/api"
+	"github.com/borosr/realworld/lib/broken"
+	"github.com/borosr/realworld/lib/tenant"
+)
+
+const TenantHeader = "X-Tenant-ID"
+
+var ErrUnknownTenant = broken.Validation("unknown tenant")
+
+var _ api.GlobalMiddleware = Tenant
+
+// Tenant stores the tenant of the request in the context, it is taken from
+// the X-Tenant-ID header or resolved from the host name, the requests of the
+// unresolved hosts belong to the default tenant
+func Tenant(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(TenantHeader)
+		if id == "" {
+			id, _ = tenant.FromHost(r.Host)
+		}
+		if id != "" && (tenant.Validate(id) != nil || !tenant.Known(id)) {
+			api.Error(w, ErrUnknownTenant)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(tenant.WithID(r.Context(), id)))
+	})
+}
@@ -0,0 +1,229 @@
+// Package sanitize cleans untrusted HTML with an allow-list of elements and
+// attributes, everything else is dropped.
+package sanitize
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Policy allow-lists the elements and their attributes, the URL attributes
+// are kept only with one of the Schemes or without a scheme
+type Policy struct {
+	Elements      map[string][]string
+	URLAttributes map[string]bool
+	Schemes       map[string]bool
+	// Rel is added to the links leaving the site
+	Rel string
+}
+
+// UGC is the policy of the user generated content, the usual elements of the
+// formatted texts without styles, forms, frames and scripts
+var UGC = Policy{
+	Elements: map[string][]string{
+		"a":          {"href", "title"},
+		"abbr":       {"title"},
+		"b":          nil,
+		"blockquote": nil,
+		"br":         nil,
+		"code":       {"class"},
+		"del":        nil,
+		"em":         nil,
+		"h1":         nil,
+		"h2":         nil,
+		"h3":         nil,
+		"h4":         nil,
+		"h5":         nil,
+		"h6":         nil,
+		"hr":         nil,
+		"i":          nil,
+		"img":        {"src", "alt", "title"},
+		"li":         nil,
+		"ol":         {"start"},
+		"p":          nil,
+		"pre":        nil,
+		"s":          nil,
+		"strong":     nil,
+		"sub":        nil,
+		"sup":        nil,
+		"table":      nil,
+		"tbody":      nil,
+		"td":         {"align"},
+		"th":         {"align"},
+		"thead":      nil,
+		"tr":         nil,
+		"ul":         nil,
+	},
+	URLAttributes: map[string]bool{"href": true, "src": true},
+	Schemes:       map[string]bool{"http": true, "https": true, "mailto": true},
+	Rel:           "nofollow noopener noreferrer",
+}
+
+// HTML cleans s with the UGC policy
+func HTML(s string) string {
+	return UGC.Sanitize(s)
+}
+
+// dropped are the elements removed together with their content
+var dropped = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"iframe":   true,
+	"object":   true,
+	"embed":    true,
+	"noscript": true,
+	"noembed":  true,
+	"noframes": true,
+	"template": true,
+	"textarea": true,
+	"title":    true,
+	"xmp":      true,
+	"select":   true,
+	"svg":      true,
+	"math":     true,
+}
+
+var void = map[string]bool{
+	"br":  true,
+	"hr":  true,
+	"img": true,
+}
+
+// Sanitize returns s with the allowed elements and attributes only. The text
+// is kept as it was written, but its angle brackets are escaped, so the
+// removed parts can't join into a new tag. The output is balanced, the
+// elements left open are closed at the end.
+func (p Policy) Sanitize(s string) string {
+	var b strings.Builder
+	var open []string
+	// skip is the element being dropped with its content, depth counts its
+	// nested occurrences
+	var skip string
+	var depth int
+	z := html.NewTokenizer(strings.NewReader(s))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		if skip != "" {
+			switch tag, _ := z.TagName(); {
+			case tt == html.StartTagToken && string(tag) == skip:
+				depth++
+			case tt == html.EndTagToken && string(tag) == skip:
+				if depth--; depth == 0 {
+					skip = ""
+				}
+			}
+			continue
+		}
+		switch tt {
+		case html.TextToken:
+			b.WriteString(escapeText(string(z.Raw())))
+		case html.StartTagToken, html.SelfClosingTagToken:
+			t := z.Token()
+			if dropped[t.Data] {
+				if tt == html.StartTagToken {
+					skip, depth = t.Data, 1
+				}
+				continue
+			}
+			if _, ok := p.Elements[t.Data]; !ok {
+				continue
+			}
+			b.WriteString(p.startTag(t))
+			if void[t.Data] {
+				continue
+			}
+			if tt == html.SelfClosingTagToken {
+				b.WriteString("</" + t.Data + ">")
+				continue
+			}
+			open = append(open, t.Data)
+		case html.EndTagToken:
+			tag, _ := z.TagName()
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] != string(tag) {
+					continue
+				}
+				for len(open) > i {
+					b.WriteString("</" + open[len(open)-1] + ">")
+					open = open[:len(open)-1]
+				}
+				break
+			}
+		}
+	}
+	for i := len(open) - 1; i >= 0; i-- {
+		b.WriteString("</" + open[i] + ">")
+	}
+	return b.String()
+}
+
+func (p Policy) startTag(t html.Token) string {
+	var b strings.Builder
+	b.WriteString("<" + t.Data)
+	var external bool
+	seen := make(map[string]bool)
+	for _, a := range t.Attr {
+		if a.Namespace != "" || seen[a.Key] || !p.allowed(t.Data, a) {
+			continue
+		}
+		seen[a.Key] = true
+		if t.Data == "a" && a.Key == "href" {
+			external = isExternal(a.Val)
+		}
+		b.WriteString(" " + a.Key + `="` + html.EscapeString(a.Val) + `"`)
+	}
+	if external && p.Rel != "" {
+		b.WriteString(` rel="` + p.Rel + `"`)
+	}
+	b.WriteString(">")
+	return b.String()
+}
+
+func (p Policy) allowed(element string, a html.Attribute) bool {
+	var listed bool
+	for _, key := range p.Elements[element] {
+		listed = listed || key == a.Key
+	}
+	switch {
+	case !listed:
+		return false
+	case p.URLAttributes[a.Key]:
+		return p.safeURL(a.Val)
+	case a.Key == "class":
+		// only the languages of the code blocks
+		return strings.HasPrefix(a.Val, "language-") && !strings.ContainsAny(a.Val, " \t\n")
+	}
+	return true
+}
+
+// safeURL accepts the relative URLs and the absolute ones with an allowed
+// scheme, the control characters the browsers strip from the URLs are
+// rejected, so they can't hide the scheme
+func (p Policy) safeURL(s string) bool {
+	for _, r := range s {
+		if r < 0x20 || r == 0x7f {
+			return false
+		}
+	}
+	u, err := url.Parse(strings.TrimSpace(s))
+	if err != nil {
+		return false
+	}
+	return u.Scheme == "" || p.Schemes[strings.ToLower(u.Scheme)]
+}
+
+func isExternal(s string) bool {
+	u, err := url.Parse(strings.TrimSpace(s))
+	return err == nil && (u.Host != "" || u.Scheme != "")
+}
+
+var textEscaper = strings.NewReplacer("<", "&lt;", ">", "&gt;")
+
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
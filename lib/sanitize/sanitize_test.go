@@ -0,0 +1,40 @@
+package sanitize
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTML(t *testing.T) {
+	for _, tc := range []struct {
+		name, in, out string
+	}{
+		{"text", "Tom & Jerry", "Tom & Jerry"},
+		{"allowed", "<p>a <strong>b</strong></p>", "<p>a <strong>b</strong></p>"},
+		{"script", "a<script>alert(1)</script>b", "ab"},
+		{"nested dropped", "<svg><svg></svg><g onload=x></g></svg>ok", "ok"},
+		{"unknown element", "<div class=\"x\"><span>a</span></div>", "a"},
+		{"event handler", `<img src="a.png" onerror="alert(1)">`, `<img src="a.png">`},
+		{"javascript link", `<a href="javascript:alert(1)">x</a>`, "<a>x</a>"},
+		{"encoded scheme", `<a href="javascript&#58;alert(1)">x</a>`, "<a>x</a>"},
+		{"hidden scheme", "<a href=\"java\tscript:alert(1)\">x</a>", "<a>x</a>"},
+		{"external link", `<a href="https://example.com" title="t">x</a>`,
+			`<a href="https://example.com" title="t" rel="nofollow noopener noreferrer">x</a>`},
+		{"relative link", `<a href="/api/articles">x</a>`, `<a href="/api/articles">x</a>`},
+		{"rel", `<a href="/x" rel="opener">x</a>`, `<a href="/x">x</a>`},
+		{"code language", `<code class="language-go">x</code><code class="a b">y</code>`,
+			`<code class="language-go">x</code><code>y</code>`},
+		{"unbalanced", "<p><em>a</p>b</em>", "<p><em>a</em></p>b"},
+		{"unclosed", "<ul><li>a", "<ul><li>a</li></ul>"},
+		{"self closing", "a<br/>b<p/>", "a<br>b<p></p>"},
+		{"comment", "a<!-- b -->c", "ac"},
+		{"joined tags", "<<script>x</script>script>alert(1)<</script>/script>",
+			"&lt;script&gt;alert(1)&lt;/script&gt;"},
+		{"attribute quotes", `<img alt="&quot;><script>">`, `<img alt="&#34;&gt;&lt;script&gt;">`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.out, HTML(tc.in))
+		})
+	}
+}
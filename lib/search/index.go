@@ -0,0 +1,243 @@
+package search
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// the BM25 parameters, k1 saturates the term frequency and b normalizes it
+// by the document length
+const (
+	k1 = 1.2
+	b  = 0.75
+	// prefixWeight discounts the terms matched by a prefix of a query word
+	prefixWeight = 0.5
+	// minPrefixLength keeps the single letters from matching everything
+	minPrefixLength = 2
+)
+
+// Field is a text of a document, the matches in a field of higher weight
+// count more
+type Field struct {
+	Text   string
+	Weight float64
+}
+
+// Result is a matching document and its relevance
+type Result struct {
+	ID    string
+	Score float64
+}
+
+type document struct {
+	length float64
+	terms  []string
+}
+
+// Index is an inverted index of documents, it is safe for concurrent use
+type Index struct {
+	mu sync.RWMutex
+	// postings holds the weighted frequency of the terms per document
+	postings  map[string]map[string]float64
+	documents map[string]document
+	// vocabulary is the sorted list of the terms for the prefix matching
+	vocabulary  []string
+	totalLength float64
+}
+
+func NewIndex() *Index {
+	return &Index{
+		postings:  make(map[string]map[string]float64),
+		documents: make(map[string]document),
+	}
+}
+
+// Add indexes the fields of a document, it replaces the former version of
+// the document
+func (idx *Index) Add(id string, fields ...Field) {
+	var frequencies = make(map[string]float64)
+	var length float64
+	for _, f := range fields {
+		for _, term := range terms(f.Text) {
+			frequencies[term] += f.Weight
+			length += f.Weight
+		}
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.remove(id)
+	if len(frequencies) == 0 {
+		return
+	}
+	var doc = document{length: length, terms: make([]string, 0, len(frequencies))}
+	for term, tf := range frequencies {
+		postings, ok := idx.postings[term]
+		if !ok {
+			postings = make(map[string]float64)
+			idx.postings[term] = postings
+			idx.insertTerm(term)
+		}
+		postings[id] = tf
+		doc.terms = append(doc.terms, term)
+	}
+	idx.documents[id] = doc
+	idx.totalLength += length
+}
+
+func (idx *Index) Remove(id string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.remove(id)
+}
+
+// Len returns the number of the indexed documents
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.documents)
+}
+
+func (idx *Index) remove(id string) {
+	doc, ok := idx.documents[id]
+	if !ok {
+		return
+	}
+	for _, term := range doc.terms {
+		postings := idx.postings[term]
+		delete(postings, id)
+		if len(postings) == 0 {
+			delete(idx.postings, term)
+			idx.deleteTerm(term)
+		}
+	}
+	delete(idx.documents, id)
+	idx.totalLength -= doc.length
+}
+
+func (idx *Index) insertTerm(term string) {
+	i := sort.SearchStrings(idx.vocabulary, term)
+	idx.vocabulary = append(idx.vocabulary, "")
+	copy(idx.vocabulary[i+1:], idx.vocabulary[i:])
+	idx.vocabulary[i] = term
+}
+
+func (idx *Index) deleteTerm(term string) {
+	i := sort.SearchStrings(idx.vocabulary, term)
+	if i < len(idx.vocabulary) && idx.vocabulary[i] == term {
+		idx.vocabulary = append(idx.vocabulary[:i], idx.vocabulary[i+1:]...)
+	}
+}
+
+// Search returns the documents matching every word of the query, the most
+// relevant first
+func (idx *Index) Search(q Query) []Result {
+	if q.Empty() {
+		return nil
+	}
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	var scores map[string]float64
+	for _, w := range q.words {
+		wordScores := idx.score(idx.expand(w))
+		if scores == nil {
+			scores = wordScores
+			continue
+		}
+		for id, score := range scores {
+			if s, ok := wordScores[id]; ok {
+				scores[id] = score + s
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+	var res = make([]Result, 0, len(scores))
+	for id, score := range scores {
+		res = append(res, Result{ID: id, Score: score})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Score != res[j].Score {
+			return res[i].Score > res[j].Score
+		}
+		return res[i].ID < res[j].ID
+	})
+	return res
+}
+
+// expand returns the indexed terms matching the word with their weights
+func (idx *Index) expand(w word) map[string]float64 {
+	var matches = make(map[string]float64)
+	if len(w.term) >= minPrefixLength {
+		for i := sort.SearchStrings(idx.vocabulary, w.term); i < len(idx.vocabulary); i++ {
+			if !strings.HasPrefix(idx.vocabulary[i], w.term) {
+				break
+			}
+			matches[idx.vocabulary[i]] = prefixWeight
+		}
+	}
+	if _, ok := idx.postings[w.stem]; ok {
+		matches[w.stem] = 1
+	}
+	return matches
+}
+
+// score sums the BM25 scores of the terms per document
+func (idx *Index) score(matches map[string]float64) map[string]float64 {
+	var scores = make(map[string]float64)
+	n := float64(len(idx.documents))
+	avgLength := idx.totalLength / n
+	for term, weight := range matches {
+		postings := idx.postings[term]
+		df := float64(len(postings))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for id, tf := range postings {
+			norm := 1 - b + b*idx.documents[id].length/avgLength
+			scores[id] += weight * idf * tf * (k1 + 1) / (tf + k1*norm)
+		}
+	}
+	return scores
+}
+
+type word struct {
+	// term is the folded word for the prefix matching
+	term string
+	stem string
+}
+
+// Query is a parsed search query
+type Query struct {
+	words []word
+}
+
+// ParseQuery parses the words of the query, the stop words are ignored
+func ParseQuery(q string) Query {
+	var query Query
+	var seen = make(map[string]bool)
+	for _, t := range Tokenize(q) {
+		if isStopWord(t.Term) || seen[t.Term] {
+			continue
+		}
+		seen[t.Term] = true
+		query.words = append(query.words, word{term: t.Term, stem: Stem(t.Term)})
+	}
+	return query
+}
+
+// Empty reports a query without searchable words
+func (q Query) Empty() bool {
+	return len(q.words) == 0
+}
+
+// matches reports whether a token of a text matches a word of the query the
+// way the index does
+func (q Query) matches(term string) bool {
+	stem := Stem(term)
+	for _, w := range q.words {
+		if stem == w.stem || len(w.term) >= minPrefixLength && strings.HasPrefix(stem, w.term) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func ids(results []Result) []string {
+	var res = make([]string, 0, len(results))
+	for _, r := range results {
+		res = append(res, r.ID)
+	}
+	return res
+}
+
+func testIndex() *Index {
+	idx := NewIndex()
+	idx.Add("dragons", Field{Text: "How to train your dragon", Weight: 3}, Field{Text: "Ever wonder how?", Weight: 1})
+	idx.Add("angular", Field{Text: "Angular tips", Weight: 3}, Field{Text: "Training for the Angular developers", Weight: 1})
+	idx.Add("go", Field{Text: "Generics in Go", Weight: 3}, Field{Text: "Programming with type parameters", Weight: 1})
+	return idx
+}
+
+func TestIndex_Search(t *testing.T) {
+	idx := testIndex()
+	assert.Equal(t, 3, idx.Len())
+
+	// stemming, the title weighs more than the body
+	assert.Equal(t, []string{"dragons", "angular"}, ids(idx.Search(ParseQuery("trained"))))
+	// every word has to match
+	assert.Equal(t, []string{"dragons"}, ids(idx.Search(ParseQuery("train dragons"))))
+	// prefix
+	assert.Equal(t, []string{"go"}, ids(idx.Search(ParseQuery("progr"))))
+	assert.Empty(t, idx.Search(ParseQuery("rust")))
+	assert.Empty(t, idx.Search(ParseQuery("the")))
+}
+
+func TestIndex_Update(t *testing.T) {
+	idx := testIndex()
+
+	idx.Add("go", Field{Text: "Rust ownership", Weight: 3})
+	assert.Empty(t, idx.Search(ParseQuery("generics")))
+	assert.Equal(t, []string{"go"}, ids(idx.Search(ParseQuery("rust"))))
+
+	idx.Remove("go")
+	assert.Equal(t, 2, idx.Len())
+	assert.Empty(t, idx.Search(ParseQuery("rust")))
+	assert.NotContains(t, idx.vocabulary, "rust")
+	idx.Remove("go")
+	assert.Equal(t, 2, idx.Len())
+}
+
+func TestIndex_Ranking(t *testing.T) {
+	idx := NewIndex()
+	idx.Add("b", Field{Text: "search engines", Weight: 1})
+	idx.Add("a", Field{Text: "search search search", Weight: 1})
+	idx.Add("c", Field{Text: "search", Weight: 1})
+	idx.Add("d", Field{Text: "search", Weight: 1})
+
+	res := idx.Search(ParseQuery("search"))
+	assert.Equal(t, []string{"a", "c", "d", "b"}, ids(res))
+	assert.Greater(t, res[0].Score, res[1].Score)
+	assert.Equal(t, res[1].Score, res[2].Score)
+}
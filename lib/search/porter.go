@@ -0,0 +1,217 @@
+package search
+
+// Stem returns the stem of a lower case English word with the Porter
+// stemming algorithm (M.F. Porter, An algorithm for suffix stripping, 1980).
+// The words with non ASCII letters are returned as they are.
+func Stem(word string) string {
+	if len(word) <= 2 {
+		return word
+	}
+	for i := 0; i < len(word); i++ {
+		if word[i] >= 0x80 {
+			return word
+		}
+	}
+	w := []byte(word)
+	w = step1a(w)
+	w = step1b(w)
+	w = step1c(w)
+	w = step2(w)
+	w = step3(w)
+	w = step4(w)
+	w = step5(w)
+	return string(w)
+}
+
+type rule struct {
+	suffix      string
+	replacement string
+}
+
+var step2Rules = []rule{
+	{"ational", "ate"}, {"tional", "tion"}, {"enci", "ence"}, {"anci", "ance"},
+	{"izer", "ize"}, {"abli", "able"}, {"alli", "al"}, {"entli", "ent"},
+	{"eli", "e"}, {"ousli", "ous"}, {"ization", "ize"}, {"ation", "ate"},
+	{"ator", "ate"}, {"alism", "al"}, {"iveness", "ive"}, {"fulness", "ful"},
+	{"ousness", "ous"}, {"aliti", "al"}, {"iviti", "ive"}, {"biliti", "ble"},
+}
+
+var step3Rules = []rule{
+	{"icate", "ic"}, {"ative", ""}, {"alize", "al"}, {"iciti", "ic"},
+	{"ical", "ic"}, {"ful", ""}, {"ness", ""},
+}
+
+var step4Rules = []rule{
+	{"al", ""}, {"ance", ""}, {"ence", ""}, {"er", ""}, {"ic", ""},
+	{"able", ""}, {"ible", ""}, {"ant", ""}, {"ement", ""}, {"ment", ""},
+	{"ent", ""}, {"ion", ""}, {"ou", ""}, {"ism", ""}, {"ate", ""},
+	{"iti", ""}, {"ous", ""}, {"ive", ""}, {"ize", ""},
+}
+
+func step1a(w []byte) []byte {
+	switch {
+	case hasSuffix(w, "sses"), hasSuffix(w, "ies"):
+		return w[:len(w)-2]
+	case hasSuffix(w, "ss"):
+		return w
+	case hasSuffix(w, "s"):
+		return w[:len(w)-1]
+	}
+	return w
+}
+
+func step1b(w []byte) []byte {
+	if hasSuffix(w, "eed") {
+		if measure(w[:len(w)-3]) > 0 {
+			return w[:len(w)-1]
+		}
+		return w
+	}
+	var stem []byte
+	switch {
+	case hasSuffix(w, "ed") && hasVowel(w[:len(w)-2]):
+		stem = w[:len(w)-2]
+	case hasSuffix(w, "ing") && hasVowel(w[:len(w)-3]):
+		stem = w[:len(w)-3]
+	default:
+		return w
+	}
+	switch {
+	case hasSuffix(stem, "at"), hasSuffix(stem, "bl"), hasSuffix(stem, "iz"):
+		return append(stem, 'e')
+	case endsWithDoubleConsonant(stem) && !hasSuffix(stem, "l") && !hasSuffix(stem, "s") && !hasSuffix(stem, "z"):
+		return stem[:len(stem)-1]
+	case measure(stem) == 1 && endsWithCVC(stem):
+		return append(stem, 'e')
+	}
+	return stem
+}
+
+func step1c(w []byte) []byte {
+	if hasSuffix(w, "y") && hasVowel(w[:len(w)-1]) {
+		w[len(w)-1] = 'i'
+	}
+	return w
+}
+
+func step2(w []byte) []byte {
+	return replaceLongest(w, step2Rules, func(stem []byte) bool {
+		return measure(stem) > 0
+	})
+}
+
+func step3(w []byte) []byte {
+	return replaceLongest(w, step3Rules, func(stem []byte) bool {
+		return measure(stem) > 0
+	})
+}
+
+func step4(w []byte) []byte {
+	if hasSuffix(w, "ion") {
+		// the longer suffixes ending with ion are handled by the rules
+		stem := w[:len(w)-3]
+		if measure(stem) > 1 && (hasSuffix(stem, "s") || hasSuffix(stem, "t")) {
+			return stem
+		}
+		return w
+	}
+	return replaceLongest(w, step4Rules, func(stem []byte) bool {
+		return measure(stem) > 1
+	})
+}
+
+func step5(w []byte) []byte {
+	if hasSuffix(w, "e") {
+		stem := w[:len(w)-1]
+		if m := measure(stem); m > 1 || m == 1 && !endsWithCVC(stem) {
+			w = stem
+		}
+	}
+	if measure(w) > 1 && endsWithDoubleConsonant(w) && hasSuffix(w, "l") {
+		w = w[:len(w)-1]
+	}
+	return w
+}
+
+// replaceLongest applies the rule of the longest matching suffix when its
+// stem satisfies the condition, the shorter suffixes are not tried
+func replaceLongest(w []byte, rules []rule, condition func(stem []byte) bool) []byte {
+	var longest *rule
+	for i := range rules {
+		if hasSuffix(w, rules[i].suffix) && (longest == nil || len(rules[i].suffix) > len(longest.suffix)) {
+			longest = &rules[i]
+		}
+	}
+	if longest == nil {
+		return w
+	}
+	stem := w[:len(w)-len(longest.suffix)]
+	if !condition(stem) {
+		return w
+	}
+	return append(stem, longest.replacement...)
+}
+
+func hasSuffix(w []byte, suffix string) bool {
+	return len(w) >= len(suffix) && string(w[len(w)-len(suffix):]) == suffix
+}
+
+func isConsonant(w []byte, i int) bool {
+	switch w[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		return i == 0 || !isConsonant(w, i-1)
+	default:
+		return true
+	}
+}
+
+// measure counts the vowel-consonant sequences of the stem, m in [C](VC){m}[V]
+func measure(w []byte) int {
+	var m, i int
+	for i < len(w) && isConsonant(w, i) {
+		i++
+	}
+	for i < len(w) {
+		for i < len(w) && !isConsonant(w, i) {
+			i++
+		}
+		if i == len(w) {
+			break
+		}
+		m++
+		for i < len(w) && isConsonant(w, i) {
+			i++
+		}
+	}
+	return m
+}
+
+func hasVowel(w []byte) bool {
+	for i := range w {
+		if !isConsonant(w, i) {
+			return true
+		}
+	}
+	return false
+}
+
+func endsWithDoubleConsonant(w []byte) bool {
+	n := len(w)
+	return n >= 2 && w[n-1] == w[n-2] && isConsonant(w, n-1)
+}
+
+// endsWithCVC reports a consonant-vowel-consonant ending, where the last
+// consonant is not w, x or y
+func endsWithCVC(w []byte) bool {
+	n := len(w)
+	if n < 3 || !isConsonant(w, n-3) || isConsonant(w, n-2) || !isConsonant(w, n-1) {
+		return false
+	}
+	switch w[n-1] {
+	case 'w', 'x', 'y':
+		return false
+	}
+	return true
+}
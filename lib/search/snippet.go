@@ -0,0 +1,82 @@
+package search
+
+import (
+	"html"
+	"strings"
+)
+
+// snippetContext is the number of the words shown before the first match
+const snippetContext = 3
+
+// Snippet returns about size bytes of the text around its best matching part,
+// the matching words are wrapped in <em> and the rest is HTML escaped. The
+// snippet starts at the beginning of the text when nothing matches, the
+// returned flag reports a match.
+func Snippet(text string, q Query, size int) (string, bool) {
+	tokens := Tokenize(text)
+	if len(tokens) == 0 {
+		return "", false
+	}
+	var matched = make([]bool, len(tokens))
+	var best, bestCount, bestLast = 0, 0, 0
+	for i, t := range tokens {
+		matched[i] = q.matches(t.Term)
+	}
+	for i := range tokens {
+		if !matched[i] {
+			continue
+		}
+		var count, last int
+		for j := i; j < len(tokens) && tokens[j].End-tokens[i].Start <= size; j++ {
+			if matched[j] {
+				count, last = count+1, j
+			}
+		}
+		if count > bestCount {
+			best, bestCount, bestLast = i, count, last
+		}
+	}
+	first, last := best, bestLast
+	fits := func(first, last int) bool {
+		return tokens[last].End-tokens[first].Start <= size
+	}
+	// a few words of context before the matches, then the rest of the size
+	// after and before them
+	for first > 0 && best-first < snippetContext && fits(first-1, last) {
+		first--
+	}
+	for last+1 < len(tokens) && fits(first, last+1) {
+		last++
+	}
+	for first > 0 && fits(first-1, last) {
+		first--
+	}
+	start, end := tokens[first].Start, tokens[last].End
+	if first == 0 {
+		start = 0
+	}
+	if last == len(tokens)-1 {
+		end = len(text)
+	}
+
+	var sb strings.Builder
+	if start > 0 {
+		sb.WriteString("…")
+	}
+	pos := start
+	for i := first; i <= last; i++ {
+		if !matched[i] {
+			continue
+		}
+		sb.WriteString(html.EscapeString(text[pos:tokens[i].Start]))
+		sb.WriteString("<em>")
+		sb.WriteString(html.EscapeString(text[tokens[i].Start:tokens[i].End]))
+		sb.WriteString("</em>")
+		pos = tokens[i].End
+	}
+	sb.WriteString(html.EscapeString(text[pos:end]))
+	if end < len(text) {
+		sb.WriteString("…")
+	}
+	return strings.TrimSpace(sb.String()), bestCount > 0
+}
@@ -0,0 +1,29 @@
+package search
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnippet(t *testing.T) {
+	q := ParseQuery("dragons")
+
+	s, ok := Snippet("How to <train> your dragon", q, 100)
+	assert.True(t, ok)
+	assert.Equal(t, "How to &lt;train&gt; your <em>dragon</em>", s)
+
+	long := strings.Repeat("lorem ipsum ", 20) + "a Dragon appears and the dragons fly " + strings.Repeat("dolor sit ", 20)
+	s, ok = Snippet(long, q, 40)
+	assert.True(t, ok)
+	assert.Equal(t, "…ipsum a <em>Dragon</em> appears and the <em>dragons</em>…", s)
+
+	s, ok = Snippet(long, ParseQuery("rust"), 20)
+	assert.False(t, ok)
+	assert.Equal(t, "lorem ipsum lorem…", s)
+
+	s, ok = Snippet("", q, 20)
+	assert.False(t, ok)
+	assert.Empty(t, s)
+}
@@ -0,0 +1,22 @@
+package search
+
+// stopWords are the frequent English words that aren't indexed
+var stopWords = map[string]struct{}{}
+
+func init() {
+	for _, w := range []string{
+		"a", "about", "an", "and", "are", "as", "at", "be", "but", "by",
+		"for", "from", "has", "have", "he", "her", "his", "i", "if", "in",
+		"into", "is", "it", "its", "of", "on", "or", "our", "she", "so",
+		"than", "that", "the", "their", "them", "then", "there", "these",
+		"they", "this", "to", "was", "we", "were", "what", "when", "which",
+		"who", "will", "with", "you", "your",
+	} {
+		stopWords[w] = struct{}{}
+	}
+}
+
+func isStopWord(term string) bool {
+	_, ok := stopWords[term]
+	return ok
+}
@@ -0,0 +1,77 @@
+// Package search is an in-memory full-text index with BM25 ranking, English
+// stemming, prefix matching and highlighted snippets.
+package search
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/borosr/realworld/lib/slug"
+)
+
+// maxTermLength skips the tokens that can't be words, e.g. encoded data
+const maxTermLength = 64
+
+// Token is a folded word of a text, Start and End are its byte offsets in
+// the text
+type Token struct {
+	Term  string
+	Start int
+	End   int
+}
+
+// Tokenize splits the text to words and folds them to lower case ASCII when
+// they have an ASCII form. The apostrophes inside the words are dropped, so
+// "don't" is the term "dont".
+func Tokenize(text string) []Token {
+	var tokens []Token
+	var term strings.Builder
+	start := -1
+	flush := func(end int) {
+		if start >= 0 && term.Len() > 0 && term.Len() <= maxTermLength {
+			tokens = append(tokens, Token{Term: term.String(), Start: start, End: end})
+		}
+		term.Reset()
+		start = -1
+	}
+	for i, r := range text {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if start < 0 {
+				start = i
+			}
+			if f := slug.Fold(r); f != "" {
+				term.WriteString(f)
+			} else {
+				term.WriteRune(unicode.ToLower(r))
+			}
+		case start >= 0 && (unicode.Is(unicode.Mn, r) || isApostrophe(r) && nextIsLetter(text[i+utf8.RuneLen(r):])):
+		default:
+			flush(i)
+		}
+	}
+	flush(len(text))
+	return tokens
+}
+
+func isApostrophe(r rune) bool {
+	return r == '\'' || r == '’'
+}
+
+func nextIsLetter(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return unicode.IsLetter(r)
+}
+
+// terms returns the indexed terms of the text, the stems of the words that
+// aren't stop words
+func terms(text string) []string {
+	var res []string
+	for _, t := range Tokenize(text) {
+		if !isStopWord(t.Term) {
+			res = append(res, Stem(t.Term))
+		}
+	}
+	return res
+}
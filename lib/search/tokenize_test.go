@@ -0,0 +1,33 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenize(t *testing.T) {
+	text := "Don't panic, Crème brûlée — 42 times!"
+	tokens := Tokenize(text)
+
+	var res []string
+	for _, tok := range tokens {
+		res = append(res, tok.Term)
+		assert.NotEmpty(t, text[tok.Start:tok.End])
+	}
+	assert.Equal(t, []string{"dont", "panic", "creme", "brulee", "42", "times"}, res)
+	assert.Equal(t, "Crème", text[tokens[2].Start:tokens[2].End])
+	assert.Equal(t, "times", text[tokens[5].Start:tokens[5].End])
+}
+
+func TestTokenize_Apostrophe(t *testing.T) {
+	var res []string
+	for _, tok := range Tokenize("the authors' notes, 'quoted'") {
+		res = append(res, tok.Term)
+	}
+	assert.Equal(t, []string{"the", "authors", "notes", "quoted"}, res)
+}
+
+func TestTerms(t *testing.T) {
+	assert.Equal(t, []string{"train", "dragon"}, terms("Training the Dragons"))
+}
@@ -0,0 +1,150 @@
+// Package slug builds URL friendly identifiers from titles.
+package slug
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	separator = '-'
+	// MaxLength is the length the slugs are cut to, on a word boundary when
+	// possible
+	MaxLength = 100
+)
+
+// transliterations groups the letters by their ASCII replacement, a letter
+// belongs to one group only
+var transliterations = map[string]string{
+	"a":   "àáâãäåāăąǎǻαάа",
+	"ae":  "æǽ",
+	"b":   "б",
+	"c":   "çćĉċč",
+	"ch":  "χч",
+	"d":   "ďđðδд",
+	"e":   "èéêëēĕėęěεέеэё",
+	"f":   "φф",
+	"g":   "ĝğġģγгґ",
+	"h":   "ĥħх",
+	"i":   "ìíîïĩīĭįıǐηήιίϊΐиі",
+	"ij":  "ĳ",
+	"j":   "ĵ",
+	"k":   "ķκк",
+	"l":   "ĺļľŀłλл",
+	"m":   "μм",
+	"n":   "ñńņňŉŋνн",
+	"o":   "òóôõöøōŏőǒǿοόωώо",
+	"oe":  "œ",
+	"p":   "πп",
+	"ps":  "ψ",
+	"r":   "ŕŗřρр",
+	"s":   "śŝşšſσςс",
+	"sch": "щ",
+	"sh":  "ш",
+	"ss":  "ß",
+	"t":   "ţťŧτт",
+	"th":  "þθ",
+	"ts":  "ц",
+	"u":   "ùúûüũūŭůűųǔу",
+	"v":   "βв",
+	"w":   "ŵ",
+	"x":   "ξ",
+	"y":   "ýÿŷυύϋΰйы",
+	"ye":  "є",
+	"yi":  "ї",
+	"ya":  "я",
+	"yu":  "ю",
+	"z":   "źżžζз",
+	"zh":  "ж",
+	"":    "ъь'’",
+}
+
+var replacements = make(map[rune]string)
+
+func init() {
+	for ascii, letters := range transliterations {
+		for _, r := range letters {
+			replacements[r] = ascii
+		}
+	}
+}
+
+// Make returns the lower case ASCII slug of the title: the accented, Greek
+// and Cyrillic letters are transliterated, the apostrophes are dropped and
+// every other character separates the words. It is empty when the title has
+// no letters or digits it can represent.
+func Make(title string) string {
+	var b strings.Builder
+	pendingSeparator := false
+	write := func(s string) {
+		if s == "" {
+			return
+		}
+		if pendingSeparator && b.Len() > 0 {
+			b.WriteRune(separator)
+		}
+		pendingSeparator = false
+		b.WriteString(s)
+	}
+	for _, r := range strings.ToLower(title) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			write(string(r))
+		case r == '&':
+			pendingSeparator = true
+			write("and")
+			pendingSeparator = true
+		case isReplaced(r):
+			write(replacements[r])
+		case unicode.IsMark(r):
+			// combining accents of the decomposed letters
+		default:
+			pendingSeparator = true
+		}
+	}
+	return truncate(b.String())
+}
+
+// WithSuffix returns the nth slug of the base, the first one is the base
+// itself and the next ones are numbered from 2
+func WithSuffix(base string, n int) string {
+	if n < 2 {
+		return base
+	}
+	suffix := string(separator) + strconv.Itoa(n)
+	if len(base)+len(suffix) > MaxLength {
+		base = strings.TrimRight(base[:MaxLength-len(suffix)], string(separator))
+	}
+	return base + suffix
+}
+
+// Fold returns the lower case ASCII form of a letter or digit, it is empty
+// for the other characters and the letters without an ASCII form
+func Fold(r rune) string {
+	r = unicode.ToLower(r)
+	switch {
+	case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+		return string(r)
+	case isReplaced(r):
+		return replacements[r]
+	default:
+		return ""
+	}
+}
+
+func isReplaced(r rune) bool {
+	_, ok := replacements[r]
+	return ok
+}
+
+func truncate(s string) string {
+	if len(s) <= MaxLength {
+		return s
+	}
+	s = s[:MaxLength]
+	if i := strings.LastIndexByte(s, separator); i > 0 {
+		s = s[:i]
+	}
+	return strings.TrimRight(s, string(separator))
+}
@@ -0,0 +1,70 @@
+package slug
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMake(t *testing.T) {
+	for title, expected := range map[string]string{
+		"How to train your dragon":    "how-to-train-your-dragon",
+		"  How   to -- train!? ":      "how-to-train",
+		"Don't panic":                 "dont-panic",
+		"Crème brûlée à la française": "creme-brulee-a-la-francaise",
+		"Straße & Œuvre":              "strasse-and-oeuvre",
+		"Łódź, Kraków":                "lodz-krakow",
+		"Привет мир":                  "privet-mir",
+		"Ελληνικά":                    "ellinika",
+		"Čapek, Dvořák":               "capek-dvorak",
+		"Cre\u0300me, decomposed":     "creme-decomposed",
+		"Go 1.18 generics":            "go-1-18-generics",
+		"日本語":                         "",
+		"!!!":                         "",
+	} {
+		assert.Equal(t, expected, Make(title), title)
+	}
+}
+
+func TestTransliterations_Unique(t *testing.T) {
+	var groups = make(map[rune]string)
+	for ascii, letters := range transliterations {
+		for _, r := range letters {
+			if other, ok := groups[r]; ok {
+				t.Errorf("%c is replaced with both %q and %q", r, other, ascii)
+			}
+			groups[r] = ascii
+		}
+	}
+}
+
+func TestMake_Truncate(t *testing.T) {
+	s := Make(strings.Repeat("word ", 30))
+	assert.LessOrEqual(t, len(s), MaxLength)
+	assert.False(t, strings.HasSuffix(s, "-"))
+	assert.True(t, strings.HasSuffix(s, "word"), "cut on a word boundary")
+}
+
+func TestWithSuffix(t *testing.T) {
+	assert.Equal(t, "title", WithSuffix("title", 1))
+	assert.Equal(t, "title-2", WithSuffix("title", 2))
+	long := strings.Repeat("a", MaxLength)
+	assert.Equal(t, MaxLength, len(WithSuffix(long, 12)))
+	assert.True(t, strings.HasSuffix(WithSuffix(long, 12), "-12"))
+}
+
+func TestFold(t *testing.T) {
+	for r, expected := range map[rune]string{
+		'a': "a",
+		'Q': "q",
+		'7': "7",
+		'É': "e",
+		'ß': "ss",
+		'Ж': "zh",
+		'-': "",
+		'日': "",
+	} {
+		assert.Equal(t, expected, Fold(r), string(r))
+	}
+}
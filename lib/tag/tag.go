@@ -0,0 +1,30 @@
+// Package tag normalizes the tags of the articles.
+package tag
+
+import (
+	"sort"
+	"strings"
+)
+
+// Normalize returns the canonical form of the tag: lower case, without the
+// leading and trailing spaces, the inner runs of spaces replaced by a dash
+func Normalize(tag string) string {
+	return strings.Join(strings.Fields(strings.ToLower(tag)), "-")
+}
+
+// List normalizes the tags, the empty ones and the duplicates are dropped and
+// the rest is sorted
+func List(tags []string) []string {
+	var seen = make(map[string]bool, len(tags))
+	var list = make([]string, 0, len(tags))
+	for _, t := range tags {
+		t = Normalize(t)
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		list = append(list, t)
+	}
+	sort.Strings(list)
+	return list
+}
@@ -0,0 +1,19 @@
+package tag
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	assert.Equal(t, "go", Normalize(" Go "))
+	assert.Equal(t, "machine-learning", Normalize("Machine \t Learning"))
+	assert.Equal(t, "c++", Normalize("C++"))
+	assert.Equal(t, "", Normalize("  "))
+}
+
+func TestList(t *testing.T) {
+	assert.Equal(t, []string{"go", "rust"}, List([]string{"rust", "Go", " go", "", "RUST"}))
+	assert.Equal(t, []string{}, List(nil))
+}
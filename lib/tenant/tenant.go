@@ -0,0 +1,85 @@
+// Package tenant carries the tenant of a request in the context. The records
+// of the tenants are stored apart, the empty ID is the default tenant, which
+// keeps the data of the single tenant deployments.
+package tenant
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/borosr/realworld/lib/config"
+)
+
+var (
+	ErrInvalid = errors.New("invalid tenant id")
+	ErrUnknown = errors.New("unknown tenant")
+
+	// the ids can't contain the separator of the stored keys
+	validID = regexp.MustCompile(`^[a-z0-9_]{1,64}$`)
+)
+
+type contextKey struct{}
+
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// ID returns the tenant of the context, empty for the default tenant
+func ID(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+func Validate(id string) error {
+	if !validID.MatchString(id) {
+		return ErrInvalid
+	}
+	return nil
+}
+
+// Configured returns the tenants listed in TENANTS
+func Configured() []string {
+	return config.List("TENANTS")
+}
+
+// All returns the default and the configured tenants, the background jobs
+// run for each of them
+func All() []string {
+	return append([]string{""}, Configured()...)
+}
+
+// Known reports whether the id is the default or a configured tenant
+func Known(id string) bool {
+	for _, t := range All() {
+		if t == id {
+			return true
+		}
+	}
+	return false
+}
+
+// FromHost resolves the tenant of a host name with the host=tenant pairs of
+// TENANT_HOSTS first, then by the first label of the host
+func FromHost(host string) (string, bool) {
+	if i := strings.LastIndexByte(host, ':'); i > strings.LastIndexByte(host, ']') {
+		host = host[:i]
+	}
+	host = strings.ToLower(host)
+	for _, pair := range config.List("TENANT_HOSTS") {
+		name, id, ok := strings.Cut(pair, "=")
+		if ok && strings.EqualFold(strings.TrimSpace(name), host) {
+			return strings.TrimSpace(id), true
+		}
+	}
+	label, _, ok := strings.Cut(host, ".")
+	if ok && label != "" {
+		for _, t := range Configured() {
+			if t == label {
+				return t, true
+			}
+		}
+	}
+	return "", false
+}
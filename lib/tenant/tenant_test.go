@@ -0,0 +1,45 @@
+package tenant
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestID(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, "", ID(ctx))
+	assert.Equal(t, "acme", ID(WithID(ctx, "acme")))
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Validate("acme_2"))
+	assert.ErrorIs(t, Validate(""), ErrInvalid)
+	assert.ErrorIs(t, Validate("a-b"), ErrInvalid, "the separator of the keys")
+	assert.ErrorIs(t, Validate("Acme"), ErrInvalid)
+}
+
+func TestFromHost(t *testing.T) {
+	os.Setenv("TENANTS", "acme,other")
+	os.Setenv("TENANT_HOSTS", "forum.example.org=other")
+	defer os.Unsetenv("TENANTS")
+	defer os.Unsetenv("TENANT_HOSTS")
+
+	for host, expected := range map[string]string{
+		"forum.example.org":     "other",
+		"FORUM.example.org:443": "other",
+		"acme.example.com":      "acme",
+		"acme.example.com:8080": "acme",
+		"unknown.example.com":   "",
+		"localhost:18000":       "",
+	} {
+		id, ok := FromHost(host)
+		assert.Equal(t, expected, id, host)
+		assert.Equal(t, expected != "", ok, host)
+	}
+	assert.True(t, Known(""))
+	assert.True(t, Known("acme"))
+	assert.False(t, Known("unknown"))
+}
@@ -1,9 +1,14 @@
 package main
 
 import (
-	"github.com/borosr/realworld/api"
+	"log"
+	"os"
+
+	"github.com/borosr/realworld/cmd"
 )
 
 func main() {
-	api.Service()
+	if err := cmd.Run(os.Args[1:]); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,50 @@
+package badger
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	bdb "github.com/dgraph-io/badger/v3"
+)
+
+const maxPendingWrites = 256
+
+// Backup writes a consistent snapshot of the whole database, it can run while
+// the database is in use
+func Backup(w io.Writer) (uint64, error) {
+	getDB()
+	return db.Backup(w, 0)
+}
+
+// Restore loads a backup into a new database created in the given directory,
+// the directory has to be empty
+func Restore(dir string, r io.Reader) error {
+	if err := ensureEmpty(dir); err != nil {
+		return err
+	}
+	opts, err := options(dir)
+	if err != nil {
+		return err
+	}
+	target, err := bdb.Open(opts)
+	if err != nil {
+		return err
+	}
+	if err := target.Load(r, maxPendingWrites); err != nil {
+		target.Close()
+		return err
+	}
+	return target.Close()
+}
+
+func ensureEmpty(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(entries) != 0 {
+		return fmt.Errorf("directory is not empty: %s", dir)
+	}
+	return nil
+}
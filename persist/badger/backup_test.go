@@ -0,0 +1,71 @@
+package badger
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/borosr/realworld/types"
+	bdb "github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackupRestore(t *testing.T) {
+	source, err := bdb.Open(bdb.DefaultOptions("").WithInMemory(true).WithLoggingLevel(bdb.WARNING))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+	ctx := context.Background()
+	if _, err := New[*types.Article](source).WithCodec(BinaryCodec{}).Save(ctx, testArticle(1)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New[*types.Article](source).SaveWithTTL(ctx, testArticle(2), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	mutex.Lock()
+	db = source
+	mutex.Unlock()
+	defer func() {
+		mutex.Lock()
+		db = nil
+		mutex.Unlock()
+	}()
+	var buf bytes.Buffer
+	if _, err := Backup(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if err := Restore(dir, bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	assert.Error(t, Restore(dir, bytes.NewReader(buf.Bytes())), "restore needs an empty directory")
+
+	restored, err := bdb.Open(testOptions(t, dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+	got, err := New[*types.Article](restored).Get(ctx, "article-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, testArticle(1).Title, got.Title)
+	expiries, err := New[*types.Article](restored).Expiries(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"article-2"}, keys(expiries), "the records keep their expiry")
+	assert.WithinDuration(t, time.Now().Add(time.Hour), expiries["article-2"], time.Minute)
+}
+
+func keys(m map[string]time.Time) []string {
+	var res []string
+	for k := range m {
+		res = append(res, k)
+	}
+	return res
+}
@@ -1,12 +1,19 @@
 package badger
 
 import (
+	"bytes"
 	"context"
-	"encoding/json"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"log"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/borosr/realworld/lib/config"
+	"github.com/borosr/realworld/lib/tenant"
+	"github.com/borosr/realworld/persist/migration"
 	"github.com/borosr/realworld/persist/types"
 	bdb "github.com/dgraph-io/badger/v3"
 	"github.com/rs/xid"
@@ -14,80 +21,176 @@ import (
 
 const defaultSequenceBandwidth = 1
 const sequencePrefix = "seq"
+const tenantPrefix = "tenant"
+const separator = "-"
 
 var db *bdb.DB
+var defaultCodec Codec
 var mutex sync.Mutex
 
 type Repository[Type types.Storable] struct {
-	db *bdb.DB
+	db    *bdb.DB
+	codec Codec
 }
 
 func Get[Type types.Storable]() Repository[Type] {
 	getDB()
+	return New[Type](db).WithCodec(defaultCodec)
+}
+
+func New[Type types.Storable](db *bdb.DB) Repository[Type] {
 	return Repository[Type]{
-		db: db,
+		db:    db,
+		codec: JSONCodec{},
 	}
 }
 
+// WithCodec sets the codec of the new records, the existing ones are always
+// decoded with the codec of their format marker
+func (r Repository[Type]) WithCodec(c Codec) Repository[Type] {
+	r.codec = c
+	return r
+}
+
+// Dir is the directory of the database
+func Dir() string {
+	return config.String("BADGER_DIR", "/tmp/badger")
+}
+
 func getDB() {
+	mutex.Lock()
+	defer mutex.Unlock()
 	if db == nil {
-		mutex.Lock()
-		defer mutex.Unlock()
 		var err error
-		db, err = bdb.Open(bdb.DefaultOptions("/tmp/badger"))
+		defaultCodec, err = CodecByName(config.String("BADGER_CODEC", "json"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts, err := options(Dir())
+		if err != nil {
+			log.Fatal(err)
+		}
+		db, err = bdb.Open(opts)
 		if err != nil {
 			log.Fatal(err)
 		}
 	}
 }
 
-func (r Repository[Type]) Save(_ context.Context, data Type) (Type, error) {
+func (r Repository[Type]) Save(ctx context.Context, data Type) (Type, error) {
+	return r.SaveWithTTL(ctx, data, 0)
+}
+
+// SaveWithTTL saves the record with Badger's own expiry, zero ttl means the
+// record never expires
+func (r Repository[Type]) SaveWithTTL(ctx context.Context, data Type, ttl time.Duration) (Type, error) {
 	if data.Key() == "" {
 		data.SetKey(xid.New().String())
 	}
-	if err := r.db.Update(func(txn *bdb.Txn) error {
-		rawData, err := json.Marshal(data)
+	if err := r.update(ctx, func(txn *bdb.Txn) error {
+		rawData, err := r.encode(data)
 		if err != nil {
 			return err
 		}
-		key := r.buildID(data.Name(), data.Key())
-		return txn.Set([]byte(key), rawData)
+		key := r.buildID(ctx, data.Name(), data.Key())
+		entry := bdb.NewEntry([]byte(key), rawData)
+		if ttl > 0 {
+			entry = entry.WithTTL(ttl)
+		}
+		return txn.SetEntry(entry)
 	}); err != nil {
 		return data, err
 	}
 	return data, nil
 }
 
-func (r Repository[Type]) Get(_ context.Context, key string) (Type, error) {
+// SaveMany writes the records with a WriteBatch, which commits and starts a
+// new transaction whenever the pending writes reach Badger's size limits. In
+// a Transaction the records are written into it instead.
+func (r Repository[Type]) SaveMany(ctx context.Context, data []Type) ([]Type, error) {
+	return data, r.batch(ctx, func(set func(e *bdb.Entry) error, _ func(key []byte) error) error {
+		for _, d := range data {
+			if d.Key() == "" {
+				d.SetKey(xid.New().String())
+			}
+			rawData, err := r.encode(d)
+			if err != nil {
+				return err
+			}
+			key := r.buildID(ctx, d.Name(), d.Key())
+			if err := set(bdb.NewEntry([]byte(key), rawData)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r Repository[Type]) Get(ctx context.Context, key string) (Type, error) {
 	var t Type
-	if err := r.db.View(func(txn *bdb.Txn) error {
-		item, err := txn.Get([]byte(r.buildID(t.Name(), key)))
+	if err := r.view(ctx, func(txn *bdb.Txn) error {
+		item, err := txn.Get([]byte(r.buildID(ctx, t.Name(), key)))
+		if errors.Is(err, bdb.ErrKeyNotFound) {
+			return types.ErrNotFound
+		}
 		if err != nil {
 			return err
 		}
-		return item.Value(func(val []byte) error {
-			return json.Unmarshal(val, &t)
-		})
+		return r.decodeItem(item, &t)
 	}); err != nil {
 		return t, err
 	}
 	return t, nil
 }
 
-func (r Repository[Type]) GetFiltered(_ context.Context, filters ...types.Filter[Type]) ([]Type, error) {
+// GetMany reads the records in a single read transaction
+func (r Repository[Type]) GetMany(ctx context.Context, keys []string) ([]Type, error) {
+	var res = make([]Type, 0, len(keys))
+	if err := r.view(ctx, func(txn *bdb.Txn) error {
+		for _, key := range keys {
+			var t Type
+			item, err := txn.Get([]byte(r.buildID(ctx, t.Name(), key)))
+			if errors.Is(err, bdb.ErrKeyNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if err := r.decodeItem(item, &t); err != nil {
+				return err
+			}
+			res = append(res, t)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (r Repository[Type]) GetFiltered(ctx context.Context, filters ...types.Filter[Type]) ([]Type, error) {
 	var res = make([]Type, 0)
-	if err := r.db.View(func(txn *bdb.Txn) error {
+	if err := r.scan(ctx, filters, func(_ *bdb.Item, t Type) {
+		res = append(res, t)
+	}); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// scan iterates the records of the type matching the filters. The records
+// which can't be decoded match no filter, so every filtered read, count and
+// delete skips them the same way.
+func (r Repository[Type]) scan(ctx context.Context, filters []types.Filter[Type], collect func(item *bdb.Item, t Type)) error {
+	return r.view(ctx, func(txn *bdb.Txn) error {
 		options := bdb.DefaultIteratorOptions
-		var t Type
-		options.Prefix = []byte(t.Name())
+		options.Prefix = r.prefix(ctx)
 		it := txn.NewIterator(options)
 		defer it.Close()
 	outer:
 		for it.Rewind(); it.Valid(); it.Next() {
-			if err := it.Item().Value(func(val []byte) error {
-				return json.Unmarshal(val, &t)
-			}); err != nil {
-				//return err
+			var t Type
+			if err := r.decodeItem(it.Item(), &t); err != nil {
 				continue
 			}
 			for _, filter := range filters {
@@ -95,7 +198,40 @@ func (r Repository[Type]) GetFiltered(_ context.Context, filters ...types.Filter
 					continue outer
 				}
 			}
+			collect(it.Item(), t)
+		}
+		return nil
+	})
+}
+
+// GetRangeBefore returns at most limit records in reverse key order, starting
+// from the last key before the given one, an empty before starts from the
+// last key of the type
+func (r Repository[Type]) GetRangeBefore(ctx context.Context, before string, limit int) ([]Type, error) {
+	var res = make([]Type, 0)
+	prefix := r.prefix(ctx)
+	seek := append(append([]byte(nil), prefix...), before...)
+	if before == "" {
+		seek = append(seek, 0xff)
+	}
+	if err := r.view(ctx, func(txn *bdb.Txn) error {
+		options := bdb.DefaultIteratorOptions
+		options.Prefix = prefix
+		options.Reverse = true
+		it := txn.NewIterator(options)
+		defer it.Close()
+		for it.Seek(seek); it.Valid(); it.Next() {
+			if bytes.Equal(it.Item().Key(), seek) {
+				continue
+			}
+			var t Type
+			if err := r.decodeItem(it.Item(), &t); err != nil {
+				continue
+			}
 			res = append(res, t)
+			if limit > 0 && len(res) == limit {
+				break
+			}
 		}
 		return nil
 	}); err != nil {
@@ -104,45 +240,75 @@ func (r Repository[Type]) GetFiltered(_ context.Context, filters ...types.Filter
 	return res, nil
 }
 
-func (r Repository[Type]) CountFiltered(_ context.Context, filters ...types.Filter[Type]) (uint64, error) {
-	var count uint64
-	if err := r.db.View(func(txn *bdb.Txn) error {
+// GetRange returns at most limit records in key order, starting from the
+// first key not before from, zero limit returns all of them
+func (r Repository[Type]) GetRange(ctx context.Context, from string, limit int) ([]Type, error) {
+	var res = make([]Type, 0)
+	prefix := r.prefix(ctx)
+	if err := r.view(ctx, func(txn *bdb.Txn) error {
 		options := bdb.DefaultIteratorOptions
-		var t Type
-		options.Prefix = []byte(t.Name())
+		options.Prefix = prefix
 		it := txn.NewIterator(options)
 		defer it.Close()
-	outer:
-		for it.Rewind(); it.Valid(); it.Next() {
-			if err := it.Item().Value(func(val []byte) error {
-				return json.Unmarshal(val, &t)
-			}); err != nil {
-				return err
+		for it.Seek(append(append([]byte(nil), prefix...), from...)); it.Valid(); it.Next() {
+			var t Type
+			if err := r.decodeItem(it.Item(), &t); err != nil {
+				continue
 			}
-			for _, filter := range filters {
-				if ok := filter(t); !ok {
-					continue outer
-				}
+			res = append(res, t)
+			if limit > 0 && len(res) == limit {
+				break
 			}
-			count++
 		}
 		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (r Repository[Type]) CountFiltered(ctx context.Context, filters ...types.Filter[Type]) (uint64, error) {
+	var count uint64
+	if err := r.scan(ctx, filters, func(_ *bdb.Item, _ Type) {
+		count++
 	}); err != nil {
 		return 0, err
 	}
 	return count, nil
 }
 
-func (r Repository[Type]) Delete(_ context.Context, key string) error {
-	return r.db.Update(func(txn *bdb.Txn) error {
+func (r Repository[Type]) Delete(ctx context.Context, key string) error {
+	return r.update(ctx, func(txn *bdb.Txn) error {
 		var t Type
-		return txn.Delete([]byte(r.buildID(t.Name(), key)))
+		return txn.Delete([]byte(r.buildID(ctx, t.Name(), key)))
 	})
 }
 
-func (r Repository[Type]) Sequence(_ context.Context, key string) (uint64, error) {
+// DeleteFiltered collects the matching keys in a read transaction and
+// deletes them with a WriteBatch
+func (r Repository[Type]) DeleteFiltered(ctx context.Context, filters ...types.Filter[Type]) (uint64, error) {
+	var matching [][]byte
+	if err := r.scan(ctx, filters, func(item *bdb.Item, _ Type) {
+		matching = append(matching, item.KeyCopy(nil))
+	}); err != nil {
+		return 0, err
+	}
+	if err := r.batch(ctx, func(_ func(e *bdb.Entry) error, del func(key []byte) error) error {
+		for _, key := range matching {
+			if err := del(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	return uint64(len(matching)), nil
+}
+
+func (r Repository[Type]) Sequence(ctx context.Context, key string) (uint64, error) {
 	var t Type
-	seq, err := r.db.GetSequence([]byte(r.buildID(sequencePrefix, t.Name(), key)), defaultSequenceBandwidth)
+	seq, err := r.db.GetSequence([]byte(r.buildID(ctx, sequencePrefix, t.Name(), key)), defaultSequenceBandwidth)
 	if err != nil {
 		return 0, err
 	}
@@ -153,6 +319,218 @@ func (r Repository[Type]) Sequence(_ context.Context, key string) (uint64, error
 	return next, nil
 }
 
-func (r Repository[Type]) buildID(parts ...string) string {
-	return strings.Join(parts, "-")
+// DeleteSequence removes a sequence, it starts from zero again on its next
+// use
+func (r Repository[Type]) DeleteSequence(ctx context.Context, key string) error {
+	var t Type
+	return r.update(ctx, func(txn *bdb.Txn) error {
+		return txn.Delete([]byte(r.buildID(ctx, sequencePrefix, t.Name(), key)))
+	})
+}
+
+// Sequences returns the next values of the sequences of the type
+func (r Repository[Type]) Sequences(ctx context.Context) (map[string]uint64, error) {
+	var t Type
+	prefix := r.buildID(ctx, sequencePrefix, t.Name(), "")
+	var res = make(map[string]uint64)
+	if err := r.db.View(func(txn *bdb.Txn) error {
+		options := bdb.DefaultIteratorOptions
+		options.Prefix = []byte(prefix)
+		it := txn.NewIterator(options)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			if err := it.Item().Value(func(val []byte) error {
+				if len(val) != 8 {
+					return fmt.Errorf("invalid sequence value: %s", it.Item().Key())
+				}
+				res[strings.TrimPrefix(string(it.Item().Key()), prefix)] = binary.BigEndian.Uint64(val)
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// SetSequence sets the next value of a sequence, it is used to restore the
+// sequences of imported records
+func (r Repository[Type]) SetSequence(ctx context.Context, key string, next uint64) error {
+	var t Type
+	return r.db.Update(func(txn *bdb.Txn) error {
+		var val [8]byte
+		binary.BigEndian.PutUint64(val[:], next)
+		return txn.Set([]byte(r.buildID(ctx, sequencePrefix, t.Name(), key)), val[:])
+	})
+}
+
+// Expiries returns the expiry of the records saved with a ttl among the
+// records of the keys, or among all the records of the type without keys
+func (r Repository[Type]) Expiries(ctx context.Context, keys ...string) (map[string]time.Time, error) {
+	var res = make(map[string]time.Time)
+	prefix := r.prefix(ctx)
+	collect := func(item *bdb.Item) {
+		if expiresAt := item.ExpiresAt(); expiresAt != 0 {
+			res[strings.TrimPrefix(string(item.Key()), string(prefix))] = time.Unix(int64(expiresAt), 0)
+		}
+	}
+	if err := r.view(ctx, func(txn *bdb.Txn) error {
+		if len(keys) > 0 {
+			for _, key := range keys {
+				item, err := txn.Get(append(append([]byte(nil), prefix...), key...))
+				if errors.Is(err, bdb.ErrKeyNotFound) {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				collect(item)
+			}
+			return nil
+		}
+		options := bdb.DefaultIteratorOptions
+		options.Prefix = prefix
+		options.PrefetchValues = false
+		it := txn.NewIterator(options)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			collect(it.Item())
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Versions counts the records by their stored schema version
+func (r Repository[Type]) Versions(ctx context.Context) (map[int]uint64, error) {
+	var res = make(map[int]uint64)
+	if err := r.db.View(func(txn *bdb.Txn) error {
+		options := bdb.DefaultIteratorOptions
+		options.Prefix = r.prefix(ctx)
+		it := txn.NewIterator(options)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			version, err := storedVersion(it.Item())
+			if err != nil {
+				return err
+			}
+			res[version]++
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Upgrade rewrites the records stored with an older schema version, the
+// records whose key changed with the schema are moved to their new key
+func (r Repository[Type]) Upgrade(ctx context.Context) (uint64, error) {
+	var outdated [][]byte
+	if err := r.db.View(func(txn *bdb.Txn) error {
+		options := bdb.DefaultIteratorOptions
+		options.Prefix = r.prefix(ctx)
+		it := txn.NewIterator(options)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			version, err := storedVersion(it.Item())
+			if err != nil {
+				return err
+			}
+			if version < migration.Version[Type]() {
+				outdated = append(outdated, it.Item().KeyCopy(nil))
+			}
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	var count uint64
+	for _, key := range outdated {
+		if err := r.db.Update(func(txn *bdb.Txn) error {
+			item, err := txn.Get(key)
+			if errors.Is(err, bdb.ErrKeyNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			var t Type
+			if err := r.decodeItem(item, &t); err != nil {
+				return err
+			}
+			rawData, err := r.encode(t)
+			if err != nil {
+				return err
+			}
+			count++
+			newKey := []byte(r.buildID(ctx, t.Name(), t.Key()))
+			if !bytes.Equal(newKey, key) {
+				if err := txn.Delete(key); err != nil {
+					return err
+				}
+			}
+			entry := bdb.NewEntry(newKey, rawData)
+			// keeps the expiry of the records saved with a ttl
+			entry.ExpiresAt = item.ExpiresAt()
+			return txn.SetEntry(entry)
+		}); err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+func (r Repository[Type]) decodeItem(item *bdb.Item, t *Type) error {
+	return item.Value(func(val []byte) error {
+		version, record, err := unwrap(val, item.UserMeta())
+		if err != nil {
+			return err
+		}
+		return migration.Decode(t, version, func(v any) error {
+			return decode(record, v)
+		})
+	})
+}
+
+// encode writes the record into the envelope with the current schema version
+// of its type
+func (r Repository[Type]) encode(t Type) ([]byte, error) {
+	record, err := encode(r.codec, t)
+	if err != nil {
+		return nil, err
+	}
+	return wrap(migration.Version[Type](), record), nil
+}
+
+func storedVersion(item *bdb.Item) (int, error) {
+	var version int
+	err := item.Value(func(val []byte) error {
+		var err error
+		version, _, err = unwrap(val, item.UserMeta())
+		return err
+	})
+	return version, err
+}
+
+// prefix limits the iteration to the records of the current type in the
+// tenant of the context, the separator prevents matching types with a common
+// name prefix
+func (r Repository[Type]) prefix(ctx context.Context) []byte {
+	var t Type
+	return []byte(r.buildID(ctx, t.Name(), ""))
+}
+
+// buildID builds a stored key, the keys of the tenants are prefixed with
+// tenant-<id>-, the default tenant keeps the unprefixed keys
+func (r Repository[Type]) buildID(ctx context.Context, parts ...string) string {
+	if id := tenant.ID(ctx); id != "" {
+		parts = append([]string{tenantPrefix, id}, parts...)
+	}
+	return strings.Join(parts, separator)
 }
@@ -0,0 +1,122 @@
+package badger_test
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/borosr/realworld/persist/badger"
+	"github.com/borosr/realworld/persist/persisttest"
+	bdb "github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func openDB(t testing.TB) *bdb.DB {
+	db, err := bdb.Open(bdb.DefaultOptions("").WithInMemory(true).WithLoggingLevel(bdb.WARNING))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+	return db
+}
+
+func TestRepository(t *testing.T) {
+	for _, codec := range []badger.Codec{badger.JSONCodec{}, badger.MsgpackCodec{}, badger.BinaryCodec{}} {
+		codec := codec
+		t.Run(codec.Name(), func(t *testing.T) {
+			persisttest.Run(t, func(t *testing.T) persisttest.Repositories {
+				db := openDB(t)
+				return persisttest.Repositories{
+					Records:     badger.New[*persisttest.Record](db).WithCodec(codec),
+					Notes:       badger.New[*persisttest.Note](db).WithCodec(codec),
+					Legacy:      badger.New[*persisttest.LegacyRecord](db).WithCodec(codec),
+					Migrated:    badger.New[*persisttest.MigratedRecord](db).WithCodec(codec),
+					LegacyPairs: badger.New[*persisttest.LegacyPair](db).WithCodec(codec),
+					Pairs:       badger.New[*persisttest.Pair](db).WithCodec(codec),
+					Transaction: func(ctx context.Context, fn func(ctx context.Context) error) error {
+						return badger.WithTransaction(ctx, db, fn)
+					},
+				}
+			})
+		})
+	}
+}
+
+// TestRepository_LargeBatch exceeds the transaction size limit of a small
+// memtable, the batch operations have to split the writes
+func TestRepository_LargeBatch(t *testing.T) {
+	db, err := bdb.Open(bdb.DefaultOptions("").WithInMemory(true).WithMemTableSize(1 << 20).WithValueThreshold(1 << 10).WithLoggingLevel(bdb.WARNING))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+	repo := badger.New[*persisttest.Record](db)
+
+	value := strings.Repeat("x", 512)
+	var records []*persisttest.Record
+	for i := 0; i < 2000; i++ {
+		records = append(records, &persisttest.Record{ID: strconv.Itoa(i), Value: value})
+	}
+	err = db.Update(func(txn *bdb.Txn) error {
+		for _, r := range records {
+			if err := txn.Set([]byte("record-"+r.ID), []byte(value)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if !assert.ErrorIs(t, err, bdb.ErrTxnTooBig, "a single transaction can't hold the batch") {
+		return
+	}
+
+	if _, err := repo.SaveMany(ctx, records); err != nil {
+		t.Fatal(err)
+	}
+	count, err := repo.CountFiltered(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, uint64(2000), count)
+	deleted, err := repo.DeleteFiltered(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, uint64(2000), deleted)
+	count, err = repo.CountFiltered(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, uint64(0), count)
+}
+
+func TestRepository_Undecodable(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+	repo := badger.New[*persisttest.Record](db)
+	if _, err := repo.Save(ctx, &persisttest.Record{ID: "a", Value: "x"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Update(func(txn *bdb.Txn) error {
+		return txn.Set([]byte("record-broken"), []byte("{not json"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := repo.GetFiltered(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(records))
+	count, err := repo.CountFiltered(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), count)
+	deleted, err := repo.DeleteFiltered(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), deleted)
+	assert.NoError(t, db.View(func(txn *bdb.Txn) error {
+		_, err := txn.Get([]byte("record-broken"))
+		return err
+	}), "the undecodable record is skipped, not deleted")
+}
@@ -0,0 +1,611 @@
+package badger
+
+import (
+	"encoding"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BinaryCodec is a compact, self-describing format: every value starts with
+// a one byte tag, numbers and lengths are varints and the struct fields are
+// stored by their JSON names, so records can be decoded without the type.
+// It round-trips the same way as the json codec: the omitempty fields are
+// skipped, the times keep their zone offset and the json.Marshaler and
+// encoding.TextMarshaler implementations are used. The ",string" option and
+// the map keys other than strings aren't supported.
+type BinaryCodec struct{}
+
+const (
+	binaryNil byte = iota
+	binaryFalse
+	binaryTrue
+	binaryInt
+	binaryUint
+	binaryFloat
+	binaryString
+	binaryBytes
+	binaryArray
+	binaryMap
+	// binaryTime is the legacy time in UTC, the times are written with their
+	// zone offset as binaryZonedTime
+	binaryTime
+	binaryJSON
+	binaryZonedTime
+)
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	jsonMarshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	errBinaryShort      = errors.New("binary codec: unexpected end of data")
+	structFields        sync.Map
+)
+
+func (BinaryCodec) Name() string {
+	return "binary"
+}
+
+func (BinaryCodec) Format() byte {
+	return FormatBinary
+}
+
+func (BinaryCodec) Marshal(v any) ([]byte, error) {
+	return appendValue(make([]byte, 0, 256), reflect.ValueOf(v))
+}
+
+func (BinaryCodec) Unmarshal(data []byte, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("binary codec: non-pointer target %T", v)
+	}
+	rest, err := readValue(data, rv.Elem())
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return fmt.Errorf("binary codec: %d trailing bytes", len(rest))
+	}
+	return nil
+}
+
+func appendValue(buf []byte, v reflect.Value) ([]byte, error) {
+	if !v.IsValid() {
+		return append(buf, binaryNil), nil
+	}
+	if v.Type() == timeType {
+		t := v.Interface().(time.Time)
+		_, offset := t.Zone()
+		buf = append(buf, binaryZonedTime)
+		buf = appendVarint(buf, t.Unix())
+		buf = appendUvarint(buf, uint64(t.Nanosecond()))
+		return appendVarint(buf, int64(offset)), nil
+	}
+	if (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) && v.IsNil() {
+		return append(buf, binaryNil), nil
+	}
+	if m, ok := implementation(v, jsonMarshalerType); ok {
+		raw, err := m.(json.Marshaler).MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		buf = appendUvarint(append(buf, binaryJSON), uint64(len(raw)))
+		return append(buf, raw...), nil
+	}
+	if m, ok := implementation(v, textMarshalerType); ok {
+		text, err := m.(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return nil, err
+		}
+		return appendString(append(buf, binaryString), string(text)), nil
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return append(buf, binaryNil), nil
+		}
+		return appendValue(buf, v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			return append(buf, binaryTrue), nil
+		}
+		return append(buf, binaryFalse), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return appendVarint(append(buf, binaryInt), v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return appendUvarint(append(buf, binaryUint), v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		var raw [8]byte
+		binary.LittleEndian.PutUint64(raw[:], math.Float64bits(v.Float()))
+		return append(append(buf, binaryFloat), raw[:]...), nil
+	case reflect.String:
+		return appendString(append(buf, binaryString), v.String()), nil
+	case reflect.Slice:
+		if v.IsNil() {
+			return append(buf, binaryNil), nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			buf = appendUvarint(append(buf, binaryBytes), uint64(v.Len()))
+			return append(buf, v.Bytes()...), nil
+		}
+		return appendArray(buf, v)
+	case reflect.Array:
+		return appendArray(buf, v)
+	case reflect.Map:
+		if v.IsNil() {
+			return append(buf, binaryNil), nil
+		}
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("binary codec: unsupported map key %s", v.Type().Key())
+		}
+		buf = appendUvarint(append(buf, binaryMap), uint64(v.Len()))
+		var err error
+		it := v.MapRange()
+		for it.Next() {
+			buf = appendString(buf, it.Key().String())
+			if buf, err = appendValue(buf, it.Value()); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case reflect.Struct:
+		var fields []field
+		for _, f := range structOf(v.Type()).fields {
+			if !f.omitEmpty || !isEmpty(v.FieldByIndex(f.index)) {
+				fields = append(fields, f)
+			}
+		}
+		buf = appendUvarint(append(buf, binaryMap), uint64(len(fields)))
+		var err error
+		for _, f := range fields {
+			buf = appendString(buf, f.name)
+			if buf, err = appendValue(buf, v.FieldByIndex(f.index)); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	}
+	return nil, fmt.Errorf("binary codec: unsupported type %s", v.Type())
+}
+
+func appendArray(buf []byte, v reflect.Value) ([]byte, error) {
+	buf = appendUvarint(append(buf, binaryArray), uint64(v.Len()))
+	var err error
+	for i := 0; i < v.Len(); i++ {
+		if buf, err = appendValue(buf, v.Index(i)); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// implementation returns the value, or its address when addressable, as the
+// interface if it implements it, the same way as encoding/json does
+func implementation(v reflect.Value, iface reflect.Type) (any, bool) {
+	if v.Kind() != reflect.Pointer && v.CanAddr() && reflect.PointerTo(v.Type()).Implements(iface) {
+		return v.Addr().Interface(), true
+	}
+	if v.Type().Implements(iface) {
+		return v.Interface(), true
+	}
+	return nil, false
+}
+
+// isEmpty reports the values omitted with omitempty by encoding/json
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Pointer:
+		return v.IsNil()
+	}
+	return false
+}
+
+func appendVarint(buf []byte, n int64) []byte {
+	var raw [binary.MaxVarintLen64]byte
+	return append(buf, raw[:binary.PutVarint(raw[:], n)]...)
+}
+
+func appendUvarint(buf []byte, n uint64) []byte {
+	var raw [binary.MaxVarintLen64]byte
+	return append(buf, raw[:binary.PutUvarint(raw[:], n)]...)
+}
+
+func appendString(buf []byte, s string) []byte {
+	return append(appendUvarint(buf, uint64(len(s))), s...)
+}
+
+func readValue(data []byte, v reflect.Value) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, errBinaryShort
+	}
+	if data[0] == binaryNil {
+		v.Set(reflect.Zero(v.Type()))
+		return data[1:], nil
+	}
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return readValue(data, v.Elem())
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			return nil, fmt.Errorf("binary codec: unsupported interface %s", v.Type())
+		}
+		value, rest, err := readAny(data)
+		if err != nil {
+			return nil, err
+		}
+		v.Set(reflect.ValueOf(value))
+		return rest, nil
+	}
+	tag, data := data[0], data[1:]
+	if v.Type() == timeType {
+		if tag != binaryTime && tag != binaryZonedTime {
+			return nil, mismatch(tag, v)
+		}
+		sec, rest, err := readVarint(data)
+		if err != nil {
+			return nil, err
+		}
+		nsec, rest, err := readUvarint(rest)
+		if err != nil {
+			return nil, err
+		}
+		var offset int64
+		if tag == binaryZonedTime {
+			if offset, rest, err = readVarint(rest); err != nil {
+				return nil, err
+			}
+		}
+		v.Set(reflect.ValueOf(zoned(time.Unix(sec, int64(nsec)), int(offset))))
+		return rest, nil
+	}
+	if tag == binaryJSON {
+		raw, rest, err := readRaw(data)
+		if err != nil {
+			return nil, err
+		}
+		u, ok := implementation(v, jsonUnmarshalerType)
+		if !ok {
+			return nil, mismatch(tag, v)
+		}
+		return rest, u.(json.Unmarshaler).UnmarshalJSON(raw)
+	}
+	if tag == binaryString {
+		if u, ok := implementation(v, textUnmarshalerType); ok {
+			text, rest, err := readRaw(data)
+			if err != nil {
+				return nil, err
+			}
+			return rest, u.(encoding.TextUnmarshaler).UnmarshalText(text)
+		}
+	}
+	switch tag {
+	case binaryFalse, binaryTrue:
+		if v.Kind() != reflect.Bool {
+			return nil, mismatch(tag, v)
+		}
+		v.SetBool(tag == binaryTrue)
+		return data, nil
+	case binaryInt:
+		n, rest, err := readVarint(data)
+		if err != nil {
+			return nil, err
+		}
+		return rest, setNumber(v, n, uint64(n), float64(n))
+	case binaryUint:
+		n, rest, err := readUvarint(data)
+		if err != nil {
+			return nil, err
+		}
+		return rest, setNumber(v, int64(n), n, float64(n))
+	case binaryFloat:
+		if len(data) < 8 {
+			return nil, errBinaryShort
+		}
+		f := math.Float64frombits(binary.LittleEndian.Uint64(data))
+		return data[8:], setNumber(v, int64(f), uint64(f), f)
+	case binaryString:
+		s, rest, err := readString(data)
+		if err != nil {
+			return nil, err
+		}
+		if v.Kind() != reflect.String {
+			return nil, mismatch(tag, v)
+		}
+		v.SetString(s)
+		return rest, nil
+	case binaryBytes:
+		n, rest, err := readUvarint(data)
+		if err != nil {
+			return nil, err
+		}
+		if uint64(len(rest)) < n {
+			return nil, errBinaryShort
+		}
+		if v.Kind() != reflect.Slice || v.Type().Elem().Kind() != reflect.Uint8 {
+			return nil, mismatch(tag, v)
+		}
+		v.SetBytes(append([]byte(nil), rest[:n]...))
+		return rest[n:], nil
+	case binaryArray:
+		n, rest, err := readUvarint(data)
+		if err != nil {
+			return nil, err
+		}
+		if n > uint64(len(rest)) {
+			return nil, errBinaryShort
+		}
+		switch v.Kind() {
+		case reflect.Slice:
+			v.Set(reflect.MakeSlice(v.Type(), int(n), int(n)))
+		case reflect.Array:
+			if uint64(v.Len()) != n {
+				return nil, mismatch(tag, v)
+			}
+		default:
+			return nil, mismatch(tag, v)
+		}
+		for i := 0; i < int(n); i++ {
+			if rest, err = readValue(rest, v.Index(i)); err != nil {
+				return nil, err
+			}
+		}
+		return rest, nil
+	case binaryMap:
+		return readMap(data, v)
+	}
+	return nil, mismatch(tag, v)
+}
+
+func readMap(data []byte, v reflect.Value) ([]byte, error) {
+	n, rest, err := readUvarint(data)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]field
+	switch v.Kind() {
+	case reflect.Struct:
+		fields = structOf(v.Type()).byName
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("binary codec: unsupported map key %s", v.Type().Key())
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+	default:
+		return nil, mismatch(binaryMap, v)
+	}
+	for i := uint64(0); i < n; i++ {
+		var key []byte
+		if key, rest, err = readRaw(rest); err != nil {
+			return nil, err
+		}
+		if v.Kind() == reflect.Map {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if rest, err = readValue(rest, elem); err != nil {
+				return nil, err
+			}
+			v.SetMapIndex(reflect.ValueOf(string(key)).Convert(v.Type().Key()), elem)
+			continue
+		}
+		f, ok := fields[string(key)]
+		if !ok {
+			// unknown field, decode and drop it
+			if _, rest, err = readAny(rest); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if rest, err = readValue(rest, fieldByIndex(v, f.index)); err != nil {
+			return nil, err
+		}
+	}
+	return rest, nil
+}
+
+// readAny decodes a value without a target type, the same way as
+// encoding/json does into an empty interface
+func readAny(data []byte) (any, []byte, error) {
+	if len(data) == 0 {
+		return nil, nil, errBinaryShort
+	}
+	var target reflect.Value
+	switch data[0] {
+	case binaryNil:
+		return nil, data[1:], nil
+	case binaryFalse, binaryTrue:
+		return data[0] == binaryTrue, data[1:], nil
+	case binaryInt:
+		return readVarint(data[1:])
+	case binaryUint:
+		return readUvarint(data[1:])
+	case binaryString:
+		return readString(data[1:])
+	case binaryFloat:
+		target = reflect.New(reflect.TypeOf(float64(0))).Elem()
+	case binaryTime, binaryZonedTime:
+		target = reflect.New(timeType).Elem()
+	case binaryJSON:
+		raw, rest, err := readRaw(data[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		var value any
+		return value, rest, json.Unmarshal(raw, &value)
+	case binaryBytes:
+		target = reflect.New(reflect.TypeOf([]byte(nil))).Elem()
+	case binaryArray:
+		target = reflect.New(reflect.TypeOf([]any(nil))).Elem()
+	case binaryMap:
+		target = reflect.New(reflect.TypeOf(map[string]any(nil))).Elem()
+	default:
+		return nil, nil, fmt.Errorf("binary codec: unknown tag %d", data[0])
+	}
+	rest, err := readValue(data, target)
+	if err != nil {
+		return nil, nil, err
+	}
+	return target.Interface(), rest, nil
+}
+
+func setNumber(v reflect.Value, i int64, u uint64, f float64) error {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("binary codec: number into %s", v.Type())
+	}
+	return nil
+}
+
+func readVarint(data []byte) (int64, []byte, error) {
+	n, size := binary.Varint(data)
+	if size <= 0 {
+		return 0, nil, errBinaryShort
+	}
+	return n, data[size:], nil
+}
+
+func readUvarint(data []byte) (uint64, []byte, error) {
+	n, size := binary.Uvarint(data)
+	if size <= 0 {
+		return 0, nil, errBinaryShort
+	}
+	return n, data[size:], nil
+}
+
+func readString(data []byte) (string, []byte, error) {
+	raw, rest, err := readRaw(data)
+	if err != nil {
+		return "", nil, err
+	}
+	return string(raw), rest, nil
+}
+
+func readRaw(data []byte) ([]byte, []byte, error) {
+	n, rest, err := readUvarint(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if uint64(len(rest)) < n {
+		return nil, nil, errBinaryShort
+	}
+	return rest[:n], rest[n:], nil
+}
+
+// zoned returns the time in the zone of the offset the same way as the
+// parsing of encoding/json: in UTC without offset, in the local zone when it
+// has the offset, otherwise in a fixed zone
+func zoned(t time.Time, offset int) time.Time {
+	if offset == 0 {
+		return t.UTC()
+	}
+	if _, local := t.Local().Zone(); local == offset {
+		return t.Local()
+	}
+	return t.In(time.FixedZone("", offset))
+}
+
+func mismatch(tag byte, v reflect.Value) error {
+	return fmt.Errorf("binary codec: tag %d can't be decoded into %s", tag, v.Type())
+}
+
+type field struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+type structInfo struct {
+	fields []field
+	byName map[string]field
+}
+
+func structOf(t reflect.Type) *structInfo {
+	if cached, ok := structFields.Load(t); ok {
+		return cached.(*structInfo)
+	}
+	info := &structInfo{
+		fields: fieldsOf(t),
+	}
+	info.byName = make(map[string]field, len(info.fields))
+	for _, f := range info.fields {
+		info.byName[f.name] = f
+	}
+	structFields.Store(t, info)
+	return info
+}
+
+// fieldsOf lists the fields the same way as encoding/json: by the name of
+// the json tag, skipping the "-" fields and flattening the embedded structs
+func fieldsOf(t reflect.Type) []field {
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if sf.Anonymous && name == "" && sf.Type.Kind() == reflect.Struct {
+			for _, embedded := range fieldsOf(sf.Type) {
+				fields = append(fields, field{
+					name:      embedded.name,
+					index:     append([]int{i}, embedded.index...),
+					omitEmpty: embedded.omitEmpty,
+				})
+			}
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		fields = append(fields, field{
+			name:      name,
+			index:     []int{i},
+			omitEmpty: strings.Contains(","+options+",", ",omitempty,"),
+		})
+	}
+	return fields
+}
+
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
@@ -0,0 +1,135 @@
+package badger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Format markers are written as the first byte of each record. They can't
+// collide with the legacy records, those were stored as plain JSON objects.
+const (
+	FormatJSON    byte = 0x01
+	FormatMsgpack byte = 0x02
+	FormatBinary  byte = 0x03
+	// FormatVersioned starts the envelope of the records: the schema version
+	// of the record follows it as a uvarint, then the record itself with the
+	// format marker of its codec
+	FormatVersioned byte = 0x04
+)
+
+type Codec interface {
+	Name() string
+	Format() byte
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+var codecs = map[byte]Codec{
+	FormatJSON:    JSONCodec{},
+	FormatMsgpack: MsgpackCodec{},
+	FormatBinary:  BinaryCodec{},
+}
+
+func CodecByName(name string) (Codec, error) {
+	for _, c := range codecs {
+		if c.Name() == name {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown codec: %s", name)
+}
+
+func encode(c Codec, v any) ([]byte, error) {
+	payload, err := c.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{c.Format()}, payload...), nil
+}
+
+// wrap puts the encoded record into the envelope with its schema version
+func wrap(version int, record []byte) []byte {
+	var raw [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(raw[:], uint64(version))
+	data := make([]byte, 0, 1+n+len(record))
+	data = append(append(data, FormatVersioned), raw[:n]...)
+	return append(data, record...)
+}
+
+// unwrap returns the schema version and the encoded record of the envelope,
+// the records written before the envelope have their version in the user
+// metadata of the entry
+func unwrap(data []byte, meta byte) (int, []byte, error) {
+	if len(data) == 0 || data[0] != FormatVersioned {
+		return int(meta), data, nil
+	}
+	version, n := binary.Uvarint(data[1:])
+	if n <= 0 {
+		return 0, nil, fmt.Errorf("invalid record envelope")
+	}
+	return int(version), data[1+n:], nil
+}
+
+// decode reads the record with the codec of its format marker, records
+// without marker are decoded as JSON
+func decode(data []byte, v any) error {
+	if len(data) == 0 {
+		return fmt.Errorf("empty record")
+	}
+	c, ok := codecs[data[0]]
+	if !ok {
+		return json.Unmarshal(data, v)
+	}
+	return c.Unmarshal(data[1:], v)
+}
+
+type JSONCodec struct{}
+
+func (JSONCodec) Name() string {
+	return "json"
+}
+
+func (JSONCodec) Format() byte {
+	return FormatJSON
+}
+
+func (JSONCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// MsgpackCodec uses the json struct tags, so the field names are the same
+// as in the JSON records
+type MsgpackCodec struct{}
+
+func (MsgpackCodec) Name() string {
+	return "msgpack"
+}
+
+func (MsgpackCodec) Format() byte {
+	return FormatMsgpack
+}
+
+func (MsgpackCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (MsgpackCodec) Unmarshal(data []byte, v any) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
@@ -0,0 +1,324 @@
+package badger
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/borosr/realworld/types"
+	bdb "github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+var allCodecs = []Codec{JSONCodec{}, MsgpackCodec{}, BinaryCodec{}}
+
+func testArticle(i int) *types.Article {
+	now := time.Date(2022, 4, 1, 12, 30, 0, 123456789, time.UTC)
+	return &types.Article{
+		Slug:           "article-" + strconv.Itoa(i),
+		Title:          "How to train your dragon " + strconv.Itoa(i),
+		Description:    "Ever wonder how?",
+		Body:           "You have to believe in yourself, it takes a lot of patience and practice.",
+		TagList:        []string{"dragons", "training"},
+		CreatedAt:      now,
+		UpdatedAt:      now.Add(time.Hour),
+		FavoritesCount: i,
+		Author: types.Profile{
+			Username: "jake" + strconv.Itoa(i%100),
+			Bio:      "I work at statefarm",
+			Image:    "https://i.stack.imgur.com/xHWG8.jpg",
+		},
+	}
+}
+
+func TestCodec_RoundTrip(t *testing.T) {
+	for _, c := range allCodecs {
+		c := c
+		t.Run(c.Name(), func(t *testing.T) {
+			expected := testArticle(1)
+			raw, err := encode(c, expected)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, c.Format(), raw[0])
+			var got *types.Article
+			if err := decode(raw, &got); err != nil {
+				t.Fatal(err)
+			}
+			assert.True(t, expected.CreatedAt.Equal(got.CreatedAt))
+			assert.True(t, expected.UpdatedAt.Equal(got.UpdatedAt))
+			got.CreatedAt, got.UpdatedAt = expected.CreatedAt, expected.UpdatedAt
+			assert.Equal(t, expected, got)
+		})
+	}
+}
+
+func TestCodec_EmbeddedStruct(t *testing.T) {
+	for _, c := range allCodecs {
+		c := c
+		t.Run(c.Name(), func(t *testing.T) {
+			expected := &types.User{
+				Email:    "jake@jake.jake",
+				Password: "hash",
+				Profile: types.Profile{
+					Username: "jake",
+					Bio:      "bio",
+				},
+			}
+			raw, err := encode(c, expected)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got *types.User
+			if err := decode(raw, &got); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, expected, got)
+		})
+	}
+}
+
+func TestCodec_Document(t *testing.T) {
+	for _, c := range allCodecs {
+		c := c
+		t.Run(c.Name(), func(t *testing.T) {
+			raw, err := encode(c, testArticle(7))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var doc map[string]any
+			if err := decode(raw, &doc); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, "article-7", doc["slug"])
+			author, ok := doc["author"].(map[string]any)
+			if assert.True(t, ok, "author is a document: %T", doc["author"]) {
+				assert.Equal(t, "jake7", author["username"])
+			}
+		})
+	}
+}
+
+func TestCodec_LegacyJSON(t *testing.T) {
+	var got *types.Article
+	if err := decode([]byte(`{"slug":"legacy","tagList":["a"]}`), &got); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "legacy", got.Slug)
+	assert.Equal(t, []string{"a"}, got.TagList)
+}
+
+// marshaled has its own JSON form, the binary codec has to use it
+type marshaled struct {
+	value string
+}
+
+func (m marshaled) MarshalJSON() ([]byte, error) {
+	return []byte(`{"v":"` + m.value + `"}`), nil
+}
+
+func (m *marshaled) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		V string `json:"v"`
+	}
+	err := json.Unmarshal(data, &raw)
+	m.value = raw.V
+	return err
+}
+
+type roundTripped struct {
+	Zoned     time.Time  `json:"zoned"`
+	Local     time.Time  `json:"local"`
+	UTC       time.Time  `json:"utc"`
+	Optional  *time.Time `json:"optional,omitempty"`
+	Omitted   string     `json:"omitted,omitempty"`
+	Kept      string     `json:"kept"`
+	Marshaled marshaled  `json:"marshaled"`
+	Pointer   *marshaled `json:"pointer"`
+}
+
+func TestBinaryCodec_SameAsJSON(t *testing.T) {
+	instant := time.Date(2022, 4, 1, 12, 30, 0, 123456789, time.UTC)
+	expected := roundTripped{
+		Zoned:     instant.In(time.FixedZone("CEST", 2*60*60)),
+		Local:     instant.Local(),
+		UTC:       instant,
+		Marshaled: marshaled{value: "a"},
+		Pointer:   &marshaled{value: "b"},
+	}
+	var fromJSON, fromBinary roundTripped
+	for c, got := range map[Codec]*roundTripped{JSONCodec{}: &fromJSON, BinaryCodec{}: &fromBinary} {
+		// the previous values are kept for the omitted fields
+		got.Omitted = "previous"
+		raw, err := encode(c, expected)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := decode(raw, got); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.Equal(t, fromJSON, fromBinary)
+	assert.Equal(t, "previous", fromBinary.Omitted)
+	assert.Equal(t, "a", fromBinary.Marshaled.value)
+	assert.Equal(t, "b", fromBinary.Pointer.value)
+	_, offset := fromBinary.Zoned.Zone()
+	assert.Equal(t, 2*60*60, offset)
+	assert.True(t, expected.Zoned.Equal(fromBinary.Zoned))
+	assert.Equal(t, time.UTC, fromBinary.UTC.Location())
+
+	var doc map[string]any
+	raw, err := encode(BinaryCodec{}, expected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := decode(raw, &doc); err != nil {
+		t.Fatal(err)
+	}
+	assert.NotContains(t, doc, "omitted")
+	assert.NotContains(t, doc, "optional")
+	assert.Equal(t, map[string]any{"v": "a"}, doc["marshaled"])
+}
+
+func TestBinaryCodec_LegacyTime(t *testing.T) {
+	// the times were written without their zone offset before
+	raw := appendUvarint(appendVarint([]byte{FormatBinary, binaryTime}, 1648816200), 5)
+	var got time.Time
+	if err := decode(raw, &got); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, time.Unix(1648816200, 5).UTC(), got)
+}
+
+func TestRepository_MixedFormats(t *testing.T) {
+	db, err := bdb.Open(bdb.DefaultOptions("").WithInMemory(true).WithLoggingLevel(bdb.WARNING))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Update(func(txn *bdb.Txn) error {
+		return txn.Set([]byte("article-legacy"), []byte(`{"slug":"legacy"}`))
+	}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for i, c := range allCodecs {
+		if _, err := New[*types.Article](db).WithCodec(c).Save(ctx, testArticle(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	articles, err := New[*types.Article](db).GetFiltered(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(allCodecs)+1, len(articles))
+}
+
+// manyVersions has more schema versions than a byte can hold
+type manyVersions struct {
+	ID string `json:"id"`
+}
+
+func (m *manyVersions) Name() string {
+	return "many_versions"
+}
+
+func (m *manyVersions) Key() string {
+	return m.ID
+}
+
+func (m *manyVersions) SetKey(id string) {
+	m.ID = id
+}
+
+func (m *manyVersions) SchemaVersion() int {
+	return 300
+}
+
+func TestRepository_VersionEnvelope(t *testing.T) {
+	db, err := bdb.Open(bdb.DefaultOptions("").WithInMemory(true).WithLoggingLevel(bdb.WARNING))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	repo := New[*manyVersions](db)
+	if _, err := repo.Save(ctx, &manyVersions{ID: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	versions, err := repo.Versions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, map[int]uint64{300: 1}, versions)
+	got, err := repo.Get(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "a", got.ID)
+
+	// the records written before the envelope have the version in the user
+	// metadata of the entry
+	raw, err := encode(JSONCodec{}, &manyVersions{ID: "legacy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Update(func(txn *bdb.Txn) error {
+		return txn.SetEntry(bdb.NewEntry([]byte("many_versions-legacy"), raw).WithMeta(7))
+	}); err != nil {
+		t.Fatal(err)
+	}
+	versions, err = repo.Versions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, map[int]uint64{7: 1, 300: 1}, versions)
+}
+
+func BenchmarkRepository_GetFiltered(b *testing.B) {
+	const articleCount = 100_000
+	for _, c := range allCodecs {
+		c := c
+		b.Run(c.Name(), func(b *testing.B) {
+			db, err := bdb.Open(bdb.DefaultOptions("").WithInMemory(true).WithLoggingLevel(bdb.WARNING))
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer db.Close()
+			wb := db.NewWriteBatch()
+			for i := 0; i < articleCount; i++ {
+				a := testArticle(i)
+				raw, err := encode(c, a)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if err := wb.Set([]byte(a.Name()+separator+a.Key()), raw); err != nil {
+					b.Fatal(err)
+				}
+			}
+			if err := wb.Flush(); err != nil {
+				b.Fatal(err)
+			}
+			repo := New[*types.Article](db)
+			ctx := context.Background()
+			b.ReportAllocs()
+			b.ResetTimer()
+			start := time.Now()
+			for i := 0; i < b.N; i++ {
+				articles, err := repo.GetFiltered(ctx, func(a *types.Article) bool {
+					return a.Author.Username == "jake42"
+				})
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(articles) != articleCount/100 {
+					b.Fatalf("unexpected result count: %d", len(articles))
+				}
+			}
+			b.ReportMetric(float64(articleCount*b.N)/time.Since(start).Seconds(), "articles/s")
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package badger
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/borosr/realworld/lib/config"
+	bdb "github.com/dgraph-io/badger/v3"
+)
+
+// defaultEncryptedIndexCacheSize keeps the decrypted table indices in a
+// bounded cache instead of the heap
+const defaultEncryptedIndexCacheSize = 100 << 20
+
+// EncryptionKey returns the master key of the database, read from the file
+// of BADGER_ENCRYPTION_KEY_FILE or from BADGER_ENCRYPTION_KEY, an empty key
+// means the database isn't encrypted
+func EncryptionKey() ([]byte, error) {
+	if path := config.String("BADGER_ENCRYPTION_KEY_FILE", ""); path != "" {
+		return ReadKey(path)
+	}
+	key := []byte(config.String("BADGER_ENCRYPTION_KEY", ""))
+	if len(key) == 0 {
+		return nil, nil
+	}
+	return key, validateKey(key)
+}
+
+// ReadKey reads an AES key from a file, the trailing whitespace is ignored
+func ReadKey(path string) ([]byte, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key := bytes.TrimRight(content, " \t\r\n")
+	return key, validateKey(key)
+}
+
+func validateKey(key []byte) error {
+	switch len(key) {
+	case 16, 24, 32:
+		return nil
+	default:
+		return fmt.Errorf("encryption key must be 16, 24 or 32 bytes long, got %d", len(key))
+	}
+}
+
+func withEncryption(opts bdb.Options, key []byte) bdb.Options {
+	opts = opts.WithEncryptionKey(key)
+	if len(key) == 0 {
+		return opts
+	}
+	if opts.IndexCacheSize == 0 {
+		opts = opts.WithIndexCacheSize(defaultEncryptedIndexCacheSize)
+	}
+	return opts.WithEncryptionKeyRotationDuration(
+		config.Duration("BADGER_DATA_KEY_ROTATION", opts.EncryptionKeyRotationDuration))
+}
+
+// RotateKey re-encrypts the key registry of a closed database with a new
+// master key. The data is encrypted with the data keys of the registry, so
+// only the registry is rewritten.
+func RotateKey(dir string, oldKey, newKey []byte) error {
+	if err := validateKey(newKey); err != nil {
+		return err
+	}
+	opts, err := options(dir)
+	if err != nil {
+		return err
+	}
+	opt := bdb.KeyRegistryOptions{
+		Dir:                           dir,
+		ReadOnly:                      true,
+		EncryptionKey:                 oldKey,
+		EncryptionKeyRotationDuration: opts.EncryptionKeyRotationDuration,
+	}
+	registry, err := bdb.OpenKeyRegistry(opt)
+	if err != nil {
+		return err
+	}
+	defer registry.Close()
+	opt.EncryptionKey = newKey
+	return bdb.WriteKeyRegistry(registry, opt)
+}
+
+// Encrypt copies an unencrypted database into an empty directory as an
+// encrypted one, the source directory is left untouched
+func Encrypt(src, dst string, key []byte) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	if err := ensureEmpty(dst); err != nil {
+		return err
+	}
+	srcOpts, err := options(src)
+	if err != nil {
+		return err
+	}
+	dstOpts, err := options(dst)
+	if err != nil {
+		return err
+	}
+	source, err := bdb.Open(withEncryption(srcOpts, nil).WithReadOnly(true))
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	target, err := bdb.Open(withEncryption(dstOpts, key))
+	if err != nil {
+		return err
+	}
+
+	r, w := io.Pipe()
+	go func() {
+		_, err := source.Backup(w, 0)
+		w.CloseWithError(err)
+	}()
+	if err := target.Load(r, maxPendingWrites); err != nil {
+		r.CloseWithError(err)
+		target.Close()
+		return err
+	}
+	return target.Close()
+}
@@ -0,0 +1,79 @@
+package badger
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/borosr/realworld/types"
+	bdb "github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptAndRotateKey(t *testing.T) {
+	ctx := context.Background()
+	src, dst := t.TempDir(), t.TempDir()
+	oldKey := []byte("0123456789abcdef0123456789abcdef")
+	newKey := []byte("fedcba9876543210")
+
+	plain, err := bdb.Open(testOptions(t, src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New[*types.Article](plain).Save(ctx, testArticle(1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := plain.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Error(t, Encrypt(src, dst, []byte("short")), "invalid key length")
+	if err := Encrypt(src, dst, oldKey); err != nil {
+		t.Fatal(err)
+	}
+	assert.Error(t, Encrypt(src, dst, oldKey), "encrypt needs an empty directory")
+
+	open := func(key []byte) (*bdb.DB, error) {
+		return bdb.Open(withEncryption(testOptions(t, dst), key))
+	}
+	_, err = open(nil)
+	assert.Error(t, err, "opening without the key")
+
+	if err := RotateKey(dst, oldKey, newKey); err != nil {
+		t.Fatal(err)
+	}
+	_, err = open(oldKey)
+	assert.Error(t, err, "opening with the rotated key")
+	encrypted, err := open(newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer encrypted.Close()
+	got, err := New[*types.Article](encrypted).Get(ctx, "article-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, testArticle(1).Title, got.Title)
+	stats, err := (&maintenance{}).metrics(encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, stats.Encrypted)
+}
+
+func TestReadKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(path, []byte("0123456789abcdef\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	key, err := ReadKey(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("0123456789abcdef"), key)
+
+	if err := os.WriteFile(path, []byte("0123456789"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, err = ReadKey(path)
+	assert.Error(t, err)
+}
@@ -0,0 +1,246 @@
+package badger
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/borosr/realworld/lib/config"
+	bdb "github.com/dgraph-io/badger/v3"
+	"github.com/dgraph-io/ristretto"
+)
+
+type MaintenanceConfig struct {
+	// GCInterval is the period of the value log garbage collection
+	GCInterval time.Duration
+	// GCDiscardRatio is the ratio of the stale data a value log file must
+	// have to be rewritten
+	GCDiscardRatio float64
+	// FlattenInterval is the period of compacting all the LSM levels into
+	// one, zero disables it
+	FlattenInterval time.Duration
+	FlattenWorkers  int
+	// KeyCountInterval is the period of counting the keys, the metrics report
+	// the last counts
+	KeyCountInterval time.Duration
+}
+
+func maintenanceConfig() MaintenanceConfig {
+	return MaintenanceConfig{
+		GCInterval:       config.Duration("BADGER_GC_INTERVAL", 10*time.Minute),
+		GCDiscardRatio:   float64(config.Int("BADGER_GC_DISCARD_PERCENT", 50)) / 100,
+		FlattenInterval:  config.Duration("BADGER_FLATTEN_INTERVAL", 0),
+		FlattenWorkers:   config.Int("BADGER_FLATTEN_WORKERS", 2),
+		KeyCountInterval: config.Duration("BADGER_KEY_COUNT_INTERVAL", 10*time.Minute),
+	}
+}
+
+type CacheStats struct {
+	Hits   uint64  `json:"hits"`
+	Misses uint64  `json:"misses"`
+	Ratio  float64 `json:"ratio"`
+}
+
+type MaintenanceStats struct {
+	GCRuns        uint64    `json:"gcRuns"`
+	GCRewrites    uint64    `json:"gcRewrites"`
+	LastGC        time.Time `json:"lastGC"`
+	FlattenRuns   uint64    `json:"flattenRuns"`
+	LastFlatten   time.Time `json:"lastFlatten"`
+	LastError     string    `json:"lastError,omitempty"`
+	LastErrorTime time.Time `json:"lastErrorTime,omitempty"`
+}
+
+type Stats struct {
+	LSMSize   int64 `json:"lsmSize"`
+	VLogSize  int64 `json:"vlogSize"`
+	Encrypted bool  `json:"encrypted"`
+	// Keys counts the keys per Storable name over all the tenants, TenantKeys
+	// counts them per tenant, the default tenant is the empty one
+	Keys          map[string]uint64 `json:"keys"`
+	TenantKeys    map[string]uint64 `json:"tenantKeys"`
+	KeysCountedAt time.Time         `json:"keysCountedAt"`
+	BlockCache    CacheStats        `json:"blockCache"`
+	IndexCache    CacheStats        `json:"indexCache"`
+	Maintenance   MaintenanceStats  `json:"maintenance"`
+}
+
+// keyCounts is the result of the last counting of the keys
+type keyCounts struct {
+	byName    map[string]uint64
+	byTenant  map[string]uint64
+	countedAt time.Time
+}
+
+// maintenance keeps the state of the maintenance jobs of a database
+type maintenance struct {
+	mu    sync.Mutex
+	stats MaintenanceStats
+	keys  keyCounts
+}
+
+var jobs = &maintenance{}
+
+// StartMaintenance runs the value log garbage collection, the counting of
+// the keys and the optional flattening periodically until the context is
+// cancelled
+func StartMaintenance(ctx context.Context) {
+	getDB()
+	cfg := maintenanceConfig()
+	go schedule(ctx, cfg.GCInterval, func() {
+		jobs.runGC(db, cfg.GCDiscardRatio)
+	})
+	go schedule(ctx, cfg.KeyCountInterval, func() {
+		if err := jobs.countKeys(db); err != nil {
+			jobs.recordError(err)
+		}
+	})
+	if cfg.FlattenInterval > 0 {
+		go schedule(ctx, cfg.FlattenInterval, func() {
+			jobs.runFlatten(db, cfg.FlattenWorkers)
+		})
+	}
+}
+
+func schedule(ctx context.Context, interval time.Duration, job func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			job()
+		}
+	}
+}
+
+// runGC repeats the collection while it finds value log files to rewrite
+func (m *maintenance) runGC(db *bdb.DB, discardRatio float64) {
+	var rewrites uint64
+	var err error
+	for {
+		if err = db.RunValueLogGC(discardRatio); err != nil {
+			break
+		}
+		rewrites++
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stats.GCRuns++
+	m.stats.GCRewrites += rewrites
+	m.stats.LastGC = time.Now()
+	if !errors.Is(err, bdb.ErrNoRewrite) && !errors.Is(err, bdb.ErrRejected) {
+		m.recordErrorLocked(err)
+	}
+}
+
+func (m *maintenance) runFlatten(db *bdb.DB, workers int) {
+	err := db.Flatten(workers)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stats.FlattenRuns++
+	m.stats.LastFlatten = time.Now()
+	if err != nil {
+		m.recordErrorLocked(err)
+	}
+}
+
+func (m *maintenance) recordError(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.recordErrorLocked(err)
+}
+
+func (m *maintenance) recordErrorLocked(err error) {
+	log.Printf("badger maintenance: %v", err)
+	m.stats.LastError = err.Error()
+	m.stats.LastErrorTime = time.Now()
+}
+
+// countKeys counts the keys by their Storable name and by their tenant, the
+// keys of the tenants are prefixed with tenant-<id>-
+func (m *maintenance) countKeys(db *bdb.DB) error {
+	counts := keyCounts{
+		byName:   make(map[string]uint64),
+		byTenant: make(map[string]uint64),
+	}
+	if err := db.View(func(txn *bdb.Txn) error {
+		options := bdb.DefaultIteratorOptions
+		options.PrefetchValues = false
+		it := txn.NewIterator(options)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			var id string
+			key := string(it.Item().Key())
+			if strings.HasPrefix(key, tenantPrefix+separator) {
+				id, key, _ = strings.Cut(strings.TrimPrefix(key, tenantPrefix+separator), separator)
+			}
+			name, _, _ := strings.Cut(key, separator)
+			counts.byName[name]++
+			counts.byTenant[id]++
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	counts.countedAt = time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys = counts
+	return nil
+}
+
+// Metrics reports the storage sizes, the key counts of the last counting and
+// the cache hit ratios
+func Metrics() (Stats, error) {
+	getDB()
+	return jobs.metrics(db)
+}
+
+// metrics reads the state of the jobs, the keys are counted here only when
+// they were never counted before
+func (m *maintenance) metrics(db *bdb.DB) (Stats, error) {
+	m.mu.Lock()
+	counted := !m.keys.countedAt.IsZero()
+	m.mu.Unlock()
+	if !counted {
+		if err := m.countKeys(db); err != nil {
+			return Stats{}, err
+		}
+	}
+	var s Stats
+	s.LSMSize, s.VLogSize = db.Size()
+	s.Encrypted = len(db.Opts().EncryptionKey) > 0
+	s.BlockCache = cacheStats(db.BlockCacheMetrics())
+	s.IndexCache = cacheStats(db.IndexCacheMetrics())
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s.Maintenance = m.stats
+	s.Keys = copyCounts(m.keys.byName)
+	s.TenantKeys = copyCounts(m.keys.byTenant)
+	s.KeysCountedAt = m.keys.countedAt
+	return s, nil
+}
+
+func copyCounts(counts map[string]uint64) map[string]uint64 {
+	var res = make(map[string]uint64, len(counts))
+	for k, v := range counts {
+		res[k] = v
+	}
+	return res
+}
+
+func cacheStats(m *ristretto.Metrics) CacheStats {
+	if m == nil {
+		return CacheStats{}
+	}
+	return CacheStats{
+		Hits:   m.Hits(),
+		Misses: m.Misses(),
+		Ratio:  m.Ratio(),
+	}
+}
@@ -0,0 +1,68 @@
+package badger
+
+import (
+	"context"
+	"testing"
+
+	"github.com/borosr/realworld/lib/tenant"
+	"github.com/borosr/realworld/types"
+	bdb "github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	db, err := bdb.Open(bdb.DefaultOptions("").WithInMemory(true).WithLoggingLevel(bdb.WARNING))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+	articles := New[*types.Article](db)
+	for i := 0; i < 3; i++ {
+		if _, err := articles.Save(ctx, testArticle(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := articles.Sequence(ctx, "article-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New[*types.User](db).Save(ctx, &types.User{Email: "jake@jake.jake"}); err != nil {
+		t.Fatal(err)
+	}
+	acme := tenant.WithID(ctx, "acme")
+	if _, err := articles.Save(acme, testArticle(0)); err != nil {
+		t.Fatal(err)
+	}
+
+	var m maintenance
+	stats, err := m.metrics(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, map[string]uint64{"article": 4, "user": 1, "seq": 1}, stats.Keys)
+	assert.Equal(t, map[string]uint64{"": 5, "acme": 1}, stats.TenantKeys)
+	assert.False(t, stats.KeysCountedAt.IsZero())
+
+	// the keys saved later are counted on the next counting only
+	if _, err := New[*types.User](db).Save(acme, &types.User{Email: "jake@jake.jake"}); err != nil {
+		t.Fatal(err)
+	}
+	stats, err = m.metrics(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, uint64(1), stats.Keys["user"])
+	assert.Nil(t, m.countKeys(db))
+	stats, err = m.metrics(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, uint64(2), stats.Keys["user"])
+
+	m.runGC(db, 0.5)
+	stats, err = m.metrics(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, uint64(1), stats.Maintenance.GCRuns)
+}
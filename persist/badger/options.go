@@ -0,0 +1,41 @@
+package badger
+
+import (
+	"fmt"
+
+	"github.com/borosr/realworld/lib/config"
+	bdb "github.com/dgraph-io/badger/v3"
+	badgerOptions "github.com/dgraph-io/badger/v3/options"
+)
+
+var compressions = map[string]badgerOptions.CompressionType{
+	"none":   badgerOptions.None,
+	"snappy": badgerOptions.Snappy,
+	"zstd":   badgerOptions.ZSTD,
+}
+
+// options builds the database options from the configuration, the unset
+// values keep the Badger defaults
+func options(dir string) (bdb.Options, error) {
+	opts := bdb.DefaultOptions(dir)
+	opts = opts.
+		WithMemTableSize(config.Int64("BADGER_MEMTABLE_SIZE", opts.MemTableSize)).
+		WithNumMemtables(config.Int("BADGER_NUM_MEMTABLES", opts.NumMemtables)).
+		WithBlockCacheSize(config.Int64("BADGER_BLOCK_CACHE_SIZE", opts.BlockCacheSize)).
+		WithIndexCacheSize(config.Int64("BADGER_INDEX_CACHE_SIZE", opts.IndexCacheSize)).
+		WithValueLogFileSize(config.Int64("BADGER_VALUE_LOG_FILE_SIZE", opts.ValueLogFileSize)).
+		WithNumCompactors(config.Int("BADGER_NUM_COMPACTORS", opts.NumCompactors)).
+		WithZSTDCompressionLevel(config.Int("BADGER_ZSTD_LEVEL", opts.ZSTDCompressionLevel))
+	if name := config.String("BADGER_COMPRESSION", ""); name != "" {
+		compression, ok := compressions[name]
+		if !ok {
+			return opts, fmt.Errorf("unknown badger compression: %s", name)
+		}
+		opts = opts.WithCompression(compression)
+	}
+	key, err := EncryptionKey()
+	if err != nil {
+		return opts, err
+	}
+	return withEncryption(opts, key), nil
+}
@@ -0,0 +1,35 @@
+package badger
+
+import (
+	"testing"
+
+	bdb "github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func testOptions(t *testing.T, dir string) bdb.Options {
+	opts, err := options(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return opts.WithLoggingLevel(bdb.WARNING)
+}
+
+func TestOptions(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("BADGER_COMPRESSION", "zstd")
+	opts, err := options(dir)
+	if assert.NoError(t, err) {
+		assert.Equal(t, compressions["zstd"], opts.Compression)
+	}
+
+	t.Setenv("BADGER_COMPRESSION", "lz4")
+	_, err = options(dir)
+	assert.EqualError(t, err, "unknown badger compression: lz4")
+
+	t.Setenv("BADGER_COMPRESSION", "")
+	t.Setenv("BADGER_ENCRYPTION_KEY", "short")
+	_, err = options(dir)
+	assert.Error(t, err, "invalid key length")
+	assert.Error(t, Restore(dir, nil), "the restore reports the invalid key")
+}
@@ -0,0 +1,86 @@
+package badger
+
+import (
+	"context"
+	"errors"
+
+	bdb "github.com/dgraph-io/badger/v3"
+)
+
+type transactionKey struct{}
+
+type transaction struct {
+	db  *bdb.DB
+	txn *bdb.Txn
+}
+
+// Transaction runs fn in one read-write transaction of the database, the
+// repositories use it with the context passed to fn
+func Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	getDB()
+	return WithTransaction(ctx, db, fn)
+}
+
+// Detach returns the context without its transaction, the repositories
+// write in transactions of their own with it
+func Detach(ctx context.Context) context.Context {
+	return context.WithValue(ctx, transactionKey{}, nil)
+}
+
+// WithTransaction runs fn in one read-write transaction of the given database,
+// the transaction is committed when fn returns nil and discarded otherwise.
+// The transaction has to fit into the memtable, Badger returns ErrTxnTooBig
+// for the larger ones.
+func WithTransaction(ctx context.Context, db *bdb.DB, fn func(ctx context.Context) error) error {
+	txn := db.NewTransaction(true)
+	defer txn.Discard()
+	if err := fn(context.WithValue(ctx, transactionKey{}, transaction{db: db, txn: txn})); err != nil {
+		return err
+	}
+	return txn.Commit()
+}
+
+// IsConflict reports a transaction failing on the concurrent write of a key
+// it read, it can be retried
+func IsConflict(err error) bool {
+	return errors.Is(err, bdb.ErrConflict)
+}
+
+// txn returns the transaction of the context started on the database of the
+// repository
+func (r Repository[Type]) txn(ctx context.Context) (*bdb.Txn, bool) {
+	t, ok := ctx.Value(transactionKey{}).(transaction)
+	if !ok || t.db != r.db {
+		return nil, false
+	}
+	return t.txn, true
+}
+
+func (r Repository[Type]) update(ctx context.Context, fn func(txn *bdb.Txn) error) error {
+	if txn, ok := r.txn(ctx); ok {
+		return fn(txn)
+	}
+	return r.db.Update(fn)
+}
+
+// view reads in the transaction of the context, so the uncommitted writes
+// are visible
+func (r Repository[Type]) view(ctx context.Context, fn func(txn *bdb.Txn) error) error {
+	if txn, ok := r.txn(ctx); ok {
+		return fn(txn)
+	}
+	return r.db.View(fn)
+}
+
+// batch writes with a WriteBatch, or into the transaction of the context
+func (r Repository[Type]) batch(ctx context.Context, fn func(set func(e *bdb.Entry) error, del func(key []byte) error) error) error {
+	if txn, ok := r.txn(ctx); ok {
+		return fn(txn.SetEntry, txn.Delete)
+	}
+	wb := r.db.NewWriteBatch()
+	defer wb.Cancel()
+	if err := fn(wb.SetEntry, wb.Delete); err != nil {
+		return err
+	}
+	return wb.Flush()
+}
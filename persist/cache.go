@@ -0,0 +1,477 @@
+package persist
+
+import (
+	"container/list"
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/borosr/realworld/lib/config"
+	"github.com/borosr/realworld/lib/tenant"
+	"github.com/borosr/realworld/persist/types"
+)
+
+// CacheConfig bounds the cache of a type, zero size disables it
+type CacheConfig struct {
+	Size int
+	TTL  time.Duration
+}
+
+// cacheConfig reads CACHE_SIZE and CACHE_TTL, they can be overridden per
+// type, e.g. CACHE_USER_SIZE
+func cacheConfig(name string) CacheConfig {
+	prefix := "CACHE_" + strings.ToUpper(name) + "_"
+	size := config.Int("CACHE_SIZE", 1000)
+	ttl := config.Duration("CACHE_TTL", time.Minute)
+	return CacheConfig{
+		Size: config.Int(prefix+"SIZE", size),
+		TTL:  config.Duration(prefix+"TTL", ttl),
+	}
+}
+
+type CacheStats struct {
+	Name      string  `json:"name"`
+	Size      int     `json:"size"`
+	Capacity  int     `json:"capacity"`
+	Hits      uint64  `json:"hits"`
+	Misses    uint64  `json:"misses"`
+	Evictions uint64  `json:"evictions"`
+	Ratio     float64 `json:"ratio"`
+}
+
+type cacheEntry[Type types.Storable] struct {
+	key     string
+	value   Type
+	expires time.Time
+}
+
+// lru is a bounded cache of the records of a type, the least recently used
+// records are evicted first and every record expires after the ttl
+type lru[Type types.Storable] struct {
+	mu      sync.Mutex
+	name    string
+	config  CacheConfig
+	entries map[string]*list.Element
+	order   *list.List
+	stats   CacheStats
+}
+
+func newLRU[Type types.Storable](name string, cfg CacheConfig) *lru[Type] {
+	return &lru[Type]{
+		name:    name,
+		config:  cfg,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+func (c *lru[Type]) get(key string) (Type, bool) {
+	var empty Type
+	if c.config.Size <= 0 {
+		return empty, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		c.stats.Misses++
+		return empty, false
+	}
+	entry := e.Value.(*cacheEntry[Type])
+	if !entry.expires.After(time.Now()) {
+		c.remove(e)
+		c.stats.Misses++
+		return empty, false
+	}
+	c.order.MoveToFront(e)
+	c.stats.Hits++
+	return entry.value, true
+}
+
+func (c *lru[Type]) set(key string, value Type, ttl time.Duration) {
+	if c.config.Size <= 0 {
+		return
+	}
+	if ttl <= 0 || ttl > c.config.TTL {
+		ttl = c.config.TTL
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := &cacheEntry[Type]{
+		key:     key,
+		value:   value,
+		expires: time.Now().Add(ttl),
+	}
+	if e, ok := c.entries[key]; ok {
+		e.Value = entry
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.config.Size {
+		c.remove(c.order.Back())
+		c.stats.Evictions++
+	}
+}
+
+func (c *lru[Type]) invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		c.remove(e)
+	}
+}
+
+func (c *lru[Type]) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+}
+
+func (c *lru[Type]) remove(e *list.Element) {
+	c.order.Remove(e)
+	delete(c.entries, e.Value.(*cacheEntry[Type]).key)
+}
+
+func (c *lru[Type]) snapshot() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.stats
+	s.Name = c.name
+	s.Size = c.order.Len()
+	s.Capacity = c.config.Size
+	if total := s.Hits + s.Misses; total > 0 {
+		s.Ratio = float64(s.Hits) / float64(total)
+	}
+	return s
+}
+
+var (
+	cachesMu sync.Mutex
+	caches   = make(map[string]interface{ snapshot() CacheStats })
+)
+
+// getCache returns the shared cache of the type, so every repository of the
+// type invalidates the same records
+func getCache[Type types.Storable]() *lru[Type] {
+	var t Type
+	cachesMu.Lock()
+	defer cachesMu.Unlock()
+	if c, ok := caches[t.Name()]; ok {
+		return c.(*lru[Type])
+	}
+	c := newLRU[Type](t.Name(), cacheConfig(t.Name()))
+	caches[t.Name()] = c
+	return c
+}
+
+// Caches returns the statistics of the record caches
+func Caches() []CacheStats {
+	cachesMu.Lock()
+	var res = make([]CacheStats, 0, len(caches))
+	for _, c := range caches {
+		res = append(res, c.snapshot())
+	}
+	cachesMu.Unlock()
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
+
+type requestCacheKey struct{}
+
+// requestCache memoizes the records read while serving a request
+type requestCache struct {
+	mu      sync.Mutex
+	records map[string]any
+}
+
+// WithRequestCache starts memoizing the records read with the returned
+// context, so a request never loads the same record twice
+func WithRequestCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, requestCacheKey{}, &requestCache{
+		records: make(map[string]any),
+	})
+}
+
+func getRequestCache(ctx context.Context) *requestCache {
+	rc, _ := ctx.Value(requestCacheKey{}).(*requestCache)
+	return rc
+}
+
+func (rc *requestCache) get(key string) (any, bool) {
+	if rc == nil {
+		return nil, false
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	v, ok := rc.records[key]
+	return v, ok
+}
+
+func (rc *requestCache) set(key string, value any) {
+	if rc == nil {
+		return
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.records[key] = value
+}
+
+func (rc *requestCache) invalidate(prefix string, keys ...string) {
+	if rc == nil {
+		return
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if len(keys) == 0 {
+		for key := range rc.records {
+			if strings.HasPrefix(key, prefix) {
+				delete(rc.records, key)
+			}
+		}
+		return
+	}
+	for _, key := range keys {
+		delete(rc.records, prefix+key)
+	}
+}
+
+// cached is a read-through cache of the decorated repository, the Get and
+// GetMany reads are served from the request cache and the LRU of the type.
+// The cached records are copied deeply, so the callers can modify the
+// returned records.
+type cached[Type types.Storable] struct {
+	Repository[Type]
+	lru *lru[Type]
+	// expiries reads the expiry of the records saved with a ttl, they are
+	// cached until their expiry at most
+	expiries expirer
+}
+
+func newCached[Type types.Storable](r Repository[Type], backend Repository[Type]) cached[Type] {
+	ex, _ := backend.(expirer)
+	return cached[Type]{
+		Repository: r,
+		lru:        getCache[Type](),
+		expiries:   ex,
+	}
+}
+
+// Get reads the uncommitted records of a Transaction from the repository,
+// they aren't cached until the commit
+func (c cached[Type]) Get(ctx context.Context, key string) (Type, error) {
+	if inTransaction(ctx) {
+		return c.Repository.Get(ctx, key)
+	}
+	rc := getRequestCache(ctx)
+	if v, ok := rc.get(c.requestKey(key)); ok {
+		return clone(v.(Type)), nil
+	}
+	if t, ok := c.lru.get(c.cacheKey(ctx, key)); ok {
+		rc.set(c.requestKey(key), clone(t))
+		return clone(t), nil
+	}
+	t, err := c.Repository.Get(ctx, key)
+	if err != nil {
+		return t, err
+	}
+	c.store(ctx, []Type{t})
+	return t, nil
+}
+
+func (c cached[Type]) GetMany(ctx context.Context, keys []string) ([]Type, error) {
+	if inTransaction(ctx) {
+		return c.Repository.GetMany(ctx, keys)
+	}
+	rc := getRequestCache(ctx)
+	var found = make(map[string]Type, len(keys))
+	var missing []string
+	for _, key := range keys {
+		if v, ok := rc.get(c.requestKey(key)); ok {
+			found[key] = clone(v.(Type))
+		} else if t, ok := c.lru.get(c.cacheKey(ctx, key)); ok {
+			found[key] = clone(t)
+		} else {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		loaded, err := c.Repository.GetMany(ctx, missing)
+		if err != nil {
+			return nil, err
+		}
+		c.store(ctx, loaded)
+		for _, t := range loaded {
+			found[t.Key()] = t
+		}
+	}
+	var res = make([]Type, 0, len(found))
+	for _, key := range keys {
+		if t, ok := found[key]; ok {
+			res = append(res, t)
+		}
+	}
+	return res, nil
+}
+
+// store caches the loaded records, the ones saved with a ttl only until their
+// expiry. The records are kept out of the LRU when their expiry can't be read.
+func (c cached[Type]) store(ctx context.Context, records []Type) {
+	rc := getRequestCache(ctx)
+	var ttls map[string]time.Time
+	if c.expiries != nil && len(records) > 0 {
+		var keys = make([]string, 0, len(records))
+		for _, t := range records {
+			keys = append(keys, t.Key())
+		}
+		var err error
+		if ttls, err = c.expiries.Expiries(ctx, keys...); err != nil {
+			for _, t := range records {
+				rc.set(c.requestKey(t.Key()), clone(t))
+			}
+			return
+		}
+	}
+	now := time.Now()
+	for _, t := range records {
+		rc.set(c.requestKey(t.Key()), clone(t))
+		var ttl time.Duration
+		if expiresAt, ok := ttls[t.Key()]; ok {
+			if ttl = expiresAt.Sub(now); ttl <= 0 {
+				continue
+			}
+		}
+		c.lru.set(c.cacheKey(ctx, t.Key()), clone(t), ttl)
+	}
+}
+
+func (c cached[Type]) Save(ctx context.Context, data Type) (Type, error) {
+	saved, err := c.Repository.Save(ctx, data)
+	c.invalidate(ctx, saved.Key())
+	return saved, err
+}
+
+// SaveWithTTL invalidates the record like Save, it is cached again on its next
+// read until its expiry at most
+func (c cached[Type]) SaveWithTTL(ctx context.Context, data Type, ttl time.Duration) (Type, error) {
+	saved, err := c.Repository.SaveWithTTL(ctx, data, ttl)
+	c.invalidate(ctx, saved.Key())
+	return saved, err
+}
+
+func (c cached[Type]) SaveMany(ctx context.Context, data []Type) ([]Type, error) {
+	saved, err := c.Repository.SaveMany(ctx, data)
+	for _, d := range saved {
+		c.invalidate(ctx, d.Key())
+	}
+	return saved, err
+}
+
+func (c cached[Type]) Delete(ctx context.Context, key string) error {
+	err := c.Repository.Delete(ctx, key)
+	c.invalidate(ctx, key)
+	return err
+}
+
+// DeleteFiltered drops the whole cache of the type, because the deleted keys
+// aren't known
+func (c cached[Type]) DeleteFiltered(ctx context.Context, filters ...types.Filter[Type]) (uint64, error) {
+	count, err := c.Repository.DeleteFiltered(ctx, filters...)
+	c.lru.purge()
+	afterCommit(ctx, c.lru.purge)
+	getRequestCache(ctx).invalidate(c.requestKey(""))
+	return count, err
+}
+
+// invalidate drops the record from the LRU after the commit of a Transaction
+// too, because the concurrent requests may have cached the former record
+func (c cached[Type]) invalidate(ctx context.Context, key string) {
+	cacheKey := c.cacheKey(ctx, key)
+	c.lru.invalidate(cacheKey)
+	afterCommit(ctx, func() {
+		c.lru.invalidate(cacheKey)
+	})
+	getRequestCache(ctx).invalidate(c.requestKey(""), key)
+}
+
+// cacheKey keeps the records of the tenants apart in the shared cache
+func (c cached[Type]) cacheKey(ctx context.Context, key string) string {
+	return tenant.ID(ctx) + "/" + key
+}
+
+func (c cached[Type]) requestKey(key string) string {
+	var t Type
+	return t.Name() + "-" + key
+}
+
+// clone copies the record deeply, so the cached record shares no pointer,
+// slice or map with the returned one. The unexported fields are copied
+// shallowly, like the location of a time.Time.
+func clone[Type types.Storable](t Type) Type {
+	v := reflect.ValueOf(t)
+	if !v.IsValid() {
+		return t
+	}
+	return deepCopy(v).Interface().(Type)
+}
+
+func deepCopy(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Elem().Type())
+		c.Elem().Set(deepCopy(v.Elem()))
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if f := c.Field(i); f.CanSet() {
+				f.Set(deepCopy(v.Field(i)))
+			}
+		}
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopy(v.Index(i)))
+		}
+		return c
+	case reflect.Array:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopy(v.Index(i)))
+		}
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		it := v.MapRange()
+		for it.Next() {
+			c.SetMapIndex(it.Key(), deepCopy(it.Value()))
+		}
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(deepCopy(v.Elem()))
+		return c
+	default:
+		return v
+	}
+}
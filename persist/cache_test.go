@@ -0,0 +1,191 @@
+package persist
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/borosr/realworld/lib/tenant"
+	"github.com/borosr/realworld/persist/badger"
+	"github.com/borosr/realworld/persist/types"
+	bdb "github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingRepository counts the reads reaching the backend
+type countingRepository struct {
+	Repository[*record]
+	gets int
+}
+
+func (c *countingRepository) Get(ctx context.Context, key string) (*record, error) {
+	c.gets++
+	return c.Repository.Get(ctx, key)
+}
+
+func (c *countingRepository) GetMany(ctx context.Context, keys []string) ([]*record, error) {
+	c.gets += len(keys)
+	return c.Repository.GetMany(ctx, keys)
+}
+
+func newTestCache(t *testing.T, cfg CacheConfig) (cached[*record], *countingRepository) {
+	db, err := bdb.Open(bdb.DefaultOptions("").WithInMemory(true).WithLoggingLevel(bdb.WARNING))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+	repository := badger.New[*record](db)
+	backend := &countingRepository{Repository: repository}
+	return cached[*record]{
+		Repository: backend,
+		lru:        newLRU[*record]("record", cfg),
+		expiries:   repository,
+	}, backend
+}
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+	repo, backend := newTestCache(t, CacheConfig{Size: 2, TTL: time.Minute})
+	for _, id := range []string{"a", "b", "c"} {
+		if _, err := repo.Save(ctx, &record{ID: id, Value: id, Tags: []string{id}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	first, err := repo.Get(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.Value = "modified"
+	first.Tags = append(first.Tags[:0], "modified")
+	second, err := repo.Get(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "a", second.Value, "the cached record is copied")
+	assert.Equal(t, []string{"a"}, second.Tags, "the slices are copied too")
+	assert.Equal(t, 1, backend.gets)
+
+	if _, err := repo.Save(ctx, &record{ID: "a", Value: "updated"}); err != nil {
+		t.Fatal(err)
+	}
+	updated, err := repo.Get(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "updated", updated.Value, "invalidated on save")
+	assert.Equal(t, 2, backend.gets)
+
+	got, err := repo.GetMany(ctx, []string{"a", "b", "c", "missing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, []string{got[0].ID, got[1].ID, got[2].ID})
+	assert.Equal(t, 5, backend.gets, "only the missing keys are loaded")
+
+	if err := repo.Delete(ctx, "c"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.Get(ctx, "c")
+	assert.ErrorIs(t, err, types.ErrNotFound)
+
+	stats := repo.lru.snapshot()
+	assert.Equal(t, 1, stats.Size, "a was evicted, c was deleted")
+	assert.Equal(t, uint64(2), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Evictions)
+}
+
+func TestCache_TTL(t *testing.T) {
+	ctx := context.Background()
+	repo, backend := newTestCache(t, CacheConfig{Size: 10, TTL: 10 * time.Millisecond})
+	if _, err := repo.Save(ctx, &record{ID: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := repo.Get(ctx, "a"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.Equal(t, 1, backend.gets)
+	time.Sleep(20 * time.Millisecond)
+	if _, err := repo.Get(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 2, backend.gets, "reloaded after the ttl")
+}
+
+func TestCache_RecordExpiry(t *testing.T) {
+	ctx := context.Background()
+	repo, backend := newTestCache(t, CacheConfig{Size: 10, TTL: time.Hour})
+	if _, err := repo.SaveWithTTL(ctx, &record{ID: "a"}, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := repo.Get(ctx, "a"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.Equal(t, 1, backend.gets, "cached until the expiry")
+	// Badger stores the expiry with second precision
+	time.Sleep(2 * time.Second)
+	_, err := repo.Get(ctx, "a")
+	assert.ErrorIs(t, err, types.ErrNotFound, "not served after the expiry")
+	got, err := repo.GetMany(ctx, []string{"a"})
+	assert.NoError(t, err)
+	assert.Empty(t, got)
+}
+
+func TestCache_RequestCache(t *testing.T) {
+	repo, backend := newTestCache(t, CacheConfig{})
+	if _, err := repo.Save(context.Background(), &record{ID: "a", Value: "first"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := WithRequestCache(context.Background())
+	for i := 0; i < 3; i++ {
+		if _, err := repo.Get(ctx, "a"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.Equal(t, 1, backend.gets, "loaded once per request even without the LRU")
+
+	if _, err := repo.Save(ctx, &record{ID: "a", Value: "second"}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := repo.Get(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "second", got.Value)
+
+	if _, err := repo.Get(WithRequestCache(context.Background()), "a"); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 3, backend.gets, "requests don't share their records")
+}
+
+func TestCache_Tenants(t *testing.T) {
+	repo, _ := newTestCache(t, CacheConfig{Size: 10, TTL: time.Minute})
+	base := context.Background()
+	acme := tenant.WithID(base, "acme")
+	if _, err := repo.Save(base, &record{ID: "a", Value: "default"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Save(acme, &record{ID: "a", Value: "acme"}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		got, err := repo.Get(base, "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "default", got.Value)
+		got, err = repo.Get(acme, "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "acme", got.Value)
+	}
+}
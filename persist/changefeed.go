@@ -0,0 +1,646 @@
+package persist
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/borosr/realworld/persist/types"
+)
+
+type Operation string
+
+const (
+	OperationCreate Operation = "create"
+	OperationUpdate Operation = "update"
+	OperationDelete Operation = "delete"
+)
+
+const (
+	// changeSequence allocated the offsets before the head of the log did, a
+	// log without head continues from it
+	changeSequence = "offset"
+	changeHeadKey  = "head"
+	// changeBatchSize is the number of the records written in a transaction
+	// by the batch operations outside of a Transaction
+	changeBatchSize = 100
+)
+
+// Redacted is stored in place of the secret fields
+var Redacted = json.RawMessage(`"[redacted]"`)
+
+// Event is a typed change of a record, Before is empty on create and After
+// is empty on delete
+type Event[Type types.Storable] struct {
+	Offset    uint64
+	Operation Operation
+	Name      string
+	Key       string
+	Before    Type
+	After     Type
+	Time      time.Time
+}
+
+// Change is the durable form of an event, stored in the change log. The
+// secret fields of the records are redacted.
+type Change struct {
+	Offset    uint64          `json:"offset"`
+	Operation Operation       `json:"operation"`
+	Type      string          `json:"type"`
+	RecordKey string          `json:"key"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	Time      time.Time       `json:"time"`
+}
+
+func (c *Change) Name() string {
+	return "change"
+}
+
+// Key is zero padded, so the log is iterated in offset order
+func (c *Change) Key() string {
+	return fmt.Sprintf("%020d", c.Offset)
+}
+
+func (c *Change) SetKey(_ string) {
+	// DO NOTHING
+}
+
+// changeHead is the next offset of the change log, only the appends read and
+// write it, one at a time
+type changeHead struct {
+	Next uint64 `json:"next"`
+}
+
+func (h *changeHead) Name() string {
+	return "change_head"
+}
+
+func (h *changeHead) Key() string {
+	return changeHeadKey
+}
+
+func (h *changeHead) SetKey(_ string) {
+	// DO NOTHING
+}
+
+// pendingChange is a change written in the transaction of the change, under
+// a key of its own, so the concurrent writes don't share a record. It is
+// moved to the log with its offset after the commit.
+type pendingChange struct {
+	ID     string  `json:"id"`
+	Change *Change `json:"change"`
+}
+
+func (p *pendingChange) Name() string {
+	return "change_pending"
+}
+
+func (p *pendingChange) Key() string {
+	return p.ID
+}
+
+func (p *pendingChange) SetKey(id string) {
+	p.ID = id
+}
+
+// pendingCount tells apart the pending changes written in the same
+// nanosecond
+var pendingCount uint64
+
+// pendingID orders the pending changes by the time they were written
+func pendingID() string {
+	return fmt.Sprintf("%020d-%010d", time.Now().UnixNano(), atomic.AddUint64(&pendingCount, 1))
+}
+
+// Checkpoint is the last offset processed by a consumer of the change log
+type Checkpoint struct {
+	Consumer string `json:"consumer"`
+	Offset   uint64 `json:"offset"`
+}
+
+func (c *Checkpoint) Name() string {
+	return "checkpoint"
+}
+
+func (c *Checkpoint) Key() string {
+	return c.Consumer
+}
+
+func (c *Checkpoint) SetKey(id string) {
+	c.Consumer = id
+}
+
+type Subscriber[Type types.Storable] func(ctx context.Context, e Event[Type])
+
+// Observer is called in the transaction of the change, its error rolls the
+// change back. It may be called more than once for a change, when the
+// transaction is retried.
+type Observer[Type types.Storable] func(ctx context.Context, e Event[Type]) error
+
+// changeLog stores the changes in the transactions of the changes as pending
+// ones, and appends them to the log after the commit
+type changeLog struct {
+	changes Ranged[*Change]
+	head    Repository[*changeHead]
+	pending Repository[*pendingChange]
+	begin   transactionFunc
+	// mu serializes the appends, so they never conflict on the head
+	mu sync.Mutex
+}
+
+var (
+	subscribersMu sync.RWMutex
+	subscribers   = make(map[string][]func(ctx context.Context, e any))
+	observers     = make(map[string][]func(ctx context.Context, e any) error)
+
+	defaultChangeLog *changeLog
+	changeLogMu      sync.Mutex
+)
+
+// Subscribe registers an in-process subscriber for the changes of a type,
+// the subscribers are called once for every committed change, after it is
+// appended to the log. The changes rolled back never reach them.
+func Subscribe[Type types.Storable](s Subscriber[Type]) {
+	var t Type
+	subscribersMu.Lock()
+	defer subscribersMu.Unlock()
+	subscribers[t.Name()] = append(subscribers[t.Name()], func(ctx context.Context, e any) {
+		s(ctx, e.(Event[Type]))
+	})
+}
+
+// Observe registers an observer for the changes of a type, the observers are
+// called in the transaction of the change, before the subscribers
+func Observe[Type types.Storable](o Observer[Type]) {
+	var t Type
+	subscribersMu.Lock()
+	defer subscribersMu.Unlock()
+	observers[t.Name()] = append(observers[t.Name()], func(ctx context.Context, e any) error {
+		return o(ctx, e.(Event[Type]))
+	})
+}
+
+// Changes reads the change log from the given offset, zero limit reads up to
+// its end
+func Changes(ctx context.Context, from uint64, limit int) ([]*Change, error) {
+	return getChangeLog().changes.GetRange(ctx, (&Change{Offset: from}).Key(), limit)
+}
+
+// PruneChanges removes the changes logged before the given time, the
+// consumers have to process the changes within the retention
+func PruneChanges(ctx context.Context, before time.Time) (uint64, error) {
+	cl := getChangeLog()
+	var count uint64
+	for {
+		changes, err := cl.changes.GetRange(ctx, "", changeBatchSize)
+		if err != nil {
+			return count, err
+		}
+		var expired []string
+		for _, c := range changes {
+			if !c.Time.Before(before) {
+				break
+			}
+			expired = append(expired, c.Key())
+		}
+		if len(expired) == 0 {
+			return count, nil
+		}
+		if err := transact(ctx, cl.begin, func(ctx context.Context) error {
+			for _, key := range expired {
+				if err := cl.changes.Delete(ctx, key); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return count, err
+		}
+		count += uint64(len(expired))
+		if len(expired) < len(changes) {
+			return count, nil
+		}
+	}
+}
+
+// Decode returns the typed event of a logged change
+func Decode[Type types.Storable](c *Change) (Event[Type], error) {
+	e := Event[Type]{
+		Offset:    c.Offset,
+		Operation: c.Operation,
+		Name:      c.Type,
+		Key:       c.RecordKey,
+		Time:      c.Time,
+	}
+	if e.Name != e.Before.Name() {
+		return e, fmt.Errorf("change of %s decoded as %s", c.Type, e.Before.Name())
+	}
+	if len(c.Before) != 0 {
+		if err := json.Unmarshal(c.Before, &e.Before); err != nil {
+			return e, err
+		}
+	}
+	if len(c.After) != 0 {
+		if err := json.Unmarshal(c.After, &e.After); err != nil {
+			return e, err
+		}
+	}
+	return e, nil
+}
+
+// LoadCheckpoint returns the offset the consumer has to continue from
+func LoadCheckpoint(ctx context.Context, consumer string) (uint64, error) {
+	c, err := backendRepository[*Checkpoint]().Get(ctx, consumer)
+	if errors.Is(err, types.ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return c.Offset, nil
+}
+
+func SaveCheckpoint(ctx context.Context, consumer string, offset uint64) error {
+	_, err := backendRepository[*Checkpoint]().Save(ctx, &Checkpoint{
+		Consumer: consumer,
+		Offset:   offset,
+	})
+	return err
+}
+
+func getChangeLog() *changeLog {
+	changeLogMu.Lock()
+	defer changeLogMu.Unlock()
+	if defaultChangeLog == nil {
+		changes, ok := backendRepository[*Change]().(Ranged[*Change])
+		if !ok {
+			log.Fatalf("the %s backend can't read ranges", backend)
+		}
+		defaultChangeLog = &changeLog{
+			changes: changes,
+			head:    backendRepository[*changeHead](),
+			pending: backendRepository[*pendingChange](),
+			begin:   backendTransaction,
+		}
+	}
+	return defaultChangeLog
+}
+
+// transact runs fn in the transaction of the context, or in a new one
+func (cl *changeLog) transact(ctx context.Context, fn func(ctx context.Context) error) error {
+	return transact(ctx, cl.begin, fn)
+}
+
+// append moves a committed change to the end of the log with the next
+// offset, in a transaction of its own. The appends run one at a time, so the
+// offsets have no gaps and follow the order of the appends.
+func (cl *changeLog) append(ctx context.Context, id string) (uint64, error) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	var offset uint64
+	err := cl.transact(ctx, func(ctx context.Context) error {
+		p, err := cl.pending.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		head, err := cl.head.Get(ctx, changeHeadKey)
+		if errors.Is(err, types.ErrNotFound) {
+			next, err := cl.changes.Sequence(ctx, changeSequence)
+			if err != nil {
+				return err
+			}
+			head = &changeHead{Next: next}
+		} else if err != nil {
+			return err
+		}
+		p.Change.Offset = head.Next
+		head.Next++
+		if _, err := cl.head.Save(ctx, head); err != nil {
+			return err
+		}
+		if _, err := cl.changes.Save(ctx, p.Change); err != nil {
+			return err
+		}
+		offset = p.Change.Offset
+		return cl.pending.Delete(ctx, id)
+	})
+	return offset, err
+}
+
+// appendPending appends the changes left pending by a stopped server in the
+// order they were written, they aren't delivered to the subscribers
+func (cl *changeLog) appendPending(ctx context.Context) (int, error) {
+	pending, err := cl.pending.GetFiltered(ctx)
+	if err != nil {
+		return 0, err
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].ID < pending[j].ID
+	})
+	for i, p := range pending {
+		if _, err := cl.append(ctx, p.ID); err != nil {
+			return i, err
+		}
+	}
+	return len(pending), nil
+}
+
+// changeFeed publishes the changes of the decorated repository, every change
+// is logged in the transaction of the write
+type changeFeed[Type types.Storable] struct {
+	Repository[Type]
+	log *changeLog
+}
+
+func newChangeFeed[Type types.Storable](r Repository[Type], log *changeLog) changeFeed[Type] {
+	return changeFeed[Type]{
+		Repository: r,
+		log:        log,
+	}
+}
+
+func (cf changeFeed[Type]) Save(ctx context.Context, data Type) (Type, error) {
+	return cf.save(ctx, data, cf.Repository.Save)
+}
+
+func (cf changeFeed[Type]) SaveWithTTL(ctx context.Context, data Type, ttl time.Duration) (Type, error) {
+	return cf.save(ctx, data, func(ctx context.Context, data Type) (Type, error) {
+		return cf.Repository.SaveWithTTL(ctx, data, ttl)
+	})
+}
+
+func (cf changeFeed[Type]) save(ctx context.Context, data Type, save func(ctx context.Context, data Type) (Type, error)) (Type, error) {
+	saved := data
+	err := cf.log.transact(ctx, func(ctx context.Context) error {
+		var before Type
+		operation := OperationCreate
+		if data.Key() != "" {
+			existing, err := cf.Repository.Get(ctx, data.Key())
+			if err == nil {
+				before = existing
+				operation = OperationUpdate
+			} else if !errors.Is(err, types.ErrNotFound) {
+				return err
+			}
+		}
+		var err error
+		if saved, err = save(ctx, data); err != nil {
+			return err
+		}
+		return cf.publish(ctx, Event[Type]{
+			Operation: operation,
+			Name:      saved.Name(),
+			Key:       saved.Key(),
+			Before:    before,
+			After:     saved,
+		})
+	})
+	return saved, err
+}
+
+// SaveMany publishes the changes after the whole batch is saved. Outside of a
+// Transaction the records are saved in batches of their own transactions.
+func (cf changeFeed[Type]) SaveMany(ctx context.Context, data []Type) ([]Type, error) {
+	if inTransaction(ctx) || len(data) <= changeBatchSize {
+		return data, cf.log.transact(ctx, func(ctx context.Context) error {
+			return cf.saveMany(ctx, data)
+		})
+	}
+	for start := 0; start < len(data); start += changeBatchSize {
+		end := start + changeBatchSize
+		if end > len(data) {
+			end = len(data)
+		}
+		if err := cf.log.transact(ctx, func(ctx context.Context) error {
+			return cf.saveMany(ctx, data[start:end])
+		}); err != nil {
+			return data, err
+		}
+	}
+	return data, nil
+}
+
+func (cf changeFeed[Type]) saveMany(ctx context.Context, data []Type) error {
+	var keys []string
+	for _, d := range data {
+		if d.Key() != "" {
+			keys = append(keys, d.Key())
+		}
+	}
+	existing, err := cf.Repository.GetMany(ctx, keys)
+	if err != nil {
+		return err
+	}
+	var before = make(map[string]Type, len(existing))
+	for _, e := range existing {
+		before[e.Key()] = e
+	}
+	saved, err := cf.Repository.SaveMany(ctx, data)
+	if err != nil {
+		return err
+	}
+	for _, s := range saved {
+		e := Event[Type]{
+			Operation: OperationCreate,
+			Name:      s.Name(),
+			Key:       s.Key(),
+			After:     s,
+		}
+		if b, ok := before[s.Key()]; ok {
+			e.Operation = OperationUpdate
+			e.Before = b
+		}
+		if err := cf.publish(ctx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cf changeFeed[Type]) Delete(ctx context.Context, key string) error {
+	return cf.log.transact(ctx, func(ctx context.Context) error {
+		existing, err := cf.Repository.Get(ctx, key)
+		if errors.Is(err, types.ErrNotFound) {
+			return cf.Repository.Delete(ctx, key)
+		}
+		if err != nil {
+			return err
+		}
+		if err := cf.Repository.Delete(ctx, key); err != nil {
+			return err
+		}
+		return cf.publish(ctx, Event[Type]{
+			Operation: OperationDelete,
+			Name:      existing.Name(),
+			Key:       key,
+			Before:    existing,
+		})
+	})
+}
+
+// DeleteFiltered deletes the matching records by their keys, so the published
+// events describe the records actually deleted. Outside of a Transaction the
+// records are deleted in batches of their own transactions, they are checked
+// against the filters again in them.
+func (cf changeFeed[Type]) DeleteFiltered(ctx context.Context, filters ...types.Filter[Type]) (uint64, error) {
+	if inTransaction(ctx) {
+		existing, err := cf.Repository.GetFiltered(ctx, filters...)
+		if err != nil {
+			return 0, err
+		}
+		return cf.deleteMany(ctx, existing)
+	}
+	matching, err := cf.Repository.GetFiltered(ctx, filters...)
+	if err != nil {
+		return 0, err
+	}
+	var count uint64
+	for start := 0; start < len(matching); start += changeBatchSize {
+		end := start + changeBatchSize
+		if end > len(matching) {
+			end = len(matching)
+		}
+		var keys = make([]string, 0, end-start)
+		for _, m := range matching[start:end] {
+			keys = append(keys, m.Key())
+		}
+		var deleted uint64
+		if err := cf.log.transact(ctx, func(ctx context.Context) error {
+			current, err := cf.Repository.GetMany(ctx, keys)
+			if err != nil {
+				return err
+			}
+			var existing = make([]Type, 0, len(current))
+		outer:
+			for _, c := range current {
+				for _, filter := range filters {
+					if !filter(c) {
+						continue outer
+					}
+				}
+				existing = append(existing, c)
+			}
+			deleted, err = cf.deleteMany(ctx, existing)
+			return err
+		}); err != nil {
+			return count, err
+		}
+		count += deleted
+	}
+	return count, nil
+}
+
+// deleteMany deletes the records one by one in the transaction of the context
+func (cf changeFeed[Type]) deleteMany(ctx context.Context, existing []Type) (uint64, error) {
+	var count uint64
+	for _, e := range existing {
+		if err := cf.Repository.Delete(ctx, e.Key()); err != nil {
+			return count, err
+		}
+		if err := cf.publish(ctx, Event[Type]{
+			Operation: OperationDelete,
+			Name:      e.Name(),
+			Key:       e.Key(),
+			Before:    e,
+		}); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+func (cf changeFeed[Type]) publish(ctx context.Context, e Event[Type]) error {
+	e.Time = time.Now()
+	c := Change{
+		Operation: e.Operation,
+		Type:      e.Name,
+		RecordKey: e.Key,
+		Time:      e.Time,
+	}
+	var err error
+	if e.Operation != OperationCreate {
+		if c.Before, err = marshalRedacted(e.Before); err != nil {
+			return err
+		}
+	}
+	if e.Operation != OperationDelete {
+		if c.After, err = marshalRedacted(e.After); err != nil {
+			return err
+		}
+	}
+	pending := &pendingChange{ID: pendingID(), Change: &c}
+	if _, err := cf.log.pending.Save(ctx, pending); err != nil {
+		return fmt.Errorf("change log: %w", err)
+	}
+
+	subscribersMu.RLock()
+	observed, list := observers[e.Name], subscribers[e.Name]
+	subscribersMu.RUnlock()
+	for _, o := range observed {
+		if err := o(ctx, e); err != nil {
+			return err
+		}
+	}
+	OnCommit(ctx, func(ctx context.Context) {
+		offset, err := cf.log.append(ctx, pending.ID)
+		if err != nil {
+			// the change stays pending, it is appended on the next start
+			log.Printf("change log of %s %s: %v", e.Name, e.Key, err)
+		}
+		e.Offset = offset
+		for _, s := range list {
+			notify(ctx, s, e)
+		}
+	})
+	return nil
+}
+
+// marshalRedacted returns the JSON of the record with its secret fields
+// redacted
+func marshalRedacted(record any) (json.RawMessage, error) {
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := record.(types.Secrets); !ok {
+		return raw, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	Redact(record, fields)
+	return json.Marshal(fields)
+}
+
+// Redact replaces the secret fields of the record set among its top level
+// JSON fields with Redacted
+func Redact(record any, fields map[string]json.RawMessage) {
+	s, ok := record.(types.Secrets)
+	if !ok {
+		return
+	}
+	for _, f := range s.SecretFields() {
+		if v, ok := fields[f]; ok && string(v) != `""` && string(v) != "null" {
+			fields[f] = Redacted
+		}
+	}
+}
+
+// notify keeps the failing subscribers from breaking the write path
+func notify(ctx context.Context, s func(ctx context.Context, e any), e any) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("change subscriber panic: %v", r)
+		}
+	}()
+	s(ctx, e)
+}
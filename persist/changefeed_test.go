@@ -0,0 +1,334 @@
+package persist
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/borosr/realworld/persist/badger"
+	"github.com/borosr/realworld/persist/types"
+	bdb "github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func testChangeLog(db *bdb.DB) *changeLog {
+	return &changeLog{
+		changes: badger.New[*Change](db),
+		head:    badger.New[*changeHead](db),
+		pending: badger.New[*pendingChange](db),
+		begin: func(ctx context.Context, fn func(ctx context.Context) error) error {
+			return badger.WithTransaction(ctx, db, fn)
+		},
+	}
+}
+
+func TestChangeFeed(t *testing.T) {
+	ctx := context.Background()
+	db, err := bdb.Open(bdb.DefaultOptions("").WithInMemory(true).WithLoggingLevel(bdb.WARNING))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	changeLogMu.Lock()
+	defaultChangeLog = testChangeLog(db)
+	changeLogMu.Unlock()
+	defer func() {
+		changeLogMu.Lock()
+		defaultChangeLog = nil
+		changeLogMu.Unlock()
+	}()
+
+	var events []Event[*record]
+	Subscribe[*record](func(_ context.Context, e Event[*record]) {
+		events = append(events, e)
+	})
+	defer func() {
+		subscribersMu.Lock()
+		delete(subscribers, "record")
+		subscribersMu.Unlock()
+	}()
+
+	repo := newChangeFeed[*record](badger.New[*record](db), getChangeLog())
+	if _, err := repo.Save(ctx, &record{ID: "a", Value: "first"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Save(ctx, &record{ID: "a", Value: "second"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Delete(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Delete(ctx, "missing"); err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.Equal(t, 3, len(events)) {
+		assert.Equal(t, OperationCreate, events[0].Operation)
+		assert.Nil(t, events[0].Before)
+		assert.Equal(t, "first", events[0].After.Value)
+		assert.Equal(t, OperationUpdate, events[1].Operation)
+		assert.Equal(t, "first", events[1].Before.Value)
+		assert.Equal(t, "second", events[1].After.Value)
+		assert.Equal(t, OperationDelete, events[2].Operation)
+		assert.Equal(t, "second", events[2].Before.Value)
+		assert.Nil(t, events[2].After)
+		assert.Equal(t, []uint64{0, 1, 2}, []uint64{events[0].Offset, events[1].Offset, events[2].Offset})
+	}
+
+	changes, err := Changes(ctx, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Equal(t, 2, len(changes)) {
+		e, err := Decode[*record](changes[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.True(t, events[1].Time.Equal(e.Time))
+		e.Time = events[1].Time
+		assert.Equal(t, events[1], e)
+		_, err = Decode[*Checkpoint](changes[0])
+		assert.Error(t, err)
+	}
+	changes, err = Changes(ctx, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, len(changes))
+}
+
+func TestChangeFeed_Batch(t *testing.T) {
+	ctx := context.Background()
+	db, err := bdb.Open(bdb.DefaultOptions("").WithInMemory(true).WithLoggingLevel(bdb.WARNING))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var events []Event[*record]
+	Subscribe[*record](func(_ context.Context, e Event[*record]) {
+		events = append(events, e)
+	})
+	defer func() {
+		subscribersMu.Lock()
+		delete(subscribers, "record")
+		subscribersMu.Unlock()
+	}()
+
+	repo := newChangeFeed[*record](badger.New[*record](db), testChangeLog(db))
+	if _, err := repo.Save(ctx, &record{ID: "a", Value: "first"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.SaveMany(ctx, []*record{{ID: "a", Value: "second"}, {ID: "b", Value: "new"}}); err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := repo.DeleteFiltered(ctx, func(r *record) bool {
+		return r.ID == "b"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, uint64(1), deleted)
+
+	if assert.Equal(t, 4, len(events)) {
+		assert.Equal(t, OperationUpdate, events[1].Operation)
+		assert.Equal(t, "first", events[1].Before.Value)
+		assert.Equal(t, OperationCreate, events[2].Operation)
+		assert.Equal(t, "b", events[2].Key)
+		assert.Equal(t, OperationDelete, events[3].Operation)
+		assert.Equal(t, "new", events[3].Before.Value)
+	}
+}
+
+// account has a secret, it is redacted in the change log
+type account struct {
+	ID       string `json:"id"`
+	Password string `json:"password"`
+}
+
+func (a *account) Name() string {
+	return "account"
+}
+
+func (a *account) Key() string {
+	return a.ID
+}
+
+func (a *account) SetKey(id string) {
+	a.ID = id
+}
+
+func (a *account) SecretFields() []string {
+	return []string{"password"}
+}
+
+func TestChangeFeed_Transaction(t *testing.T) {
+	ctx := context.Background()
+	db, err := bdb.Open(bdb.DefaultOptions("").WithInMemory(true).WithLoggingLevel(bdb.WARNING))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	cl := testChangeLog(db)
+	changeLogMu.Lock()
+	defaultChangeLog = cl
+	changeLogMu.Unlock()
+	defer func() {
+		changeLogMu.Lock()
+		defaultChangeLog = nil
+		changeLogMu.Unlock()
+	}()
+	records := newChangeFeed[*record](badger.New[*record](db), cl)
+	accounts := newChangeFeed[*account](badger.New[*account](db), cl)
+
+	// the offsets allocated by the sequence before are continued
+	for i := 0; i < 3; i++ {
+		if _, err := cl.changes.Sequence(ctx, changeSequence); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := accounts.Save(ctx, &account{ID: "jake", Password: "hash"}); err != nil {
+		t.Fatal(err)
+	}
+
+	failure := errors.New("failure")
+	err = transact(ctx, cl.begin, func(ctx context.Context) error {
+		if _, err := records.Save(ctx, &record{ID: "rolled-back"}); err != nil {
+			return err
+		}
+		return failure
+	})
+	assert.True(t, errors.Is(err, failure))
+
+	// the concurrent writes of different records don't conflict
+	var wg sync.WaitGroup
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := records.Save(ctx, &record{ID: strconv.Itoa(i)}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	changes, err := Changes(ctx, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Equal(t, 201, len(changes), "the rolled back change isn't logged") {
+		for i, c := range changes {
+			assert.Equal(t, uint64(i+3), c.Offset, "the offsets have no gaps")
+		}
+		assert.JSONEq(t, `{"id":"jake","password":"[redacted]"}`, string(changes[0].After))
+	}
+	pending, err := cl.pending.GetFiltered(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, pending, "the committed changes are appended")
+	changes, err = Changes(ctx, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Equal(t, 2, len(changes)) {
+		assert.Equal(t, uint64(10), changes[0].Offset)
+	}
+
+	pruned, err := PruneChanges(ctx, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, uint64(201), pruned)
+	changes, err = Changes(ctx, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, changes)
+	if _, err := records.Save(ctx, &record{ID: "after"}); err != nil {
+		t.Fatal(err)
+	}
+	changes, err = Changes(ctx, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Equal(t, 1, len(changes)) {
+		assert.Equal(t, uint64(204), changes[0].Offset, "the offsets aren't reused after pruning")
+	}
+}
+
+func TestChangeFeed_AppendPending(t *testing.T) {
+	ctx := context.Background()
+	db, err := bdb.Open(bdb.DefaultOptions("").WithInMemory(true).WithLoggingLevel(bdb.WARNING))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	cl := testChangeLog(db)
+
+	// the server stopped after the commits, before the appends
+	for _, key := range []string{"first", "second"} {
+		if _, err := cl.pending.Save(ctx, &pendingChange{
+			ID:     pendingID(),
+			Change: &Change{Operation: OperationCreate, Type: "record", RecordKey: key, Time: time.Now()},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	appended, err := cl.appendPending(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, appended)
+
+	changes, err := cl.changes.GetRange(ctx, "", 0)
+	assert.NoError(t, err)
+	if assert.Equal(t, 2, len(changes)) {
+		assert.Equal(t, "first", changes[0].RecordKey)
+		assert.Equal(t, []uint64{0, 1}, []uint64{changes[0].Offset, changes[1].Offset})
+	}
+	pending, err := cl.pending.GetFiltered(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestChangeFeed_Observer(t *testing.T) {
+	ctx := context.Background()
+	db, err := bdb.Open(bdb.DefaultOptions("").WithInMemory(true).WithLoggingLevel(bdb.WARNING))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	log := testChangeLog(db)
+	backend := badger.New[*record](db)
+	observed := badger.New[*account](db)
+
+	failing := errors.New("observer failed")
+	Observe[*record](func(ctx context.Context, e Event[*record]) error {
+		if e.After != nil && e.After.Value == "fail" {
+			return failing
+		}
+		_, err := observed.Save(ctx, &account{ID: e.Key})
+		return err
+	})
+	defer func() {
+		subscribersMu.Lock()
+		delete(observers, "record")
+		subscribersMu.Unlock()
+	}()
+
+	repo := newChangeFeed[*record](backend, log)
+	if _, err := repo.Save(ctx, &record{ID: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = observed.Get(ctx, "a")
+	assert.NoError(t, err, "the observer writes in the transaction of the change")
+
+	_, err = repo.Save(ctx, &record{ID: "b", Value: "fail"})
+	assert.ErrorIs(t, err, failing)
+	_, err = backend.Get(ctx, "b")
+	assert.ErrorIs(t, err, types.ErrNotFound, "the failing observer rolls the change back")
+	changes, err := log.changes.GetFiltered(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(changes))
+}
@@ -0,0 +1,228 @@
+package persist
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/borosr/realworld/persist/badger"
+)
+
+const (
+	exportExtension = ".ndjson"
+	sequenceFile    = "_sequences" + exportExtension
+	expiryFile      = "_expiries" + exportExtension
+)
+
+var ErrUnsupportedBackend = errors.New("not supported by the persist backend")
+
+type sequencer interface {
+	Sequences(ctx context.Context) (map[string]uint64, error)
+	SetSequence(ctx context.Context, key string, next uint64) error
+}
+
+// expirer is implemented by the backend repositories, the records saved with
+// a ttl are exported with their expiry
+type expirer interface {
+	Expiries(ctx context.Context, keys ...string) (map[string]time.Time, error)
+}
+
+type expiryLine struct {
+	Type      string    `json:"type"`
+	Key       string    `json:"key"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type sequenceLine struct {
+	Type string `json:"type"`
+	Key  string `json:"key"`
+	Next uint64 `json:"next"`
+}
+
+// Export writes the records of every registered type into the directory as
+// newline-delimited JSON, one file per Storable name, the next values of the
+// sequences and the expiries of the records saved with a ttl are written into
+// separate files
+func Export(ctx context.Context, dir string) (map[string]uint64, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	var counts = make(map[string]uint64)
+	var sequences []sequenceLine
+	var expiries []expiryLine
+	for _, e := range registered() {
+		// the expiries are read first, a record expiring meanwhile is missing
+		// from the export instead of being exported without its expiry
+		if ex, ok := e.repository.(expirer); ok {
+			values, err := ex.Expiries(ctx)
+			if err != nil {
+				return counts, fmt.Errorf("export %s: %w", e.name, err)
+			}
+			for key, expiresAt := range values {
+				expiries = append(expiries, expiryLine{Type: e.name, Key: key, ExpiresAt: expiresAt})
+			}
+		}
+		count, err := writeFile(filepath.Join(dir, e.name+exportExtension), func(w io.Writer) (uint64, error) {
+			return e.export(ctx, w)
+		})
+		if err != nil {
+			return counts, fmt.Errorf("export %s: %w", e.name, err)
+		}
+		counts[e.name] = count
+
+		if s, ok := e.repository.(sequencer); ok {
+			values, err := s.Sequences(ctx)
+			if err != nil {
+				return counts, err
+			}
+			for key, next := range values {
+				sequences = append(sequences, sequenceLine{Type: e.name, Key: key, Next: next})
+			}
+		}
+	}
+	if _, err := writeLines(filepath.Join(dir, sequenceFile), sequences); err != nil {
+		return counts, err
+	}
+	sort.Slice(expiries, func(i, j int) bool {
+		if expiries[i].Type != expiries[j].Type {
+			return expiries[i].Type < expiries[j].Type
+		}
+		return expiries[i].Key < expiries[j].Key
+	})
+	_, err := writeLines(filepath.Join(dir, expiryFile), expiries)
+	return counts, err
+}
+
+// Import loads an export created by Export, the records of the types missing
+// from the directory are left untouched. The records saved with a ttl expire
+// at the same time as they would have in the exported database, the ones
+// expired since the export are skipped.
+func Import(ctx context.Context, dir string) (map[string]uint64, error) {
+	var counts = make(map[string]uint64)
+	var byName = make(map[string]entity)
+	expiries, err := readExpiries(filepath.Join(dir, expiryFile))
+	if err != nil {
+		return counts, err
+	}
+	for _, e := range registered() {
+		byName[e.name] = e
+		f, err := os.Open(filepath.Join(dir, e.name+exportExtension))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return counts, err
+		}
+		count, err := e.load(ctx, bufio.NewReader(f), expiries[e.name])
+		f.Close()
+		if err != nil {
+			return counts, fmt.Errorf("import %s: %w", e.name, err)
+		}
+		counts[e.name] = count
+	}
+
+	f, err := os.Open(filepath.Join(dir, sequenceFile))
+	if os.IsNotExist(err) {
+		return counts, nil
+	}
+	if err != nil {
+		return counts, err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for {
+		var line sequenceLine
+		if err := dec.Decode(&line); errors.Is(err, io.EOF) {
+			return counts, nil
+		} else if err != nil {
+			return counts, err
+		}
+		s, ok := byName[line.Type].repository.(sequencer)
+		if !ok {
+			continue
+		}
+		if err := s.SetSequence(ctx, line.Key, line.Next); err != nil {
+			return counts, err
+		}
+	}
+}
+
+// readExpiries reads the expiries of the records by their type and key, the
+// exports created before the expiries were exported have none
+func readExpiries(path string) (map[string]map[string]time.Time, error) {
+	var res = make(map[string]map[string]time.Time)
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return res, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for {
+		var line expiryLine
+		if err := dec.Decode(&line); errors.Is(err, io.EOF) {
+			return res, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if res[line.Type] == nil {
+			res[line.Type] = make(map[string]time.Time)
+		}
+		res[line.Type][line.Key] = line.ExpiresAt
+	}
+}
+
+// Backup writes a consistent online backup of the database
+func Backup(w io.Writer) (uint64, error) {
+	if backend != BackendBadger {
+		return 0, fmt.Errorf("backup: %w, use export instead", ErrUnsupportedBackend)
+	}
+	return badger.Backup(w)
+}
+
+// Restore loads a backup created by Backup into an empty directory
+func Restore(dir string, r io.Reader) error {
+	if backend != BackendBadger {
+		return fmt.Errorf("restore: %w, use import instead", ErrUnsupportedBackend)
+	}
+	return badger.Restore(dir, r)
+}
+
+func writeLines[Line any](path string, lines []Line) (uint64, error) {
+	return writeFile(path, func(w io.Writer) (uint64, error) {
+		enc := json.NewEncoder(w)
+		for _, line := range lines {
+			if err := enc.Encode(line); err != nil {
+				return 0, err
+			}
+		}
+		return uint64(len(lines)), nil
+	})
+}
+
+func writeFile(path string, write func(w io.Writer) (uint64, error)) (uint64, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	w := bufio.NewWriter(f)
+	count, err := write(w)
+	if err != nil {
+		f.Close()
+		return count, err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return count, err
+	}
+	return count, f.Close()
+}
@@ -0,0 +1,178 @@
+package persist
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/borosr/realworld/lib/tenant"
+	"github.com/borosr/realworld/persist/badger"
+	"github.com/borosr/realworld/persist/sqlite"
+	bdb "github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+type record struct {
+	ID    string   `json:"id"`
+	Value string   `json:"value"`
+	Count int      `json:"count"`
+	Tags  []string `json:"tags"`
+}
+
+func (r *record) Name() string {
+	return "record"
+}
+
+func (r *record) Key() string {
+	return r.ID
+}
+
+func (r *record) SetKey(id string) {
+	r.ID = id
+}
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+	source, err := bdb.Open(bdb.DefaultOptions("").WithInMemory(true).WithLoggingLevel(bdb.WARNING))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+	records := badger.New[*record](source)
+	for _, r := range []*record{
+		{ID: "a", Value: "first", Tags: []string{"x"}},
+		{ID: "b", Value: "second", Count: 2},
+	} {
+		if _, err := records.Save(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := records.Sequence(ctx, "a"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entities = make(map[string]entity)
+	register[*record](records)
+	dir := t.TempDir()
+	counts, err := Export(ctx, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, map[string]uint64{"record": 2}, counts)
+
+	target, err := sqlite.Open(filepath.Join(t.TempDir(), "target.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+	imported, err := sqlite.New[*record](target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entities = make(map[string]entity)
+	register[*record](imported)
+	counts, err = Import(ctx, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, map[string]uint64{"record": 2}, counts)
+
+	got, err := imported.Get(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, &record{ID: "a", Value: "first", Tags: []string{"x"}}, got)
+	next, err := imported.Sequence(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, uint64(3), next, "sequences are moved with the records")
+}
+
+func TestExportImport_Tenant(t *testing.T) {
+	base := context.Background()
+	acme := tenant.WithID(base, "acme")
+	db, err := bdb.Open(bdb.DefaultOptions("").WithInMemory(true).WithLoggingLevel(bdb.WARNING))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	records := badger.New[*record](db)
+	if _, err := records.Save(base, &record{ID: "default"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := records.Save(acme, &record{ID: "acme"}); err != nil {
+		t.Fatal(err)
+	}
+	entities = make(map[string]entity)
+	register[*record](records)
+
+	dir := t.TempDir()
+	counts, err := Export(acme, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, map[string]uint64{"record": 1}, counts)
+
+	copied := tenant.WithID(base, "copy")
+	if _, err := Import(copied, dir); err != nil {
+		t.Fatal(err)
+	}
+	all, err := records.GetFiltered(copied)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Equal(t, 1, len(all)) {
+		assert.Equal(t, "acme", all[0].ID, "only the records of the exported tenant")
+	}
+}
+
+func TestExportImport_TTL(t *testing.T) {
+	ctx := context.Background()
+	source, err := bdb.Open(bdb.DefaultOptions("").WithInMemory(true).WithLoggingLevel(bdb.WARNING))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+	records := badger.New[*record](source)
+	if _, err := records.Save(ctx, &record{ID: "kept"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := records.SaveWithTTL(ctx, &record{ID: "expiring"}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	entities = make(map[string]entity)
+	register[*record](records)
+	dir := t.TempDir()
+	if _, err := Export(ctx, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	target, err := sqlite.Open(filepath.Join(t.TempDir(), "target.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+	imported, err := sqlite.New[*record](target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entities = make(map[string]entity)
+	register[*record](imported)
+	counts, err := Import(ctx, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, map[string]uint64{"record": 2}, counts)
+	expiries, err := imported.Expiries(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Contains(t, expiries, "expiring") {
+		assert.WithinDuration(t, time.Now().Add(time.Hour), expiries["expiring"], time.Minute)
+	}
+	assert.NotContains(t, expiries, "kept", "the records without ttl stay permanent")
+}
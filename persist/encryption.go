@@ -0,0 +1,24 @@
+package persist
+
+import (
+	"fmt"
+
+	"github.com/borosr/realworld/persist/badger"
+)
+
+// RotateKey replaces the master key of the closed Badger database in dir
+func RotateKey(dir string, oldKey, newKey []byte) error {
+	if backend != BackendBadger {
+		return fmt.Errorf("rotate key: %w", ErrUnsupportedBackend)
+	}
+	return badger.RotateKey(dir, oldKey, newKey)
+}
+
+// Encrypt rewrites the unencrypted Badger database of src into the empty dst
+// directory encrypted with the key
+func Encrypt(src, dst string, key []byte) error {
+	if backend != BackendBadger {
+		return fmt.Errorf("encrypt: %w", ErrUnsupportedBackend)
+	}
+	return badger.Encrypt(src, dst, key)
+}
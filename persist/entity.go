@@ -0,0 +1,109 @@
+package persist
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/borosr/realworld/persist/migration"
+	"github.com/borosr/realworld/persist/types"
+)
+
+// entity is a stored type, every type requested with Get is registered to
+// make the maintenance commands work on all the types
+type entity struct {
+	name       string
+	version    int
+	repository any
+	export     func(ctx context.Context, w io.Writer) (uint64, error)
+	// load saves the records read, the ones having an expiry are saved with
+	// the ttl left until it
+	load func(ctx context.Context, r io.Reader, expiries map[string]time.Time) (uint64, error)
+}
+
+// loadBatchSize is the number of imported records saved together
+const loadBatchSize = 1000
+
+var (
+	entitiesMu sync.Mutex
+	entities   = make(map[string]entity)
+)
+
+func register[Type types.Storable](repository Repository[Type]) {
+	var t Type
+	entitiesMu.Lock()
+	defer entitiesMu.Unlock()
+	entities[t.Name()] = entity{
+		name:       t.Name(),
+		version:    migration.Version[Type](),
+		repository: repository,
+		export: func(ctx context.Context, w io.Writer) (uint64, error) {
+			records, err := repository.GetFiltered(ctx)
+			if err != nil {
+				return 0, err
+			}
+			enc := json.NewEncoder(w)
+			for _, record := range records {
+				if err := enc.Encode(record); err != nil {
+					return 0, err
+				}
+			}
+			return uint64(len(records)), nil
+		},
+		load: func(ctx context.Context, r io.Reader, expiries map[string]time.Time) (uint64, error) {
+			var count uint64
+			var batch = make([]Type, 0, loadBatchSize)
+			flush := func() error {
+				if _, err := repository.SaveMany(ctx, batch); err != nil {
+					return err
+				}
+				count += uint64(len(batch))
+				batch = batch[:0]
+				return nil
+			}
+			dec := json.NewDecoder(r)
+			for {
+				var record Type
+				if err := dec.Decode(&record); errors.Is(err, io.EOF) {
+					return count, flush()
+				} else if err != nil {
+					return count, err
+				}
+				if expiresAt, ok := expiries[record.Key()]; ok {
+					ttl := time.Until(expiresAt)
+					if ttl <= 0 {
+						continue
+					}
+					if _, err := repository.SaveWithTTL(ctx, record, ttl); err != nil {
+						return count, err
+					}
+					count++
+					continue
+				}
+				batch = append(batch, record)
+				if len(batch) == loadBatchSize {
+					if err := flush(); err != nil {
+						return count, err
+					}
+				}
+			}
+		},
+	}
+}
+
+func registered() []entity {
+	entitiesMu.Lock()
+	defer entitiesMu.Unlock()
+	var res = make([]entity, 0, len(entities))
+	for _, e := range entities {
+		res = append(res, e)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].name < res[j].name
+	})
+	return res
+}
@@ -0,0 +1,69 @@
+package persist
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/borosr/realworld/lib/config"
+	"github.com/borosr/realworld/lib/tenant"
+
+	"github.com/borosr/realworld/persist/badger"
+	"github.com/borosr/realworld/persist/sqlite"
+)
+
+type StorageStats = badger.Stats
+
+// StartMaintenance appends the changes left pending by the last run to the
+// change log, and schedules the storage maintenance jobs of the backend and
+// the pruning of the change log
+func StartMaintenance(ctx context.Context) {
+	for _, id := range tenant.All() {
+		if n, err := getChangeLog().appendPending(tenant.WithID(ctx, id)); err != nil {
+			log.Printf("pending changes of tenant %q: %v", id, err)
+		} else if n > 0 {
+			log.Printf("appended %d pending changes of tenant %q", n, id)
+		}
+	}
+	switch backend {
+	case BackendBadger:
+		badger.StartMaintenance(ctx)
+	case BackendSQLite:
+		sqlite.StartMaintenance(ctx)
+	}
+	startChangeLogPruner(ctx)
+}
+
+// startChangeLogPruner removes the changes older than the retention of every
+// tenant periodically, zero retention keeps them
+func startChangeLogPruner(ctx context.Context) {
+	retention := config.Duration("CHANGE_LOG_RETENTION", 7*24*time.Hour)
+	if retention <= 0 {
+		return
+	}
+	interval := config.Duration("CHANGE_LOG_PRUNE_INTERVAL", time.Hour)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				for _, id := range tenant.All() {
+					if _, err := PruneChanges(tenant.WithID(ctx, id), time.Now().Add(-retention)); err != nil {
+						log.Printf("change log pruning of tenant %q: %v", id, err)
+					}
+				}
+			}
+		}
+	}()
+}
+
+func Stats() (StorageStats, error) {
+	if backend != BackendBadger {
+		return StorageStats{}, fmt.Errorf("storage stats: %w", ErrUnsupportedBackend)
+	}
+	return badger.Metrics()
+}
@@ -0,0 +1,98 @@
+package persist
+
+import (
+	"context"
+	"time"
+
+	"github.com/borosr/realworld/persist/migration"
+)
+
+type migrator interface {
+	Versions(ctx context.Context) (map[int]uint64, error)
+	Upgrade(ctx context.Context) (uint64, error)
+}
+
+type MigrationReport struct {
+	Type    string `json:"type"`
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+	// Records is the number of records stored before the migration
+	Records uint64 `json:"records"`
+	// Applied reports whether the migration was executed eagerly before
+	Applied bool `json:"applied"`
+}
+
+// Migrate rewrites the records of the registered types stored with an older
+// schema version and records the applied migrations, in dry-run mode it only
+// reports the records each migration would touch
+func Migrate(ctx context.Context, dryRun bool) ([]MigrationReport, error) {
+	appliedRepository := Get[*migration.Applied]()
+	var reports []MigrationReport
+	for _, e := range registered() {
+		m, ok := e.repository.(migrator)
+		if !ok {
+			continue
+		}
+		versions, err := m.Versions(ctx)
+		if err != nil {
+			return reports, err
+		}
+		applied, err := appliedRepository.GetFiltered(ctx, func(a *migration.Applied) bool {
+			return a.Type == e.name
+		})
+		if err != nil {
+			return reports, err
+		}
+		var appliedVersions = make(map[int]bool)
+		for _, a := range applied {
+			appliedVersions[a.Version] = true
+		}
+
+		var pending []MigrationReport
+		var outdated uint64
+		for version, count := range versions {
+			if version < e.version {
+				outdated += count
+			}
+		}
+		for _, mig := range migration.List(e.name) {
+			if mig.Version > e.version {
+				continue
+			}
+			report := MigrationReport{
+				Type:    e.name,
+				Version: mig.Version,
+				Name:    mig.Name,
+				Applied: appliedVersions[mig.Version],
+			}
+			for version, count := range versions {
+				if version < mig.Version {
+					report.Records += count
+				}
+			}
+			reports = append(reports, report)
+			if !report.Applied {
+				pending = append(pending, report)
+			}
+		}
+		if dryRun || (len(pending) == 0 && outdated == 0) {
+			continue
+		}
+
+		if _, err := m.Upgrade(ctx); err != nil {
+			return reports, err
+		}
+		for _, p := range pending {
+			if _, err := appliedRepository.Save(ctx, &migration.Applied{
+				Type:      p.Type,
+				Version:   p.Version,
+				Migration: p.Name,
+				Records:   p.Records,
+				AppliedAt: time.Now(),
+			}); err != nil {
+				return reports, err
+			}
+		}
+	}
+	return reports, nil
+}
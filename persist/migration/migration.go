@@ -0,0 +1,140 @@
+// Package migration upgrades the stored records when the schema of a
+// Storable changes. The records are upgraded lazily when they are read, and
+// can be rewritten eagerly with the migrate command.
+package migration
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/borosr/realworld/persist/types"
+)
+
+// Versioned types report the schema version of their records, the types
+// without it are at version zero. The version has to be incremented with
+// every registered migration.
+type Versioned interface {
+	SchemaVersion() int
+}
+
+type Func func(doc map[string]any) error
+
+type Migration struct {
+	// Type is the Storable name of the upgraded records
+	Type string
+	// Version is the schema version after the migration ran
+	Version int
+	Name    string
+	Up      Func
+}
+
+// Applied records an eagerly executed migration in the database
+type Applied struct {
+	Type      string    `json:"type"`
+	Version   int       `json:"version"`
+	Migration string    `json:"migration"`
+	Records   uint64    `json:"records"`
+	AppliedAt time.Time `json:"appliedAt"`
+}
+
+func (a *Applied) Name() string {
+	return "migration"
+}
+
+func (a *Applied) Key() string {
+	return fmt.Sprintf("%s-%05d", a.Type, a.Version)
+}
+
+func (a *Applied) SetKey(_ string) {
+	// DO NOTHING
+}
+
+var (
+	mu         sync.RWMutex
+	migrations = make(map[string][]Migration)
+)
+
+func Register(m Migration) {
+	if m.Version < 1 {
+		panic(fmt.Sprintf("invalid %s migration version: %d", m.Type, m.Version))
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	list := append(migrations[m.Type], m)
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Version < list[j].Version
+	})
+	migrations[m.Type] = list
+}
+
+// Rename returns a migration moving a field of the document
+func Rename(from, to string) Func {
+	return func(doc map[string]any) error {
+		if value, ok := doc[from]; ok {
+			doc[to] = value
+			delete(doc, from)
+		}
+		return nil
+	}
+}
+
+func List(typeName string) []Migration {
+	mu.RLock()
+	defer mu.RUnlock()
+	return append([]Migration(nil), migrations[typeName]...)
+}
+
+// Version returns the current schema version of the type
+func Version[Type types.Storable]() int {
+	var t Type
+	if v, ok := (interface{})(t).(Versioned); ok {
+		return v.SchemaVersion()
+	}
+	return 0
+}
+
+// Upgrade runs the migrations of the type from the stored version up to the
+// target version on the document
+func Upgrade(typeName string, from, to int, doc map[string]any) error {
+	version := from
+	for _, m := range List(typeName) {
+		if m.Version <= from || m.Version > to {
+			continue
+		}
+		if m.Version != version+1 {
+			return fmt.Errorf("missing %s migration to version %d", typeName, version+1)
+		}
+		if err := m.Up(doc); err != nil {
+			return fmt.Errorf("%s migration %s: %w", typeName, m.Name, err)
+		}
+		version = m.Version
+	}
+	if version != to {
+		return fmt.Errorf("missing %s migration to version %d", typeName, version+1)
+	}
+	return nil
+}
+
+// Decode unmarshals a stored record into t, the records stored with an older
+// schema version are decoded as a document and upgraded first
+func Decode[Type types.Storable](t *Type, version int, unmarshal func(v any) error) error {
+	target := Version[Type]()
+	if version >= target {
+		return unmarshal(t)
+	}
+	var doc map[string]any
+	if err := unmarshal(&doc); err != nil {
+		return err
+	}
+	if err := Upgrade((*t).Name(), version, target, doc); err != nil {
+		return err
+	}
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, t)
+}
@@ -0,0 +1,85 @@
+package migration
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type post struct {
+	Headline string `json:"headline"`
+}
+
+func (p *post) Name() string {
+	return "post"
+}
+
+func (p *post) Key() string {
+	return p.Headline
+}
+
+func (p *post) SetKey(id string) {
+	p.Headline = id
+}
+
+func (p *post) SchemaVersion() int {
+	return 2
+}
+
+func init() {
+	Register(Migration{
+		Type:    "post",
+		Version: 2,
+		Name:    "rename-subject",
+		Up:      Rename("subject", "headline"),
+	})
+	Register(Migration{
+		Type:    "post",
+		Version: 1,
+		Name:    "rename-title",
+		Up:      Rename("title", "subject"),
+	})
+}
+
+func TestUpgrade(t *testing.T) {
+	doc := map[string]any{"title": "hello"}
+	if err := Upgrade("post", 0, 2, doc); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, map[string]any{"headline": "hello"}, doc)
+}
+
+func TestUpgrade_Partial(t *testing.T) {
+	doc := map[string]any{"subject": "hello"}
+	if err := Upgrade("post", 1, 2, doc); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, map[string]any{"headline": "hello"}, doc)
+}
+
+func TestUpgrade_Missing(t *testing.T) {
+	assert.Error(t, Upgrade("post", 0, 3, map[string]any{}))
+	assert.Error(t, Upgrade("unknown", 0, 1, map[string]any{}))
+}
+
+func TestDecode(t *testing.T) {
+	unmarshal := func(v any) error {
+		switch target := v.(type) {
+		case *map[string]any:
+			*target = map[string]any{"title": "hello"}
+			return nil
+		}
+		t.Fatalf("unexpected target: %T", v)
+		return nil
+	}
+	var p *post
+	if err := Decode(&p, 0, unmarshal); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "hello", p.Headline)
+}
+
+func TestVersion(t *testing.T) {
+	assert.Equal(t, 2, Version[*post]())
+	assert.Equal(t, 0, Version[*Applied]())
+}
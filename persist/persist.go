@@ -2,20 +2,92 @@ package persist
 
 import (
 	"context"
+	"log"
+	"time"
 
+	"github.com/borosr/realworld/lib/config"
 	"github.com/borosr/realworld/persist/badger"
+	"github.com/borosr/realworld/persist/sqlite"
 	"github.com/borosr/realworld/persist/types"
 )
 
+const (
+	BackendBadger = "badger"
+	BackendSQLite = "sqlite"
+)
+
+var backend = config.String("PERSIST_BACKEND", BackendBadger)
+
 type Repository[Type types.Storable] interface {
 	Save(ctx context.Context, data Type) (Type, error)
+	// SaveWithTTL saves a record that expires after the ttl, the expired
+	// records are invisible to the reads
+	SaveWithTTL(ctx context.Context, data Type, ttl time.Duration) (Type, error)
+	// SaveMany saves the records in as few transactions as the backend allows
+	SaveMany(ctx context.Context, data []Type) ([]Type, error)
 	Get(ctx context.Context, key string) (Type, error)
+	// GetMany returns the existing records of the keys in the order of the
+	// keys, the missing ones are skipped
+	GetMany(ctx context.Context, keys []string) ([]Type, error)
 	GetFiltered(ctx context.Context, filters ...types.Filter[Type]) ([]Type, error)
 	CountFiltered(ctx context.Context, filters ...types.Filter[Type]) (uint64, error)
 	Delete(ctx context.Context, key string) error
+	// DeleteFiltered deletes the records matching the filters and returns
+	// their number
+	DeleteFiltered(ctx context.Context, filters ...types.Filter[Type]) (uint64, error)
 	Sequence(ctx context.Context, key string) (uint64, error)
+	// DeleteSequence removes a sequence, it starts from zero again
+	DeleteSequence(ctx context.Context, key string) error
 }
 
+// Get returns the repository of the type, the changes made through it are
+// published to the change feed, the Tombstoned types are soft deleted and the
+// reads by key are cached
 func Get[Type types.Storable]() Repository[Type] {
-	return badger.Get[Type]()
+	backend := backendRepository[Type]()
+	register[Type](backend)
+	var repository = backend
+	if isTombstoned[Type]() {
+		repository = softDelete[Type]{Repository: backend}
+	}
+	return newCached[Type](newChangeFeed[Type](repository, getChangeLog()), backend)
+}
+
+// GetLog returns the repository of an append-only log or a derived index, the
+// records written through it are neither published to the change feed nor
+// cached
+func GetLog[Type types.Storable]() Repository[Type] {
+	repository := backendRepository[Type]()
+	register[Type](repository)
+	return repository
+}
+
+// Ranged repositories read the records in key order from a key on, or in
+// reverse key order before a key
+type Ranged[Type types.Storable] interface {
+	Repository[Type]
+	GetRange(ctx context.Context, from string, limit int) ([]Type, error)
+	GetRangeBefore(ctx context.Context, before string, limit int) ([]Type, error)
+}
+
+// GetRangedLog returns the repository of an append-only log like GetLog,
+// which can be read in pages by the keys
+func GetRangedLog[Type types.Storable]() Ranged[Type] {
+	repository, ok := GetLog[Type]().(Ranged[Type])
+	if !ok {
+		log.Fatalf("the %s backend can't read ranges", backend)
+	}
+	return repository
+}
+
+func backendRepository[Type types.Storable]() Repository[Type] {
+	switch backend {
+	case BackendBadger:
+		return badger.Get[Type]()
+	case BackendSQLite:
+		return sqlite.Get[Type]()
+	default:
+		log.Fatalf("unknown persist backend: %s", backend)
+		return nil
+	}
 }
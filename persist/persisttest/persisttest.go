@@ -0,0 +1,710 @@
+// Package persisttest contains the conformance tests every persist backend
+// has to pass.
+package persisttest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/borosr/realworld/lib/tenant"
+	"github.com/borosr/realworld/persist"
+	"github.com/borosr/realworld/persist/migration"
+	"github.com/borosr/realworld/persist/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type Record struct {
+	ID    string   `json:"id"`
+	Value string   `json:"value"`
+	Count int      `json:"count"`
+	Tags  []string `json:"tags"`
+}
+
+func (r *Record) Name() string {
+	return "record"
+}
+
+func (r *Record) Key() string {
+	return r.ID
+}
+
+func (r *Record) SetKey(id string) {
+	r.ID = id
+}
+
+// Note shares its name prefix with Record to verify that the backends keep
+// the types apart
+type Note struct {
+	ID   string `json:"id"`
+	Text string `json:"text"`
+}
+
+func (n *Note) Name() string {
+	return "recordnote"
+}
+
+func (n *Note) Key() string {
+	return n.ID
+}
+
+func (n *Note) SetKey(id string) {
+	n.ID = id
+}
+
+// LegacyRecord and MigratedRecord are two schema versions of the same type
+type LegacyRecord struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+func (r *LegacyRecord) Name() string {
+	return "migrated"
+}
+
+func (r *LegacyRecord) Key() string {
+	return r.ID
+}
+
+func (r *LegacyRecord) SetKey(id string) {
+	r.ID = id
+}
+
+type MigratedRecord struct {
+	ID    string `json:"id"`
+	Value string `json:"value"`
+}
+
+func (r *MigratedRecord) Name() string {
+	return "migrated"
+}
+
+func (r *MigratedRecord) Key() string {
+	return r.ID
+}
+
+func (r *MigratedRecord) SetKey(id string) {
+	r.ID = id
+}
+
+func (r *MigratedRecord) SchemaVersion() int {
+	return 1
+}
+
+// LegacyPair and Pair are two schema versions of a type whose key is built
+// from its fields, the separator of the parts changed
+type LegacyPair struct {
+	Left  string `json:"left"`
+	Right string `json:"right"`
+}
+
+func (p *LegacyPair) Name() string {
+	return "pair"
+}
+
+func (p *LegacyPair) Key() string {
+	return p.Left + "-" + p.Right
+}
+
+func (p *LegacyPair) SetKey(_ string) {
+	// DO NOTHING
+}
+
+type Pair struct {
+	Left  string `json:"left"`
+	Right string `json:"right"`
+}
+
+func (p *Pair) Name() string {
+	return "pair"
+}
+
+func (p *Pair) Key() string {
+	return p.Left + "/" + p.Right
+}
+
+func (p *Pair) SetKey(_ string) {
+	// DO NOTHING
+}
+
+func (p *Pair) SchemaVersion() int {
+	return 1
+}
+
+func init() {
+	migration.Register(migration.Migration{
+		Type:    "migrated",
+		Version: 1,
+		Name:    "rename-title",
+		Up:      migration.Rename("title", "value"),
+	})
+	migration.Register(migration.Migration{
+		Type:    "pair",
+		Version: 1,
+		Name:    "slash-key",
+		Up: func(doc map[string]any) error {
+			return nil
+		},
+	})
+}
+
+// Repositories are expected to share the same, empty database
+type Repositories struct {
+	Records  persist.Repository[*Record]
+	Notes    persist.Repository[*Note]
+	Legacy   persist.Repository[*LegacyRecord]
+	Migrated persist.Repository[*MigratedRecord]
+	// LegacyPairs and Pairs store the same records with different keys
+	LegacyPairs persist.Repository[*LegacyPair]
+	Pairs       persist.Repository[*Pair]
+	// Transaction runs fn in one transaction of the database
+	Transaction func(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type sequencer interface {
+	Sequences(ctx context.Context) (map[string]uint64, error)
+	SetSequence(ctx context.Context, key string, next uint64) error
+}
+
+type ranger interface {
+	GetRange(ctx context.Context, from string, limit int) ([]*Record, error)
+	GetRangeBefore(ctx context.Context, before string, limit int) ([]*Record, error)
+}
+
+type migrator interface {
+	Versions(ctx context.Context) (map[int]uint64, error)
+	Upgrade(ctx context.Context) (uint64, error)
+}
+
+type Factory func(t *testing.T) Repositories
+
+func Run(t *testing.T, open Factory) {
+	t.Run("save_generates_key", func(t *testing.T) {
+		repo := open(t).Records
+		saved, err := repo.Save(context.Background(), &Record{Value: "generated"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.NotEmpty(t, saved.ID)
+		got, err := repo.Get(context.Background(), saved.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "generated", got.Value)
+	})
+	t.Run("save_overwrites", func(t *testing.T) {
+		repo := open(t).Records
+		ctx := context.Background()
+		if _, err := repo.Save(ctx, &Record{ID: "a", Value: "first", Tags: []string{"x"}}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.Save(ctx, &Record{ID: "a", Value: "second"}); err != nil {
+			t.Fatal(err)
+		}
+		got, err := repo.Get(ctx, "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "second", got.Value)
+		assert.Empty(t, got.Tags)
+		count, err := repo.CountFiltered(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, uint64(1), count)
+	})
+	t.Run("get_missing", func(t *testing.T) {
+		repo := open(t).Records
+		_, err := repo.Get(context.Background(), "missing")
+		assert.True(t, errors.Is(err, types.ErrNotFound), "expected ErrNotFound, got %v", err)
+	})
+	t.Run("get_filtered", func(t *testing.T) {
+		repo := open(t).Records
+		ctx := context.Background()
+		for _, r := range []*Record{
+			{ID: "a", Value: "even", Count: 2},
+			{ID: "b", Value: "odd", Count: 3},
+			{ID: "c", Value: "even", Count: 4},
+		} {
+			if _, err := repo.Save(ctx, r); err != nil {
+				t.Fatal(err)
+			}
+		}
+		all, err := repo.GetFiltered(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []string{"a", "b", "c"}, keys(all))
+		even, err := repo.GetFiltered(ctx, func(r *Record) bool {
+			return r.Value == "even"
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []string{"a", "c"}, keys(even))
+		combined, err := repo.GetFiltered(ctx, func(r *Record) bool {
+			return r.Value == "even"
+		}, func(r *Record) bool {
+			return r.Count > 2
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []string{"c"}, keys(combined))
+		count, err := repo.CountFiltered(ctx, func(r *Record) bool {
+			return r.Value == "even"
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, uint64(2), count)
+	})
+	t.Run("get_range", func(t *testing.T) {
+		repos := open(t)
+		ctx := context.Background()
+		for _, id := range []string{"03", "01", "04", "02"} {
+			if _, err := repos.Records.Save(ctx, &Record{ID: id}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := repos.Notes.Save(ctx, &Note{ID: "05"}); err != nil {
+			t.Fatal(err)
+		}
+		r, ok := repos.Records.(ranger)
+		if !ok {
+			t.Fatal("repository doesn't support ranges")
+		}
+		got, err := r.GetRange(ctx, "02", 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []string{"02", "03"}, keys(got))
+		got, err = r.GetRange(ctx, "025", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []string{"03", "04"}, keys(got), "up to the end of the type")
+		got, err = r.GetRangeBefore(ctx, "", 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []string{"04", "03", "02"}, orderedKeys(got), "from the end of the type")
+		got, err = r.GetRangeBefore(ctx, "03", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []string{"02", "01"}, orderedKeys(got), "before the key")
+	})
+	t.Run("types_are_separated", func(t *testing.T) {
+		repos := open(t)
+		records, notes := repos.Records, repos.Notes
+		ctx := context.Background()
+		if _, err := records.Save(ctx, &Record{ID: "a"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := notes.Save(ctx, &Note{ID: "a", Text: "note"}); err != nil {
+			t.Fatal(err)
+		}
+		count, err := records.CountFiltered(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, uint64(1), count)
+		all, err := records.GetFiltered(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []string{"a"}, keys(all))
+	})
+	t.Run("delete", func(t *testing.T) {
+		repo := open(t).Records
+		ctx := context.Background()
+		if _, err := repo.Save(ctx, &Record{ID: "a"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.Delete(ctx, "a"); err != nil {
+			t.Fatal(err)
+		}
+		_, err := repo.Get(ctx, "a")
+		assert.True(t, errors.Is(err, types.ErrNotFound), "expected ErrNotFound, got %v", err)
+		assert.NoError(t, repo.Delete(ctx, "a"), "deleting a missing key is not an error")
+	})
+	t.Run("batch", func(t *testing.T) {
+		repo := open(t).Records
+		ctx := context.Background()
+		var records []*Record
+		for i := 0; i < 1500; i++ {
+			records = append(records, &Record{ID: fmt.Sprintf("%04d", i), Count: i})
+		}
+		records = append(records, &Record{Value: "generated"})
+		saved, err := repo.SaveMany(ctx, records)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.NotEmpty(t, saved[len(saved)-1].ID)
+		count, err := repo.CountFiltered(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, uint64(1501), count)
+
+		var keys = []string{"0003", "missing", "0001"}
+		for i := 100; i < 1300; i++ {
+			keys = append(keys, fmt.Sprintf("%04d", i))
+		}
+		got, err := repo.GetMany(ctx, keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if assert.Equal(t, 1202, len(got)) {
+			assert.Equal(t, "0003", got[0].ID, "kept the order of the keys")
+			assert.Equal(t, "0001", got[1].ID)
+			assert.Equal(t, 1299, got[len(got)-1].Count)
+		}
+		empty, err := repo.GetMany(ctx, nil)
+		assert.NoError(t, err)
+		assert.Empty(t, empty)
+
+		deleted, err := repo.DeleteFiltered(ctx, func(r *Record) bool {
+			return r.Count%2 == 1
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, uint64(750), deleted)
+		count, err = repo.CountFiltered(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, uint64(751), count)
+		_, err = repo.Get(ctx, "0001")
+		assert.True(t, errors.Is(err, types.ErrNotFound), "expected ErrNotFound, got %v", err)
+	})
+	t.Run("tenants", func(t *testing.T) {
+		repo := open(t).Records
+		base := context.Background()
+		acme := tenant.WithID(base, "acme")
+		other := tenant.WithID(base, "other")
+		for _, ctx := range []context.Context{base, acme, other} {
+			if _, err := repo.Save(ctx, &Record{ID: "shared", Value: "tenant " + tenant.ID(ctx)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := repo.Save(acme, &Record{ID: "only-acme"}); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := repo.Get(acme, "shared")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "tenant acme", got.Value)
+		got, err = repo.Get(base, "shared")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "tenant ", got.Value)
+		_, err = repo.Get(other, "only-acme")
+		assert.True(t, errors.Is(err, types.ErrNotFound), "expected ErrNotFound, got %v", err)
+		many, err := repo.GetMany(other, []string{"shared", "only-acme"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []string{"shared"}, keys(many))
+
+		all, err := repo.GetFiltered(acme)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []string{"only-acme", "shared"}, keys(all))
+		all, err = repo.GetFiltered(base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []string{"shared"}, keys(all))
+
+		for i := uint64(0); i < 2; i++ {
+			next, err := repo.Sequence(acme, "seq")
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, i, next)
+		}
+		next, err := repo.Sequence(other, "seq")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, uint64(0), next, "the sequences are per tenant")
+		values, err := repo.(sequencer).Sequences(base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Empty(t, values)
+
+		deleted, err := repo.DeleteFiltered(other)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, uint64(1), deleted)
+		if err := repo.Delete(acme, "shared"); err != nil {
+			t.Fatal(err)
+		}
+		count, err := repo.CountFiltered(base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, uint64(1), count, "the default tenant is untouched")
+		count, err = repo.CountFiltered(acme)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, uint64(1), count)
+	})
+	t.Run("ttl", func(t *testing.T) {
+		repo := open(t).Records
+		ctx := context.Background()
+		if _, err := repo.SaveWithTTL(ctx, &Record{ID: "short"}, time.Second); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.SaveWithTTL(ctx, &Record{ID: "long"}, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.SaveWithTTL(ctx, &Record{ID: "renewed"}, time.Second); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.Save(ctx, &Record{ID: "renewed"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.Save(ctx, &Record{ID: "plain"}); err != nil {
+			t.Fatal(err)
+		}
+		_, err := repo.Get(ctx, "short")
+		assert.NoError(t, err, "visible before the expiry")
+
+		// Badger stores the expiry with second precision
+		time.Sleep(2 * time.Second)
+
+		_, err = repo.Get(ctx, "short")
+		assert.True(t, errors.Is(err, types.ErrNotFound), "expected ErrNotFound, got %v", err)
+		all, err := repo.GetFiltered(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []string{"long", "plain", "renewed"}, keys(all))
+		count, err := repo.CountFiltered(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, uint64(3), count)
+	})
+	t.Run("sequence", func(t *testing.T) {
+		repo := open(t).Records
+		ctx := context.Background()
+		for i := uint64(0); i < 3; i++ {
+			next, err := repo.Sequence(ctx, "first")
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, i, next)
+		}
+		next, err := repo.Sequence(ctx, "second")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, uint64(0), next)
+
+		s, ok := repo.(sequencer)
+		if !ok {
+			t.Fatal("repository doesn't expose its sequences")
+		}
+		values, err := s.Sequences(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, map[string]uint64{"first": 3, "second": 1}, values)
+		if err := s.SetSequence(ctx, "third", 10); err != nil {
+			t.Fatal(err)
+		}
+		next, err = repo.Sequence(ctx, "third")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, uint64(10), next)
+		if err := repo.DeleteSequence(ctx, "first"); err != nil {
+			t.Fatal(err)
+		}
+		next, err = repo.Sequence(ctx, "first")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, uint64(0), next, "a deleted sequence starts again")
+		assert.NoError(t, repo.DeleteSequence(ctx, "missing"))
+	})
+	t.Run("transaction", func(t *testing.T) {
+		repos := open(t)
+		records, notes := repos.Records, repos.Notes
+		ctx := context.Background()
+		if _, err := records.SaveMany(ctx, []*Record{{ID: "kept"}, {ID: "deleted"}}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := records.Sequence(ctx, "seq"); err != nil {
+			t.Fatal(err)
+		}
+		err := repos.Transaction(ctx, func(ctx context.Context) error {
+			if _, err := records.Save(ctx, &Record{ID: "new", Value: "new"}); err != nil {
+				return err
+			}
+			if _, err := notes.SaveMany(ctx, []*Note{{ID: "a"}, {ID: "b"}}); err != nil {
+				return err
+			}
+			got, err := records.Get(ctx, "new")
+			if err != nil {
+				return err
+			}
+			assert.Equal(t, "new", got.Value, "the writes are visible in the transaction")
+			if _, err := records.DeleteFiltered(ctx, func(r *Record) bool {
+				return r.ID == "deleted"
+			}); err != nil {
+				return err
+			}
+			count, err := records.CountFiltered(ctx)
+			if err != nil {
+				return err
+			}
+			assert.Equal(t, uint64(2), count)
+			return records.DeleteSequence(ctx, "seq")
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		all, err := records.GetFiltered(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []string{"kept", "new"}, keys(all), "committed")
+		next, err := records.Sequence(ctx, "seq")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, uint64(0), next)
+
+		failure := errors.New("failure")
+		err = repos.Transaction(ctx, func(ctx context.Context) error {
+			if _, err := records.Save(ctx, &Record{ID: "discarded"}); err != nil {
+				return err
+			}
+			if err := records.Delete(ctx, "kept"); err != nil {
+				return err
+			}
+			if _, err := notes.DeleteFiltered(ctx); err != nil {
+				return err
+			}
+			return failure
+		})
+		assert.True(t, errors.Is(err, failure), "expected the error of the transaction, got %v", err)
+		all, err = records.GetFiltered(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []string{"kept", "new"}, keys(all), "rolled back")
+		count, err := notes.CountFiltered(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, uint64(2), count)
+	})
+	t.Run("migration", func(t *testing.T) {
+		repos := open(t)
+		ctx := context.Background()
+		if _, err := repos.Legacy.Save(ctx, &LegacyRecord{ID: "a", Title: "old"}); err != nil {
+			t.Fatal(err)
+		}
+		got, err := repos.Migrated.Get(ctx, "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "old", got.Value, "upgraded lazily on read")
+		all, err := repos.Migrated.GetFiltered(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if assert.Equal(t, 1, len(all)) {
+			assert.Equal(t, "old", all[0].Value)
+		}
+
+		m, ok := repos.Migrated.(migrator)
+		if !ok {
+			t.Fatal("repository doesn't support migrations")
+		}
+		versions, err := m.Versions(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, map[int]uint64{0: 1}, versions)
+		upgraded, err := m.Upgrade(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, uint64(1), upgraded)
+		versions, err = m.Versions(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, map[int]uint64{1: 1}, versions)
+		got, err = repos.Migrated.Get(ctx, "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "old", got.Value)
+	})
+	t.Run("migration_moves_key", func(t *testing.T) {
+		repos := open(t)
+		ctx := context.Background()
+		if _, err := repos.LegacyPairs.Save(ctx, &LegacyPair{Left: "go", Right: "tips-jake"}); err != nil {
+			t.Fatal(err)
+		}
+		_, err := repos.Pairs.Get(ctx, "go/tips-jake")
+		assert.True(t, errors.Is(err, types.ErrNotFound), "expected ErrNotFound before the upgrade, got %v", err)
+
+		m, ok := repos.Pairs.(migrator)
+		if !ok {
+			t.Fatal("repository doesn't support migrations")
+		}
+		upgraded, err := m.Upgrade(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, uint64(1), upgraded)
+		got, err := repos.Pairs.Get(ctx, "go/tips-jake")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, Pair{Left: "go", Right: "tips-jake"}, *got)
+		all, err := repos.Pairs.GetFiltered(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []string{"go/tips-jake"}, keys(all), "the old key is deleted")
+	})
+}
+
+// orderedKeys returns the keys in the order of the records
+func orderedKeys[Type types.Storable](records []Type) []string {
+	var res = make([]string, 0, len(records))
+	for _, r := range records {
+		res = append(res, r.Key())
+	}
+	return res
+}
+
+func keys[Type types.Storable](records []Type) []string {
+	var res = make([]string, 0, len(records))
+	for _, r := range records {
+		res = append(res, r.Key())
+	}
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,188 @@
+package persist
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/borosr/realworld/persist/types"
+)
+
+var ErrNotDeleted = errors.New("record is not deleted")
+
+// Trash manages the soft deleted records of a Tombstoned type
+type Trash[Type types.Storable] interface {
+	// GetFiltered returns the deleted records
+	GetFiltered(ctx context.Context, filters ...types.Filter[Type]) ([]Type, error)
+	// Get returns a deleted record
+	Get(ctx context.Context, key string) (Type, error)
+	Restore(ctx context.Context, key string) (Type, error)
+	// Purge removes the records deleted before the given time permanently
+	Purge(ctx context.Context, deletedBefore time.Time) (uint64, error)
+	// Remove removes the matching records permanently, deleted or not
+	Remove(ctx context.Context, filters ...types.Filter[Type]) (uint64, error)
+	// SaveMany rewrites deleted records, they stay deleted. It fails with
+	// ErrNotDeleted when a record isn't deleted.
+	SaveMany(ctx context.Context, records []Type) ([]Type, error)
+}
+
+func isTombstoned[Type types.Storable]() bool {
+	var t Type
+	_, ok := (interface{})(t).(types.Tombstoned)
+	return ok
+}
+
+func deletionTime[Type types.Storable](t Type) *time.Time {
+	return (interface{})(t).(types.Tombstoned).DeletionTime()
+}
+
+func notDeleted[Type types.Storable](t Type) bool {
+	return deletionTime(t) == nil
+}
+
+func deleted[Type types.Storable](t Type) bool {
+	return deletionTime(t) != nil
+}
+
+// softDelete hides the tombstoned records of the decorated repository
+type softDelete[Type types.Storable] struct {
+	Repository[Type]
+}
+
+func (sd softDelete[Type]) Get(ctx context.Context, key string) (Type, error) {
+	t, err := sd.Repository.Get(ctx, key)
+	if err != nil {
+		return t, err
+	}
+	if deleted(t) {
+		var empty Type
+		return empty, types.ErrNotFound
+	}
+	return t, nil
+}
+
+func (sd softDelete[Type]) GetMany(ctx context.Context, keys []string) ([]Type, error) {
+	records, err := sd.Repository.GetMany(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	var res = make([]Type, 0, len(records))
+	for _, t := range records {
+		if notDeleted(t) {
+			res = append(res, t)
+		}
+	}
+	return res, nil
+}
+
+func (sd softDelete[Type]) GetFiltered(ctx context.Context, filters ...types.Filter[Type]) ([]Type, error) {
+	return sd.Repository.GetFiltered(ctx, append([]types.Filter[Type]{notDeleted[Type]}, filters...)...)
+}
+
+func (sd softDelete[Type]) CountFiltered(ctx context.Context, filters ...types.Filter[Type]) (uint64, error) {
+	return sd.Repository.CountFiltered(ctx, append([]types.Filter[Type]{notDeleted[Type]}, filters...)...)
+}
+
+func (sd softDelete[Type]) Delete(ctx context.Context, key string) error {
+	t, err := sd.Get(ctx, key)
+	if errors.Is(err, types.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	(interface{})(t).(types.Tombstoned).SetDeletionTime(&now)
+	_, err = sd.Repository.Save(ctx, t)
+	return err
+}
+
+// DeleteFiltered marks the matching records as deleted in a single batch
+func (sd softDelete[Type]) DeleteFiltered(ctx context.Context, filters ...types.Filter[Type]) (uint64, error) {
+	records, err := sd.GetFiltered(ctx, filters...)
+	if err != nil {
+		return 0, err
+	}
+	if len(records) == 0 {
+		return 0, nil
+	}
+	now := time.Now()
+	for _, t := range records {
+		(interface{})(t).(types.Tombstoned).SetDeletionTime(&now)
+	}
+	if _, err := sd.Repository.SaveMany(ctx, records); err != nil {
+		return 0, err
+	}
+	return uint64(len(records)), nil
+}
+
+type trash[Type types.Storable] struct {
+	// repository restores the records, so the restore is published as a
+	// change
+	repository Repository[Type]
+	// permanent removes the records, the removals are published as well
+	permanent Repository[Type]
+	backend   Repository[Type]
+}
+
+// GetTrash returns the trash of a Tombstoned type
+func GetTrash[Type types.Storable]() Trash[Type] {
+	if !isTombstoned[Type]() {
+		var t Type
+		panic(fmt.Sprintf("%s is not soft deleted", t.Name()))
+	}
+	backend := backendRepository[Type]()
+	return trash[Type]{
+		repository: Get[Type](),
+		permanent:  newCached[Type](newChangeFeed[Type](backend, getChangeLog()), backend),
+		backend:    backend,
+	}
+}
+
+func (tr trash[Type]) GetFiltered(ctx context.Context, filters ...types.Filter[Type]) ([]Type, error) {
+	return tr.backend.GetFiltered(ctx, append([]types.Filter[Type]{deleted[Type]}, filters...)...)
+}
+
+func (tr trash[Type]) Get(ctx context.Context, key string) (Type, error) {
+	t, err := tr.backend.Get(ctx, key)
+	if err != nil {
+		return t, err
+	}
+	if !deleted(t) {
+		var empty Type
+		return empty, ErrNotDeleted
+	}
+	return t, nil
+}
+
+func (tr trash[Type]) Restore(ctx context.Context, key string) (Type, error) {
+	t, err := tr.Get(ctx, key)
+	if err != nil {
+		return t, err
+	}
+	(interface{})(t).(types.Tombstoned).SetDeletionTime(nil)
+	return tr.repository.Save(ctx, t)
+}
+
+// Purge removes the records through the change feed and the cache like
+// Remove, so the removals are published and no purged record is cached
+func (tr trash[Type]) Purge(ctx context.Context, deletedBefore time.Time) (uint64, error) {
+	return tr.permanent.DeleteFiltered(ctx, func(t Type) bool {
+		deletedAt := deletionTime(t)
+		return deletedAt != nil && deletedAt.Before(deletedBefore)
+	})
+}
+
+func (tr trash[Type]) Remove(ctx context.Context, filters ...types.Filter[Type]) (uint64, error) {
+	return tr.permanent.DeleteFiltered(ctx, filters...)
+}
+
+func (tr trash[Type]) SaveMany(ctx context.Context, records []Type) ([]Type, error) {
+	for _, t := range records {
+		if !deleted(t) {
+			return nil, ErrNotDeleted
+		}
+	}
+	return tr.permanent.SaveMany(ctx, records)
+}
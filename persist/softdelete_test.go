@@ -0,0 +1,126 @@
+package persist
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/borosr/realworld/persist/badger"
+	"github.com/borosr/realworld/persist/types"
+	bdb "github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+type tombstonedRecord struct {
+	ID        string     `json:"id"`
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+}
+
+func (r *tombstonedRecord) Key() string {
+	return r.ID
+}
+
+func (r *tombstonedRecord) SetKey(id string) {
+	r.ID = id
+}
+
+func (r *tombstonedRecord) Name() string {
+	return "tombstonedrecord"
+}
+
+func (r *tombstonedRecord) DeletionTime() *time.Time {
+	return r.DeletedAt
+}
+
+func (r *tombstonedRecord) SetDeletionTime(t *time.Time) {
+	r.DeletedAt = t
+}
+
+func TestSoftDelete(t *testing.T) {
+	ctx := context.Background()
+	db, err := bdb.Open(bdb.DefaultOptions("").WithInMemory(true).WithLoggingLevel(bdb.WARNING))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	backend := badger.New[*tombstonedRecord](db)
+	repo := softDelete[*tombstonedRecord]{Repository: backend}
+	log := testChangeLog(db)
+	tr := trash[*tombstonedRecord]{
+		repository: repo,
+		permanent:  newChangeFeed[*tombstonedRecord](backend, log),
+		backend:    backend,
+	}
+
+	for _, id := range []string{"a", "b"} {
+		if _, err := repo.Save(ctx, &tombstonedRecord{ID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.Delete(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = repo.Get(ctx, "a")
+	assert.True(t, errors.Is(err, types.ErrNotFound))
+	visible, err := repo.GetFiltered(ctx)
+	if assert.NoError(t, err) && assert.Equal(t, 1, len(visible)) {
+		assert.Equal(t, "b", visible[0].ID)
+	}
+	count, err := repo.CountFiltered(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), count)
+
+	deleted, err := tr.GetFiltered(ctx)
+	if assert.NoError(t, err) && assert.Equal(t, 1, len(deleted)) {
+		assert.Equal(t, "a", deleted[0].ID)
+		assert.NotNil(t, deleted[0].DeletedAt)
+	}
+	_, err = tr.Get(ctx, "b")
+	assert.ErrorIs(t, err, ErrNotDeleted)
+
+	restored, err := tr.Restore(ctx, "a")
+	if assert.NoError(t, err) {
+		assert.Nil(t, restored.DeletedAt)
+	}
+	_, err = repo.Get(ctx, "a")
+	assert.NoError(t, err)
+
+	if err := repo.Delete(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+	purged, err := tr.Purge(ctx, time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), purged)
+	purged, err = tr.Purge(ctx, time.Now().Add(time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), purged)
+	_, err = backend.Get(ctx, "b")
+	assert.True(t, errors.Is(err, types.ErrNotFound))
+	// the purge is published like the other removals
+	changes, err := log.changes.GetFiltered(ctx)
+	if assert.NoError(t, err) && assert.Equal(t, 1, len(changes)) {
+		assert.Equal(t, OperationDelete, changes[0].Operation)
+		assert.Equal(t, "b", changes[0].RecordKey)
+	}
+
+	deletedCount, err := repo.DeleteFiltered(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), deletedCount)
+	visible, err = repo.GetMany(ctx, []string{"a"})
+	assert.NoError(t, err)
+	assert.Empty(t, visible)
+	tombstoned, err := tr.Get(ctx, "a")
+	if assert.NoError(t, err) {
+		assert.NotNil(t, tombstoned.DeletedAt)
+	}
+
+	_, err = tr.SaveMany(ctx, []*tombstonedRecord{{ID: "c"}})
+	assert.ErrorIs(t, err, ErrNotDeleted)
+	_, err = tr.SaveMany(ctx, []*tombstonedRecord{tombstoned})
+	assert.NoError(t, err)
+	_, err = tr.Get(ctx, "a")
+	assert.NoError(t, err, "rewritten in the trash")
+}
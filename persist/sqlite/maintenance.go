@@ -0,0 +1,103 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/borosr/realworld/lib/config"
+)
+
+var (
+	tablesMu sync.Mutex
+	tables   = make(map[*sql.DB]map[string]struct{})
+)
+
+// registerTable collects the tables prepared by the repositories, so they are
+// created once per process
+func registerTable(db *sql.DB, table string) {
+	tablesMu.Lock()
+	defer tablesMu.Unlock()
+	if tables[db] == nil {
+		tables[db] = make(map[string]struct{})
+	}
+	tables[db][table] = struct{}{}
+}
+
+func tableRegistered(db *sql.DB, table string) bool {
+	tablesMu.Lock()
+	defer tablesMu.Unlock()
+	_, ok := tables[db][table]
+	return ok
+}
+
+// recordTables lists the tables with an expiry column in the database, the
+// tables of the tenants are created on their first use, so after a restart
+// they exist before any repository registers them
+func recordTables(ctx context.Context, db *sql.DB) ([]string, error) {
+	rows, err := db.QueryContext(ctx, `SELECT m.name FROM sqlite_master m, pragma_table_info(m.name) c
+		WHERE m.type = 'table' AND c.name = 'expires_at'`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		res = append(res, quote(name))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+// StartMaintenance deletes the expired rows periodically until the context
+// is cancelled
+func StartMaintenance(ctx context.Context) {
+	getDB()
+	interval := config.Duration("SQLITE_EXPIRY_INTERVAL", 10*time.Minute)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := DeleteExpired(ctx, db); err != nil {
+					log.Printf("sqlite expiry: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// DeleteExpired removes the expired rows of every record table of the db
+func DeleteExpired(ctx context.Context, db *sql.DB) (int64, error) {
+	var count int64
+	tables, err := recordTables(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+	for _, table := range tables {
+		res, err := db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE expires_at <= ?`, table), now())
+		if err != nil {
+			return count, fmt.Errorf("%s: %w", table, err)
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return count, err
+		}
+		count += affected
+	}
+	return count, nil
+}
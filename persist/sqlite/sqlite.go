@@ -0,0 +1,597 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/borosr/realworld/lib/config"
+	"github.com/borosr/realworld/lib/tenant"
+	"github.com/borosr/realworld/persist/migration"
+	"github.com/borosr/realworld/persist/types"
+	"github.com/rs/xid"
+	_ "modernc.org/sqlite"
+)
+
+const sequenceTable = "sequence"
+const separator = "-"
+const tenantPrefix = "tenant"
+
+// maxParameters stays below the default SQLITE_MAX_VARIABLE_NUMBER of the
+// older SQLite versions
+const maxParameters = 999
+
+var db *sql.DB
+var mutex sync.Mutex
+
+type Repository[Type types.Storable] struct {
+	db *sql.DB
+}
+
+func Get[Type types.Storable]() Repository[Type] {
+	getDB()
+	r, err := New[Type](db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return r
+}
+
+// New prepares the table of the given type, one table is created for each
+// Storable name with the key as primary key and the record as a JSON document.
+// The tables of the tenants are created on their first use.
+func New[Type types.Storable](db *sql.DB) (Repository[Type], error) {
+	r := Repository[Type]{
+		db: db,
+	}
+	if _, err := r.table(context.Background()); err != nil {
+		return r, err
+	}
+	if _, err := db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		name  TEXT PRIMARY KEY,
+		value INTEGER NOT NULL
+	)`, quote(sequenceTable))); err != nil {
+		return r, err
+	}
+	return r, nil
+}
+
+// table returns the table of the type in the tenant of the context, the
+// tables of the tenants are named <tenant>.<name>
+func (r Repository[Type]) table(ctx context.Context) (string, error) {
+	var t Type
+	name := t.Name()
+	if id := tenant.ID(ctx); id != "" {
+		name = id + "." + name
+	}
+	table := quote(name)
+	if tableRegistered(r.db, table) {
+		return table, nil
+	}
+	if _, err := r.conn(ctx).ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		key        TEXT PRIMARY KEY,
+		data       TEXT NOT NULL,
+		version    INTEGER NOT NULL DEFAULT 0,
+		expires_at INTEGER
+	)`, table)); err != nil {
+		return table, err
+	}
+	if err := r.addColumn(ctx, table, "version INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return table, err
+	}
+	if err := r.addColumn(ctx, table, "expires_at INTEGER"); err != nil {
+		return table, err
+	}
+	// a table created in a transaction is gone when the transaction is
+	// rolled back, so it is registered on its first use outside of one
+	if _, ok := r.tx(ctx); !ok {
+		registerTable(r.db, table)
+	}
+	return table, nil
+}
+
+// sequenceName prefixes the sequences of the tenants the same way as the
+// Badger keys
+func (r Repository[Type]) sequenceName(ctx context.Context, key string) string {
+	var t Type
+	parts := []string{t.Name(), key}
+	if id := tenant.ID(ctx); id != "" {
+		parts = append([]string{tenantPrefix, id}, parts...)
+	}
+	return strings.Join(parts, separator)
+}
+
+// Open opens the database file and limits the pool to a single connection,
+// because SQLite serializes the writers anyway
+func Open(path string) (*sql.DB, error) {
+	conn, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	conn.SetMaxOpenConns(1)
+	if err := conn.Ping(); err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+func getDB() {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if db == nil {
+		var err error
+		db, err = Open(config.String("SQLITE_PATH", "/tmp/realworld.db"))
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func (r Repository[Type]) Save(ctx context.Context, data Type) (Type, error) {
+	return r.SaveWithTTL(ctx, data, 0)
+}
+
+// SaveWithTTL stores the expiry in the expires_at column, the reads skip the
+// expired rows until the maintenance deletes them
+func (r Repository[Type]) SaveWithTTL(ctx context.Context, data Type, ttl time.Duration) (Type, error) {
+	if data.Key() == "" {
+		data.SetKey(xid.New().String())
+	}
+	rawData, err := json.Marshal(data)
+	if err != nil {
+		return data, err
+	}
+	var expiresAt sql.NullInt64
+	if ttl > 0 {
+		expiresAt = sql.NullInt64{Int64: time.Now().Add(ttl).UnixNano(), Valid: true}
+	}
+	table, err := r.table(ctx)
+	if err != nil {
+		return data, err
+	}
+	if _, err := r.conn(ctx).ExecContext(ctx, upsert(table), data.Key(), string(rawData), migration.Version[Type](), expiresAt); err != nil {
+		return data, err
+	}
+	return data, nil
+}
+
+// SaveMany saves the records in one transaction
+func (r Repository[Type]) SaveMany(ctx context.Context, data []Type) ([]Type, error) {
+	table, err := r.table(ctx)
+	if err != nil {
+		return data, err
+	}
+	return data, r.batch(ctx, func(tx *sql.Tx) error {
+		stmt, err := tx.PrepareContext(ctx, upsert(table))
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, d := range data {
+			if d.Key() == "" {
+				d.SetKey(xid.New().String())
+			}
+			rawData, err := json.Marshal(d)
+			if err != nil {
+				return err
+			}
+			if _, err := stmt.ExecContext(ctx, d.Key(), string(rawData), migration.Version[Type](), nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func upsert(table string) string {
+	return fmt.Sprintf(`INSERT INTO %s (key, data, version, expires_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET data = excluded.data, version = excluded.version, expires_at = excluded.expires_at`, table)
+}
+
+func (r Repository[Type]) Get(ctx context.Context, key string) (Type, error) {
+	var t Type
+	var rec record
+	table, err := r.table(ctx)
+	if err != nil {
+		return t, err
+	}
+	err = r.conn(ctx).QueryRowContext(ctx, fmt.Sprintf(`SELECT data, version FROM %s WHERE key = ? AND %s`, table, notExpired), key, now()).
+		Scan(&rec.data, &rec.version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return t, types.ErrNotFound
+	}
+	if err != nil {
+		return t, err
+	}
+	if err := decodeRecord(rec, &t); err != nil {
+		return t, err
+	}
+	return t, nil
+}
+
+// GetMany queries the keys in chunks to stay below SQLite's limit on the
+// number of parameters
+func (r Repository[Type]) GetMany(ctx context.Context, keys []string) ([]Type, error) {
+	var byKey = make(map[string]record, len(keys))
+	for start := 0; start < len(keys); start += maxParameters {
+		end := start + maxParameters
+		if end > len(keys) {
+			end = len(keys)
+		}
+		var args = make([]any, 0, end-start)
+		for _, key := range keys[start:end] {
+			args = append(args, key)
+		}
+		records, err := r.load(ctx, "key IN (?"+strings.Repeat(", ?", len(args)-1)+")", args...)
+		if err != nil {
+			return nil, err
+		}
+		for _, rec := range records {
+			byKey[rec.key] = rec
+		}
+	}
+	var res = make([]Type, 0, len(byKey))
+	for _, key := range keys {
+		rec, ok := byKey[key]
+		if !ok {
+			continue
+		}
+		var t Type
+		if err := decodeRecord(rec, &t); err != nil {
+			return nil, err
+		}
+		res = append(res, t)
+	}
+	return res, nil
+}
+
+func (r Repository[Type]) GetFiltered(ctx context.Context, filters ...types.Filter[Type]) ([]Type, error) {
+	var res = make([]Type, 0)
+	if err := r.scan(ctx, filters, func(t Type) {
+		res = append(res, t)
+	}); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// GetRange returns at most limit records in key order, starting from the
+// first key not before from, zero limit returns all of them
+func (r Repository[Type]) GetRange(ctx context.Context, from string, limit int) ([]Type, error) {
+	records, err := r.loadLimit(ctx, "key >= ?", limit, from)
+	if err != nil {
+		return nil, err
+	}
+	var res = make([]Type, 0, len(records))
+	for _, rec := range records {
+		var t Type
+		if err := decodeRecord(rec, &t); err != nil {
+			continue
+		}
+		res = append(res, t)
+	}
+	return res, nil
+}
+
+// GetRangeBefore returns at most limit records in reverse key order, starting
+// from the last key before the given one, an empty before starts from the
+// last key of the type
+func (r Repository[Type]) GetRangeBefore(ctx context.Context, before string, limit int) ([]Type, error) {
+	where, args := "", []any(nil)
+	if before != "" {
+		where, args = "key < ?", []any{before}
+	}
+	records, err := r.loadOrdered(ctx, where, "key DESC", limit, args...)
+	if err != nil {
+		return nil, err
+	}
+	var res = make([]Type, 0, len(records))
+	for _, rec := range records {
+		var t Type
+		if err := decodeRecord(rec, &t); err != nil {
+			continue
+		}
+		res = append(res, t)
+	}
+	return res, nil
+}
+
+func (r Repository[Type]) CountFiltered(ctx context.Context, filters ...types.Filter[Type]) (uint64, error) {
+	var count uint64
+	if err := r.scan(ctx, filters, func(_ Type) {
+		count++
+	}); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (r Repository[Type]) Delete(ctx context.Context, key string) error {
+	table, err := r.table(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = r.conn(ctx).ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE key = ?`, table), key)
+	return err
+}
+
+// DeleteFiltered deletes the matching records in one transaction
+func (r Repository[Type]) DeleteFiltered(ctx context.Context, filters ...types.Filter[Type]) (uint64, error) {
+	var keys []string
+	if err := r.scan(ctx, filters, func(t Type) {
+		keys = append(keys, t.Key())
+	}); err != nil {
+		return 0, err
+	}
+	table, err := r.table(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if err := r.batch(ctx, func(tx *sql.Tx) error {
+		stmt, err := tx.PrepareContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE key = ?`, table))
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, key := range keys {
+			if _, err := stmt.ExecContext(ctx, key); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	return uint64(len(keys)), nil
+}
+
+// Sequence returns the next value of the sequence starting from zero, the
+// same way as the Badger sequences do
+func (r Repository[Type]) Sequence(ctx context.Context, key string) (uint64, error) {
+	var next uint64
+	if err := r.conn(ctx).QueryRowContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s (name, value) VALUES (?, 1) ON CONFLICT (name) DO UPDATE SET value = value + 1 RETURNING value - 1`,
+		quote(sequenceTable)), r.sequenceName(ctx, key)).
+		Scan(&next); err != nil {
+		return 0, err
+	}
+	return next, nil
+}
+
+// DeleteSequence removes a sequence, it starts from zero again on its next
+// use
+func (r Repository[Type]) DeleteSequence(ctx context.Context, key string) error {
+	_, err := r.conn(ctx).ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE name = ?`, quote(sequenceTable)),
+		r.sequenceName(ctx, key))
+	return err
+}
+
+// scan loads the documents before running the filters, so a filter can use
+// the database as well without waiting for the only connection
+func (r Repository[Type]) scan(ctx context.Context, filters []types.Filter[Type], collect func(t Type)) error {
+	records, err := r.load(ctx, "")
+	if err != nil {
+		return err
+	}
+outer:
+	for _, rec := range records {
+		var t Type
+		if err := decodeRecord(rec, &t); err != nil {
+			continue
+		}
+		for _, filter := range filters {
+			if ok := filter(t); !ok {
+				continue outer
+			}
+		}
+		collect(t)
+	}
+	return nil
+}
+
+func (r Repository[Type]) load(ctx context.Context, where string, args ...any) ([]record, error) {
+	return r.loadLimit(ctx, where, 0, args...)
+}
+
+// loadLimit loads at most limit records in key order, zero limit loads all
+func (r Repository[Type]) loadLimit(ctx context.Context, where string, limit int, args ...any) ([]record, error) {
+	return r.loadOrdered(ctx, where, "key", limit, args...)
+}
+
+func (r Repository[Type]) loadOrdered(ctx context.Context, where, order string, limit int, args ...any) ([]record, error) {
+	table, err := r.table(ctx)
+	if err != nil {
+		return nil, err
+	}
+	query := fmt.Sprintf(`SELECT key, data, version FROM %s WHERE %s`, table, notExpired)
+	if where != "" {
+		query += " AND " + where
+	}
+	query += " ORDER BY " + order
+	args = append([]any{now()}, args...)
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+	rows, err := r.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var records []record
+	for rows.Next() {
+		var rec record
+		if err := rows.Scan(&rec.key, &rec.data, &rec.version); err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+	return records, rows.Err()
+}
+
+// Sequences returns the next values of the sequences of the type
+func (r Repository[Type]) Sequences(ctx context.Context) (map[string]uint64, error) {
+	prefix := r.sequenceName(ctx, "")
+	rows, err := r.conn(ctx).QueryContext(ctx, fmt.Sprintf(`SELECT name, value FROM %s WHERE substr(name, 1, ?) = ?`,
+		quote(sequenceTable)), len(prefix), prefix)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res = make(map[string]uint64)
+	for rows.Next() {
+		var name string
+		var next uint64
+		if err := rows.Scan(&name, &next); err != nil {
+			return nil, err
+		}
+		res[strings.TrimPrefix(name, prefix)] = next
+	}
+	return res, rows.Err()
+}
+
+// SetSequence sets the next value of a sequence, it is used to restore the
+// sequences of imported records
+func (r Repository[Type]) SetSequence(ctx context.Context, key string, next uint64) error {
+	_, err := r.conn(ctx).ExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s (name, value) VALUES (?, ?) ON CONFLICT (name) DO UPDATE SET value = excluded.value`,
+		quote(sequenceTable)), r.sequenceName(ctx, key), next)
+	return err
+}
+
+// Expiries returns the expiry of the records saved with a ttl among the
+// records of the keys, or among all the records of the type without keys
+func (r Repository[Type]) Expiries(ctx context.Context, keys ...string) (map[string]time.Time, error) {
+	table, err := r.table(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var res = make(map[string]time.Time)
+	query := func(where string, args ...any) error {
+		rows, err := r.conn(ctx).QueryContext(ctx, fmt.Sprintf(`SELECT key, expires_at FROM %s WHERE expires_at IS NOT NULL AND %s%s`,
+			table, notExpired, where), append([]any{now()}, args...)...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var key string
+			var expiresAt int64
+			if err := rows.Scan(&key, &expiresAt); err != nil {
+				return err
+			}
+			res[key] = time.Unix(0, expiresAt)
+		}
+		return rows.Err()
+	}
+	if len(keys) == 0 {
+		return res, query("")
+	}
+	for start := 0; start < len(keys); start += maxParameters - 1 {
+		end := start + maxParameters - 1
+		if end > len(keys) {
+			end = len(keys)
+		}
+		var args = make([]any, 0, end-start)
+		for _, key := range keys[start:end] {
+			args = append(args, key)
+		}
+		if err := query(" AND key IN (?"+strings.Repeat(", ?", len(args)-1)+")", args...); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// Versions counts the records by their stored schema version
+func (r Repository[Type]) Versions(ctx context.Context) (map[int]uint64, error) {
+	table, err := r.table(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.conn(ctx).QueryContext(ctx, fmt.Sprintf(`SELECT version, COUNT(*) FROM %s WHERE %s GROUP BY version`, table, notExpired), now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res = make(map[int]uint64)
+	for rows.Next() {
+		var version int
+		var count uint64
+		if err := rows.Scan(&version, &count); err != nil {
+			return nil, err
+		}
+		res[version] = count
+	}
+	return res, rows.Err()
+}
+
+// Upgrade rewrites the records stored with an older schema version
+func (r Repository[Type]) Upgrade(ctx context.Context) (uint64, error) {
+	table, err := r.table(ctx)
+	if err != nil {
+		return 0, err
+	}
+	records, err := r.load(ctx, "version < ?", migration.Version[Type]())
+	if err != nil {
+		return 0, err
+	}
+	var count uint64
+	for _, rec := range records {
+		var t Type
+		if err := decodeRecord(rec, &t); err != nil {
+			return count, err
+		}
+		rawData, err := json.Marshal(t)
+		if err != nil {
+			return count, err
+		}
+		// the records whose key changed with the schema are moved, replacing
+		// a record saved with the new key meanwhile
+		if _, err := r.conn(ctx).ExecContext(ctx, fmt.Sprintf(`UPDATE OR REPLACE %s SET key = ?, data = ?, version = ? WHERE key = ? AND version = ?`, table),
+			t.Key(), string(rawData), migration.Version[Type](), rec.key, rec.version); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// addColumn extends the tables created by an earlier version
+func (r Repository[Type]) addColumn(ctx context.Context, table, definition string) error {
+	_, err := r.conn(ctx).ExecContext(ctx, fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s`, table, definition))
+	if err != nil && strings.Contains(err.Error(), "duplicate column name") {
+		return nil
+	}
+	return err
+}
+
+// notExpired is the condition of the visible rows, it takes the current
+// time as parameter
+const notExpired = "(expires_at IS NULL OR expires_at > ?)"
+
+func now() int64 {
+	return time.Now().UnixNano()
+}
+
+type record struct {
+	key     string
+	data    string
+	version int
+}
+
+func decodeRecord[Type types.Storable](rec record, t *Type) error {
+	return migration.Decode(t, rec.version, func(v any) error {
+		return json.Unmarshal([]byte(rec.data), v)
+	})
+}
+
+func quote(identifier string) string {
+	return `"` + strings.ReplaceAll(identifier, `"`, `""`) + `"`
+}
@@ -0,0 +1,105 @@
+package sqlite_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/borosr/realworld/lib/tenant"
+	"github.com/borosr/realworld/persist/persisttest"
+	"github.com/borosr/realworld/persist/sqlite"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository(t *testing.T) {
+	persisttest.Run(t, func(t *testing.T) persisttest.Repositories {
+		db, err := sqlite.Open(filepath.Join(t.TempDir(), "test.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			db.Close()
+		})
+		records, err := sqlite.New[*persisttest.Record](db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		notes, err := sqlite.New[*persisttest.Note](db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		legacy, err := sqlite.New[*persisttest.LegacyRecord](db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		migrated, err := sqlite.New[*persisttest.MigratedRecord](db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		legacyPairs, err := sqlite.New[*persisttest.LegacyPair](db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pairs, err := sqlite.New[*persisttest.Pair](db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return persisttest.Repositories{
+			Records:     records,
+			Notes:       notes,
+			Legacy:      legacy,
+			Migrated:    migrated,
+			LegacyPairs: legacyPairs,
+			Pairs:       pairs,
+			Transaction: func(ctx context.Context, fn func(ctx context.Context) error) error {
+				return sqlite.WithTransaction(ctx, db, fn)
+			},
+		}
+	})
+}
+
+func TestDeleteExpired(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := sqlite.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := sqlite.New[*persisttest.Record](db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acme := tenant.WithID(ctx, "acme")
+	for _, ctx := range []context.Context{ctx, acme} {
+		if _, err := records.SaveWithTTL(ctx, &persisttest.Record{ID: "expired"}, time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := records.Save(ctx, &persisttest.Record{ID: "kept"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	// the tables of the tenants are swept after a restart before their use
+	db, err = sqlite.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	deleted, err := sqlite.DeleteExpired(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, int64(2), deleted)
+	for _, table := range []string{`"record"`, `"acme.record"`} {
+		var rows int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM ` + table).Scan(&rows); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, 1, rows, table)
+	}
+}
@@ -0,0 +1,82 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+)
+
+type transactionKey struct{}
+
+type transaction struct {
+	db *sql.DB
+	tx *sql.Tx
+}
+
+// querier is implemented by both the database and its transactions
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Transaction runs fn in one transaction of the database, the repositories
+// use it with the context passed to fn
+func Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	getDB()
+	return WithTransaction(ctx, db, fn)
+}
+
+// Detach returns the context without its transaction, the repositories
+// write in transactions of their own with it
+func Detach(ctx context.Context) context.Context {
+	return context.WithValue(ctx, transactionKey{}, nil)
+}
+
+// WithTransaction runs fn in one transaction of the given database, the
+// transaction is committed when fn returns nil and rolled back otherwise
+func WithTransaction(ctx context.Context, db *sql.DB, fn func(ctx context.Context) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(context.WithValue(ctx, transactionKey{}, transaction{db: db, tx: tx})); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// tx returns the transaction of the context started on the database of the
+// repository
+func (r Repository[Type]) tx(ctx context.Context) (*sql.Tx, bool) {
+	t, ok := ctx.Value(transactionKey{}).(transaction)
+	if !ok || t.db != r.db {
+		return nil, false
+	}
+	return t.tx, true
+}
+
+// conn returns the transaction of the context, the pool has a single
+// connection, so the statements outside of it would wait for its end
+func (r Repository[Type]) conn(ctx context.Context) querier {
+	if tx, ok := r.tx(ctx); ok {
+		return tx
+	}
+	return r.db
+}
+
+// batch runs fn in the transaction of the context, or in a new one
+func (r Repository[Type]) batch(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	if tx, ok := r.tx(ctx); ok {
+		return fn(tx)
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
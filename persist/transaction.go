@@ -0,0 +1,102 @@
+package persist
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/borosr/realworld/persist/badger"
+	"github.com/borosr/realworld/persist/sqlite"
+)
+
+type transactionKey struct{}
+
+// transaction collects the work to do after the commit
+type transaction struct {
+	committed []func()
+}
+
+// Transaction runs fn in one transaction of the backend: the writes made
+// through the repositories with the context of fn are committed together when
+// fn returns nil and discarded otherwise. The observers of the changes are
+// called in the transaction, so their writes are part of it, the subscribers
+// after the commit. A Transaction
+// started with the context of another one joins it. A transaction failing on
+// the concurrent write of a record it read is retried, so fn may run more
+// than once.
+func Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return transact(ctx, backendTransaction, fn)
+}
+
+type transactionFunc func(ctx context.Context, fn func(ctx context.Context) error) error
+
+func backendTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	switch backend {
+	case BackendBadger:
+		return badger.Transaction(ctx, fn)
+	case BackendSQLite:
+		return sqlite.Transaction(ctx, fn)
+	default:
+		log.Fatalf("unknown persist backend: %s", backend)
+		return nil
+	}
+}
+
+// maxAttempts limits the runs of a transaction failing on conflicts
+const maxAttempts = 10
+
+func transact(ctx context.Context, begin transactionFunc, fn func(ctx context.Context) error) error {
+	if inTransaction(ctx) {
+		return fn(ctx)
+	}
+	for attempt := 1; ; attempt++ {
+		tx := &transaction{}
+		err := begin(context.WithValue(ctx, transactionKey{}, tx), fn)
+		if badger.IsConflict(err) && attempt < maxAttempts {
+			// the jitter keeps the conflicting transactions apart
+			time.Sleep(time.Duration(rand.Int63n(int64(attempt) * int64(time.Millisecond))))
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for _, f := range tx.committed {
+			f()
+		}
+		return nil
+	}
+}
+
+func inTransaction(ctx context.Context) bool {
+	_, ok := ctx.Value(transactionKey{}).(*transaction)
+	return ok
+}
+
+// afterCommit runs f after the commit of the Transaction of the context, it
+// is dropped when there is no transaction or it is rolled back
+func afterCommit(ctx context.Context, f func()) {
+	if tx, ok := ctx.Value(transactionKey{}).(*transaction); ok {
+		tx.committed = append(tx.committed, f)
+	}
+}
+
+// OnCommit runs f after the commit of the Transaction of the context, or
+// right away outside of a transaction. The subscribers keeping derived state
+// in memory use it, so a rolled back change never reaches that state. The
+// context passed to f has no transaction, the writes of f start their own.
+func OnCommit(ctx context.Context, f func(ctx context.Context)) {
+	if inTransaction(ctx) {
+		afterCommit(ctx, func() {
+			f(detach(ctx))
+		})
+		return
+	}
+	f(ctx)
+}
+
+// detach returns the context without the transactions of the backends
+func detach(ctx context.Context) context.Context {
+	ctx = context.WithValue(ctx, transactionKey{}, nil)
+	return sqlite.Detach(badger.Detach(ctx))
+}
@@ -0,0 +1,99 @@
+package persist
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/borosr/realworld/persist/badger"
+	bdb "github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransaction_Cache(t *testing.T) {
+	db, err := bdb.Open(bdb.DefaultOptions("").WithInMemory(true).WithLoggingLevel(bdb.WARNING))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	begin := func(ctx context.Context, fn func(ctx context.Context) error) error {
+		return badger.WithTransaction(ctx, db, fn)
+	}
+	repo := cached[*record]{
+		Repository: badger.New[*record](db),
+		lru:        newLRU[*record]("record", CacheConfig{Size: 10, TTL: time.Minute}),
+	}
+	ctx := WithRequestCache(context.Background())
+	if _, err := repo.Save(ctx, &record{ID: "a", Value: "committed"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Get(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	failure := errors.New("failure")
+	err = transact(ctx, begin, func(ctx context.Context) error {
+		if _, err := repo.Save(ctx, &record{ID: "a", Value: "uncommitted"}); err != nil {
+			return err
+		}
+		got, err := repo.Get(ctx, "a")
+		if err != nil {
+			return err
+		}
+		assert.Equal(t, "uncommitted", got.Value)
+		return failure
+	})
+	assert.True(t, errors.Is(err, failure))
+	got, err := repo.Get(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "committed", got.Value, "the uncommitted record wasn't cached")
+
+	err = transact(ctx, begin, func(ctx context.Context) error {
+		if _, err := repo.Save(ctx, &record{ID: "a", Value: "updated"}); err != nil {
+			return err
+		}
+		// a concurrent request caches the former record meanwhile
+		repo.lru.set(repo.cacheKey(ctx, "a"), &record{ID: "a", Value: "committed"}, 0)
+		return transact(ctx, begin, func(ctx context.Context) error {
+			got, err := repo.Get(ctx, "a")
+			if err != nil {
+				return err
+			}
+			assert.Equal(t, "updated", got.Value, "the nested transaction joins the outer one")
+			return nil
+		})
+	})
+	assert.NoError(t, err)
+	got, err = repo.Get(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "updated", got.Value, "invalidated after the commit")
+}
+
+func TestOnCommit(t *testing.T) {
+	begin := func(ctx context.Context, fn func(ctx context.Context) error) error {
+		return fn(ctx)
+	}
+	var calls []string
+	OnCommit(context.Background(), func(ctx context.Context) { calls = append(calls, "outside") })
+	assert.Equal(t, []string{"outside"}, calls)
+
+	failure := errors.New("failure")
+	_ = transact(context.Background(), begin, func(ctx context.Context) error {
+		OnCommit(ctx, func(ctx context.Context) { calls = append(calls, "rolled back") })
+		return failure
+	})
+	_ = transact(context.Background(), begin, func(ctx context.Context) error {
+		OnCommit(ctx, func(ctx context.Context) {
+			assert.False(t, inTransaction(ctx), "detached from the committed transaction")
+			calls = append(calls, "committed")
+		})
+		assert.Equal(t, []string{"outside"}, calls, "deferred to the commit")
+		return nil
+	})
+	assert.Equal(t, []string{"outside", "committed"}, calls)
+}
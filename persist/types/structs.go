@@ -1,9 +1,29 @@
 package types
 
+import (
+	"errors"
+	"time"
+)
+
+var ErrNotFound = errors.New("record not found")
+
 type Storable interface {
 	Name() string
 	Key() string
 	SetKey(id string)
 }
 
+// Tombstoned types are soft deleted: Delete marks the record with the time
+// of the deletion and the marked records are hidden from the reads
+type Tombstoned interface {
+	DeletionTime() *time.Time
+	SetDeletionTime(t *time.Time)
+}
+
 type Filter[Type Storable] func(t Type) bool
+
+// Secrets types name the JSON fields holding their secrets, the change log
+// and the audit log store those fields redacted
+type Secrets interface {
+	SecretFields() []string
+}
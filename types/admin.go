@@ -0,0 +1,14 @@
+package types
+
+import "time"
+
+type BackupWrapper struct {
+	Backup Backup `json:"backup"`
+}
+
+type Backup struct {
+	File      string    `json:"file"`
+	Size      int64     `json:"size"`
+	Version   uint64    `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+}
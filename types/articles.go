@@ -3,6 +3,20 @@ package types
 import (
 	"strconv"
 	"time"
+
+	"github.com/borosr/realworld/lib/tag"
+	"github.com/borosr/realworld/persist/migration"
+)
+
+// The publication statuses of the articles. The drafts and the scheduled
+// articles are visible to their author only, the archived ones can be read
+// by their slug but they aren't listed. The PublishAt of an article is the
+// time it is scheduled to, or the time it was published at.
+const (
+	ArticleDraft     = "draft"
+	ArticleScheduled = "scheduled"
+	ArticlePublished = "published"
+	ArticleArchived  = "archived"
 )
 
 type ArticleListResponseWrapper struct {
@@ -15,16 +29,77 @@ type ArticleWrapper[SpecificArticle Article | ArticleRequest] struct {
 }
 
 type Article struct {
-	Slug           string    `json:"slug"`
-	Title          string    `json:"title"`
-	Description    string    `json:"description"`
-	Body           string    `json:"body"`
-	TagList        []string  `json:"tagList"`
-	CreatedAt      time.Time `json:"createdAt"`
-	UpdatedAt      time.Time `json:"updatedAt"`
-	Favorited      bool      `json:"favorited"`
-	FavoritesCount int       `json:"favoritesCount"`
-	Author         Profile   `json:"author"`
+	// ID is the permanent key of the article, the first slug it had. The
+	// articles stored before the slugs could change have no ID, their key is
+	// the slug.
+	ID             string     `json:"id,omitempty"`
+	Slug           string     `json:"slug"`
+	Title          string     `json:"title"`
+	Description    string     `json:"description"`
+	Body           string     `json:"body"`
+	TagList        []string   `json:"tagList"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
+	Favorited      bool       `json:"favorited"`
+	FavoritesCount int        `json:"favoritesCount"`
+	Author         Profile    `json:"author"`
+	Status         string     `json:"status"`
+	PublishAt      *time.Time `json:"publishAt,omitempty"`
+	DeletedAt      *time.Time `json:"deletedAt,omitempty"`
+	// Revision is the number of the latest revision of the article, zero for
+	// the articles not changed since the revisions are stored
+	Revision int `json:"revision,omitempty"`
+	// BodyHTML is the sanitized HTML of the Markdown body, it is rendered on
+	// request only
+	BodyHTML string `json:"bodyHtml,omitempty"`
+}
+
+// SchemaVersion 1 added the Status and the PublishAt of the articles, 2
+// normalized their tags
+func (a *Article) SchemaVersion() int {
+	return 2
+}
+
+func init() {
+	migration.Register(migration.Migration{
+		Type:    "article",
+		Version: 1,
+		Name:    "publish-existing",
+		Up: func(doc map[string]any) error {
+			doc["status"] = ArticlePublished
+			doc["publishAt"] = doc["createdAt"]
+			return nil
+		},
+	})
+	migration.Register(migration.Migration{
+		Type:    "article",
+		Version: 2,
+		Name:    "normalize-tags",
+		Up: func(doc map[string]any) error {
+			list, ok := doc["tagList"].([]any)
+			if !ok {
+				return nil
+			}
+			var tags = make([]string, 0, len(list))
+			for _, t := range list {
+				if s, ok := t.(string); ok {
+					tags = append(tags, s)
+				}
+			}
+			doc["tagList"] = tag.List(tags)
+			return nil
+		},
+	})
+	// the document doesn't change, the migrate command moves the favorites
+	// to their new keys
+	migration.Register(migration.Migration{
+		Type:    "favorite",
+		Version: 1,
+		Name:    "separate-key",
+		Up: func(doc map[string]any) error {
+			return nil
+		},
+	})
 }
 
 func (a *Article) Name() string {
@@ -32,24 +107,98 @@ func (a *Article) Name() string {
 }
 
 func (a *Article) Key() string {
+	if a.ID != "" {
+		return a.ID
+	}
 	return a.Slug
 }
 
 func (a *Article) SetKey(id string) {
-	a.Slug = id
+	a.ID = id
+	if a.Slug == "" {
+		a.Slug = id
+	}
 }
 
+// Public reports whether anyone can read the article, the articles without a
+// status are published
+func (a *Article) Public() bool {
+	return a.Listed() || a.Status == ArticleArchived
+}
+
+// Listed reports whether the article is shown in the lists, the feeds and the
+// search results
+func (a *Article) Listed() bool {
+	return a.Status == ArticlePublished || a.Status == ""
+}
+
+// PublishedAt is the time the article has been published at, the creation
+// time of the articles without one
+func (a *Article) PublishedAt() time.Time {
+	if a.PublishAt != nil {
+		return *a.PublishAt
+	}
+	return a.CreatedAt
+}
+
+func (a *Article) DeletionTime() *time.Time {
+	return a.DeletedAt
+}
+
+func (a *Article) SetDeletionTime(t *time.Time) {
+	a.DeletedAt = t
+}
+
+// SlugAlias maps a slug to the key of the article, the former slugs of an
+// article are redirected to the current one
+type SlugAlias struct {
+	Slug      string `json:"slug"`
+	ArticleID string `json:"articleId"`
+}
+
+func (s *SlugAlias) Name() string {
+	return "slug"
+}
+
+func (s *SlugAlias) Key() string {
+	return s.Slug
+}
+
+func (s *SlugAlias) SetKey(id string) {
+	s.Slug = id
+}
+
+// Favorite and Comment refer to the article by its key
 type Favorite struct {
 	Slug     string `json:"slug"`
 	Username string `json:"username"`
+	// DeletedAt is set on the favorites of a deleted article, they are
+	// restored with the article
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
 }
 
 func (f *Favorite) Name() string {
 	return "favorite"
 }
 
+// Key separates the article key from the username with a slash, the article
+// keys never contain one
 func (f *Favorite) Key() string {
-	return f.Slug + "-" + f.Username
+	return f.Slug + "/" + f.Username
+}
+
+// SchemaVersion 1 changed the separator of the key from a dash, which
+// appears in the slugs and the usernames as well
+func (f *Favorite) SchemaVersion() int {
+	return 1
+}
+
+func (f *Favorite) DeletionTime() *time.Time {
+	return f.DeletedAt
+}
+
+func (f *Favorite) SetDeletionTime(t *time.Time) {
+	f.DeletedAt = t
 }
 
 func (f *Favorite) SetKey(id string) {
@@ -61,6 +210,10 @@ type ArticleRequest struct {
 	Description string   `json:"description"`
 	Body        string   `json:"body"`
 	TagList     []string `json:"tagList"`
+	// Status is published by default, or scheduled when PublishAt is in the
+	// future
+	Status    string     `json:"status"`
+	PublishAt *time.Time `json:"publishAt"`
 }
 
 type CommentWrapper[SpecificComment CommonComment | CommentRequest] struct {
@@ -69,10 +222,14 @@ type CommentWrapper[SpecificComment CommonComment | CommentRequest] struct {
 
 type CommentListResponseWrapper struct {
 	Comments []CommonComment `json:"comments"`
+	// NextCursor continues a paginated list, it is empty on the last page
+	NextCursor string `json:"nextCursor,omitempty"`
 }
 
 type CommentRequest struct {
 	Body string `json:"body"`
+	// ParentID is the comment replied to, the comments start from 0
+	ParentID *int `json:"parentId"`
 }
 
 type CommonComment struct {
@@ -81,11 +238,35 @@ type CommonComment struct {
 	UpdatedAt time.Time `json:"updatedAt"`
 	Body      string    `json:"body"`
 	Author    Profile   `json:"author"`
+	ParentID  *int      `json:"parentId,omitempty"`
+	// Deleted marks the placeholder of a deleted comment with replies in the
+	// listed threads, it has no body and no author. It isn't stored.
+	Deleted bool `json:"deleted,omitempty"`
 }
 
 type Comment struct {
 	CommonComment
-	Slug string `json:"slug"`
+	Slug      string     `json:"slug"`
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+	// Depth is the number of the comments above the comment in its thread
+	Depth int `json:"depth,omitempty"`
+	// History holds the former bodies of an edited comment, the first is the
+	// original one
+	History []CommentEdit `json:"history,omitempty"`
+}
+
+// CommentEdit is a former body of a comment with the time it was written
+type CommentEdit struct {
+	Body      string    `json:"body"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type CommentHistoryResponseWrapper struct {
+	History []CommentEdit `json:"history"`
+}
+
+type TrashedCommentListResponseWrapper struct {
+	Comments []Comment `json:"comments"`
 }
 
 func (c *Comment) Name() string {
@@ -99,3 +280,35 @@ func (c *Comment) Key() string {
 func (c *Comment) SetKey(_ string) {
 	// DO NOTHING
 }
+
+func (c *Comment) DeletionTime() *time.Time {
+	return c.DeletedAt
+}
+
+func (c *Comment) SetDeletionTime(t *time.Time) {
+	c.DeletedAt = t
+}
+
+// Schedule lists the scheduled articles of a tenant by their publishAt, the
+// earliest first, so the due articles are found without a scan
+type Schedule struct {
+	ID    string          `json:"id"`
+	Items []ScheduledItem `json:"items"`
+}
+
+type ScheduledItem struct {
+	Article   string    `json:"article"`
+	PublishAt time.Time `json:"publishAt"`
+}
+
+func (s *Schedule) Name() string {
+	return "schedule"
+}
+
+func (s *Schedule) Key() string {
+	return s.ID
+}
+
+func (s *Schedule) SetKey(id string) {
+	s.ID = id
+}
@@ -0,0 +1,49 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// AuditEntry records a mutation of a stored record, the entries are never
+// updated
+type AuditEntry struct {
+	ID        uint64        `json:"id"`
+	Actor     string        `json:"actor,omitempty"`
+	Action    string        `json:"action"`
+	Type      string        `json:"type"`
+	RecordKey string        `json:"key"`
+	RequestID string        `json:"requestId,omitempty"`
+	Changes   []FieldChange `json:"changes,omitempty"`
+	// Records is the number of the records of the bulk actions, like the
+	// imports
+	Records   uint64    `json:"records,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// FieldChange is the value of a top level field before and after the
+// mutation, Before is empty on create and After is empty on delete
+type FieldChange struct {
+	Field  string          `json:"field"`
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+func (a *AuditEntry) Name() string {
+	return "audit"
+}
+
+// Key is zero padded, so the entries are iterated in the order they were
+// recorded
+func (a *AuditEntry) Key() string {
+	return fmt.Sprintf("%020d", a.ID)
+}
+
+func (a *AuditEntry) SetKey(_ string) {
+	// DO NOTHING
+}
+
+type AuditListResponse struct {
+	Entries []*AuditEntry `json:"entries"`
+}
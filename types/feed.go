@@ -0,0 +1,51 @@
+package types
+
+import "time"
+
+// Feed is the list of the articles published by the profiles the user
+// follows, newest first. It is updated when the followed authors publish and
+// when the user follows or unfollows someone. A Stale feed missed an update,
+// it is rebuilt on its next read.
+type Feed struct {
+	Username string     `json:"username"`
+	Items    []FeedItem `json:"items"`
+	Stale    bool       `json:"stale,omitempty"`
+}
+
+type FeedItem struct {
+	// ArticleID is the key of the article
+	ArticleID string    `json:"articleId"`
+	Author    string    `json:"author"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (f *Feed) Name() string {
+	return "feed"
+}
+
+func (f *Feed) Key() string {
+	return f.Username
+}
+
+func (f *Feed) SetKey(id string) {
+	f.Username = id
+}
+
+// Timeline is the list of the latest articles published by an author, newest
+// first, the feeds are built from the timelines of the followed authors
+type Timeline struct {
+	Author string     `json:"author"`
+	Items  []FeedItem `json:"items"`
+}
+
+func (t *Timeline) Name() string {
+	return "timeline"
+}
+
+func (t *Timeline) Key() string {
+	return t.Author
+}
+
+func (t *Timeline) SetKey(id string) {
+	t.Author = id
+}
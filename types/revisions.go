@@ -0,0 +1,52 @@
+package types
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/borosr/realworld/lib/diff"
+)
+
+// Revision is an immutable snapshot of an article, stored on every change of
+// its content. Author is the user who made the change.
+type Revision struct {
+	ArticleID   string    `json:"articleId"`
+	Number      int       `json:"number"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Body        string    `json:"body"`
+	TagList     []string  `json:"tagList"`
+	Author      Profile   `json:"author"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+func (r *Revision) Name() string {
+	return "revision"
+}
+
+func (r *Revision) Key() string {
+	return r.ArticleID + "-" + strconv.Itoa(r.Number)
+}
+
+func (r *Revision) SetKey(_ string) {
+	// DO NOTHING
+}
+
+type RevisionWrapper struct {
+	Revision Revision `json:"revision"`
+}
+
+type RevisionListResponseWrapper struct {
+	Revisions []*Revision `json:"revisions"`
+}
+
+// RevisionDiff is the line level diff of the bodies of two revisions
+type RevisionDiff struct {
+	From  int         `json:"from"`
+	To    int         `json:"to"`
+	Lines []diff.Edit `json:"lines"`
+}
+
+type RevisionDiffWrapper struct {
+	Diff RevisionDiff `json:"diff"`
+}
@@ -0,0 +1,16 @@
+package types
+
+// SearchResult is a matching article with its relevance and a highlighted
+// part of its text
+type SearchResult struct {
+	*Article
+	Score   float64 `json:"score"`
+	Snippet string  `json:"snippet"`
+}
+
+// SearchResponseWrapper has the shape of the ArticleListResponseWrapper, the
+// articles have a score and a snippet too
+type SearchResponseWrapper struct {
+	Articles      []SearchResult `json:"articles"`
+	ArticlesCount int            `json:"articlesCount"`
+}
@@ -1,5 +1,127 @@
 package types
 
+import (
+	"context"
+	"time"
+
+	"github.com/borosr/realworld/lib/api"
+	"github.com/borosr/realworld/lib/broken"
+)
+
+// TagsWrapper lists the tags in the requested order, TagCounts has the same
+// order with the number of the published articles of every tag
 type TagsWrapper struct {
-	Tags []string `json:"tags"`
+	Tags      []string   `json:"tags"`
+	TagCounts []TagCount `json:"tagCounts"`
+}
+
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+	// Recent is the number of the articles published within the trending
+	// window, it is set for the trending tags only
+	Recent int `json:"recent,omitempty"`
+}
+
+// TagIndex marks the tag counts of a tenant as built, the counts are kept by
+// tag in TagStats
+type TagIndex struct {
+	ID string `json:"id"`
+	// Built is false until the counts are built from the articles, the
+	// changes of the articles write the index until then
+	Built bool `json:"built"`
+}
+
+func (t *TagIndex) Name() string {
+	return "tag_index"
+}
+
+func (t *TagIndex) Key() string {
+	return t.ID
+}
+
+func (t *TagIndex) SetKey(id string) {
+	t.ID = id
+}
+
+// TagStats counts the published articles of a tag, it is updated with the
+// changes of the articles
+type TagStats struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+	// Daily counts the articles by the day they were published on, the days
+	// older than the longest trending window are dropped
+	Daily map[string]int `json:"daily,omitempty"`
+}
+
+func (t *TagStats) Name() string {
+	return "tag_stats"
+}
+
+func (t *TagStats) Key() string {
+	return t.Tag
+}
+
+func (t *TagStats) SetKey(tag string) {
+	t.Tag = tag
+}
+
+// TagAlias redirects a tag to another one, the aliased tags of the articles
+// are replaced when they are saved
+type TagAlias struct {
+	Alias     string    `json:"alias"`
+	Tag       string    `json:"tag"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (t *TagAlias) Name() string {
+	return "tag_alias"
+}
+
+func (t *TagAlias) Key() string {
+	return t.Alias
+}
+
+func (t *TagAlias) SetKey(id string) {
+	t.Alias = id
+}
+
+type TagMergeRequest struct {
+	From []string `json:"from"`
+	Into string   `json:"into"`
+	// Alias keeps redirecting the merged tags, so the articles saved later
+	// with them get the tag merged into
+	Alias bool `json:"alias"`
+}
+
+func (t TagMergeRequest) Validate(_ context.Context) error {
+	if len(t.From) == 0 {
+		return broken.Validation("missing from field")
+	}
+	if t.Into == "" {
+		return broken.Validation("missing into field")
+	}
+	return nil
+}
+
+type TagMergeWrapper[Specific TagMergeRequest | TagMerge] struct {
+	Merge Specific `json:"merge"`
+}
+
+func (t TagMergeWrapper[Specific]) Validate(ctx context.Context) error {
+	if v, ok := (interface{})(t.Merge).(api.Validator); ok {
+		return v.Validate(ctx)
+	}
+	return nil
+}
+
+// TagMerge is the result of a merge, the number of the rewritten articles
+type TagMerge struct {
+	Into     string   `json:"into"`
+	From     []string `json:"from"`
+	Articles int      `json:"articles"`
+}
+
+type TagAliasesWrapper struct {
+	Aliases []*TagAlias `json:"aliases"`
 }
@@ -91,6 +91,10 @@ func (u *User) SetKey(id string) {
 	u.Email = id
 }
 
+func (u *User) SecretFields() []string {
+	return []string{"password", "token"}
+}
+
 type ProfileWrapper struct {
 	Profile Profile `json:"profile"`
 }
@@ -118,3 +122,23 @@ func (f *Follow) Key() string {
 func (f *Follow) SetKey(id string) {
 	// DO NOTHING
 }
+
+// FollowIndex lists the follows of a user in both directions, sorted by the
+// usernames, so the followers of an author are read without a scan
+type FollowIndex struct {
+	Username  string   `json:"username"`
+	Followers []string `json:"followers"`
+	Following []string `json:"following"`
+}
+
+func (f *FollowIndex) Name() string {
+	return "follow_index"
+}
+
+func (f *FollowIndex) Key() string {
+	return f.Username
+}
+
+func (f *FollowIndex) SetKey(id string) {
+	f.Username = id
+}